@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
@@ -11,22 +12,30 @@ import (
 	"wsgw/internal/config"
 	"wsgw/pkgs/logging"
 	"wsgw/pkgs/monitoring"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/pflag"
 )
 
 func main() {
-	ctx, cancelRequests := signal.NotifyContext(
+	signals, stopSignals := signal.NotifyContext(
 		context.Background(),
 		os.Interrupt,
-		syscall.SIGHUP,
-		syscall.SIGHUP,
 		syscall.SIGINT,
 		syscall.SIGTERM,
 		syscall.SIGQUIT,
 	)
-	defer cancelRequests()
+	defer stopSignals()
 
 	logger := logging.Get().With().Logger()
-	ctx = logger.WithContext(ctx)
+	// The requests are cancelled on shutdown, once the instance has drained
+	ctx, cancelRequests := context.WithCancel(logger.WithContext(context.Background()))
+	defer cancelRequests()
+
+	// wsgw config check [flags]
+	if len(os.Args) > 2 && os.Args[1] == "config" && os.Args[2] == "check" {
+		os.Exit(checkConfig(append([]string{os.Args[0]}, os.Args[3:]...)))
+	}
 
 	var serverWanted bool = true
 
@@ -38,13 +47,48 @@ func main() {
 	}
 
 	if serverWanted {
-		conf := config.GetConfig(os.Args)
+		if xconnectErr := wsgw.EnableExtendedConnect(); xconnectErr != nil {
+			logger.Warn().Err(xconnectErr).Msg("the clients will open their WebSockets over HTTP/1.1")
+		}
+
+		// SIGHUP reloads the settings which can change without dropping the connections
+		reloadRequests := make(chan os.Signal, 1)
+		signal.Notify(reloadRequests, syscall.SIGHUP)
 
+		conf, configErr := config.GetConfig(os.Args)
+		if errors.Is(configErr, pflag.ErrHelp) {
+			return
+		}
+		if configErr != nil {
+			fmt.Fprintln(os.Stderr, configErr)
+			os.Exit(1)
+		}
+		setLogLevel(logger, conf)
+
+		otlpHeaders, headersErr := config.ParseOtlpHeaders(conf.OtlpHeaders)
+		if headersErr != nil {
+			fmt.Fprintln(os.Stderr, headersErr)
+			os.Exit(1)
+		}
 		shutdownOtel := monitoring.InitOtel(ctx, monitoring.OtelConfig{
 			OtlpEndpoint:         conf.OtlpEndpoint,
+			OtlpProtocol:         conf.OtlpProtocol,
+			OtlpHeaders:          otlpHeaders,
+			OtlpCAFile:           conf.OtlpCAFile,
+			OtlpClientCertFile:   conf.OtlpClientCertFile,
+			OtlpClientKeyFile:    conf.OtlpClientKeyFile,
 			OtlpServiceNamespace: conf.OtlpServiceNamespace,
 			OtlpServiceName:      conf.OtlpServiceName,
 			OtlpTraceSampleAll:   conf.OtlpTraceSampleAll,
+			TraceSampler:         conf.OtlpTraceSampler,
+			TraceSamplerRatio:    conf.OtlpTraceSamplerRatio,
+			TraceBatcher: monitoring.TraceBatcherConfig{
+				MaxQueueSize:       conf.OtlpTraceQueueSize,
+				MaxExportBatchSize: conf.OtlpTraceBatchSize,
+				BatchTimeout:       conf.OtlpTraceBatchTimeout,
+			},
+			Propagators:       conf.TracePropagators,
+			PrometheusEnabled: conf.MetricsEnabled,
 		}, config.OtelScope)
 		defer shutdownOtel(context.Background())
 
@@ -69,11 +113,29 @@ func main() {
 			srvErrChan <- errAppStart
 		}()
 
-		<-ctx.Done()
-		logger.Info().Msg("server context canceled")
+	waitForShutdown:
+		for {
+			select {
+			case <-signals.Done():
+				break waitForShutdown
+			case <-reloadRequests:
+				reloadConfig(ctx, app)
+			case srvErr := <-srvErrChan:
+				// The server failed to set up, or its listeners failed: exiting lets the orchestrator know
+				logger.Error().Err(srvErr).Msg("server exited unexpectedly")
+				shutdownOtel(context.Background())
+				os.Exit(1)
+			}
+		}
+		logger.Info().Msg("shutdown requested")
+		// The readiness probe fails while draining, for the load balancers to stop sending new clients
+		app.Drain(ctx)
 
-		shutdownErr := shutdownServer()
-		logger.Info().Msgf("server shut down with %v\n", shutdownErr)
+		// The server isn't ready yet if the shutdown is requested during its setup
+		if shutdownServer != nil {
+			shutdownErr := shutdownServer()
+			logger.Info().Msgf("server shut down with %v\n", shutdownErr)
+		}
 
 		select {
 		case srvErr := <-srvErrChan:
@@ -85,3 +147,43 @@ func main() {
 		logger.Info().Msg("Exiting...")
 	}
 }
+
+// checkConfig validates the configuration and returns the exit code of `wsgw config check`
+func checkConfig(args []string) int {
+	_, configErr := config.GetConfig(args)
+	if errors.Is(configErr, pflag.ErrHelp) {
+		return 0
+	}
+	if configErr != nil {
+		fmt.Fprintln(os.Stderr, configErr)
+		return 1
+	}
+	fmt.Println("configuration is valid")
+	return 0
+}
+
+// reloadConfig loads the configuration again and applies the settings which can change at runtime.
+// An invalid configuration is logged and ignored.
+func reloadConfig(ctx context.Context, app *wsgw.Server) {
+	logger := zerolog.Ctx(ctx).With().Logger()
+	logger.Info().Msg("reloading the configuration...")
+	conf, configErr := config.GetConfig(os.Args)
+	if configErr != nil {
+		logger.Error().Err(configErr).Msg("the configuration is invalid, keeping the current one")
+		return
+	}
+	if reloadErr := app.Reload(ctx, conf); reloadErr != nil {
+		logger.Error().Err(reloadErr).Msg("failed to reload the configuration, keeping the current one")
+		return
+	}
+	setLogLevel(logger, conf)
+}
+
+func setLogLevel(logger zerolog.Logger, conf config.Config) {
+	if len(conf.LogLevel) == 0 {
+		return
+	}
+	if levelErr := logging.SetLevel(conf.LogLevel); levelErr != nil {
+		logger.Error().Err(levelErr).Msg("failed to set the log level")
+	}
+}
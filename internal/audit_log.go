@@ -0,0 +1,191 @@
+package wsgw
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"wsgw/internal/config"
+
+	"github.com/rs/zerolog"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// The events of the audit log
+const (
+	auditEventConnect    = "connect"
+	auditEventDisconnect = "disconnect"
+	auditEventAdmin      = "admin"
+)
+
+// The reasons the connections are rejected for
+const (
+	rejectProfileNotFound = "profile_not_found"
+	rejectConnectionLimit = "connection_limit"
+	rejectBackendOverload = "backend_overloaded"
+	rejectUnauthenticated = "unauthenticated"
+	rejectBackendRejected = "backend_rejected"
+	rejectInternalError   = "internal_error"
+)
+
+// The parties closing the connections
+const (
+	initiatorClient  = "client"
+	initiatorBackend = "backend"
+	initiatorServer  = "server"
+	initiatorNetwork = "network"
+)
+
+// The transports of the connections
+const (
+	transportWebSocket    = "websocket"
+	transportSSE          = "sse"
+	transportLongPoll     = "long-poll"
+	transportWebTransport = "webtransport"
+)
+
+// auditEvent is a line of the audit log. The connect events tell whether the connection was accepted and,
+// if not, why; the disconnect events how the connection ended and the traffic it carried; the admin events
+// who changed what at runtime.
+type auditEvent struct {
+	Time            time.Time    `json:"time"`
+	Event           string       `json:"event"`
+	Host            string       `json:"host"`
+	ConnectionID    ConnectionID `json:"connectionId,omitempty"`
+	GatewayEndpoint string       `json:"gatewayEndpoint,omitempty"`
+	Transport       string       `json:"transport,omitempty"`
+	RemoteAddress   string       `json:"remoteAddress,omitempty"`
+	// Outcome is accepted or rejected for the connect events
+	Outcome string `json:"outcome,omitempty"`
+	// Reason is the reason of a rejection
+	Reason string `json:"reason,omitempty"`
+	Status int    `json:"status,omitempty"`
+	// CloseCode and CloseReason are those of the WebSocket close frame ending the connection, if any
+	CloseCode   int    `json:"closeCode,omitempty"`
+	CloseReason string `json:"closeReason,omitempty"`
+	Initiator   string `json:"initiator,omitempty"`
+	// DurationMs is how long the connection lasted
+	DurationMs int64         `json:"durationMs,omitempty"`
+	Traffic    *auditTraffic `json:"traffic,omitempty"`
+	// Action and Details are those of the admin events
+	Action  string            `json:"action,omitempty"`
+	Details map[string]string `json:"details,omitempty"`
+}
+
+type auditTraffic struct {
+	MessagesFromClient int64 `json:"messagesFromClient"`
+	BytesFromClient    int64 `json:"bytesFromClient"`
+	MessagesToClient   int64 `json:"messagesToClient"`
+	BytesToClient      int64 `json:"bytesToClient"`
+}
+
+// auditLog writes the audit events as NDJSON to stdout or to a file rotated by size. A nil auditLog
+// drops the events, so that the audit log costs nothing unless it is enabled.
+type auditLog struct {
+	mux     sync.Mutex
+	encoder *json.Encoder
+	closer  io.Closer
+	host    string
+}
+
+// newAuditLog opens the sink of the audit log; nil if it isn't configured
+func newAuditLog(conf config.AuditLogConfig) *auditLog {
+	if len(conf.Sink) == 0 {
+		return nil
+	}
+	host, _ := os.Hostname()
+	if conf.Sink == "stdout" {
+		return &auditLog{encoder: json.NewEncoder(os.Stdout), host: host}
+	}
+	// The file is opened on the first write
+	file := &lumberjack.Logger{Filename: conf.Sink, MaxSize: conf.MaxSize, MaxBackups: conf.MaxBackups}
+	return &auditLog{encoder: json.NewEncoder(file), closer: file, host: host}
+}
+
+func (a *auditLog) record(ctx context.Context, event auditEvent) {
+	if a == nil {
+		return
+	}
+	event.Time = time.Now().UTC()
+	event.Host = a.host
+
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	if encodeErr := a.encoder.Encode(event); encodeErr != nil {
+		zerolog.Ctx(ctx).Error().Err(encodeErr).Str("event", event.Event).Msg("failed to write audit event")
+	}
+}
+
+// connectRejected records the rejection of a connect attempt
+func (a *auditLog) connectRejected(ctx context.Context, endpoint string, transport string, remoteAddress string, reason string, status int) {
+	a.record(ctx, auditEvent{
+		Event:           auditEventConnect,
+		GatewayEndpoint: endpoint,
+		Transport:       transport,
+		RemoteAddress:   remoteAddress,
+		Outcome:         "rejected",
+		Reason:          reason,
+		Status:          status,
+	})
+}
+
+// connectAccepted records the acceptance of a connection by the backend
+func (a *auditLog) connectAccepted(ctx context.Context, endpoint string, appConn *appConnection) {
+	a.record(ctx, auditEvent{
+		Event:           auditEventConnect,
+		ConnectionID:    appConn.id,
+		GatewayEndpoint: endpoint,
+		Transport:       appConn.transport,
+		RemoteAddress:   appConn.remoteAddress,
+		Outcome:         "accepted",
+	})
+}
+
+// connectionEnd is how a connection ended
+type connectionEnd struct {
+	closeCode   int
+	closeReason string
+	initiator   string
+}
+
+// disconnect records the end of a connection
+func (a *auditLog) disconnect(ctx context.Context, endpoint string, conn *connection, appConn *appConnection, end connectionEnd) {
+	a.record(ctx, auditEvent{
+		Event:           auditEventDisconnect,
+		ConnectionID:    conn.id,
+		GatewayEndpoint: endpoint,
+		Transport:       appConn.transport,
+		RemoteAddress:   appConn.remoteAddress,
+		CloseCode:       end.closeCode,
+		CloseReason:     end.closeReason,
+		Initiator:       end.initiator,
+		DurationMs:      time.Since(conn.connectedAt).Milliseconds(),
+		Traffic: &auditTraffic{
+			MessagesFromClient: conn.throughput.messagesFromClient.Load(),
+			BytesFromClient:    conn.throughput.bytesFromClient.Load(),
+			MessagesToClient:   conn.throughput.messagesToClient.Load(),
+			BytesToClient:      conn.throughput.bytesToClient.Load(),
+		},
+	})
+}
+
+// admin records an action of the admin API, taken from the given remote address
+func (a *auditLog) admin(ctx context.Context, action string, remoteAddress string, details map[string]string) {
+	a.record(ctx, auditEvent{
+		Event:         auditEventAdmin,
+		RemoteAddress: remoteAddress,
+		Action:        action,
+		Details:       details,
+	})
+}
+
+func (a *auditLog) close() error {
+	if a == nil || a.closer == nil {
+		return nil
+	}
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return a.closer.Close()
+}
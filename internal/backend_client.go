@@ -0,0 +1,398 @@
+package wsgw
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"wsgw/internal/config"
+	loadmanagement "wsgw/pkgs/loadmanegement"
+	"wsgw/pkgs/monitoring"
+	"wsgw/pkgs/signing"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	defaultBackendTimeout     = 15 * time.Second
+	defaultBackendDialTimeout = 30 * time.Second
+	defaultBackendKeepAlive   = 30 * time.Second
+	defaultMaxIdleConns       = 100
+	defaultIdleConnTimeout    = 90 * time.Second
+)
+
+// backendClient sends the requests of wsgw to the backend
+type backendClient struct {
+	// profile is the name of the backend profile the client is for ("" for the default backend)
+	profile    string
+	httpClient *http.Client
+	// signer signs the requests sent to the backend, nil if signing isn't configured.
+	signer    *signing.Signer
+	endpoints backendEndpoints
+	upstreams *upstreamPool
+
+	// batcher is nil if the client messages aren't batched
+	batcher *messageBatcher
+
+	disconnectRetries retryPolicy
+	disconnectOutbox  *disconnectOutbox
+	disconnectMetrics disconnectNotificationMetrics
+
+	// breaker is nil if the circuit breaker isn't enabled
+	breaker  *loadmanagement.CircuitBreaker
+	shedding loadSheddingPolicy
+	metrics  backendMetrics
+}
+
+// loadSheddingPolicy tells what to do while the circuit of the backend is open
+type loadSheddingPolicy struct {
+	rejectConnects bool
+	notifyClients  bool
+}
+
+type backendMetrics struct {
+	circuitState metric.Int64Gauge
+	shed         metric.Int64Counter
+	duration     metric.Float64Histogram
+}
+
+// backendDurationBuckets are the bucket boundaries, in seconds, of the durations of the backend calls
+var backendDurationBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+func newBackendMetrics() backendMetrics {
+	return backendMetrics{
+		circuitState: monitoring.CreateGague(config.OtelScope, "wsgw.backend.circuit_state", "State of the circuit breaker of the backend calls: 0 closed, 1 half-open, 2 open", "{state}"),
+		shed:         monitoring.CreateCounter(config.OtelScope, "wsgw.backend.shed", "Backend calls not attempted because of the open circuit, by endpoint"),
+		duration: monitoring.CreateHistogram(config.OtelScope, "wsgw.backend.duration", "Duration of the backend calls, by endpoint and status", "s",
+			metric.WithExplicitBucketBoundaries(backendDurationBuckets...)),
+	}
+}
+
+// record records the duration of a backend call. The status is the class of the status code of the response,
+// such as 2xx, or error if there is no response.
+func (m backendMetrics) record(ctx context.Context, endpoint *backendEndpoint, profile string, start time.Time, response *http.Response) {
+	status := "error"
+	if response != nil {
+		status = fmt.Sprintf("%dxx", response.StatusCode/100)
+	}
+	m.duration.Record(ctx, time.Since(start).Seconds(), metric.WithAttributes(
+		attribute.String("endpoint", endpoint.name),
+		attribute.String("profile", profile),
+		attribute.String("status", status),
+	))
+}
+
+const (
+	defaultBreakerWindow               = 10 * time.Second
+	defaultBreakerMinRequests          = 20
+	defaultBreakerFailureRateThreshold = 0.5
+	defaultBreakerSlowCallDuration     = 5 * time.Second
+	defaultBreakerOpenDuration         = 15 * time.Second
+	defaultBreakerHalfOpenProbes       = 3
+)
+
+const (
+	defaultDisconnectRetryMaxAttempts    = 3
+	defaultDisconnectRetryInitialBackoff = 100 * time.Millisecond
+	defaultDisconnectRetryMaxBackoff     = 2 * time.Second
+)
+
+// newBackendHTTPClient creates the HTTP client the backend calls are made with, shared by all backend profiles
+func newBackendHTTPClient(configuration config.Config) (*http.Client, error) {
+	transport, transportErr := newBackendTransport(configuration)
+	if transportErr != nil {
+		return nil, transportErr
+	}
+	return &http.Client{Transport: transport}, nil
+}
+
+// newBackendClient creates the client of a backend profile, whose replicas are at baseUrls. The background
+// tasks of the client (health checks, flushing the disconnect outbox) run until ctx is done.
+func newBackendClient(ctx context.Context, profile string, baseUrls []string, configuration config.Config, httpClient *http.Client) (*backendClient, error) {
+	var signer *signing.Signer
+	if len(configuration.BackendSigningKeys) > 0 {
+		keys, parseErr := signing.ParseKeys(configuration.BackendSigningKeys)
+		if parseErr != nil {
+			return nil, fmt.Errorf("failed to parse backend signing keys: %w", parseErr)
+		}
+		signer = signing.NewSigner(keys[0])
+	}
+
+	defaultTimeout := orDefault(configuration.BackendTransport.Timeout, defaultBackendTimeout)
+	endpoints, endpointsErr := newBackendEndpoints(baseUrls, configuration.BackendEndpoints, defaultTimeout)
+	if endpointsErr != nil {
+		return nil, endpointsErr
+	}
+	upstreams, upstreamsErr := newUpstreamPool(baseUrls, configuration.Upstreams)
+	if upstreamsErr != nil {
+		return nil, upstreamsErr
+	}
+
+	notificationsConfig := configuration.Disconnects
+	if len(profile) > 0 && len(notificationsConfig.OutboxFile) > 0 {
+		notificationsConfig.OutboxFile = fmt.Sprintf("%s.%s", notificationsConfig.OutboxFile, profile)
+	}
+	client := &backendClient{
+		profile:    profile,
+		httpClient: httpClient,
+		signer:     signer,
+		endpoints:  endpoints,
+		upstreams:  upstreams,
+		disconnectRetries: retryPolicy{
+			maxAttempts:    orDefault(notificationsConfig.RetryMaxAttempts, defaultDisconnectRetryMaxAttempts),
+			initialBackoff: orDefault(notificationsConfig.RetryInitialBackoff, defaultDisconnectRetryInitialBackoff),
+			maxBackoff:     orDefault(notificationsConfig.RetryMaxBackoff, defaultDisconnectRetryMaxBackoff),
+		},
+		disconnectMetrics: newDisconnectNotificationMetrics(),
+		shedding: loadSheddingPolicy{
+			rejectConnects: configuration.BackendBreaker.RejectConnects,
+			notifyClients:  configuration.BackendBreaker.NotifyClients,
+		},
+		metrics: newBackendMetrics(),
+	}
+	go upstreams.runHealthChecks(ctx, client.httpClient)
+	if configuration.BackendBreaker.Enabled {
+		client.breaker = newBackendCircuitBreaker(ctx, profile, configuration.BackendBreaker, client.metrics)
+	}
+
+	if configuration.MessageBatch.MaxSize > 0 && !endpoints.message.disabled {
+		if strings.Contains(endpoints.message.urlTemplate, connectionIdPlaceholder) {
+			return nil, errors.New("the URL of the message callback cannot refer to the connection ID when the messages are batched")
+		}
+		batcher, batcherErr := newMessageBatcher(configuration.MessageBatch, client.sendMessageBatch)
+		if batcherErr != nil {
+			return nil, batcherErr
+		}
+		client.batcher = batcher
+		go batcher.run(ctx)
+	}
+
+	outbox, outboxErr := newDisconnectOutbox(notificationsConfig, client.sendDisconnected, client.disconnectMetrics)
+	if outboxErr != nil {
+		return nil, outboxErr
+	}
+	client.disconnectOutbox = outbox
+	if !endpoints.disconnected.disabled {
+		go outbox.run(ctx)
+	}
+
+	return client, nil
+}
+
+func orDefault[T comparable](value T, defaultValue T) T {
+	var zero T
+	if value == zero {
+		return defaultValue
+	}
+	return value
+}
+
+// newBackendTransport creates the transport for the backend calls:
+//   - HTTP/1.1 (plain or TLS) by default,
+//   - h2c with WSGW_HTTP2 and an `http://` backend,
+//   - h2 (negotiated via ALPN, falling back to HTTP/1.1) with WSGW_HTTP2 and an `https://` backend.
+//
+// The protocol is chosen by the scheme of the URL of each call, as the callbacks may be configured with
+// URLs of their own.
+func newBackendTransport(configuration config.Config) (http.RoundTripper, error) {
+	transportConfig := configuration.BackendTransport
+	tlsConfig, tlsErr := newBackendTLSConfig(transportConfig, configuration.TLSMinVersion)
+	if tlsErr != nil {
+		return nil, tlsErr
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   orDefault(transportConfig.DialTimeout, defaultBackendDialTimeout),
+		KeepAlive: defaultBackendKeepAlive,
+	}
+
+	transport := &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		TLSClientConfig:       tlsConfig,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ForceAttemptHTTP2:     configuration.Http2,
+		MaxIdleConns:          orDefault(transportConfig.MaxIdleConns, defaultMaxIdleConns),
+		MaxIdleConnsPerHost:   orDefault(transportConfig.MaxIdleConnsPerHost, defaultMaxIdleConns),
+		MaxConnsPerHost:       transportConfig.MaxConnsPerHost,
+		IdleConnTimeout:       orDefault(transportConfig.IdleConnTimeout, defaultIdleConnTimeout),
+		ExpectContinueTimeout: time.Second,
+	}
+	if !configuration.Http2 {
+		return transport, nil
+	}
+
+	// h2c is spoken with prior knowledge: a transport offering HTTP/1.1 as well would never use it
+	cleartext := transport.Clone()
+	cleartext.Protocols = &http.Protocols{}
+	cleartext.Protocols.SetUnencryptedHTTP2(true)
+	return &schemeTransport{cleartext: cleartext, tls: transport}, nil
+}
+
+// schemeTransport sends the `http://` calls and the `https://` ones through transports of their own
+type schemeTransport struct {
+	cleartext *http.Transport
+	tls       *http.Transport
+}
+
+func (t *schemeTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if request.URL.Scheme == "http" {
+		return t.cleartext.RoundTrip(request)
+	}
+	return t.tls.RoundTrip(request)
+}
+
+func (t *schemeTransport) CloseIdleConnections() {
+	t.cleartext.CloseIdleConnections()
+	t.tls.CloseIdleConnections()
+}
+
+// newBackendTLSConfig returns the TLS configuration of the backend calls, nil if no TLS
+// customization is configured (the system roots are used for `https://` backends then).
+func newBackendTLSConfig(transportConfig config.BackendTransportConfig, tlsMinVersion string) (*tls.Config, error) {
+	if len(transportConfig.CAFile) == 0 &&
+		len(transportConfig.ClientCertFile) == 0 &&
+		len(transportConfig.ClientKeyFile) == 0 &&
+		len(transportConfig.ServerName) == 0 {
+		return nil, nil
+	}
+
+	minVersion, versionErr := parseTLSVersion(tlsMinVersion)
+	if versionErr != nil {
+		return nil, versionErr
+	}
+
+	tlsConfig := &tls.Config{
+		MinVersion: minVersion,
+		ServerName: transportConfig.ServerName,
+	}
+
+	if len(transportConfig.CAFile) > 0 {
+		pool, poolErr := loadCertPool(transportConfig.CAFile)
+		if poolErr != nil {
+			return nil, poolErr
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if len(transportConfig.ClientCertFile) > 0 || len(transportConfig.ClientKeyFile) > 0 {
+		if len(transportConfig.ClientCertFile) == 0 || len(transportConfig.ClientKeyFile) == 0 {
+			return nil, errors.New("both the backend client certificate and the key file must be specified")
+		}
+		// Loaded on each handshake, so that rotated client certificates are picked up without a restart
+		certFile, keyFile := transportConfig.ClientCertFile, transportConfig.ClientKeyFile
+		if _, loadErr := tls.LoadX509KeyPair(certFile, keyFile); loadErr != nil {
+			return nil, fmt.Errorf("failed to load the backend client key pair: %w", loadErr)
+		}
+		tlsConfig.GetClientCertificate = func(_ *tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, loadErr := tls.LoadX509KeyPair(certFile, keyFile)
+			if loadErr != nil {
+				return nil, loadErr
+			}
+			return &cert, nil
+		}
+	}
+
+	return tlsConfig, nil
+}
+
+func newBackendCircuitBreaker(ctx context.Context, profile string, breakerConfig config.CircuitBreakerConfig, metrics backendMetrics) *loadmanagement.CircuitBreaker {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "backendCircuitBreaker").Str("profile", profile).Logger()
+	profileAttr := metric.WithAttributes(attribute.String("profile", profile))
+	metrics.circuitState.Record(ctx, int64(loadmanagement.CircuitClosed), profileAttr)
+	return loadmanagement.NewCircuitBreaker(
+		loadmanagement.CircuitBreakerConfig{
+			Window:                orDefault(breakerConfig.Window, defaultBreakerWindow),
+			MinRequests:           orDefault(breakerConfig.MinRequests, defaultBreakerMinRequests),
+			FailureRateThreshold:  orDefault(breakerConfig.FailureRateThreshold, defaultBreakerFailureRateThreshold),
+			SlowCallDuration:      orDefault(breakerConfig.SlowCallDuration, defaultBreakerSlowCallDuration),
+			SlowCallRateThreshold: breakerConfig.SlowCallRateThreshold,
+			OpenDuration:          orDefault(breakerConfig.OpenDuration, defaultBreakerOpenDuration),
+			HalfOpenProbes:        orDefault(breakerConfig.HalfOpenProbes, defaultBreakerHalfOpenProbes),
+		},
+		func(from loadmanagement.CircuitState, to loadmanagement.CircuitState) {
+			logger.Warn().Stringer("from", from).Stringer("to", to).Msg("backend circuit state changed")
+			metrics.circuitState.Record(context.Background(), int64(to), profileAttr)
+		},
+	)
+}
+
+// checkBaseUrls checks whether the callbacks can be made at the base URLs
+func (b *backendClient) checkBaseUrls(baseUrls []string) error {
+	for _, endpoint := range []*backendEndpoint{&b.endpoints.connecting, &b.endpoints.message, &b.endpoints.disconnected} {
+		if checkErr := endpoint.checkBaseUrls(baseUrls); checkErr != nil {
+			return checkErr
+		}
+	}
+	return nil
+}
+
+// setBaseUrls replaces the backend replicas; checkBaseUrls is to be called first
+func (b *backendClient) setBaseUrls(baseUrls []string) {
+	b.upstreams.setBaseUrls(baseUrls)
+}
+
+// resolve returns the URL of the endpoint for a call of the connection, picking the backend replica
+// to call if the URL is relative to the base URL. The returned function must be called when the call is done.
+func (b *backendClient) resolve(endpoint *backendEndpoint, connId ConnectionID) (string, func()) {
+	if !endpoint.usesBaseUrl {
+		return endpoint.url("", connId), func() {}
+	}
+	selected, release := b.upstreams.pick(connId)
+	return endpoint.url(selected.baseUrl, connId), release
+}
+
+// do sends the request to the endpoint through the circuit breaker, if one is enabled. While the circuit
+// is open, a loadmanagement.OverloadError is returned without the request being sent. 5xx responses count
+// as failures, while the requests cancelled by their callers, such as those of the clients disconnecting or
+// those cancelled on shutdown, aren't counted. The connect calls bypass the breaker if connects aren't to be
+// rejected while it is open.
+func (b *backendClient) do(endpoint *backendEndpoint, request *http.Request) (*http.Response, error) {
+	if b.breaker == nil || (endpoint == &b.endpoints.connecting && !b.shedding.rejectConnects) {
+		return b.send(endpoint, request)
+	}
+
+	done, allowErr := b.breaker.Allow()
+	if allowErr != nil {
+		b.metrics.shed.Add(request.Context(), 1, metric.WithAttributes(attribute.String("endpoint", endpoint.name), attribute.String("profile", b.profile)))
+		return nil, allowErr
+	}
+	response, requestErr := b.send(endpoint, request)
+	done(callOutcome(response, requestErr))
+	return response, requestErr
+}
+
+// callOutcome tells how a backend call counts for the circuit breaker
+func callOutcome(response *http.Response, requestErr error) loadmanagement.CallOutcome {
+	switch {
+	case errors.Is(requestErr, context.Canceled):
+		return loadmanagement.CallAbandoned
+	case requestErr != nil || response.StatusCode >= 500:
+		return loadmanagement.CallFailed
+	default:
+		return loadmanagement.CallSucceeded
+	}
+}
+
+// send sends the request, recording its duration up to the response headers
+func (b *backendClient) send(endpoint *backendEndpoint, request *http.Request) (*http.Response, error) {
+	start := time.Now()
+	response, requestErr := b.httpClient.Do(request)
+	b.metrics.record(request.Context(), endpoint, b.profile, start, response)
+	return response, requestErr
+}
+
+// sign signs the request if signing is configured; a no-op otherwise.
+// It must be called after the connection ID header has been set.
+func (b *backendClient) sign(request *http.Request, body []byte) {
+	if b.signer == nil {
+		return
+	}
+	b.signer.Sign(request, body)
+}
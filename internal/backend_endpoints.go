@@ -0,0 +1,110 @@
+package wsgw
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"wsgw/internal/config"
+)
+
+const (
+	baseUrlPlaceholder      = "{baseUrl}"
+	connectionIdPlaceholder = "{connectionId}"
+)
+
+// backendEndpoint is one of the backend callbacks
+type backendEndpoint struct {
+	name        string
+	urlTemplate string
+	// usesBaseUrl tells whether the URL is relative to the base URL of the backend, in which case the calls
+	// are balanced among the backend replicas
+	usesBaseUrl bool
+	method      string
+	timeout     time.Duration
+	disabled    bool
+}
+
+// url resolves the URL template of the endpoint for the backend replica and the connection
+func (e *backendEndpoint) url(baseUrl string, connId ConnectionID) string {
+	resolved := strings.ReplaceAll(e.urlTemplate, baseUrlPlaceholder, baseUrl)
+	return strings.ReplaceAll(resolved, connectionIdPlaceholder, url.PathEscape(string(connId)))
+}
+
+// backendEndpoints are the callbacks wsgw notifies the backend through
+type backendEndpoints struct {
+	connecting   backendEndpoint
+	message      backendEndpoint
+	disconnected backendEndpoint
+}
+
+func newBackendEndpoints(baseUrls []string, endpointsConfig config.BackendEndpointsConfig, defaultTimeout time.Duration) (backendEndpoints, error) {
+	connecting, connectingErr := newBackendEndpoint("connect", baseUrls, ConnectPath, http.MethodGet, endpointsConfig.Connect, defaultTimeout)
+	if connectingErr != nil {
+		return backendEndpoints{}, connectingErr
+	}
+	message, messageErr := newBackendEndpoint("message", baseUrls, MessagePath, http.MethodPost, endpointsConfig.Message, defaultTimeout)
+	if messageErr != nil {
+		return backendEndpoints{}, messageErr
+	}
+	disconnected, disconnectedErr := newBackendEndpoint("disconnected", baseUrls, DisonnectedPath, http.MethodPost, endpointsConfig.Disconnected, defaultTimeout)
+	if disconnectedErr != nil {
+		return backendEndpoints{}, disconnectedErr
+	}
+	return backendEndpoints{
+		connecting:   connecting,
+		message:      message,
+		disconnected: disconnected,
+	}, nil
+}
+
+func newBackendEndpoint(
+	name string,
+	baseUrls []string,
+	defaultPath EndpointPath,
+	defaultMethod string,
+	endpointConfig config.BackendEndpointConfig,
+	defaultTimeout time.Duration,
+) (backendEndpoint, error) {
+	endpoint := backendEndpoint{
+		name:     name,
+		method:   strings.ToUpper(orDefault(endpointConfig.Method, defaultMethod)),
+		timeout:  orDefault(endpointConfig.Timeout, defaultTimeout),
+		disabled: endpointConfig.Disabled,
+	}
+	if endpoint.disabled {
+		return endpoint, nil
+	}
+
+	endpoint.urlTemplate = orDefault(endpointConfig.URL, fmt.Sprintf("%s/ws%s", baseUrlPlaceholder, defaultPath))
+	endpoint.usesBaseUrl = strings.Contains(endpoint.urlTemplate, baseUrlPlaceholder)
+	if checkErr := endpoint.checkBaseUrls(baseUrls); checkErr != nil {
+		return backendEndpoint{}, checkErr
+	}
+
+	return endpoint, nil
+}
+
+// checkBaseUrls checks that the URL of the endpoint resolves to a valid URL for each of the base URLs
+func (e *backendEndpoint) checkBaseUrls(baseUrls []string) error {
+	if e.disabled {
+		return nil
+	}
+	if e.usesBaseUrl && len(baseUrls) == 0 {
+		return fmt.Errorf("the URL of the %s callback refers to the base URL, but no base URL is configured", e.name)
+	}
+
+	// Placeholder for URLs not using the base URL, so that the loop runs once
+	candidateBaseUrls := baseUrls
+	if !e.usesBaseUrl {
+		candidateBaseUrls = []string{""}
+	}
+	for _, baseUrl := range candidateBaseUrls {
+		parsed, parseErr := url.Parse(e.url(baseUrl, "connection-id"))
+		if parseErr != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+			return fmt.Errorf("invalid URL for the %s callback: %q (base URL: %q)", e.name, e.urlTemplate, baseUrl)
+		}
+	}
+	return nil
+}
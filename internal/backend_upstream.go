@@ -0,0 +1,90 @@
+package wsgw
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"wsgw/internal/config"
+
+	"github.com/rs/zerolog"
+)
+
+type upstreamMode string
+
+const (
+	// httpUpstreamMode calls the HTTP callbacks of the backend
+	httpUpstreamMode upstreamMode = "http"
+	// natsUpstreamMode publishes the events of the connections to NATS
+	natsUpstreamMode upstreamMode = "nats"
+	// grpcUpstreamMode streams the events of the connections to the backend over gRPC
+	grpcUpstreamMode upstreamMode = "grpc"
+)
+
+// backendUpstream carries the events of the client connections to the backend
+type backendUpstream interface {
+	// connecting asks the backend whether to accept the connection, and returns the attributes the backend
+	// describes the accepted connection with. The connection is rejected with errAppConnAuthn,
+	// errAppConnAccepting, errAppConnInternal or a loadmanagement.OverloadError.
+	connecting(ctx context.Context, r *http.Request, connId ConnectionID) (connectionAttributes, error)
+	// message relays a message of the client. The error, if any, is reported to the client.
+	message(ctx context.Context, connId ConnectionID, msg string) error
+	// disconnected notifies the backend that the connection is closed
+	disconnected(ctx context.Context, header http.Header, connId ConnectionID)
+}
+
+// pushSource is implemented by the upstreams which also carry the messages of the backend to the clients
+type pushSource interface {
+	// consumePushes relays the messages of the backend to the connections until ctx is done.
+	// Messages to connections not owned by the gateway endpoint are rejected.
+	consumePushes(ctx context.Context, ws *wsConnections, owns func(connId ConnectionID) bool) error
+}
+
+// newUpstreamFactory returns the function creating the upstream of a backend profile in the given mode
+func newUpstreamFactory(ctx context.Context, mode upstreamMode, configuration config.Config) (func(profile string, baseUrls []string) (backendUpstream, error), error) {
+	switch mode {
+	case httpUpstreamMode:
+		httpClient, httpClientErr := newBackendHTTPClient(configuration)
+		if httpClientErr != nil {
+			return nil, httpClientErr
+		}
+		return func(profile string, baseUrls []string) (backendUpstream, error) {
+			backend, backendErr := newBackendClient(ctx, profile, baseUrls, configuration, httpClient)
+			if backendErr != nil {
+				return nil, backendErr
+			}
+			return backend, nil
+		}, nil
+	case natsUpstreamMode:
+		conn, connectErr := connectNats(ctx, configuration.Nats)
+		if connectErr != nil {
+			return nil, connectErr
+		}
+		return func(profile string, _ []string) (backendUpstream, error) {
+			return newNatsUpstream(conn, configuration.Nats, profile), nil
+		}, nil
+	case grpcUpstreamMode:
+		stream, streamErr := newGrpcStream(ctx, configuration)
+		if streamErr != nil {
+			return nil, streamErr
+		}
+		return func(profile string, _ []string) (backendUpstream, error) {
+			return &grpcUpstream{stream: stream, profile: profile}, nil
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported backend upstream %q: expected %s, %s or %s", mode, httpUpstreamMode, natsUpstreamMode, grpcUpstreamMode)
+	}
+}
+
+// connectStatusError maps the HTTP status the backend accepted or rejected a connection with to the error of connecting
+func connectStatusError(logger zerolog.Logger, status int) error {
+	switch status {
+	case http.StatusOK:
+		return nil
+	case http.StatusUnauthorized:
+		logger.Info().Msg("Authentication failed")
+		return errAppConnAuthn
+	default:
+		logger.Info().Msgf("Received status code %d", status)
+		return errAppConnAccepting
+	}
+}
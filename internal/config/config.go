@@ -1,61 +1,607 @@
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"strings"
 	"sync"
+	"time"
 
-	"github.com/knadh/koanf/providers/env/v2"
 	"github.com/knadh/koanf/v2"
 )
 
 type Config struct {
-	ServerHost           string
-	ServerPort           int
+	ServerHost string
+	ServerPort int
+	// TLS on the client listener; disabled unless the certificate and the key files are set
+	TLSCertFile       string
+	TLSKeyFile        string
+	TLSMinVersion     string
+	TLSCipherPolicy   string
+	TLSReloadInterval time.Duration
+	// ClientHttp2 serves the clients over HTTP/2 as well, WebSockets included (RFC 8441 extended CONNECT)
+	ClientHttp2 bool
+	// WebTransportPort, if set, serves the experimental WebTransport (HTTP/3) transport on this UDP port; requires TLS
+	WebTransportPort int
+	// AdminServerPort, if set, moves the backend-facing push endpoint to a listener of its own
+	AdminServerHost      string
+	AdminServerPort      int
+	AdminTLSCertFile     string
+	AdminTLSKeyFile      string
+	AdminTLSClientCAFile string
 	Http2                bool
 	AppBaseUrl           string
+	Upstreams            UpstreamsConfig
+	BackendTransport     BackendTransportConfig
+	BackendEndpoints     BackendEndpointsConfig
+	// Disconnects configures the delivery of the disconnect notifications
+	Disconnects    DisconnectNotificationsConfig
+	BackendBreaker CircuitBreakerConfig
+	// GrpcPushEnabled serves the gRPC push API, on a listener of its own if GrpcPushPort is set,
+	// otherwise next to the HTTP push endpoint
+	GrpcPushEnabled bool
+	GrpcPushPort    int
+	// MessageBatch, if enabled, makes wsgw send the client messages to the backend in batches
+	MessageBatch MessageBatchConfig
+	// Routing selects the backend profile the connections and the client messages go to
+	Routing RoutingConfig
+	// Endpoints are gateway endpoints served in addition to the default one, each with a connect path of its own
+	Endpoints []GatewayEndpointConfig
+	// FallbackTransports offers Server-Sent Events and long polling to the clients which can't use WebSockets
+	FallbackTransports FallbackTransportsConfig
+	// WebSocketKeepalive pings the WebSocket clients, ending the connections of those which don't answer
+	WebSocketKeepalive WebSocketKeepaliveConfig
+	// BackendUpstream is how the events of the connections reach the backend: http (default), nats or grpc
+	BackendUpstream      string
+	Nats                 NatsConfig
+	GrpcUpstream         GrpcUpstreamConfig
 	AckNewConnWithConnId bool
+	// LogLevel, if set, overrides the LOG_LEVEL environment variable
+	LogLevel string
+	// BackendSigningKeys are `<key-id>:<secret>` pairs; the first one signs the requests to the backend.
+	BackendSigningKeys    []string
 	LoadBalancerAddress   string // TODO: remove this
 	OtlpEndpoint          string
 	OtlpServiceNamespace  string
 	OtlpServiceName       string
 	OtlpServiceInstanceId string
-	OtlpTraceSampleAll    bool
+	// OtlpProtocol is that of the OTLP exporters: http/protobuf (the default) or grpc
+	OtlpProtocol string
+	// OtlpHeaders are the headers of the exports, as comma-separated key=value pairs with URL-encoded values
+	OtlpHeaders string
+	// OtlpCAFile, OtlpClientCertFile and OtlpClientKeyFile set up the TLS of the exports to an https endpoint
+	OtlpCAFile         string
+	OtlpClientCertFile string
+	OtlpClientKeyFile  string
+	OtlpTraceSampleAll bool
+	// OtlpTraceSampler is one of the samplers of OTEL_TRACES_SAMPLER; OtlpTraceSamplerRatio is the ratio
+	// of the ratio-based ones
+	OtlpTraceSampler      string
+	OtlpTraceSamplerRatio float64
+	// OtlpTraceQueueSize, OtlpTraceBatchSize and OtlpTraceBatchTimeout size the batching of the exported spans
+	OtlpTraceQueueSize    int
+	OtlpTraceBatchSize    int
+	OtlpTraceBatchTimeout time.Duration
+	// TracePropagators are the formats the trace context is propagated in: tracecontext, baggage, b3 or b3multi
+	TracePropagators []string
+	// TraceContextField is the field of the JSON frames of the clients holding the W3C traceparent of the frame
+	TraceContextField string
+	// MetricsEnabled serves the metrics in the Prometheus format at /metrics, on the admin listener if enabled
+	MetricsEnabled bool
+	// AuditLog writes the connection lifecycle and the admin actions as an NDJSON event stream
+	AuditLog AuditLogConfig
+	// Readiness configures the checks of the readiness probe and the draining on shutdown
+	Readiness ReadinessConfig
+	// ConnectionEvents, if its URL is set, makes wsgw report the events of the connections' health to the URL
+	ConnectionEvents ConnectionEventsConfig
+	// MetricsConnectionAttributes are the connection attributes, provided by the backend on connect, the
+	// throughput metrics are broken down by; MetricsAttributeMaxValues caps the number of values of each
+	MetricsConnectionAttributes []string
+	MetricsAttributeMaxValues   int
+}
+
+// NatsConfig configures the NATS upstream
+type NatsConfig struct {
+	URL string
+	// SubjectPrefix prefixes the subjects the events are published on and the pushes are consumed from
+	SubjectPrefix string
+	// RequestTimeout is how long wsgw waits for the backend to accept or reject a connection
+	RequestTimeout time.Duration
+}
+
+// FallbackTransportsConfig configures the Server-Sent Events and the long-polling transports
+type FallbackTransportsConfig struct {
+	Enabled bool
+	// SSEKeepAliveInterval is how often a comment is sent on idle event streams, so that proxies don't time them out
+	SSEKeepAliveInterval time.Duration
+	// LongPollTimeout is how long a poll waits for messages
+	LongPollTimeout time.Duration
+	// LongPollSessionTimeout is how long a long-polling connection lives without polls
+	LongPollSessionTimeout time.Duration
+}
+
+// WebSocketKeepaliveConfig configures the pings of the WebSocket clients
+type WebSocketKeepaliveConfig struct {
+	// PingInterval is how often a client is pinged, 30s by default
+	PingInterval time.Duration
+	// PingTimeout is how long wsgw waits for the pong, 10s by default, before ending the connection
+	PingTimeout time.Duration
+	Disabled    bool
+}
+
+// GrpcUpstreamConfig configures the gRPC upstream
+type GrpcUpstreamConfig struct {
+	// Target is the gRPC target of the backend, e.g. `dns:///backend:9090`
+	Target string
+	// TLS enables TLS with the system roots; the backend transport CA, client certificate and server name also enable it
+	TLS bool
+	// RequestTimeout is how long wsgw waits for the backend to accept or reject a connection
+	RequestTimeout time.Duration
+	// SendBuffer is the number of events waiting to be sent on the stream before the clients are held up
+	SendBuffer int
+	// PushTimeout is how long a push may wait for room in the buffer of the connection, holding up the stream meanwhile
+	PushTimeout         time.Duration
+	ReconnectMinBackoff time.Duration
+	ReconnectMaxBackoff time.Duration
+	// Endpoint is the name of the gateway endpoint the stream serves; set by wsgw for the named endpoints
+	Endpoint string
+}
+
+// UpstreamsConfig configures the balancing of the backend calls among several backend replicas
+type UpstreamsConfig struct {
+	// BaseUrls are the base URLs of the replicas; AppBaseUrl is used if empty
+	BaseUrls []string
+	// Balancing is either round_robin or least_in_flight
+	Balancing string
+	// Sticky makes the calls of a connection go to the same replica, as long as it is healthy
+	Sticky              bool
+	HealthCheckPath     string
+	HealthCheckInterval time.Duration
+	HealthCheckTimeout  time.Duration
+	UnhealthyThreshold  int
+	HealthyThreshold    int
+}
+
+// BackendTransportConfig configures the HTTP client wsgw calls the backend with
+type BackendTransportConfig struct {
+	CAFile              string
+	ClientCertFile      string
+	ClientKeyFile       string
+	ServerName          string
+	MaxIdleConns        int
+	MaxIdleConnsPerHost int
+	MaxConnsPerHost     int
+	IdleConnTimeout     time.Duration
+	DialTimeout         time.Duration
+	// Timeout is the default timeout of the backend calls; the per-endpoint timeouts override it
+	Timeout time.Duration
+}
+
+// BackendEndpointConfig configures one of the backend callbacks
+type BackendEndpointConfig struct {
+	// URL of the callback; may contain the `{baseUrl}` and `{connectionId}` placeholders.
+	// Defaults to `{baseUrl}/ws/<callback>`.
+	URL      string
+	Method   string
+	Timeout  time.Duration
+	Disabled bool
+}
+
+// BackendEndpointsConfig configures the backend callbacks
+type BackendEndpointsConfig struct {
+	Connect      BackendEndpointConfig
+	Message      BackendEndpointConfig
+	Disconnected BackendEndpointConfig
+}
+
+// ConnectionEventsConfig configures the delivery of the connection events: slow consumers, keepalive timeouts,
+// rate limit violations, backpressure recoveries and client close codes. The events are POSTed in batches.
+type ConnectionEventsConfig struct {
+	URL           string
+	BatchSize     int
+	FlushInterval time.Duration
+	// QueueSize bounds the events waiting for delivery; the events overflowing it are dropped
+	QueueSize           int
+	Timeout             time.Duration
+	RetryMaxAttempts    int
+	RetryInitialBackoff time.Duration
+	RetryMaxBackoff     time.Duration
+}
+
+// ReadinessConfig configures the readiness probe and the draining on shutdown
+type ReadinessConfig struct {
+	// BackendProbeEnabled makes the readiness depend on the backend answering the probe requests
+	// with a status below 500
+	BackendProbeEnabled bool
+	// BackendProbeURL is the URL probed, the connect callback of the default backend by default
+	BackendProbeURL      string
+	BackendProbeMethod   string
+	BackendProbeInterval time.Duration
+	BackendProbeTimeout  time.Duration
+	// DrainDelay is how long the instance keeps serving on shutdown, while the readiness probe fails,
+	// before it closes the listeners
+	DrainDelay time.Duration
+}
+
+// AuditLogConfig configures the audit log
+type AuditLogConfig struct {
+	// Sink is `stdout` or the path of the file the events are appended to; the audit log is off if it is empty
+	Sink string
+	// MaxSize is the size in megabytes the file is rotated at, 100 by default; MaxBackups is the number of
+	// rotated files kept, all of them by default
+	MaxSize    int
+	MaxBackups int
+}
+
+// DisconnectNotificationsConfig configures the retries of the disconnect notifications and the outbox
+// holding the notifications which couldn't be delivered even after the retries
+type DisconnectNotificationsConfig struct {
+	RetryMaxAttempts    int
+	RetryInitialBackoff time.Duration
+	RetryMaxBackoff     time.Duration
+	OutboxSize          int
+	// OutboxFile, if set, makes the outbox survive restarts
+	OutboxFile          string
+	OutboxFlushInterval time.Duration
+}
+
+// CircuitBreakerConfig configures the circuit breaker around the backend calls and the load shedding while it is open
+type CircuitBreakerConfig struct {
+	Enabled               bool
+	Window                time.Duration
+	MinRequests           int
+	FailureRateThreshold  float64
+	SlowCallDuration      time.Duration
+	SlowCallRateThreshold float64
+	OpenDuration          time.Duration
+	HalfOpenProbes        int
+	// RejectConnects makes wsgw answer `/connect` with `503` while the circuit is open
+	RejectConnects bool
+	// NotifyClients makes wsgw answer client messages with a "backend unavailable" frame while the circuit is open
+	NotifyClients bool
+}
+
+// MessageBatchConfig configures the batching of the client messages sent to the backend
+type MessageBatchConfig struct {
+	// MaxSize is the number of messages a batch is sent at, at the latest; 0 disables batching
+	MaxSize int
+	// MaxDelay is how long a message may wait for the batch to fill
+	MaxDelay time.Duration
+	// Format is either json (a JSON array) or ndjson (newline-delimited JSON)
+	Format string
+}
+
+// RoutingConfig configures the backend profiles and the routing of the client messages among them
+type RoutingConfig struct {
+	// Profiles maps the names of the backend profiles to the base URLs of their replicas.
+	// Clients select the profile of the connection through the `/connect/<profile>` path.
+	Profiles map[string][]string
+	// MessageField is the field of the JSON client messages whose value is the routing key
+	MessageField string
+	// TopicSeparator ends the topic prefix of the client messages serving as the routing key
+	TopicSeparator string
+	// MessageRoutes are `<routing-key>=<profile>` pairs; a trailing `*` in the routing key matches any suffix
+	MessageRoutes []string
+}
+
+// GatewayEndpointConfig configures a named gateway endpoint (virtual host). The connection IDs of the
+// endpoint are prefixed with its name, and the backend can push to them only through the endpoint's push path.
+type GatewayEndpointConfig struct {
+	Name string
+	// ConnectPath defaults to `/<name>/connect`
+	ConnectPath          string
+	AppBaseUrls          []string
+	AckNewConnWithConnId bool
+	// AllowedOrigins are the origin patterns accepted in the WS handshake
+	AllowedOrigins []string
+	// MaxConnections limits the number of concurrent connections of the endpoint, 0 means no limit
+	MaxConnections int
+	// MessageBuffer is the number of pushed messages buffered per connection
+	MessageBuffer int
 }
 
 const envNamePrefix = "WSGW_"
 
-func GetConfig(args []string) Config {
-	var k = koanf.New(".")
-	k.Load(env.Provider(".", env.Opt{
-		Prefix: envNamePrefix,
-		TransformFunc: func(k, v string) (string, any) {
-			// Transform the key.
-			k = strings.TrimPrefix(k, envNamePrefix)
-
-			// Transform the value into slices, if they contain spaces.
-			// Eg: MYVAR_TAGS="foo bar baz" -> tags: ["foo", "bar", "baz"]
-			if strings.Contains(v, " ") {
-				return k, strings.Split(v, " ")
-			}
+// GetConfig loads the configuration from, in increasing order of precedence, the configuration file, the `WSGW_*`
+// environment variables and the command line flags, and validates it. args are the command line arguments,
+// the name of the program included.
+func GetConfig(args []string) (Config, error) {
+	k, loadErr := load(args)
+	if loadErr != nil {
+		return Config{}, loadErr
+	}
+	configuration := newConfig(k)
+	if validateErr := errors.Join(checkKeys(k), checkValueTypes(k), configuration.Validate()); validateErr != nil {
+		return Config{}, fmt.Errorf("invalid configuration:\n%w", validateErr)
+	}
+	return configuration, nil
+}
 
-			return k, v
-		},
-	}), nil)
+func newConfig(k *koanf.Koanf) Config {
 	return Config{
-		ServerHost:            k.String("SERVER_HOST"),
-		ServerPort:            k.Int("SERVER_PORT"),
-		Http2:                 k.Bool("HTTP2"),
-		AppBaseUrl:            k.String("APP_BASE_URL"),
+		ServerHost:           k.String("SERVER_HOST"),
+		ServerPort:           k.Int("SERVER_PORT"),
+		TLSCertFile:          k.String("TLS_CERT_FILE"),
+		TLSKeyFile:           k.String("TLS_KEY_FILE"),
+		TLSMinVersion:        k.String("TLS_MIN_VERSION"),
+		TLSCipherPolicy:      k.String("TLS_CIPHER_POLICY"),
+		TLSReloadInterval:    k.Duration("TLS_RELOAD_INTERVAL"),
+		ClientHttp2:          k.Bool("CLIENT_HTTP2"),
+		WebTransportPort:     k.Int("WEBTRANSPORT_PORT"),
+		AdminServerHost:      k.String("ADMIN_SERVER_HOST"),
+		AdminServerPort:      k.Int("ADMIN_SERVER_PORT"),
+		AdminTLSCertFile:     k.String("ADMIN_TLS_CERT_FILE"),
+		AdminTLSKeyFile:      k.String("ADMIN_TLS_KEY_FILE"),
+		AdminTLSClientCAFile: k.String("ADMIN_TLS_CLIENT_CA_FILE"),
+		Http2:                k.Bool("HTTP2"),
+		GrpcPushEnabled:      k.Bool("GRPC_PUSH_ENABLED"),
+		GrpcPushPort:         k.Int("GRPC_PUSH_PORT"),
+		AppBaseUrl:           k.String("APP_BASE_URL"),
+		Upstreams:            getUpstreamsConfig(k),
+		BackendTransport:     getBackendTransportConfig(k),
+		BackendEndpoints:     getBackendEndpointsConfig(k),
+		BackendBreaker:       getCircuitBreakerConfig(k),
+		Disconnects:          getDisconnectNotificationsConfig(k),
+		MessageBatch:         getMessageBatchConfig(k),
+		Routing:              getRoutingConfig(k),
+		Endpoints:            getGatewayEndpointsConfig(k),
+		BackendUpstream:      k.String("BACKEND_UPSTREAM"),
+		FallbackTransports:   getFallbackTransportsConfig(k),
+		WebSocketKeepalive:   getWebSocketKeepaliveConfig(k),
+		Nats:                 getNatsConfig(k),
+		GrpcUpstream:         getGrpcUpstreamConfig(k),
+		LogLevel:             k.String("LOG_LEVEL"),
+
 		AckNewConnWithConnId:  k.Bool("ACK_NEW_CONN_WITH_CONN_ID"),
+		BackendSigningKeys:    stringList(k, "BACKEND_SIGNING_KEYS"),
 		LoadBalancerAddress:   k.String("LOAD_BALANCER_ADDRESS"),
 		OtlpEndpoint:          k.String("OTLP_ENDPOINT"),
 		OtlpServiceNamespace:  k.String("OTLP_SERVICE_NAMESPACE"),
 		OtlpServiceName:       k.String("OTLP_SERVICE_NAME"),
 		OtlpServiceInstanceId: k.String("OTLP_SERVICE_INSTANCE_ID"),
 		OtlpTraceSampleAll:    k.Bool("OTLP_TRACE_SAMPLE_ALL"),
+		OtlpProtocol:          k.String("OTLP_PROTOCOL"),
+		// The values of the headers may contain spaces, e.g. `Authorization=Bearer <token>`
+		OtlpHeaders:           strings.Join(stringList(k, "OTLP_HEADERS"), " "),
+		OtlpCAFile:            k.String("OTLP_CA_FILE"),
+		OtlpClientCertFile:    k.String("OTLP_CLIENT_CERT_FILE"),
+		OtlpClientKeyFile:     k.String("OTLP_CLIENT_KEY_FILE"),
+		OtlpTraceSampler:      k.String("OTLP_TRACE_SAMPLER"),
+		OtlpTraceSamplerRatio: floatOrDefault(k, "OTLP_TRACE_SAMPLER_RATIO", 1),
+		OtlpTraceQueueSize:    k.Int("OTLP_TRACE_QUEUE_SIZE"),
+		OtlpTraceBatchSize:    k.Int("OTLP_TRACE_BATCH_SIZE"),
+		OtlpTraceBatchTimeout: k.Duration("OTLP_TRACE_BATCH_TIMEOUT"),
+		TracePropagators:      stringList(k, "TRACE_PROPAGATORS"),
+		MetricsEnabled:        k.Bool("METRICS_ENABLED"),
+		TraceContextField:     k.String("TRACE_CONTEXT_FIELD"),
+
+		AuditLog: AuditLogConfig{
+			Sink:       k.String("AUDIT_LOG"),
+			MaxSize:    k.Int("AUDIT_LOG_MAX_SIZE"),
+			MaxBackups: k.Int("AUDIT_LOG_MAX_BACKUPS"),
+		},
+		Readiness: ReadinessConfig{
+			BackendProbeEnabled:  k.Bool("READINESS_BACKEND_PROBE_ENABLED"),
+			BackendProbeURL:      k.String("READINESS_BACKEND_PROBE_URL"),
+			BackendProbeMethod:   k.String("READINESS_BACKEND_PROBE_METHOD"),
+			BackendProbeInterval: k.Duration("READINESS_BACKEND_PROBE_INTERVAL"),
+			BackendProbeTimeout:  k.Duration("READINESS_BACKEND_PROBE_TIMEOUT"),
+			DrainDelay:           k.Duration("SHUTDOWN_DRAIN_DELAY"),
+		},
+		ConnectionEvents: ConnectionEventsConfig{
+			URL:                 k.String("CONNECTION_EVENTS_URL"),
+			BatchSize:           k.Int("CONNECTION_EVENTS_BATCH_SIZE"),
+			FlushInterval:       k.Duration("CONNECTION_EVENTS_FLUSH_INTERVAL"),
+			QueueSize:           k.Int("CONNECTION_EVENTS_QUEUE_SIZE"),
+			Timeout:             k.Duration("CONNECTION_EVENTS_TIMEOUT"),
+			RetryMaxAttempts:    k.Int("CONNECTION_EVENTS_RETRY_MAX_ATTEMPTS"),
+			RetryInitialBackoff: k.Duration("CONNECTION_EVENTS_RETRY_INITIAL_BACKOFF"),
+			RetryMaxBackoff:     k.Duration("CONNECTION_EVENTS_RETRY_MAX_BACKOFF"),
+		},
+		MetricsConnectionAttributes: stringList(k, "METRICS_CONNECTION_ATTRIBUTES"),
+		MetricsAttributeMaxValues:   k.Int("METRICS_ATTRIBUTE_MAX_VALUES"),
+	}
+}
+
+func getNatsConfig(k *koanf.Koanf) NatsConfig {
+	return NatsConfig{
+		URL:            k.String("NATS_URL"),
+		SubjectPrefix:  k.String("NATS_SUBJECT_PREFIX"),
+		RequestTimeout: k.Duration("NATS_REQUEST_TIMEOUT"),
+	}
+}
+
+func getFallbackTransportsConfig(k *koanf.Koanf) FallbackTransportsConfig {
+	return FallbackTransportsConfig{
+		Enabled:                k.Bool("FALLBACK_TRANSPORTS_ENABLED"),
+		SSEKeepAliveInterval:   k.Duration("SSE_KEEPALIVE_INTERVAL"),
+		LongPollTimeout:        k.Duration("LONG_POLL_TIMEOUT"),
+		LongPollSessionTimeout: k.Duration("LONG_POLL_SESSION_TIMEOUT"),
+	}
+}
+
+func getWebSocketKeepaliveConfig(k *koanf.Koanf) WebSocketKeepaliveConfig {
+	return WebSocketKeepaliveConfig{
+		PingInterval: k.Duration("WS_PING_INTERVAL"),
+		PingTimeout:  k.Duration("WS_PING_TIMEOUT"),
+		Disabled:     k.Bool("WS_PING_DISABLED"),
+	}
+}
+
+func getGrpcUpstreamConfig(k *koanf.Koanf) GrpcUpstreamConfig {
+	return GrpcUpstreamConfig{
+		Target:              k.String("GRPC_UPSTREAM_TARGET"),
+		TLS:                 k.Bool("GRPC_UPSTREAM_TLS"),
+		RequestTimeout:      k.Duration("GRPC_UPSTREAM_REQUEST_TIMEOUT"),
+		SendBuffer:          k.Int("GRPC_UPSTREAM_SEND_BUFFER"),
+		PushTimeout:         k.Duration("GRPC_UPSTREAM_PUSH_TIMEOUT"),
+		ReconnectMinBackoff: k.Duration("GRPC_UPSTREAM_RECONNECT_MIN_BACKOFF"),
+		ReconnectMaxBackoff: k.Duration("GRPC_UPSTREAM_RECONNECT_MAX_BACKOFF"),
+	}
+}
+
+func getUpstreamsConfig(k *koanf.Koanf) UpstreamsConfig {
+	return UpstreamsConfig{
+		BaseUrls:            stringList(k, "APP_BASE_URLS"),
+		Balancing:           k.String("UPSTREAM_BALANCING"),
+		Sticky:              k.Bool("UPSTREAM_STICKY"),
+		HealthCheckPath:     k.String("UPSTREAM_HEALTH_CHECK_PATH"),
+		HealthCheckInterval: k.Duration("UPSTREAM_HEALTH_CHECK_INTERVAL"),
+		HealthCheckTimeout:  k.Duration("UPSTREAM_HEALTH_CHECK_TIMEOUT"),
+		UnhealthyThreshold:  k.Int("UPSTREAM_UNHEALTHY_THRESHOLD"),
+		HealthyThreshold:    k.Int("UPSTREAM_HEALTHY_THRESHOLD"),
+	}
+}
+
+func getBackendTransportConfig(k *koanf.Koanf) BackendTransportConfig {
+	return BackendTransportConfig{
+		CAFile:              k.String("BACKEND_CA_FILE"),
+		ClientCertFile:      k.String("BACKEND_CLIENT_CERT_FILE"),
+		ClientKeyFile:       k.String("BACKEND_CLIENT_KEY_FILE"),
+		ServerName:          k.String("BACKEND_SERVER_NAME"),
+		MaxIdleConns:        k.Int("BACKEND_MAX_IDLE_CONNS"),
+		MaxIdleConnsPerHost: k.Int("BACKEND_MAX_IDLE_CONNS_PER_HOST"),
+		MaxConnsPerHost:     k.Int("BACKEND_MAX_CONNS_PER_HOST"),
+		IdleConnTimeout:     k.Duration("BACKEND_IDLE_CONN_TIMEOUT"),
+		DialTimeout:         k.Duration("BACKEND_DIAL_TIMEOUT"),
+		Timeout:             k.Duration("BACKEND_TIMEOUT"),
+	}
+}
+
+func getBackendEndpointsConfig(k *koanf.Koanf) BackendEndpointsConfig {
+	endpoint := func(name string) BackendEndpointConfig {
+		return BackendEndpointConfig{
+			URL:      k.String(fmt.Sprintf("BACKEND_%s_URL", name)),
+			Method:   k.String(fmt.Sprintf("BACKEND_%s_METHOD", name)),
+			Timeout:  k.Duration(fmt.Sprintf("BACKEND_%s_TIMEOUT", name)),
+			Disabled: k.Bool(fmt.Sprintf("BACKEND_%s_DISABLED", name)),
+		}
+	}
+	return BackendEndpointsConfig{
+		Connect:      endpoint("CONNECT"),
+		Message:      endpoint("MESSAGE"),
+		Disconnected: endpoint("DISCONNECTED"),
+	}
+}
+
+func getDisconnectNotificationsConfig(k *koanf.Koanf) DisconnectNotificationsConfig {
+	return DisconnectNotificationsConfig{
+		RetryMaxAttempts:    k.Int("DISCONNECTED_RETRY_MAX_ATTEMPTS"),
+		RetryInitialBackoff: k.Duration("DISCONNECTED_RETRY_INITIAL_BACKOFF"),
+		RetryMaxBackoff:     k.Duration("DISCONNECTED_RETRY_MAX_BACKOFF"),
+		OutboxSize:          k.Int("DISCONNECTED_OUTBOX_SIZE"),
+		OutboxFile:          k.String("DISCONNECTED_OUTBOX_FILE"),
+		OutboxFlushInterval: k.Duration("DISCONNECTED_OUTBOX_FLUSH_INTERVAL"),
+	}
+}
+
+func getCircuitBreakerConfig(k *koanf.Koanf) CircuitBreakerConfig {
+	return CircuitBreakerConfig{
+		Enabled:               k.Bool("BACKEND_BREAKER_ENABLED"),
+		Window:                k.Duration("BACKEND_BREAKER_WINDOW"),
+		MinRequests:           k.Int("BACKEND_BREAKER_MIN_REQUESTS"),
+		FailureRateThreshold:  k.Float64("BACKEND_BREAKER_FAILURE_RATE"),
+		SlowCallDuration:      k.Duration("BACKEND_BREAKER_SLOW_CALL_DURATION"),
+		SlowCallRateThreshold: k.Float64("BACKEND_BREAKER_SLOW_CALL_RATE"),
+		OpenDuration:          k.Duration("BACKEND_BREAKER_OPEN_DURATION"),
+		HalfOpenProbes:        k.Int("BACKEND_BREAKER_HALF_OPEN_PROBES"),
+		RejectConnects:        boolOrDefault(k, "BACKEND_BREAKER_REJECT_CONNECTS", true),
+		NotifyClients:         boolOrDefault(k, "BACKEND_BREAKER_NOTIFY_CLIENTS", true),
+	}
+}
+
+func getMessageBatchConfig(k *koanf.Koanf) MessageBatchConfig {
+	return MessageBatchConfig{
+		MaxSize:  k.Int("MESSAGE_BATCH_MAX_SIZE"),
+		MaxDelay: k.Duration("MESSAGE_BATCH_MAX_DELAY"),
+		Format:   k.String("MESSAGE_BATCH_FORMAT"),
+	}
+}
+
+func getRoutingConfig(k *koanf.Koanf) RoutingConfig {
+	profiles := map[string][]string{}
+	for _, profile := range stringList(k, "BACKEND_PROFILES") {
+		profiles[profile] = stringList(k, fmt.Sprintf("BACKEND_PROFILE_%s_BASE_URLS", strings.ToUpper(profile)))
+	}
+	return RoutingConfig{
+		Profiles:       profiles,
+		MessageField:   k.String("MESSAGE_ROUTE_FIELD"),
+		TopicSeparator: k.String("MESSAGE_ROUTE_TOPIC_SEPARATOR"),
+		MessageRoutes:  stringList(k, "MESSAGE_ROUTES"),
+	}
+}
+
+func getGatewayEndpointsConfig(k *koanf.Koanf) []GatewayEndpointConfig {
+	var endpoints []GatewayEndpointConfig
+	for _, name := range stringList(k, "ENDPOINTS") {
+		prefix := fmt.Sprintf("ENDPOINT_%s_", strings.ToUpper(name))
+		allowedOrigins := stringList(k, prefix+"ALLOWED_ORIGINS")
+		if len(allowedOrigins) == 0 {
+			allowedOrigins = []string{k.String("LOAD_BALANCER_ADDRESS")}
+		}
+		endpoints = append(endpoints, GatewayEndpointConfig{
+			Name:                 name,
+			ConnectPath:          k.String(prefix + "CONNECT_PATH"),
+			AppBaseUrls:          stringList(k, prefix+"APP_BASE_URLS"),
+			AckNewConnWithConnId: boolOrDefault(k, prefix+"ACK_NEW_CONN_WITH_CONN_ID", k.Bool("ACK_NEW_CONN_WITH_CONN_ID")),
+			AllowedOrigins:       allowedOrigins,
+			MaxConnections:       k.Int(prefix + "MAX_CONNECTIONS"),
+			MessageBuffer:        k.Int(prefix + "MESSAGE_BUFFER"),
+		})
+	}
+	return endpoints
+}
+
+// boolOrDefault returns the boolean value of the key, or the default if the key isn't set
+func boolOrDefault(k *koanf.Koanf, key string, defaultValue bool) bool {
+	if !k.Exists(key) {
+		return defaultValue
+	}
+	return k.Bool(key)
+}
+
+// floatOrDefault returns the number value of the key, or the default if the key isn't set
+func floatOrDefault(k *koanf.Koanf, key string, defaultValue float64) float64 {
+	if !k.Exists(key) {
+		return defaultValue
+	}
+	return k.Float64(key)
+}
+
+// ParseOtlpHeaders parses the headers of the OTLP exports: comma-separated key=value pairs, the values
+// URL-encoded, as in OTEL_EXPORTER_OTLP_HEADERS
+func ParseOtlpHeaders(value string) (map[string]string, error) {
+	if len(strings.TrimSpace(value)) == 0 {
+		return nil, nil
+	}
+	headers := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		key, encodedValue, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found || len(key) == 0 {
+			return nil, fmt.Errorf("expected key=value, got %q", strings.TrimSpace(pair))
+		}
+		decodedValue, unescapeErr := url.QueryUnescape(strings.TrimSpace(encodedValue))
+		if unescapeErr != nil {
+			return nil, fmt.Errorf("the value of %s isn't URL-encoded: %w", key, unescapeErr)
+		}
+		headers[key] = decodedValue
+	}
+	return headers, nil
+}
+
+// stringList returns the space-separated list value of the key. A single-item
+// list isn't split into a slice by the env provider, so it is wrapped here.
+func stringList(k *koanf.Koanf, key string) []string {
+	if values := k.Strings(key); len(values) > 0 {
+		return values
+	}
+	if value := k.String(key); len(value) > 0 {
+		return []string{value}
 	}
+	return nil
 }
 
 var instanceId string
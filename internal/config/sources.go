@@ -0,0 +1,131 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/knadh/koanf/parsers/toml/v2"
+	"github.com/knadh/koanf/parsers/yaml"
+	"github.com/knadh/koanf/providers/env/v2"
+	"github.com/knadh/koanf/providers/file"
+	"github.com/knadh/koanf/v2"
+	"github.com/spf13/pflag"
+)
+
+// ConfigFileEnvName names the configuration file, unless the --config flag does
+const ConfigFileEnvName = envNamePrefix + "CONFIG_FILE"
+
+// settingFlags are the settings with a command line flag of their own; `--set KEY=VALUE` sets the others.
+// The flags are named after the keys: `--server-port` sets SERVER_PORT.
+var settingFlags = map[string]string{
+	"server-host":       "the host the client listener binds to",
+	"server-port":       "the port the clients connect to",
+	"app-base-url":      "the base URL of the backend",
+	"admin-server-host": "the host the admin listener binds to",
+	"admin-server-port": "the port of the admin listener",
+	"tls-cert-file":     "the certificate file of the client listener",
+	"tls-key-file":      "the key file of the client listener",
+	"log-level":         "the log level: trace, debug, info, warn or error",
+}
+
+// NewFlagSet returns the command line flags of wsgw
+func NewFlagSet(name string) *pflag.FlagSet {
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	flags.StringP("config", "c", "", fmt.Sprintf("the YAML or TOML configuration file (env: %s)", ConfigFileEnvName))
+	for flagName, usage := range settingFlags {
+		flags.String(flagName, "", usage)
+	}
+	flags.StringArray("set", nil, "sets any setting as `KEY=VALUE`, KEY being the name of the environment variable without the WSGW_ prefix")
+	return flags
+}
+
+// load merges the configuration file, the environment variables and the command line flags, in this order.
+// The keys are the names of the environment variables without the `WSGW_` prefix.
+func load(args []string) (*koanf.Koanf, error) {
+	flags := NewFlagSet(filepath.Base(args[0]))
+	if parseErr := flags.Parse(args[1:]); parseErr != nil {
+		return nil, parseErr
+	}
+
+	k := koanf.New(".")
+
+	configFile, _ := flags.GetString("config")
+	if len(configFile) == 0 {
+		configFile = os.Getenv(ConfigFileEnvName)
+	}
+	if len(configFile) > 0 {
+		if fileErr := loadFile(k, configFile); fileErr != nil {
+			return nil, fileErr
+		}
+	}
+
+	envErr := k.Load(env.Provider(".", env.Opt{
+		Prefix: envNamePrefix,
+		TransformFunc: func(k, v string) (string, any) {
+			return strings.TrimPrefix(k, envNamePrefix), splitList(v)
+		},
+	}), nil)
+	if envErr != nil {
+		return nil, fmt.Errorf("failed to load the environment variables: %w", envErr)
+	}
+
+	var flagErr error
+	flags.Visit(func(flag *pflag.Flag) {
+		switch flag.Name {
+		case "config":
+		case "set":
+			settings, _ := flags.GetStringArray("set")
+			for _, setting := range settings {
+				key, value, found := strings.Cut(setting, "=")
+				if !found || len(key) == 0 {
+					flagErr = fmt.Errorf("invalid --set %q: expected KEY=VALUE", setting)
+					return
+				}
+				_ = k.Set(strings.ToUpper(strings.TrimPrefix(key, envNamePrefix)), splitList(value))
+			}
+		default:
+			_ = k.Set(flagKey(flag.Name), splitList(flag.Value.String()))
+		}
+	})
+	return k, flagErr
+}
+
+// loadFile loads the YAML or TOML configuration file. Its keys are case-insensitive and may be nested:
+// `backend: {connect: {timeout: 5s}}` is BACKEND_CONNECT_TIMEOUT.
+func loadFile(k *koanf.Koanf, configFile string) error {
+	var parser koanf.Parser
+	switch strings.ToLower(filepath.Ext(configFile)) {
+	case ".yaml", ".yml":
+		parser = yaml.Parser()
+	case ".toml":
+		parser = toml.Parser()
+	default:
+		return fmt.Errorf("unsupported configuration file %q: expected a .yaml, .yml or .toml file", configFile)
+	}
+
+	fileSettings := koanf.New("_")
+	if loadErr := fileSettings.Load(file.Provider(configFile), parser); loadErr != nil {
+		return fmt.Errorf("failed to load the configuration file %q: %w", configFile, loadErr)
+	}
+	for key, value := range fileSettings.All() {
+		if text, isText := value.(string); isText {
+			value = splitList(text)
+		}
+		_ = k.Set(strings.ToUpper(key), value)
+	}
+	return nil
+}
+
+// splitList turns the values with spaces into lists, as `WSGW_ENDPOINTS="chat feed"`
+func splitList(value string) any {
+	if strings.Contains(value, " ") {
+		return strings.Split(value, " ")
+	}
+	return value
+}
+
+func flagKey(flagName string) string {
+	return strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
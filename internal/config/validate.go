@@ -0,0 +1,396 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/knadh/koanf/v2"
+	"github.com/rs/zerolog"
+)
+
+// Validate checks the configuration for the mistakes wsgw would otherwise start with silently, or fail on only
+// once the clients connect. The settings are referred to by the names of their environment variables.
+func (c Config) Validate() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.ServerPort <= 0 || c.ServerPort > 65535 {
+		fail("WSGW_SERVER_PORT must be set to the port the clients connect to, e.g. WSGW_SERVER_PORT=8080")
+	}
+	for name, port := range map[string]int{"WSGW_ADMIN_SERVER_PORT": c.AdminServerPort, "WSGW_GRPC_PUSH_PORT": c.GrpcPushPort, "WSGW_WEBTRANSPORT_PORT": c.WebTransportPort} {
+		if port < 0 || port > 65535 {
+			fail("%s must be a port number between 1 and 65535, got %d", name, port)
+		}
+	}
+
+	upstream := c.BackendUpstream
+	switch upstream {
+	case "", "http":
+		if c.BackendEndpoints.usesBaseUrl() && len(c.AppBaseUrl) == 0 && len(c.Upstreams.BaseUrls) == 0 && len(c.Routing.Profiles) == 0 && len(c.Endpoints) == 0 {
+			fail("WSGW_APP_BASE_URL must be set to the base URL of the backend, e.g. WSGW_APP_BASE_URL=http://backend:8080 " +
+				"(alternatively, set WSGW_APP_BASE_URLS, WSGW_BACKEND_PROFILES or WSGW_ENDPOINTS)")
+		}
+	case "nats":
+		if len(c.Nats.URL) == 0 {
+			fail("WSGW_NATS_URL must be set with WSGW_BACKEND_UPSTREAM=nats, e.g. WSGW_NATS_URL=nats://nats:4222")
+		}
+	case "grpc":
+		if len(c.GrpcUpstream.Target) == 0 {
+			fail("WSGW_GRPC_UPSTREAM_TARGET must be set with WSGW_BACKEND_UPSTREAM=grpc, e.g. WSGW_GRPC_UPSTREAM_TARGET=dns:///backend:9090")
+		}
+	default:
+		fail("WSGW_BACKEND_UPSTREAM must be http, nats or grpc, got %q", upstream)
+	}
+
+	checkUrls := func(name string, values ...string) {
+		for _, value := range values {
+			if parsed, parseErr := url.Parse(value); parseErr != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || len(parsed.Host) == 0 {
+				fail("%s must be an http:// or https:// URL, got %q", name, value)
+			}
+		}
+	}
+	if len(c.AppBaseUrl) > 0 {
+		checkUrls("WSGW_APP_BASE_URL", c.AppBaseUrl)
+	}
+	checkUrls("WSGW_APP_BASE_URLS", c.Upstreams.BaseUrls...)
+	for profile, baseUrls := range c.Routing.Profiles {
+		name := fmt.Sprintf("WSGW_BACKEND_PROFILE_%s_BASE_URLS", strings.ToUpper(profile))
+		if len(baseUrls) == 0 && (upstream == "" || upstream == "http") {
+			fail("%s must be set to the base URLs of the backend profile %q", name, profile)
+		}
+		checkUrls(name, baseUrls...)
+	}
+
+	endpointNames := map[string]bool{}
+	// connectPaths maps the connect paths to the endpoints serving them, the default endpoint serving /connect
+	connectPaths := map[string]string{"/connect": "the default endpoint"}
+	for _, endpoint := range c.Endpoints {
+		prefix := fmt.Sprintf("WSGW_ENDPOINT_%s_", strings.ToUpper(endpoint.Name))
+		if endpointNames[endpoint.Name] {
+			fail("the gateway endpoint %q is listed twice in WSGW_ENDPOINTS", endpoint.Name)
+		}
+		endpointNames[endpoint.Name] = true
+		if len(endpoint.AppBaseUrls) == 0 && (upstream == "" || upstream == "http") {
+			fail("%sAPP_BASE_URLS must be set to the base URLs of the backend of the gateway endpoint %q", prefix, endpoint.Name)
+		}
+		checkUrls(prefix+"APP_BASE_URLS", endpoint.AppBaseUrls...)
+		if endpoint.MaxConnections < 0 || endpoint.MessageBuffer < 0 {
+			fail("%sMAX_CONNECTIONS and %sMESSAGE_BUFFER cannot be negative", prefix, prefix)
+		}
+		connectPath := endpoint.ConnectPath
+		if len(connectPath) == 0 {
+			connectPath = fmt.Sprintf("/%s/connect", endpoint.Name)
+		} else if !strings.HasPrefix(connectPath, "/") || strings.HasSuffix(connectPath, "/") || strings.ContainsAny(connectPath, ":*") {
+			fail("%sCONNECT_PATH must start with a /, not end with one and contain no : or *, e.g. %sCONNECT_PATH=/%s/ws, got %q",
+				prefix, prefix, endpoint.Name, connectPath)
+		}
+		if other, taken := connectPaths[connectPath]; taken {
+			fail("the connect path %s of the gateway endpoint %q is already that of %s: set %sCONNECT_PATH to another path",
+				connectPath, endpoint.Name, other, prefix)
+		} else {
+			connectPaths[connectPath] = fmt.Sprintf("the gateway endpoint %q", endpoint.Name)
+		}
+	}
+
+	checkKeyPair := func(certName, certFile, keyName, keyFile string) {
+		if (len(certFile) == 0) != (len(keyFile) == 0) {
+			fail("%s and %s must be set together", certName, keyName)
+		}
+	}
+	checkKeyPair("WSGW_TLS_CERT_FILE", c.TLSCertFile, "WSGW_TLS_KEY_FILE", c.TLSKeyFile)
+	checkKeyPair("WSGW_ADMIN_TLS_CERT_FILE", c.AdminTLSCertFile, "WSGW_ADMIN_TLS_KEY_FILE", c.AdminTLSKeyFile)
+	checkKeyPair("WSGW_BACKEND_CLIENT_CERT_FILE", c.BackendTransport.ClientCertFile, "WSGW_BACKEND_CLIENT_KEY_FILE", c.BackendTransport.ClientKeyFile)
+	checkKeyPair("WSGW_OTLP_CLIENT_CERT_FILE", c.OtlpClientCertFile, "WSGW_OTLP_CLIENT_KEY_FILE", c.OtlpClientKeyFile)
+	for name, path := range map[string]string{
+		"WSGW_TLS_CERT_FILE":            c.TLSCertFile,
+		"WSGW_TLS_KEY_FILE":             c.TLSKeyFile,
+		"WSGW_ADMIN_TLS_CERT_FILE":      c.AdminTLSCertFile,
+		"WSGW_ADMIN_TLS_KEY_FILE":       c.AdminTLSKeyFile,
+		"WSGW_ADMIN_TLS_CLIENT_CA_FILE": c.AdminTLSClientCAFile,
+		"WSGW_BACKEND_CA_FILE":          c.BackendTransport.CAFile,
+		"WSGW_BACKEND_CLIENT_CERT_FILE": c.BackendTransport.ClientCertFile,
+		"WSGW_BACKEND_CLIENT_KEY_FILE":  c.BackendTransport.ClientKeyFile,
+		"WSGW_OTLP_CA_FILE":             c.OtlpCAFile,
+		"WSGW_OTLP_CLIENT_CERT_FILE":    c.OtlpClientCertFile,
+		"WSGW_OTLP_CLIENT_KEY_FILE":     c.OtlpClientKeyFile,
+	} {
+		if len(path) == 0 {
+			continue
+		}
+		if _, statErr := os.Stat(path); statErr != nil {
+			fail("%s: %w", name, statErr)
+		}
+	}
+	if c.WebTransportPort != 0 && len(c.TLSCertFile) == 0 {
+		fail("WSGW_WEBTRANSPORT_PORT requires TLS on the client listener: set WSGW_TLS_CERT_FILE and WSGW_TLS_KEY_FILE")
+	}
+	if len(c.AdminTLSClientCAFile) > 0 && len(c.AdminTLSCertFile) == 0 {
+		fail("WSGW_ADMIN_TLS_CLIENT_CA_FILE requires TLS on the admin listener: set WSGW_ADMIN_TLS_CERT_FILE and WSGW_ADMIN_TLS_KEY_FILE")
+	}
+	if !slices.Contains([]string{"", "1.2", "1.3"}, c.TLSMinVersion) {
+		fail("WSGW_TLS_MIN_VERSION must be 1.2 or 1.3, got %q", c.TLSMinVersion)
+	}
+
+	for _, key := range c.BackendSigningKeys {
+		if id, secret, found := strings.Cut(key, ":"); !found || len(id) == 0 || len(secret) == 0 {
+			fail("WSGW_BACKEND_SIGNING_KEYS must be <key-id>:<secret> pairs, got one without the key ID or the secret")
+		}
+	}
+
+	if len(c.OtlpEndpoint) > 0 {
+		checkUrls("WSGW_OTLP_ENDPOINT", c.OtlpEndpoint)
+	}
+	if !slices.Contains([]string{"", "http/protobuf", "grpc"}, c.OtlpProtocol) {
+		fail("WSGW_OTLP_PROTOCOL must be http/protobuf or grpc, got %q", c.OtlpProtocol)
+	}
+	if _, headersErr := ParseOtlpHeaders(c.OtlpHeaders); headersErr != nil {
+		fail("WSGW_OTLP_HEADERS must be comma-separated key=value pairs with URL-encoded values: %w", headersErr)
+	}
+	samplers := []string{"", "always_on", "always_off", "traceidratio", "parentbased_always_on", "parentbased_always_off", "parentbased_traceidratio"}
+	if !slices.Contains(samplers, c.OtlpTraceSampler) {
+		fail("WSGW_OTLP_TRACE_SAMPLER must be one of %s, got %q", strings.Join(samplers[1:], ", "), c.OtlpTraceSampler)
+	}
+	if len(c.OtlpTraceSampler) > 0 && c.OtlpTraceSampleAll {
+		fail("WSGW_OTLP_TRACE_SAMPLE_ALL and WSGW_OTLP_TRACE_SAMPLER cannot be set together: use WSGW_OTLP_TRACE_SAMPLER=always_on")
+	}
+	if c.OtlpTraceSamplerRatio < 0 || c.OtlpTraceSamplerRatio > 1 {
+		fail("WSGW_OTLP_TRACE_SAMPLER_RATIO must be between 0 and 1, got %v", c.OtlpTraceSamplerRatio)
+	}
+	if c.OtlpTraceQueueSize < 0 || c.OtlpTraceBatchSize < 0 || c.OtlpTraceBatchTimeout < 0 {
+		fail("WSGW_OTLP_TRACE_QUEUE_SIZE, WSGW_OTLP_TRACE_BATCH_SIZE and WSGW_OTLP_TRACE_BATCH_TIMEOUT cannot be negative")
+	}
+	if c.OtlpTraceQueueSize > 0 && c.OtlpTraceBatchSize > c.OtlpTraceQueueSize {
+		fail("WSGW_OTLP_TRACE_BATCH_SIZE cannot exceed WSGW_OTLP_TRACE_QUEUE_SIZE")
+	}
+	for _, propagator := range c.TracePropagators {
+		if !slices.Contains([]string{"tracecontext", "baggage", "b3", "b3multi"}, propagator) {
+			fail("WSGW_TRACE_PROPAGATORS must list tracecontext, baggage, b3 or b3multi, got %q", propagator)
+		}
+	}
+
+	if c.WebSocketKeepalive.PingInterval < 0 || c.WebSocketKeepalive.PingTimeout < 0 {
+		fail("WSGW_WS_PING_INTERVAL and WSGW_WS_PING_TIMEOUT cannot be negative: set WSGW_WS_PING_DISABLED=true to turn the pings off")
+	}
+
+	if c.MetricsAttributeMaxValues < 0 {
+		fail("WSGW_METRICS_ATTRIBUTE_MAX_VALUES cannot be negative")
+	}
+
+	if len(c.ConnectionEvents.URL) > 0 {
+		checkUrls("WSGW_CONNECTION_EVENTS_URL", c.ConnectionEvents.URL)
+	}
+	if c.ConnectionEvents.BatchSize < 0 || c.ConnectionEvents.QueueSize < 0 || c.ConnectionEvents.RetryMaxAttempts < 0 ||
+		c.ConnectionEvents.FlushInterval < 0 || c.ConnectionEvents.Timeout < 0 || c.ConnectionEvents.RetryInitialBackoff < 0 || c.ConnectionEvents.RetryMaxBackoff < 0 {
+		fail("the WSGW_CONNECTION_EVENTS_* settings cannot be negative")
+	}
+
+	if c.Readiness.BackendProbeEnabled {
+		if len(c.Readiness.BackendProbeURL) > 0 {
+			checkUrls("WSGW_READINESS_BACKEND_PROBE_URL", c.Readiness.BackendProbeURL)
+		} else if (upstream != "" && upstream != "http") || c.BackendEndpoints.Connect.Disabled || (len(c.AppBaseUrl) == 0 && len(c.Upstreams.BaseUrls) == 0) {
+			fail("WSGW_READINESS_BACKEND_PROBE_URL must be set unless the default backend is called over HTTP with its connect callback enabled")
+		}
+	}
+	if !slices.Contains([]string{"", "GET", "HEAD", "OPTIONS"}, strings.ToUpper(c.Readiness.BackendProbeMethod)) {
+		fail("WSGW_READINESS_BACKEND_PROBE_METHOD must be GET, HEAD or OPTIONS, got %q", c.Readiness.BackendProbeMethod)
+	}
+	if c.Readiness.BackendProbeInterval < 0 || c.Readiness.BackendProbeTimeout < 0 || c.Readiness.DrainDelay < 0 {
+		fail("WSGW_READINESS_BACKEND_PROBE_INTERVAL, WSGW_READINESS_BACKEND_PROBE_TIMEOUT and WSGW_SHUTDOWN_DRAIN_DELAY cannot be negative")
+	}
+
+	if len(c.AuditLog.Sink) > 0 && c.AuditLog.Sink != "stdout" {
+		// The file is created on start, in a directory which must exist
+		if _, statErr := os.Stat(filepath.Dir(c.AuditLog.Sink)); statErr != nil {
+			fail("WSGW_AUDIT_LOG must be stdout or the path of a file in an existing directory: %w", statErr)
+		}
+	}
+	if c.AuditLog.MaxSize < 0 || c.AuditLog.MaxBackups < 0 {
+		fail("WSGW_AUDIT_LOG_MAX_SIZE and WSGW_AUDIT_LOG_MAX_BACKUPS cannot be negative")
+	}
+
+	if len(c.LogLevel) > 0 {
+		if _, levelErr := zerolog.ParseLevel(c.LogLevel); levelErr != nil {
+			fail("WSGW_LOG_LEVEL must be trace, debug, info, warn or error, got %q", c.LogLevel)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// usesBaseUrl tells whether any of the enabled callbacks is called at the base URL of the backend
+func (e BackendEndpointsConfig) usesBaseUrl() bool {
+	for _, endpoint := range []BackendEndpointConfig{e.Connect, e.Message, e.Disconnected} {
+		if !endpoint.Disabled && (len(endpoint.URL) == 0 || strings.Contains(endpoint.URL, "{baseUrl}")) {
+			return true
+		}
+	}
+	return false
+}
+
+// valueTypes tell the type of the settings by the suffix of their keys. koanf reads the malformed values as
+// zeros, so they are checked before being read.
+var valueTypes = []struct {
+	suffixes []string
+	check    func(value string) error
+	expected string
+}{
+	{
+		suffixes: []string{"_TIMEOUT", "_INTERVAL", "_BACKOFF", "_DURATION", "_DELAY", "_WINDOW"},
+		check:    func(value string) error { _, err := time.ParseDuration(value); return err },
+		expected: "a duration such as 500ms, 5s or 1m",
+	},
+	{
+		suffixes: []string{"_PORT", "_SIZE", "_BUFFER", "_CONNS", "_CONNECTIONS", "_ATTEMPTS", "_THRESHOLD", "_PROBES", "_REQUESTS", "_MAX_VALUES", "_BACKUPS"},
+		check:    func(value string) error { _, err := strconv.Atoi(value); return err },
+		expected: "an integer",
+	},
+	{
+		suffixes: []string{"_RATE", "_RATIO"},
+		check:    func(value string) error { _, err := strconv.ParseFloat(value, 64); return err },
+		expected: "a number",
+	},
+	{
+		suffixes: []string{"_ENABLED", "_DISABLED", "_STICKY", "_TLS", "HTTP2", "_CONN_ID", "_SAMPLE_ALL", "_CONNECTS", "_CLIENTS"},
+		check:    func(value string) error { _, err := strconv.ParseBool(value); return err },
+		expected: "true or false",
+	},
+}
+
+// checkValueTypes reports the values which aren't of the type of their setting
+func checkValueTypes(k *koanf.Koanf) error {
+	var errs []error
+	for _, key := range k.Keys() {
+		// The values of the configuration file may be typed already
+		value := fmt.Sprint(k.Get(key))
+		for _, valueType := range valueTypes {
+			if !slices.ContainsFunc(valueType.suffixes, func(suffix string) bool { return strings.HasSuffix(key, suffix) }) {
+				continue
+			}
+			if valueType.check(value) != nil {
+				errs = append(errs, fmt.Errorf("%s%s must be %s, got %q", envNamePrefix, key, valueType.expected, value))
+			}
+			break
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// settingKeys are the keys of the settings, but those of the backend profiles and of the gateway endpoints,
+// which are named after them
+var settingKeys = []string{
+	"CONFIG_FILE",
+	"SERVER_HOST", "SERVER_PORT", "CLIENT_HTTP2", "WEBTRANSPORT_PORT", "HTTP2", "LOG_LEVEL", "LOAD_BALANCER_ADDRESS",
+	"TLS_CERT_FILE", "TLS_KEY_FILE", "TLS_MIN_VERSION", "TLS_CIPHER_POLICY", "TLS_RELOAD_INTERVAL",
+	"ADMIN_SERVER_HOST", "ADMIN_SERVER_PORT", "ADMIN_TLS_CERT_FILE", "ADMIN_TLS_KEY_FILE", "ADMIN_TLS_CLIENT_CA_FILE",
+	"GRPC_PUSH_ENABLED", "GRPC_PUSH_PORT",
+	"APP_BASE_URL", "APP_BASE_URLS", "ACK_NEW_CONN_WITH_CONN_ID", "BACKEND_SIGNING_KEYS", "BACKEND_UPSTREAM",
+	"UPSTREAM_BALANCING", "UPSTREAM_STICKY", "UPSTREAM_HEALTH_CHECK_PATH", "UPSTREAM_HEALTH_CHECK_INTERVAL",
+	"UPSTREAM_HEALTH_CHECK_TIMEOUT", "UPSTREAM_UNHEALTHY_THRESHOLD", "UPSTREAM_HEALTHY_THRESHOLD",
+	"BACKEND_CA_FILE", "BACKEND_CLIENT_CERT_FILE", "BACKEND_CLIENT_KEY_FILE", "BACKEND_SERVER_NAME",
+	"BACKEND_MAX_IDLE_CONNS", "BACKEND_MAX_IDLE_CONNS_PER_HOST", "BACKEND_MAX_CONNS_PER_HOST",
+	"BACKEND_IDLE_CONN_TIMEOUT", "BACKEND_DIAL_TIMEOUT", "BACKEND_TIMEOUT",
+	"BACKEND_CONNECT_URL", "BACKEND_CONNECT_METHOD", "BACKEND_CONNECT_TIMEOUT", "BACKEND_CONNECT_DISABLED",
+	"BACKEND_MESSAGE_URL", "BACKEND_MESSAGE_METHOD", "BACKEND_MESSAGE_TIMEOUT", "BACKEND_MESSAGE_DISABLED",
+	"BACKEND_DISCONNECTED_URL", "BACKEND_DISCONNECTED_METHOD", "BACKEND_DISCONNECTED_TIMEOUT", "BACKEND_DISCONNECTED_DISABLED",
+	"BACKEND_BREAKER_ENABLED", "BACKEND_BREAKER_WINDOW", "BACKEND_BREAKER_MIN_REQUESTS", "BACKEND_BREAKER_FAILURE_RATE",
+	"BACKEND_BREAKER_SLOW_CALL_DURATION", "BACKEND_BREAKER_SLOW_CALL_RATE", "BACKEND_BREAKER_OPEN_DURATION",
+	"BACKEND_BREAKER_HALF_OPEN_PROBES", "BACKEND_BREAKER_REJECT_CONNECTS", "BACKEND_BREAKER_NOTIFY_CLIENTS",
+	"DISCONNECTED_RETRY_MAX_ATTEMPTS", "DISCONNECTED_RETRY_INITIAL_BACKOFF", "DISCONNECTED_RETRY_MAX_BACKOFF",
+	"DISCONNECTED_OUTBOX_SIZE", "DISCONNECTED_OUTBOX_FILE", "DISCONNECTED_OUTBOX_FLUSH_INTERVAL",
+	"MESSAGE_BATCH_MAX_SIZE", "MESSAGE_BATCH_MAX_DELAY", "MESSAGE_BATCH_FORMAT",
+	"BACKEND_PROFILES", "MESSAGE_ROUTE_FIELD", "MESSAGE_ROUTE_TOPIC_SEPARATOR", "MESSAGE_ROUTES", "ENDPOINTS",
+	"FALLBACK_TRANSPORTS_ENABLED", "SSE_KEEPALIVE_INTERVAL", "LONG_POLL_TIMEOUT", "LONG_POLL_SESSION_TIMEOUT",
+	"WS_PING_INTERVAL", "WS_PING_TIMEOUT", "WS_PING_DISABLED",
+	"NATS_URL", "NATS_SUBJECT_PREFIX", "NATS_REQUEST_TIMEOUT",
+	"GRPC_UPSTREAM_TARGET", "GRPC_UPSTREAM_TLS", "GRPC_UPSTREAM_REQUEST_TIMEOUT", "GRPC_UPSTREAM_SEND_BUFFER",
+	"GRPC_UPSTREAM_PUSH_TIMEOUT", "GRPC_UPSTREAM_RECONNECT_MIN_BACKOFF", "GRPC_UPSTREAM_RECONNECT_MAX_BACKOFF",
+	"OTLP_ENDPOINT", "OTLP_PROTOCOL", "OTLP_HEADERS", "OTLP_CA_FILE", "OTLP_CLIENT_CERT_FILE", "OTLP_CLIENT_KEY_FILE",
+	"OTLP_SERVICE_NAMESPACE", "OTLP_SERVICE_NAME", "OTLP_SERVICE_INSTANCE_ID", "OTLP_TRACE_SAMPLE_ALL",
+	"OTLP_TRACE_SAMPLER", "OTLP_TRACE_SAMPLER_RATIO", "OTLP_TRACE_QUEUE_SIZE", "OTLP_TRACE_BATCH_SIZE",
+	"OTLP_TRACE_BATCH_TIMEOUT", "TRACE_PROPAGATORS", "TRACE_CONTEXT_FIELD",
+	"METRICS_ENABLED", "METRICS_CONNECTION_ATTRIBUTES", "METRICS_ATTRIBUTE_MAX_VALUES",
+	"AUDIT_LOG", "AUDIT_LOG_MAX_SIZE", "AUDIT_LOG_MAX_BACKUPS",
+	"READINESS_BACKEND_PROBE_ENABLED", "READINESS_BACKEND_PROBE_URL", "READINESS_BACKEND_PROBE_METHOD",
+	"READINESS_BACKEND_PROBE_INTERVAL", "READINESS_BACKEND_PROBE_TIMEOUT", "SHUTDOWN_DRAIN_DELAY",
+	"CONNECTION_EVENTS_URL", "CONNECTION_EVENTS_BATCH_SIZE", "CONNECTION_EVENTS_FLUSH_INTERVAL",
+	"CONNECTION_EVENTS_QUEUE_SIZE", "CONNECTION_EVENTS_TIMEOUT", "CONNECTION_EVENTS_RETRY_MAX_ATTEMPTS",
+	"CONNECTION_EVENTS_RETRY_INITIAL_BACKOFF", "CONNECTION_EVENTS_RETRY_MAX_BACKOFF",
+}
+
+// endpointSettingKeys are the keys of the settings of a gateway endpoint, after its ENDPOINT_<NAME>_ prefix
+var endpointSettingKeys = []string{"CONNECT_PATH", "APP_BASE_URLS", "ACK_NEW_CONN_WITH_CONN_ID", "ALLOWED_ORIGINS", "MAX_CONNECTIONS", "MESSAGE_BUFFER"}
+
+// checkKeys reports the keys which aren't those of a setting, misspelt ones most likely, along with the closest
+// setting
+func checkKeys(k *koanf.Koanf) error {
+	known := slices.Clone(settingKeys)
+	for _, profile := range stringList(k, "BACKEND_PROFILES") {
+		known = append(known, fmt.Sprintf("BACKEND_PROFILE_%s_BASE_URLS", strings.ToUpper(profile)))
+	}
+	for _, name := range stringList(k, "ENDPOINTS") {
+		for _, key := range endpointSettingKeys {
+			known = append(known, fmt.Sprintf("ENDPOINT_%s_%s", strings.ToUpper(name), key))
+		}
+	}
+	// The settings of the profiles and endpoints not configured are suggested with a placeholder for their name
+	suggested := append(slices.Clone(known), "BACKEND_PROFILE_<PROFILE>_BASE_URLS")
+	for _, key := range endpointSettingKeys {
+		suggested = append(suggested, "ENDPOINT_<NAME>_"+key)
+	}
+
+	var errs []error
+	for _, key := range k.Keys() {
+		if slices.Contains(known, key) {
+			continue
+		}
+		closest := slices.MinFunc(suggested, func(a, b string) int { return keyDistance(key, a) - keyDistance(key, b) })
+		if keyDistance(key, closest) <= len(key)/3 {
+			errs = append(errs, fmt.Errorf("%s%s isn't a setting, did you mean %s%s?", envNamePrefix, key, envNamePrefix, closest))
+		} else {
+			errs = append(errs, fmt.Errorf("%s%s isn't a setting", envNamePrefix, key))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// keyDistance is the edit distance between the key and the setting, or the end of the setting after one of its
+// underscores if that is closer: MAX_CONECTIONS is close to ENDPOINT_CHAT_MAX_CONNECTIONS.
+func keyDistance(key string, setting string) int {
+	distance := editDistance(key, setting)
+	for i := range setting {
+		if setting[i] == '_' {
+			distance = min(distance, editDistance(key, setting[i+1:]))
+		}
+	}
+	return distance
+}
+
+// editDistance is the number of single-character insertions, deletions and substitutions turning a into b
+func editDistance(a string, b string) int {
+	previous := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		current := make([]int, len(b)+1)
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			substitution := previous[j-1]
+			if a[i-1] != b[j-1] {
+				substitution++
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, substitution)
+		}
+		previous = current
+	}
+	return previous[len(b)]
+}
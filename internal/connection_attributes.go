@@ -0,0 +1,113 @@
+package wsgw
+
+import (
+	"strings"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// ConnectionAttributesHeaderKey is the header of the response of the connect callback describing the accepted
+// connection, as comma-separated `key=value` pairs: `X-WSGW-CONNECTION-ATTRIBUTES: tenant=acme, plan=pro`
+const ConnectionAttributesHeaderKey = "X-WSGW-CONNECTION-ATTRIBUTES"
+
+const (
+	maxConnectionAttributes     = 16
+	maxConnectionAttributeValue = 128
+)
+
+// connectionAttributes are provided by the backend on connect, e.g. the tenant of the connection
+type connectionAttributes map[string]string
+
+// parseConnectionAttributes parses the connection attributes header, skipping the malformed pairs
+func parseConnectionAttributes(header string) connectionAttributes {
+	if len(header) == 0 {
+		return nil
+	}
+	attributes := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		key, value, found := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if !found || len(key) == 0 {
+			continue
+		}
+		attributes[key] = strings.TrimSpace(value)
+	}
+	return limitConnectionAttributes(attributes)
+}
+
+// limitConnectionAttributes bounds the memory the attributes of a connection take
+func limitConnectionAttributes(attributes map[string]string) connectionAttributes {
+	if len(attributes) == 0 {
+		return nil
+	}
+	limited := make(connectionAttributes, min(len(attributes), maxConnectionAttributes))
+	for key, value := range attributes {
+		if len(limited) == maxConnectionAttributes {
+			break
+		}
+		if len(key) > maxConnectionAttributeValue {
+			continue
+		}
+		if len(value) > maxConnectionAttributeValue {
+			value = value[:maxConnectionAttributeValue]
+		}
+		limited[key] = value
+	}
+	return limited
+}
+
+// otherAttributeValue replaces the values of a metric dimension beyond its limit
+const otherAttributeValue = "other"
+
+const defaultMetricsAttributeMaxValues = 100
+
+// metricDimensions are the connection attributes the throughput metrics are broken down by. As each distinct
+// value makes a time series, the values of each attribute are capped: those seen after the limit is reached
+// are recorded as "other".
+type metricDimensions struct {
+	keys      []string
+	maxValues int
+
+	mux  sync.Mutex
+	seen map[string]map[string]struct{}
+}
+
+func newMetricDimensions(keys []string, maxValues int) *metricDimensions {
+	return &metricDimensions{
+		keys:      keys,
+		maxValues: orDefault(maxValues, defaultMetricsAttributeMaxValues),
+		seen:      map[string]map[string]struct{}{},
+	}
+}
+
+// of returns the metric attributes of a connection; the attributes the backend didn't provide are left out
+func (d *metricDimensions) of(attributes connectionAttributes) attribute.Set {
+	if d == nil || len(d.keys) == 0 {
+		return *attribute.EmptySet()
+	}
+
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	var keyValues []attribute.KeyValue
+	for _, key := range d.keys {
+		value, provided := attributes[key]
+		if !provided {
+			continue
+		}
+		values, ok := d.seen[key]
+		if !ok {
+			values = map[string]struct{}{}
+			d.seen[key] = values
+		}
+		if _, known := values[value]; !known {
+			if len(values) >= d.maxValues {
+				value = otherAttributeValue
+			} else {
+				values[value] = struct{}{}
+			}
+		}
+		keyValues = append(keyValues, attribute.String(key, value))
+	}
+	return attribute.NewSet(keyValues...)
+}
@@ -0,0 +1,243 @@
+package wsgw
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+	"wsgw/pkgs/logging"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// LogLevelPath is the admin path reading and changing the log level at runtime
+	LogLevelPath EndpointPath = "/log-level"
+	// DebugSessionsPath is the admin path of the debug sessions
+	DebugSessionsPath EndpointPath = "/debug-sessions"
+)
+
+const (
+	defaultDebugSessionDuration = 15 * time.Minute
+	maxDebugSessionDuration     = time.Hour
+)
+
+const debugSessionIdPathParamName = "debugSessionId"
+
+// debugSession logs verbosely the requests and the connections of a connection ID or of a remote address,
+// whatever the log level, until it expires
+type debugSession struct {
+	ID            string       `json:"id"`
+	ConnectionID  ConnectionID `json:"connectionId,omitempty"`
+	RemoteAddress string       `json:"remoteAddress,omitempty"`
+	ExpiresAt     time.Time    `json:"expiresAt"`
+}
+
+func (s debugSession) matches(target *debugTarget, now time.Time) bool {
+	if now.After(s.ExpiresAt) {
+		return false
+	}
+	if len(s.ConnectionID) > 0 {
+		connId := target.connId.Load()
+		return connId != nil && *connId == s.ConnectionID
+	}
+	for _, address := range target.remoteAddresses {
+		if address == s.RemoteAddress {
+			return true
+		}
+	}
+	return false
+}
+
+// debugSessions are the debug sessions of the server, shared by the client and the admin listeners
+type debugSessions struct {
+	mux      sync.Mutex
+	sessions map[string]debugSession
+	// count is the number of sessions, expired or not, so that the debug events of the other connections
+	// are dropped without locking while there are none
+	count atomic.Int32
+	// audit records the changes of the log level and of the debug sessions
+	audit *auditLog
+}
+
+func newDebugSessions(audit *auditLog) *debugSessions {
+	return &debugSessions{sessions: map[string]debugSession{}, audit: audit}
+}
+
+func (d *debugSessions) add(session debugSession) {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	d.sessions[session.ID] = session
+	d.count.Store(int32(len(d.sessions)))
+}
+
+// remove removes the session; false if there is none with the ID
+func (d *debugSessions) remove(id string) bool {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	_, found := d.sessions[id]
+	delete(d.sessions, id)
+	d.count.Store(int32(len(d.sessions)))
+	return found
+}
+
+// list returns the sessions which haven't expired, dropping the others
+func (d *debugSessions) list() []debugSession {
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	now := time.Now()
+	sessions := make([]debugSession, 0, len(d.sessions))
+	for id, session := range d.sessions {
+		if now.After(session.ExpiresAt) {
+			delete(d.sessions, id)
+			continue
+		}
+		sessions = append(sessions, session)
+	}
+	d.count.Store(int32(len(d.sessions)))
+	return sessions
+}
+
+func (d *debugSessions) matches(target *debugTarget) bool {
+	if d.count.Load() == 0 {
+		return false
+	}
+	d.mux.Lock()
+	defer d.mux.Unlock()
+	now := time.Now()
+	for _, session := range d.sessions {
+		if session.matches(target, now) {
+			return true
+		}
+	}
+	return false
+}
+
+// debugTarget is what the debug sessions are matched against. The connection ID of a connect request
+// is known only once the connection is accepted.
+type debugTarget struct {
+	remoteAddresses []string
+	connId          atomic.Pointer[ConnectionID]
+}
+
+type debugTargetKey struct{}
+
+// setDebugConnectionId tells the debug sessions which connection the request is about
+func setDebugConnectionId(ctx context.Context, connId ConnectionID) {
+	if target, ok := ctx.Value(debugTargetKey{}).(*debugTarget); ok {
+		target.connId.Store(&connId)
+	}
+}
+
+// middleware makes the logger of the request, and so those of its connection, verbose while a debug
+// session matches the request. The remote address is that of the TCP connection, or the client IP gin
+// reads from the X-Forwarded-For header.
+func (d *debugSessions) middleware() gin.HandlerFunc {
+	return func(g *gin.Context) {
+		target := &debugTarget{remoteAddresses: []string{g.ClientIP()}}
+		if host, _, splitErr := net.SplitHostPort(g.Request.RemoteAddr); splitErr == nil && host != g.ClientIP() {
+			target.remoteAddresses = append(target.remoteAddresses, host)
+		}
+
+		ctx := g.Request.Context()
+		logger := logging.Verbose(*zerolog.Ctx(ctx), func() bool { return d.matches(target) })
+		ctx = context.WithValue(logger.WithContext(ctx), debugTargetKey{}, target)
+		g.Request = g.Request.WithContext(ctx)
+
+		g.Next()
+	}
+}
+
+// register registers the admin routes of the log level and of the debug sessions
+func (d *debugSessions) register(adminEngine *gin.Engine) {
+	adminEngine.GET(string(LogLevelPath), func(g *gin.Context) {
+		g.JSON(http.StatusOK, gin.H{"level": logging.CurrentLevel()})
+	})
+	adminEngine.PUT(string(LogLevelPath), func(g *gin.Context) {
+		var request struct {
+			Level string `json:"level"`
+		}
+		if bindErr := g.ShouldBindJSON(&request); bindErr != nil {
+			g.JSON(http.StatusBadRequest, gin.H{"error": bindErr.Error()})
+			return
+		}
+		if levelErr := logging.SetLevel(request.Level); levelErr != nil {
+			g.JSON(http.StatusBadRequest, gin.H{"error": levelErr.Error()})
+			return
+		}
+		zerolog.Ctx(g.Request.Context()).Warn().Str("level", request.Level).Msg("log level changed")
+		d.audit.admin(g.Request.Context(), "log_level_changed", g.ClientIP(), map[string]string{"level": request.Level})
+		g.JSON(http.StatusOK, gin.H{"level": logging.CurrentLevel()})
+	})
+
+	adminEngine.GET(string(DebugSessionsPath), func(g *gin.Context) {
+		g.JSON(http.StatusOK, d.list())
+	})
+	adminEngine.POST(string(DebugSessionsPath), d.createHandler)
+	adminEngine.DELETE(string(DebugSessionsPath)+"/:"+debugSessionIdPathParamName, func(g *gin.Context) {
+		id := g.Param(debugSessionIdPathParamName)
+		if !d.remove(id) {
+			g.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		d.audit.admin(g.Request.Context(), "debug_session_stopped", g.ClientIP(), map[string]string{"debugSessionId": id})
+		g.Status(http.StatusNoContent)
+	})
+}
+
+// createHandler starts a debug session for either a connection ID or a remote address, for the duration
+// of the request, 15 minutes by default and an hour at most
+func (d *debugSessions) createHandler(g *gin.Context) {
+	var request struct {
+		ConnectionID  ConnectionID `json:"connectionId"`
+		RemoteAddress string       `json:"remoteAddress"`
+		Duration      string       `json:"duration"`
+	}
+	if bindErr := g.ShouldBindJSON(&request); bindErr != nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": bindErr.Error()})
+		return
+	}
+	if (len(request.ConnectionID) == 0) == (len(request.RemoteAddress) == 0) {
+		g.JSON(http.StatusBadRequest, gin.H{"error": "exactly one of connectionId and remoteAddress must be set"})
+		return
+	}
+	if len(request.RemoteAddress) > 0 && net.ParseIP(request.RemoteAddress) == nil {
+		g.JSON(http.StatusBadRequest, gin.H{"error": "remoteAddress must be an IP address"})
+		return
+	}
+
+	duration := defaultDebugSessionDuration
+	if len(request.Duration) > 0 {
+		parsed, parseErr := time.ParseDuration(request.Duration)
+		if parseErr != nil || parsed <= 0 || parsed > maxDebugSessionDuration {
+			g.JSON(http.StatusBadRequest, gin.H{"error": "duration must be a positive duration of an hour at most, such as 90s or 15m"})
+			return
+		}
+		duration = parsed
+	}
+
+	session := debugSession{
+		ID:            xid.New().String(),
+		ConnectionID:  request.ConnectionID,
+		RemoteAddress: request.RemoteAddress,
+		ExpiresAt:     time.Now().Add(duration).UTC(),
+	}
+	d.add(session)
+	zerolog.Ctx(g.Request.Context()).Info().
+		Str("debugSessionId", session.ID).
+		Str(ConnectionIDKey, string(session.ConnectionID)).
+		Str("remoteAddress", session.RemoteAddress).
+		Time("expiresAt", session.ExpiresAt).
+		Msg("debug session started")
+	d.audit.admin(g.Request.Context(), "debug_session_started", g.ClientIP(), map[string]string{
+		"debugSessionId": session.ID,
+		ConnectionIDKey:  string(session.ConnectionID),
+		"remoteAddress":  session.RemoteAddress,
+		"expiresAt":      session.ExpiresAt.Format(time.RFC3339),
+	})
+	g.JSON(http.StatusCreated, session)
+}
@@ -0,0 +1,238 @@
+package wsgw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+	"wsgw/internal/config"
+	"wsgw/pkgs/monitoring"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+const (
+	defaultOutboxSize          = 1000
+	defaultOutboxFlushInterval = 5 * time.Second
+)
+
+// credentialHeaders are the headers of the connect requests which aren't persisted with the disconnect notifications
+var credentialHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "X-Api-Key", "X-Auth-Token"}
+
+// disconnectEvent is a disconnect notification for the backend
+type disconnectEvent struct {
+	Seq            uint64       `json:"seq"`
+	ConnectionID   ConnectionID `json:"connectionId"`
+	Header         http.Header  `json:"header"`
+	DisconnectedAt time.Time    `json:"disconnectedAt"`
+}
+
+type disconnectNotificationMetrics struct {
+	// notifications counts the notifications by outcome: delivered, queued, redelivered, dropped, rejected
+	notifications metric.Int64Counter
+	outboxSize    metric.Int64UpDownCounter
+}
+
+func newDisconnectNotificationMetrics() disconnectNotificationMetrics {
+	return disconnectNotificationMetrics{
+		notifications: monitoring.CreateCounter(config.OtelScope, "wsgw.disconnect_notifications", "Disconnect notifications to the backend, by outcome"),
+		outboxSize:    monitoring.CreateUpDownCounter(config.OtelScope, "wsgw.disconnect_outbox.size", "Disconnect notifications waiting for the backend to recover", "{notification}"),
+	}
+}
+
+func (m disconnectNotificationMetrics) count(ctx context.Context, outcome string, n int) {
+	m.notifications.Add(ctx, int64(n), metric.WithAttributes(attribute.String("outcome", outcome)))
+}
+
+// disconnectOutbox keeps the disconnect notifications the backend couldn't be notified of
+// and re-sends them when the backend recovers. The outbox is bounded: when it is full,
+// the oldest notification is dropped. If a file is configured, the content of the outbox
+// is saved to it on each change, and loaded from it at startup, so that undelivered
+// notifications survive restarts.
+type disconnectOutbox struct {
+	mux     sync.Mutex
+	events  []disconnectEvent
+	nextSeq uint64
+
+	capacity      int
+	file          string
+	flushInterval time.Duration
+	send          func(ctx context.Context, event disconnectEvent) error
+	wake          chan struct{}
+	metrics       disconnectNotificationMetrics
+}
+
+func newDisconnectOutbox(conf config.DisconnectNotificationsConfig, send func(ctx context.Context, event disconnectEvent) error, metrics disconnectNotificationMetrics) (*disconnectOutbox, error) {
+	outbox := &disconnectOutbox{
+		capacity:      orDefault(conf.OutboxSize, defaultOutboxSize),
+		file:          conf.OutboxFile,
+		flushInterval: orDefault(conf.OutboxFlushInterval, defaultOutboxFlushInterval),
+		send:          send,
+		wake:          make(chan struct{}, 1),
+		metrics:       metrics,
+	}
+	if loadErr := outbox.load(); loadErr != nil {
+		return nil, loadErr
+	}
+	return outbox, nil
+}
+
+func (o *disconnectOutbox) load() error {
+	if len(o.file) == 0 {
+		return nil
+	}
+	content, readErr := os.ReadFile(o.file)
+	if errors.Is(readErr, os.ErrNotExist) {
+		return nil
+	}
+	if readErr != nil {
+		return fmt.Errorf("failed to read the disconnect outbox file: %w", readErr)
+	}
+	var events []disconnectEvent
+	if unmarshalErr := json.Unmarshal(content, &events); unmarshalErr != nil {
+		return fmt.Errorf("failed to parse the disconnect outbox file %s: %w", o.file, unmarshalErr)
+	}
+	if len(events) > o.capacity {
+		events = events[len(events)-o.capacity:]
+	}
+	o.events = events
+	for _, event := range events {
+		o.nextSeq = max(o.nextSeq, event.Seq+1)
+	}
+	o.metrics.outboxSize.Add(context.Background(), int64(len(events)))
+	return nil
+}
+
+// save writes the content of the outbox to the file, if one is configured, without the credentials of the clients.
+// Must be called with mux held.
+func (o *disconnectOutbox) save(logger zerolog.Logger) {
+	if len(o.file) == 0 {
+		return
+	}
+	persisted := make([]disconnectEvent, len(o.events))
+	for i, event := range o.events {
+		persisted[i] = event
+		persisted[i].Header = withoutCredentials(event.Header)
+	}
+	content, marshalErr := json.Marshal(persisted)
+	if marshalErr != nil {
+		logger.Error().Err(marshalErr).Msg("failed to marshal the disconnect outbox")
+		return
+	}
+	tmpFile := filepath.Join(filepath.Dir(o.file), "."+filepath.Base(o.file)+".tmp")
+	if writeErr := os.WriteFile(tmpFile, content, 0o600); writeErr != nil {
+		logger.Error().Err(writeErr).Msg("failed to save the disconnect outbox")
+		return
+	}
+	if renameErr := os.Rename(tmpFile, o.file); renameErr != nil {
+		logger.Error().Err(renameErr).Msg("failed to save the disconnect outbox")
+	}
+}
+
+// withoutCredentials returns a copy of the header without the credential headers
+func withoutCredentials(header http.Header) http.Header {
+	stripped := header.Clone()
+	for _, name := range credentialHeaders {
+		stripped.Del(name)
+	}
+	return stripped
+}
+
+func (o *disconnectOutbox) add(ctx context.Context, event disconnectEvent) {
+	logger := zerolog.Ctx(ctx).With().Str(ConnectionIDKey, string(event.ConnectionID)).Logger()
+
+	o.mux.Lock()
+	defer o.mux.Unlock()
+
+	event.Seq = o.nextSeq
+	o.nextSeq++
+
+	if len(o.events) >= o.capacity {
+		dropped := o.events[0]
+		o.events = o.events[1:]
+		o.metrics.count(ctx, "dropped", 1)
+		o.metrics.outboxSize.Add(ctx, -1)
+		logger.Warn().Str("droppedConnectionId", string(dropped.ConnectionID)).Msg("disconnect outbox full, dropped the oldest notification")
+	}
+	o.events = append(o.events, event)
+	o.metrics.count(ctx, "queued", 1)
+	o.metrics.outboxSize.Add(ctx, 1)
+	o.save(logger)
+}
+
+// backendRecovered signals the flusher that the backend is accepting notifications again
+func (o *disconnectOutbox) backendRecovered() {
+	select {
+	case o.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (o *disconnectOutbox) peek() (disconnectEvent, bool) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	if len(o.events) == 0 {
+		return disconnectEvent{}, false
+	}
+	return o.events[0], true
+}
+
+// remove removes the event if it is still at the head of the outbox (it might have been dropped meanwhile)
+func (o *disconnectOutbox) remove(ctx context.Context, event disconnectEvent) {
+	o.mux.Lock()
+	defer o.mux.Unlock()
+	if len(o.events) == 0 || o.events[0].Seq != event.Seq {
+		return
+	}
+	o.events = o.events[1:]
+	o.metrics.outboxSize.Add(ctx, -1)
+	o.save(*zerolog.Ctx(ctx))
+}
+
+// flush sends the queued notifications in order, until the outbox is empty or a notification fails
+func (o *disconnectOutbox) flush(ctx context.Context) {
+	logger := zerolog.Ctx(ctx).With().Logger()
+	for ctx.Err() == nil {
+		event, ok := o.peek()
+		if !ok {
+			return
+		}
+		sendErr := o.send(ctx, event)
+		if sendErr != nil && !errors.Is(sendErr, errPermanent) {
+			logger.Debug().Err(sendErr).Msg("backend still not accepting disconnect notifications")
+			return
+		}
+		if sendErr != nil {
+			logger.Info().Err(sendErr).Str(ConnectionIDKey, string(event.ConnectionID)).Msg("backend rejected queued disconnect notification")
+			o.metrics.count(ctx, "rejected", 1)
+		} else {
+			o.metrics.count(ctx, "redelivered", 1)
+		}
+		o.remove(ctx, event)
+	}
+}
+
+// run flushes the outbox periodically and whenever the backend is seen to recover, until ctx is done
+func (o *disconnectOutbox) run(ctx context.Context) {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "disconnectOutbox").Logger()
+	ctx = logger.WithContext(ctx)
+
+	ticker := time.NewTicker(o.flushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-o.wake:
+		}
+		o.flush(ctx)
+	}
+}
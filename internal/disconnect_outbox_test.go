@@ -0,0 +1,123 @@
+package wsgw
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"wsgw/internal/config"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type disconnectOutboxTestSuite struct {
+	suite.Suite
+	// sent are the connections of the notifications sent, and sendErrs the errors the sends fail with, in order
+	sent     []ConnectionID
+	sendErrs []error
+}
+
+func TestDisconnectOutboxTestSuite(t *testing.T) {
+	suite.Run(t, &disconnectOutboxTestSuite{})
+}
+
+func (s *disconnectOutboxTestSuite) SetupTest() {
+	s.sent = nil
+	s.sendErrs = nil
+}
+
+func (s *disconnectOutboxTestSuite) newOutbox(conf config.DisconnectNotificationsConfig) *disconnectOutbox {
+	outbox, outboxErr := newDisconnectOutbox(conf, func(_ context.Context, event disconnectEvent) error {
+		s.sent = append(s.sent, event.ConnectionID)
+		if len(s.sendErrs) == 0 {
+			return nil
+		}
+		sendErr := s.sendErrs[0]
+		s.sendErrs = s.sendErrs[1:]
+		return sendErr
+	}, newDisconnectNotificationMetrics())
+	s.Require().NoError(outboxErr)
+	return outbox
+}
+
+func (s *disconnectOutboxTestSuite) queued(outbox *disconnectOutbox) []ConnectionID {
+	outbox.mux.Lock()
+	defer outbox.mux.Unlock()
+	var connIds []ConnectionID
+	for _, event := range outbox.events {
+		connIds = append(connIds, event.ConnectionID)
+	}
+	return connIds
+}
+
+func (s *disconnectOutboxTestSuite) TestDropsTheOldestWhenFull() {
+	outbox := s.newOutbox(config.DisconnectNotificationsConfig{OutboxSize: 2})
+	for _, connId := range []ConnectionID{"first", "second", "third"} {
+		outbox.add(context.Background(), disconnectEvent{ConnectionID: connId})
+	}
+	s.Equal([]ConnectionID{"second", "third"}, s.queued(outbox))
+}
+
+func (s *disconnectOutboxTestSuite) TestSurvivesRestarts() {
+	file := filepath.Join(s.T().TempDir(), "outbox.json")
+	outbox := s.newOutbox(config.DisconnectNotificationsConfig{OutboxFile: file})
+	outbox.add(context.Background(), disconnectEvent{ConnectionID: "first"})
+	outbox.add(context.Background(), disconnectEvent{ConnectionID: "second"})
+
+	restarted := s.newOutbox(config.DisconnectNotificationsConfig{OutboxFile: file})
+	s.Equal([]ConnectionID{"first", "second"}, s.queued(restarted))
+	// The sequence goes on from the saved notifications
+	restarted.add(context.Background(), disconnectEvent{ConnectionID: "third"})
+	s.Equal(uint64(2), restarted.events[2].Seq)
+
+	// Only the most recent notifications fit a smaller outbox
+	smaller := s.newOutbox(config.DisconnectNotificationsConfig{OutboxFile: file, OutboxSize: 2})
+	s.Equal([]ConnectionID{"second", "third"}, s.queued(smaller))
+}
+
+func (s *disconnectOutboxTestSuite) TestCredentialsAreNotPersisted() {
+	file := filepath.Join(s.T().TempDir(), "outbox.json")
+	outbox := s.newOutbox(config.DisconnectNotificationsConfig{OutboxFile: file})
+	header := http.Header{}
+	header.Set("Authorization", "Bearer secret-token")
+	header.Set("Cookie", "session=secret-session")
+	header.Set("X-Tenant", "acme")
+	outbox.add(context.Background(), disconnectEvent{ConnectionID: "first", Header: header})
+
+	content, readErr := os.ReadFile(file)
+	s.Require().NoError(readErr)
+	s.NotContains(string(content), "secret")
+
+	restarted := s.newOutbox(config.DisconnectNotificationsConfig{OutboxFile: file})
+	s.Require().Len(restarted.events, 1)
+	s.Equal(http.Header{"X-Tenant": {"acme"}}, restarted.events[0].Header)
+	// The notifications not persisted yet keep their headers
+	s.Equal("Bearer secret-token", outbox.events[0].Header.Get("Authorization"))
+}
+
+func (s *disconnectOutboxTestSuite) TestRejectsCorruptFile() {
+	file := filepath.Join(s.T().TempDir(), "outbox.json")
+	s.Require().NoError(os.WriteFile(file, []byte("not json"), 0o600))
+	_, outboxErr := newDisconnectOutbox(config.DisconnectNotificationsConfig{OutboxFile: file}, nil, newDisconnectNotificationMetrics())
+	s.Error(outboxErr)
+}
+
+func (s *disconnectOutboxTestSuite) TestFlushesInOrderUntilAFailure() {
+	file := filepath.Join(s.T().TempDir(), "outbox.json")
+	outbox := s.newOutbox(config.DisconnectNotificationsConfig{OutboxFile: file})
+	for _, connId := range []ConnectionID{"first", "second", "third", "fourth"} {
+		outbox.add(context.Background(), disconnectEvent{ConnectionID: connId})
+	}
+
+	// The permanently rejected notifications are discarded, the others wait for the backend to recover
+	s.sendErrs = []error{nil, errors.Join(errPermanent, errors.New("rejected")), errors.New("unavailable")}
+	outbox.flush(context.Background())
+	s.Equal([]ConnectionID{"first", "second", "third"}, s.sent)
+	s.Equal([]ConnectionID{"third", "fourth"}, s.queued(outbox))
+
+	outbox.flush(context.Background())
+	s.Empty(s.queued(outbox))
+	s.Empty(s.queued(s.newOutbox(config.DisconnectNotificationsConfig{OutboxFile: file})))
+}
@@ -0,0 +1,578 @@
+package wsgw
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"wsgw/internal/config"
+
+	"github.com/coder/websocket"
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+)
+
+const (
+	// SessionTokenHeaderKey authenticates the requests of the clients of the fallback transports
+	SessionTokenHeaderKey = "X-WSGW-SESSION-TOKEN"
+	// SessionTokenKey is the key of the session token in the first message of the fallback transports
+	SessionTokenKey = "sessionToken"
+
+	defaultSSEKeepAliveInterval         = 15 * time.Second
+	defaultLongPollTimeout              = 25 * time.Second
+	defaultLongPollSessionTimeout       = time.Minute
+	longPollOutboxSize                  = 256
+	maxMessagesPerPoll                  = 100
+	maxFallbackClientMessageSize  int64 = 32768 // The default read limit of the WebSocket connections
+)
+
+var (
+	errInvalidSessionToken = errors.New("invalid session token")
+	errSessionClosed       = errors.New("session closed")
+)
+
+// fallbackSession is the client end of a connection made over one of the fallback transports. The messages of the
+// client come in with `POST /send/{connectionId}` requests authenticated by the session token.
+type fallbackSession struct {
+	id         ConnectionID
+	token      string
+	fromClient chan string
+	closed     chan struct{}
+	closeOnce  sync.Once
+	// closeErr and expired are set before closed is closed
+	closeErr websocket.CloseError
+	// expired tells that the client stopped polling
+	expired bool
+}
+
+func newFallbackSession(connId ConnectionID) (*fallbackSession, error) {
+	tokenBytes := make([]byte, 32)
+	if _, randErr := rand.Read(tokenBytes); randErr != nil {
+		return nil, randErr
+	}
+	return &fallbackSession{
+		id:         connId,
+		token:      base64.RawURLEncoding.EncodeToString(tokenBytes),
+		fromClient: make(chan string),
+		closed:     make(chan struct{}),
+	}, nil
+}
+
+func (s *fallbackSession) session() *fallbackSession {
+	return s
+}
+
+// end closes the session; the reads of the connection fail with the close error
+func (s *fallbackSession) end(code websocket.StatusCode, reason string) {
+	s.closeOnce.Do(func() {
+		s.closeErr = websocket.CloseError{Code: code, Reason: reason}
+		close(s.closed)
+	})
+}
+
+// expire closes the session of a client which stopped polling
+func (s *fallbackSession) expire() {
+	s.closeOnce.Do(func() {
+		s.closeErr = websocket.CloseError{Code: websocket.StatusGoingAway, Reason: "session expired"}
+		s.expired = true
+		close(s.closed)
+	})
+}
+
+func (s *fallbackSession) Read(ctx context.Context) (string, error) {
+	select {
+	case msg := <-s.fromClient:
+		return msg, nil
+	case <-s.closed:
+		if s.expired {
+			return "", fmt.Errorf("%w: %w", errKeepaliveTimeout, s.closeErr)
+		}
+		return "", s.closeErr
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (s *fallbackSession) Close() error {
+	s.end(websocket.StatusPolicyViolation, "connection too slow to keep up with messages")
+	return nil
+}
+
+// send hands the message of the client over to the connection
+func (s *fallbackSession) send(ctx context.Context, msg string) error {
+	select {
+	case s.fromClient <- msg:
+		return nil
+	case <-s.closed:
+		return errSessionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type fallbackIO interface {
+	wsIO
+	session() *fallbackSession
+}
+
+// sseIO writes the messages to the client as Server-Sent Events
+type sseIO struct {
+	*fallbackSession
+	writeMux   sync.Mutex
+	writer     gin.ResponseWriter
+	controller *http.ResponseController
+}
+
+// sseWriteTimeout bounds the writes without a deadline of their own, the stream being exempt from the write
+// timeout of the server
+const sseWriteTimeout = 10 * time.Second
+
+func newSSEIO(session *fallbackSession, writer gin.ResponseWriter) *sseIO {
+	return &sseIO{fallbackSession: session, writer: writer, controller: http.NewResponseController(writer)}
+}
+
+func (s *sseIO) setWriteDeadline(ctx context.Context) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(sseWriteTimeout)
+	}
+	_ = s.controller.SetWriteDeadline(deadline)
+}
+
+func (s *sseIO) writeEvent(ctx context.Context, event string, data string) error {
+	s.writeMux.Lock()
+	defer s.writeMux.Unlock()
+	s.setWriteDeadline(ctx)
+	var frame strings.Builder
+	if len(event) > 0 {
+		fmt.Fprintf(&frame, "event: %s\n", event)
+	}
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&frame, "data: %s\n", line)
+	}
+	frame.WriteString("\n")
+	if _, writeErr := io.WriteString(s.writer, frame.String()); writeErr != nil {
+		return writeErr
+	}
+	s.writer.Flush()
+	return nil
+}
+
+func (s *sseIO) keepAlive() error {
+	s.writeMux.Lock()
+	defer s.writeMux.Unlock()
+	s.setWriteDeadline(context.Background())
+	if _, writeErr := io.WriteString(s.writer, ": keepalive\n\n"); writeErr != nil {
+		return writeErr
+	}
+	s.writer.Flush()
+	return nil
+}
+
+func (s *sseIO) Write(ctx context.Context, msg string) error {
+	return s.writeEvent(ctx, "", msg)
+}
+
+// CloseWith sends a `close` event before ending the stream, as the client would reconnect otherwise
+func (s *sseIO) CloseWith(code websocket.StatusCode, reason string) error {
+	data, _ := json.Marshal(map[string]any{"code": code, "reason": reason})
+	writeErr := s.writeEvent(context.Background(), "close", string(data))
+	s.end(code, reason)
+	return writeErr
+}
+
+// longPollIO keeps the messages to the client until they are polled
+type longPollIO struct {
+	*fallbackSession
+	outbox     chan string
+	polling    atomic.Int32
+	lastPolled atomic.Int64
+}
+
+func (l *longPollIO) Write(ctx context.Context, msg string) error {
+	select {
+	case l.outbox <- msg:
+		return nil
+	case <-l.closed:
+		return errSessionClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *longPollIO) CloseWith(code websocket.StatusCode, reason string) error {
+	l.end(code, reason)
+	return nil
+}
+
+// poll waits up to the timeout for messages to the client and returns those available, or errSessionClosed
+// once the session is closed and all of its messages are polled
+func (l *longPollIO) poll(ctx context.Context, timeout time.Duration) ([]string, error) {
+	l.polling.Add(1)
+	defer func() {
+		l.lastPolled.Store(time.Now().UnixNano())
+		l.polling.Add(-1)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var messages []string
+	select {
+	case msg := <-l.outbox:
+		messages = append(messages, msg)
+	case <-l.closed:
+		select {
+		case msg := <-l.outbox:
+			messages = append(messages, msg)
+		default:
+			return nil, errSessionClosed
+		}
+	case <-timer.C:
+		return []string{}, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	for len(messages) < maxMessagesPerPoll {
+		select {
+		case msg := <-l.outbox:
+			messages = append(messages, msg)
+		default:
+			return messages, nil
+		}
+	}
+	return messages, nil
+}
+
+// expireIdle ends the session once it isn't polled for the session timeout
+func (l *longPollIO) expireIdle(sessionTimeout time.Duration) {
+	ticker := time.NewTicker(sessionTimeout / 4)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-l.closed:
+			return
+		case <-ticker.C:
+			if l.polling.Load() == 0 && time.Since(time.Unix(0, l.lastPolled.Load())) > sessionTimeout {
+				l.expire()
+				return
+			}
+		}
+	}
+}
+
+// fallbackSessions are the connections of a gateway endpoint made over the fallback transports
+type fallbackSessions struct {
+	mux      sync.Mutex
+	sessions map[ConnectionID]fallbackIO
+}
+
+func newFallbackSessions() *fallbackSessions {
+	return &fallbackSessions{sessions: make(map[ConnectionID]fallbackIO)}
+}
+
+func (fs *fallbackSessions) add(transport fallbackIO) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	fs.sessions[transport.session().id] = transport
+}
+
+func (fs *fallbackSessions) remove(connId ConnectionID) {
+	fs.mux.Lock()
+	defer fs.mux.Unlock()
+	delete(fs.sessions, connId)
+}
+
+// authorize returns the session of the request, provided that the request carries its token
+func (fs *fallbackSessions) authorize(g *gin.Context) (fallbackIO, error) {
+	connId := ConnectionID(g.Param(connIdPathParamName))
+	setDebugConnectionId(g.Request.Context(), connId)
+	fs.mux.Lock()
+	transport, ok := fs.sessions[connId]
+	fs.mux.Unlock()
+	if !ok {
+		return nil, errConnectionNotFound
+	}
+	if subtle.ConstantTimeCompare([]byte(g.GetHeader(SessionTokenHeaderKey)), []byte(transport.session().token)) != 1 {
+		return nil, errInvalidSessionToken
+	}
+	return transport, nil
+}
+
+// abortWithSessionError answers the request with the status corresponding to the error of the session lookup
+func abortWithSessionError(g *gin.Context, err error) {
+	switch {
+	case errors.Is(err, errConnectionNotFound):
+		g.AbortWithStatus(http.StatusNotFound)
+	case errors.Is(err, errInvalidSessionToken):
+		g.AbortWithStatus(http.StatusForbidden)
+	case errors.Is(err, errSessionClosed):
+		g.AbortWithStatus(http.StatusGone)
+	default:
+		g.AbortWithStatus(http.StatusInternalServerError)
+	}
+}
+
+// fallbackCORS rejects the requests of the origins not allowed to connect, and lets browsers make cross-origin
+// requests from the allowed ones. The origins are matched like those of the WebSocket connections.
+func fallbackCORS(originPatterns *allowedOrigins) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		origin := g.GetHeader("Origin")
+		if len(origin) == 0 {
+			g.Next()
+			return
+		}
+		originUrl, parseErr := url.Parse(origin)
+		if parseErr != nil {
+			g.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		if !strings.EqualFold(originUrl.Host, g.Request.Host) {
+			if !originAllowed(originUrl, originPatterns.get()) {
+				g.AbortWithStatus(http.StatusForbidden)
+				return
+			}
+			g.Header("Access-Control-Allow-Origin", origin)
+			g.Header("Access-Control-Allow-Credentials", "true")
+			g.Header("Vary", "Origin")
+		}
+		if g.Request.Method == http.MethodOptions {
+			g.Header("Access-Control-Allow-Methods", "GET, POST, DELETE")
+			g.Header("Access-Control-Allow-Headers", "Authorization, Content-Type, "+SessionTokenHeaderKey)
+			g.AbortWithStatus(http.StatusNoContent)
+			return
+		}
+		g.Next()
+	}
+}
+
+func originAllowed(originUrl *url.URL, originPatterns []string) bool {
+	for _, pattern := range originPatterns {
+		target := originUrl.Host
+		if strings.Contains(pattern, "://") {
+			target = originUrl.String()
+		}
+		if matched, _ := path.Match(strings.ToLower(pattern), strings.ToLower(target)); matched {
+			return true
+		}
+	}
+	return false
+}
+
+// registerFallbackTransports registers the Server-Sent Events and the long-polling transports of the endpoint:
+// `GET <prefix>/events[/{profile}]`, `POST <prefix>/poll[/{profile}]`, `GET|DELETE <prefix>/poll/{connectionId}`
+// and `POST <prefix>/send/{connectionId}`.
+func (e *gatewayEndpoint) registerFallbackTransports(ctx context.Context, clientEngine *gin.Engine, createConnectionId func(ctx context.Context) ConnectionID) {
+	sessions := newFallbackSessions()
+	group := clientEngine.Group(e.pathPrefix, fallbackCORS(e.originPatterns))
+
+	events := e.sseHandler(sessions, createConnectionId)
+	group.GET("/events", events)
+	group.GET(fmt.Sprintf("/events/:%s", connectProfilePathParamName), events)
+
+	openPoll := e.longPollConnectHandler(ctx, sessions, createConnectionId)
+	group.POST("/poll", openPoll)
+	group.POST(fmt.Sprintf("/poll/:%s", connectProfilePathParamName), openPoll)
+	group.GET(fmt.Sprintf("/poll/:%s", connIdPathParamName), e.longPollHandler(sessions))
+	group.DELETE(fmt.Sprintf("/poll/:%s", connIdPathParamName), longPollCloseHandler(sessions))
+
+	group.POST(fmt.Sprintf("/send/:%s", connIdPathParamName), sendHandler(sessions))
+
+	// Answered by fallbackCORS
+	for _, preflightPath := range []string{"/poll", fmt.Sprintf("/poll/:%s", connIdPathParamName), fmt.Sprintf("/send/:%s", connIdPathParamName)} {
+		group.OPTIONS(preflightPath, func(g *gin.Context) {})
+	}
+}
+
+func sessionAck(session *fallbackSession) map[string]string {
+	return map[string]string{ConnectionIDKey: string(session.id), SessionTokenKey: session.token}
+}
+
+func (e *gatewayEndpoint) sseHandler(sessions *fallbackSessions, createConnectionId func(ctx context.Context) ConnectionID) gin.HandlerFunc {
+	keepAliveInterval := orDefault(e.fallback.SSEKeepAliveInterval, defaultSSEKeepAliveInterval)
+
+	return func(g *gin.Context) {
+		requestContext := g.Request.Context()
+		tracer := otel.Tracer(config.OtelScope)
+		requestContext, span := tracer.Start(requestContext, "new-sse-connection")
+		defer span.End()
+
+		appConn, accepted := acceptConnection(g, requestContext, e.router, e.wsConns, transportSSE, createConnectionId)
+		if !accepted {
+			return
+		}
+		logger := zerolog.Ctx(requestContext).With().Str(ConnectionIDKey, string(appConn.id)).Logger()
+
+		session, sessionErr := newFallbackSession(appConn.id)
+		if sessionErr != nil {
+			logger.Error().Err(sessionErr).Msg("failed to create session")
+			g.AbortWithStatus(http.StatusInternalServerError)
+			handleClientDisconnected(requestContext, stripWSUpgradeHeaders(g.Request.Header), appConn, logger)
+			return
+		}
+		transport := newSSEIO(session, g.Writer)
+		sessions.add(transport)
+
+		defer func() {
+			sessions.remove(appConn.id)
+			// The request is over by now: the callback must not be cancelled along with it
+			clientDisconnectCtx, clientDisconnectSpan := tracer.Start(context.WithoutCancel(requestContext), "new-sse-disconnect")
+			defer clientDisconnectSpan.End()
+			handleClientDisconnected(clientDisconnectCtx, stripWSUpgradeHeaders(g.Request.Header), appConn, logger)
+		}()
+
+		g.Header("Content-Type", "text/event-stream")
+		g.Header("Cache-Control", "no-cache")
+		// Keeps nginx from buffering the stream
+		g.Header("X-Accel-Buffering", "no")
+		g.Status(http.StatusOK)
+
+		ack, _ := json.Marshal(sessionAck(session))
+		if ackErr := transport.writeEvent(requestContext, "session", string(ack)); ackErr != nil {
+			logger.Info().Err(ackErr).Msg("failed to send session event")
+			return
+		}
+
+		go func() {
+			ticker := time.NewTicker(keepAliveInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-requestContext.Done():
+					return
+				case <-session.closed:
+					return
+				case <-ticker.C:
+					if keepAliveErr := transport.keepAlive(); keepAliveErr != nil {
+						return
+					}
+				}
+			}
+		}()
+
+		// The frames are traced in spans of their own, linked to that of the connect request
+		span.End()
+		closedErr := e.wsConns.processMessages(requestContext, appConn, transport, handleClientMessage(appConn, e.router))
+		logger.Debug().Err(closedErr).Msg("event stream finished")
+	}
+}
+
+// longPollConnectHandler accepts the connection and answers with its ID and session token. The connection
+// lives on, beyond the request, until the client closes it or stops polling.
+func (e *gatewayEndpoint) longPollConnectHandler(ctx context.Context, sessions *fallbackSessions, createConnectionId func(ctx context.Context) ConnectionID) gin.HandlerFunc {
+	sessionTimeout := orDefault(e.fallback.LongPollSessionTimeout, defaultLongPollSessionTimeout)
+
+	return func(g *gin.Context) {
+		requestContext := g.Request.Context()
+		tracer := otel.Tracer(config.OtelScope)
+		requestContext, span := tracer.Start(requestContext, "new-long-poll-connection")
+		defer span.End()
+
+		appConn, accepted := acceptConnection(g, requestContext, e.router, e.wsConns, transportLongPoll, createConnectionId)
+		if !accepted {
+			return
+		}
+		logger := zerolog.Ctx(requestContext).With().Str(ConnectionIDKey, string(appConn.id)).Logger()
+		connReqHeader := stripWSUpgradeHeaders(g.Request.Header)
+
+		session, sessionErr := newFallbackSession(appConn.id)
+		if sessionErr != nil {
+			logger.Error().Err(sessionErr).Msg("failed to create session")
+			g.AbortWithStatus(http.StatusInternalServerError)
+			handleClientDisconnected(requestContext, connReqHeader, appConn, logger)
+			return
+		}
+		transport := &longPollIO{fallbackSession: session, outbox: make(chan string, longPollOutboxSize)}
+		transport.lastPolled.Store(time.Now().UnixNano())
+		sessions.add(transport)
+
+		// The connection outlives the request, but not the server
+		sessionCtx := logger.WithContext(ctx)
+		go transport.expireIdle(sessionTimeout)
+		go func() {
+			defer func() {
+				sessions.remove(appConn.id)
+				clientDisconnectCtx, clientDisconnectSpan := tracer.Start(sessionCtx, "new-long-poll-disconnect")
+				defer clientDisconnectSpan.End()
+				handleClientDisconnected(clientDisconnectCtx, connReqHeader, appConn, logger)
+			}()
+			closedErr := e.wsConns.processMessages(sessionCtx, appConn, transport, handleClientMessage(appConn, e.router))
+			logger.Debug().Err(closedErr).Msg("long-polling session finished")
+		}()
+
+		g.JSON(http.StatusOK, sessionAck(session))
+	}
+}
+
+// longPollHandler answers with the JSON array of the messages to the client, empty if none came within the poll
+// timeout, or with `410` and the close code and reason once the connection is closed
+func (e *gatewayEndpoint) longPollHandler(sessions *fallbackSessions) gin.HandlerFunc {
+	pollTimeout := orDefault(e.fallback.LongPollTimeout, defaultLongPollTimeout)
+
+	return func(g *gin.Context) {
+		transport, authErr := sessions.authorize(g)
+		if authErr != nil {
+			abortWithSessionError(g, authErr)
+			return
+		}
+		longPoll, ok := transport.(*longPollIO)
+		if !ok {
+			g.AbortWithStatus(http.StatusConflict)
+			return
+		}
+		messages, pollErr := longPoll.poll(g.Request.Context(), pollTimeout)
+		if errors.Is(pollErr, errSessionClosed) {
+			g.JSON(http.StatusGone, map[string]any{"code": longPoll.closeErr.Code, "reason": longPoll.closeErr.Reason})
+			return
+		}
+		if pollErr != nil {
+			return
+		}
+		g.JSON(http.StatusOK, messages)
+	}
+}
+
+func longPollCloseHandler(sessions *fallbackSessions) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		transport, authErr := sessions.authorize(g)
+		if authErr != nil {
+			abortWithSessionError(g, authErr)
+			return
+		}
+		transport.session().end(websocket.StatusNormalClosure, "")
+		g.Status(http.StatusNoContent)
+	}
+}
+
+// sendHandler relays the body of the request to the connection as a message of the client
+func sendHandler(sessions *fallbackSessions) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		transport, authErr := sessions.authorize(g)
+		if authErr != nil {
+			abortWithSessionError(g, authErr)
+			return
+		}
+		body, readErr := io.ReadAll(http.MaxBytesReader(g.Writer, g.Request.Body, maxFallbackClientMessageSize))
+		if readErr != nil {
+			g.AbortWithStatus(http.StatusRequestEntityTooLarge)
+			return
+		}
+		if sendErr := transport.session().send(g.Request.Context(), string(body)); sendErr != nil {
+			abortWithSessionError(g, sendErr)
+			return
+		}
+		g.Status(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,87 @@
+package wsgw
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"wsgw/internal/config"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const traceParentKey = "traceparent"
+
+// The frames of a connection are traced in spans of their own, linked to the span of the connect request,
+// so that the traces of long-lived connections don't grow without bounds. A client frame starts a new trace,
+// unless it carries the traceparent of the client in its JSON envelope. A pushed message continues the trace
+// of its push.
+
+// startClientFrameSpan starts the span of a frame of the client. If traceContextField is set and the frame is
+// a JSON object with a traceparent in that field, the span continues the trace of the client.
+func startClientFrameSpan(ctx context.Context, conn *connection, traceContextField string, msg string) (context.Context, trace.Span) {
+	options := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(attribute.String("connection_id", string(conn.id))),
+	}
+	if conn.spanContext.IsValid() {
+		options = append(options, trace.WithLinks(trace.Link{SpanContext: conn.spanContext}))
+	}
+
+	if clientCtx, found := clientTraceContext(ctx, traceContextField, msg); found {
+		ctx = clientCtx
+	} else {
+		options = append(options, trace.WithNewRoot())
+	}
+	return otel.Tracer(config.OtelScope).Start(ctx, "ws-client-message", options...)
+}
+
+// clientTraceContext extracts the traceparent from the traceContextField of the JSON envelope of the frame
+func clientTraceContext(ctx context.Context, traceContextField string, msg string) (context.Context, bool) {
+	if len(traceContextField) == 0 || !strings.HasPrefix(strings.TrimSpace(msg), "{") {
+		return ctx, false
+	}
+	var envelope map[string]json.RawMessage
+	if json.Unmarshal([]byte(msg), &envelope) != nil {
+		return ctx, false
+	}
+	var traceParent string
+	if json.Unmarshal(envelope[traceContextField], &traceParent) != nil || len(traceParent) == 0 {
+		return ctx, false
+	}
+	// The field holds a W3C traceparent, whatever the propagators of the backend calls
+	clientCtx := propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{traceParentKey: traceParent})
+	spanContext := trace.SpanContextFromContext(clientCtx)
+	return clientCtx, spanContext.IsValid() && spanContext.IsRemote()
+}
+
+// startPushWriteSpan starts the span of the write of a pushed message to the client, as a child of the span
+// of its push if any
+func startPushWriteSpan(ctx context.Context, conn *connection, msg pushedMessage) (context.Context, trace.Span) {
+	options := []trace.SpanStartOption{
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(attribute.String("connection_id", string(conn.id))),
+	}
+	if conn.spanContext.IsValid() {
+		options = append(options, trace.WithLinks(trace.Link{SpanContext: conn.spanContext}))
+	}
+
+	if msg.spanContext.IsValid() {
+		ctx = trace.ContextWithSpanContext(ctx, msg.spanContext)
+	} else {
+		options = append(options, trace.WithNewRoot())
+	}
+	return otel.Tracer(config.OtelScope).Start(ctx, "ws-push-write", options...)
+}
+
+// endSpan ends the span of a frame, recording the error the frame failed with
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,187 @@
+package wsgw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"wsgw/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/quic-go/webtransport-go"
+)
+
+// connectionIdNamespaceSeparator separates the name of the gateway endpoint from the rest of the connection ID
+const connectionIdNamespaceSeparator = "."
+
+// gatewayEndpoint is a connect path of wsgw with the backend, the connections and the push path of its own.
+// The push path and the paths of the fallback transports and WebTransport are under the path prefix of the endpoint.
+type gatewayEndpoint struct {
+	// name is empty for the default endpoint
+	name           string
+	connectPath    string
+	pathPrefix     string
+	pushPath       string
+	router         *backendRouter
+	wsConns        *wsConnections
+	originPatterns *allowedOrigins
+	ackNewConnId   bool
+	fallback       config.FallbackTransportsConfig
+}
+
+// allowedOrigins are the origin patterns accepted in the handshakes of an endpoint, replaced on configuration reloads
+type allowedOrigins struct {
+	patterns atomic.Pointer[[]string]
+}
+
+func newAllowedOrigins(patterns []string) *allowedOrigins {
+	origins := &allowedOrigins{}
+	origins.set(patterns)
+	return origins
+}
+
+func (o *allowedOrigins) get() []string {
+	return *o.patterns.Load()
+}
+
+func (o *allowedOrigins) set(patterns []string) {
+	o.patterns.Store(&patterns)
+}
+
+// owns tells whether the connection ID was issued by the endpoint. The IDs of the default endpoint
+// are those not namespaced with the name of any of the named endpoints.
+func (e *gatewayEndpoint) owns(connId ConnectionID, endpointNames map[string]bool) bool {
+	namespace, _, namespaced := strings.Cut(string(connId), connectionIdNamespaceSeparator)
+	if len(e.name) > 0 {
+		return namespaced && namespace == e.name
+	}
+	return !namespaced || !endpointNames[namespace]
+}
+
+// register registers the routes of the endpoint; webTransport is nil unless WebTransport is enabled
+func (e *gatewayEndpoint) register(ctx context.Context, clientEngine *gin.Engine, adminEngine *gin.Engine, webTransport *webtransport.Server, createConnectionId func(ctx context.Context) ConnectionID, endpointNames map[string]bool) error {
+	if len(e.name) > 0 {
+		baseCreateConnectionId := createConnectionId
+		createConnectionId = func(ctx context.Context) ConnectionID {
+			return ConnectionID(e.name + connectionIdNamespaceSeparator + string(baseCreateConnectionId(ctx)))
+		}
+	}
+
+	connect := connectHandler(e.router, e.wsConns, e.originPatterns, createConnectionId, e.ackNewConnId)
+	clientEngine.GET(e.connectPath, connect)
+	// The path of the connect request may select the backend profile of the connection
+	clientEngine.GET(fmt.Sprintf("%s/:%s", e.connectPath, connectProfilePathParamName), connect)
+	// The WebSockets over HTTP/2 are opened with extended CONNECT requests (RFC 8441)
+	clientEngine.Handle(http.MethodConnect, e.connectPath, connect)
+	clientEngine.Handle(http.MethodConnect, fmt.Sprintf("%s/:%s", e.connectPath, connectProfilePathParamName), connect)
+
+	if e.fallback.Enabled {
+		e.registerFallbackTransports(ctx, clientEngine, createConnectionId)
+	}
+	if webTransport != nil {
+		e.registerWebTransport(clientEngine, webTransport, createConnectionId)
+	}
+
+	owns := func(connId ConnectionID) bool { return e.owns(connId, endpointNames) }
+	adminEngine.POST(fmt.Sprintf("%s/:%s", e.pushPath, connIdPathParamName), pushHandler(e.wsConns, owns))
+	adminEngine.GET(fmt.Sprintf("%s%s/:%s", e.pathPrefix, ConnectionsPath, connIdPathParamName), connectionDetailsHandler(e.wsConns, owns))
+
+	// The upstreams of the endpoint share the source of the pushes, so it is enough to consume from one of them
+	if source, ok := e.router.defaultUpstream.(pushSource); ok {
+		return source.consumePushes(ctx, e.wsConns, owns)
+	}
+	return nil
+}
+
+// closeGatewayEndpoints releases what the gateway endpoints hold beyond their connections
+func closeGatewayEndpoints(endpoints []*gatewayEndpoint) error {
+	var closeErr error
+	for _, endpoint := range endpoints {
+		closeErr = errors.Join(closeErr, endpoint.wsConns.stopObserving())
+	}
+	return closeErr
+}
+
+// newGatewayEndpoints creates the default gateway endpoint and the named ones configured.
+// The default endpoint is left out if only named endpoints have a backend configured.
+func newGatewayEndpoints(ctx context.Context, configuration config.Config, audit *auditLog, events *lifecycleNotifier) (endpoints []*gatewayEndpoint, err error) {
+	defer func() {
+		if err != nil {
+			_ = closeGatewayEndpoints(endpoints)
+		}
+	}()
+	observability := connectionsObservability{
+		// The cap on the values of the metric dimensions applies to all the endpoints, as they share the metrics
+		dimensions:        newMetricDimensions(configuration.MetricsConnectionAttributes, configuration.MetricsAttributeMaxValues),
+		traceContextField: configuration.TraceContextField,
+		audit:             audit,
+		events:            events,
+	}
+
+	httpUpstream := orDefault(configuration.BackendUpstream, string(httpUpstreamMode)) == string(httpUpstreamMode)
+	hasDefaultBackend := !httpUpstream || len(configuration.AppBaseUrl) > 0 || len(configuration.Upstreams.BaseUrls) > 0 || len(configuration.Routing.Profiles) > 0
+	if hasDefaultBackend || len(configuration.Endpoints) == 0 {
+		defaultRouter, routerErr := newBackendRouter(ctx, configuration)
+		if routerErr != nil {
+			return nil, routerErr
+		}
+		endpoints = append(endpoints, &gatewayEndpoint{
+			connectPath:    string(ConnectPath),
+			pushPath:       string(MessagePath),
+			router:         defaultRouter,
+			wsConns:        newWsConnections("", 0, 0, configuration.WebSocketKeepalive, observability),
+			originPatterns: newAllowedOrigins(defaultOriginPatterns(configuration)),
+			ackNewConnId:   configuration.AckNewConnWithConnId,
+			fallback:       configuration.FallbackTransports,
+		})
+	}
+
+	for _, endpointConfig := range configuration.Endpoints {
+		if len(endpointConfig.Name) == 0 || strings.ContainsAny(endpointConfig.Name, connectionIdNamespaceSeparator+"/") {
+			return nil, fmt.Errorf("invalid gateway endpoint name %q", endpointConfig.Name)
+		}
+		if httpUpstream && len(endpointConfig.AppBaseUrls) == 0 {
+			return nil, fmt.Errorf("no backend base URL is configured for the gateway endpoint %q", endpointConfig.Name)
+		}
+
+		router, routerErr := newBackendRouter(ctx, endpointConfiguration(configuration, endpointConfig))
+		if routerErr != nil {
+			return nil, fmt.Errorf("gateway endpoint %q: %w", endpointConfig.Name, routerErr)
+		}
+		endpoints = append(endpoints, &gatewayEndpoint{
+			name:           endpointConfig.Name,
+			connectPath:    orDefault(endpointConfig.ConnectPath, fmt.Sprintf("/%s%s", endpointConfig.Name, ConnectPath)),
+			pathPrefix:     "/" + endpointConfig.Name,
+			pushPath:       fmt.Sprintf("/%s%s", endpointConfig.Name, MessagePath),
+			router:         router,
+			wsConns:        newWsConnections(endpointConfig.Name, endpointConfig.MessageBuffer, endpointConfig.MaxConnections, configuration.WebSocketKeepalive, observability),
+			originPatterns: newAllowedOrigins(endpointConfig.AllowedOrigins),
+			ackNewConnId:   endpointConfig.AckNewConnWithConnId,
+			fallback:       configuration.FallbackTransports,
+		})
+	}
+	return endpoints, nil
+}
+
+// defaultOriginPatterns are the origin patterns of the default gateway endpoint
+func defaultOriginPatterns(configuration config.Config) []string {
+	return []string{configuration.LoadBalancerAddress}
+}
+
+// endpointConfiguration derives the configuration of the backend of a named gateway endpoint from the global one:
+// the transport, callback, retry and breaker settings are shared, the backend URLs, the NATS subjects, the gRPC stream
+// and the routing are not.
+func endpointConfiguration(configuration config.Config, endpointConfig config.GatewayEndpointConfig) config.Config {
+	derived := configuration
+	derived.AppBaseUrl = ""
+	derived.Upstreams.BaseUrls = endpointConfig.AppBaseUrls
+	derived.Routing = config.RoutingConfig{}
+	derived.Nats.SubjectPrefix = fmt.Sprintf("%s.%s", orDefault(derived.Nats.SubjectPrefix, defaultNatsSubjectPrefix), endpointConfig.Name)
+	derived.GrpcUpstream.Endpoint = endpointConfig.Name
+	if len(derived.Disconnects.OutboxFile) > 0 {
+		derived.Disconnects.OutboxFile = fmt.Sprintf("%s.%s", derived.Disconnects.OutboxFile, endpointConfig.Name)
+	}
+	return derived
+}
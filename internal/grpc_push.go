@@ -0,0 +1,211 @@
+package wsgw
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"wsgw/pkgs/monitoring"
+	"wsgw/pkgs/pushapi"
+
+	"github.com/coder/websocket"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// grpcContentType is the content type of the gRPC requests, with or without a subtype such as `+proto`
+const grpcContentType = "application/grpc"
+
+// pushService serves the gRPC push API off the connections of the gateway endpoints
+type pushService struct {
+	pushapi.UnimplementedPushServiceServer
+	endpoints     []*gatewayEndpoint
+	endpointNames map[string]bool
+}
+
+func newGrpcPushServer(endpoints []*gatewayEndpoint, endpointNames map[string]bool) *grpc.Server {
+	server := grpc.NewServer()
+	pushapi.RegisterPushServiceServer(server, &pushService{endpoints: endpoints, endpointNames: endpointNames})
+	return server
+}
+
+// connectionEndpoint returns the gateway endpoint owning the connection ID
+func (s *pushService) connectionEndpoint(connId ConnectionID) (*gatewayEndpoint, error) {
+	if len(connId) == 0 {
+		return nil, status.Error(codes.InvalidArgument, "missing connection ID")
+	}
+	for _, endpoint := range s.endpoints {
+		if endpoint.owns(connId, s.endpointNames) {
+			return endpoint, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "no gateway endpoint serves connection %s", connId)
+}
+
+// namedEndpoint returns the gateway endpoint with the given name, the default one if the name is empty
+func (s *pushService) namedEndpoint(name string) (*gatewayEndpoint, error) {
+	for _, endpoint := range s.endpoints {
+		if endpoint.name == name {
+			return endpoint, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "unknown gateway endpoint %q", name)
+}
+
+func (s *pushService) push(ctx context.Context, connId ConnectionID, msg string) error {
+	endpoint, endpointErr := s.connectionEndpoint(connId)
+	if endpointErr != nil {
+		return endpointErr
+	}
+	// The write of the message continues the trace the backend may send in the metadata of the call
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		traceData := map[string]string{}
+		for key, values := range md {
+			if len(values) > 0 {
+				traceData[key] = values[0]
+			}
+		}
+		ctx = monitoring.ExtractTraceData(ctx, traceData)
+	}
+	reply := pushReply(ctx, endpoint.wsConns, func(connId ConnectionID) bool { return true }, connId, msg, 0)
+	if reply.Status == http.StatusNoContent {
+		return nil
+	}
+	return status.Error(grpcCode(reply.Status), reply.Error)
+}
+
+func (s *pushService) Push(ctx context.Context, request *pushapi.PushRequest) (*pushapi.PushResponse, error) {
+	if pushErr := s.push(ctx, ConnectionID(request.GetConnectionId()), request.GetMessage()); pushErr != nil {
+		return nil, pushErr
+	}
+	return &pushapi.PushResponse{}, nil
+}
+
+func (s *pushService) PushMany(ctx context.Context, request *pushapi.PushManyRequest) (*pushapi.PushManyResponse, error) {
+	results := make([]*pushapi.PushResult, len(request.GetConnectionIds()))
+	for i, connId := range request.GetConnectionIds() {
+		pushErr := s.push(ctx, ConnectionID(connId), request.GetMessage())
+		results[i] = &pushapi.PushResult{
+			ConnectionId: connId,
+			Code:         int32(status.Code(pushErr)),
+		}
+		if pushErr != nil {
+			results[i].Error = status.Convert(pushErr).Message()
+		}
+	}
+	return &pushapi.PushManyResponse{Results: results}, nil
+}
+
+func (s *pushService) Close(ctx context.Context, request *pushapi.CloseRequest) (*pushapi.CloseResponse, error) {
+	connId := ConnectionID(request.GetConnectionId())
+	endpoint, endpointErr := s.connectionEndpoint(connId)
+	if endpointErr != nil {
+		return nil, endpointErr
+	}
+	code := websocket.StatusCode(request.GetCode())
+	if code == 0 {
+		code = websocket.StatusNormalClosure
+	}
+	closeErr := endpoint.wsConns.close(connId, code, request.GetReason())
+	if errors.Is(closeErr, errConnectionNotFound) {
+		return nil, status.Error(codes.NotFound, closeErr.Error())
+	}
+	if closeErr != nil {
+		return nil, status.Error(codes.Internal, closeErr.Error())
+	}
+	var remoteAddress string
+	if caller, ok := peer.FromContext(ctx); ok {
+		remoteAddress = caller.Addr.String()
+	}
+	endpoint.wsConns.audit.admin(ctx, "connection_close_requested", remoteAddress, map[string]string{
+		ConnectionIDKey: string(connId),
+		"closeCode":     strconv.Itoa(int(code)),
+		"closeReason":   request.GetReason(),
+	})
+	return &pushapi.CloseResponse{}, nil
+}
+
+func (s *pushService) ListConnections(_ context.Context, request *pushapi.ListConnectionsRequest) (*pushapi.ListConnectionsResponse, error) {
+	endpoint, endpointErr := s.namedEndpoint(request.GetEndpoint())
+	if endpointErr != nil {
+		return nil, endpointErr
+	}
+	conns := endpoint.wsConns.list()
+	response := &pushapi.ListConnectionsResponse{Connections: make([]*pushapi.Connection, len(conns))}
+	for i, conn := range conns {
+		response.Connections[i] = &pushapi.Connection{
+			ConnectionId: string(conn.id),
+			ConnectedAt:  timestamppb.New(conn.connectedAt),
+		}
+	}
+	return response, nil
+}
+
+// WatchConnections streams the connects and disconnects until the client goes away. A client not keeping up
+// with the events gets RESOURCE_EXHAUSTED, as it would otherwise miss some of them.
+func (s *pushService) WatchConnections(request *pushapi.WatchConnectionsRequest, stream pushapi.PushService_WatchConnectionsServer) error {
+	endpoint, endpointErr := s.namedEndpoint(request.GetEndpoint())
+	if endpointErr != nil {
+		return endpointErr
+	}
+	events, stop := endpoint.wsConns.watch()
+	defer stop()
+	// Lets the client know when the events start to be watched
+	if headerErr := stream.SendHeader(metadata.MD{}); headerErr != nil {
+		return headerErr
+	}
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, ok := <-events:
+			if !ok {
+				return status.Error(codes.ResourceExhausted, "the watcher fell behind")
+			}
+			eventType := pushapi.ConnectionEvent_TYPE_DISCONNECTED
+			if event.connected {
+				eventType = pushapi.ConnectionEvent_TYPE_CONNECTED
+			}
+			sendErr := stream.Send(&pushapi.ConnectionEvent{
+				Type:         eventType,
+				ConnectionId: string(event.id),
+				Timestamp:    timestamppb.New(event.at),
+			})
+			if sendErr != nil {
+				return sendErr
+			}
+		}
+	}
+}
+
+// grpcCode maps the HTTP status of a push to the corresponding gRPC code
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusForbidden:
+		return codes.PermissionDenied
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusServiceUnavailable:
+		return codes.Unavailable
+	default:
+		return codes.Internal
+	}
+}
+
+// withGrpc serves the gRPC requests with the gRPC server and the rest with the handler
+func withGrpc(handler http.Handler, grpcServer *grpc.Server) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), grpcContentType) {
+			grpcServer.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
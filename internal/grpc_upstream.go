@@ -0,0 +1,352 @@
+package wsgw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+	"wsgw/internal/config"
+	loadmanagement "wsgw/pkgs/loadmanegement"
+	"wsgw/pkgs/monitoring"
+	"wsgw/pkgs/upstreamapi"
+
+	"github.com/coder/websocket"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+const (
+	defaultGrpcUpstreamRequestTimeout      = 5 * time.Second
+	defaultGrpcUpstreamSendBuffer          = 1024
+	defaultGrpcUpstreamPushTimeout         = time.Second
+	defaultGrpcUpstreamReconnectMinBackoff = 100 * time.Millisecond
+	defaultGrpcUpstreamReconnectMaxBackoff = 10 * time.Second
+)
+
+// errGrpcStreamDown is returned for the events which can't be sent because the stream is being reopened
+var errGrpcStreamDown = errors.New("backend stream down")
+
+// grpcPushTarget is where the pushes of the backend go
+type grpcPushTarget struct {
+	ws   *wsConnections
+	owns func(connId ConnectionID) bool
+}
+
+// grpcStream is the long-lived bidirectional stream carrying the events of the connections of a gateway endpoint
+// to the backend and the commands of the backend back. The stream is reopened with backoff whenever it ends.
+//
+// The events wait in a bounded buffer for the stream, so a slow backend holds up the reads of the clients. The
+// pushes wait for room in the buffer of their connection, so a slow client holds up the reads of the stream and,
+// through the HTTP/2 flow control, the backend.
+type grpcStream struct {
+	client   upstreamapi.UpstreamServiceClient
+	metadata metadata.MD
+	events   chan *upstreamapi.GatewayEvent
+	up       atomic.Bool
+	nextId   atomic.Uint64
+	target   atomic.Pointer[grpcPushTarget]
+
+	pendingMux sync.Mutex
+	// pending are the Connect events waiting for their ConnectResult
+	pending map[uint64]chan *upstreamapi.ConnectResult
+
+	requestTimeout time.Duration
+	pushTimeout    time.Duration
+	reconnect      retryPolicy
+}
+
+func newGrpcStream(ctx context.Context, configuration config.Config) (*grpcStream, error) {
+	upstreamConfig := configuration.GrpcUpstream
+	if len(upstreamConfig.Target) == 0 {
+		return nil, errors.New("no gRPC upstream target is configured")
+	}
+
+	tlsConfig, tlsErr := newBackendTLSConfig(configuration.BackendTransport, configuration.TLSMinVersion)
+	if tlsErr != nil {
+		return nil, tlsErr
+	}
+	transportCredentials := insecure.NewCredentials()
+	if tlsConfig != nil {
+		transportCredentials = credentials.NewTLS(tlsConfig)
+	} else if upstreamConfig.TLS {
+		transportCredentials = credentials.NewTLS(nil)
+	}
+	conn, dialErr := grpc.NewClient(upstreamConfig.Target, grpc.WithTransportCredentials(transportCredentials))
+	if dialErr != nil {
+		return nil, fmt.Errorf("failed to create the gRPC upstream client: %w", dialErr)
+	}
+
+	md := metadata.Pairs("x-wsgw-instance-id", config.GetInstanceId())
+	if len(upstreamConfig.Endpoint) > 0 {
+		md.Set("x-wsgw-endpoint", upstreamConfig.Endpoint)
+	}
+
+	stream := &grpcStream{
+		client:         upstreamapi.NewUpstreamServiceClient(conn),
+		metadata:       md,
+		events:         make(chan *upstreamapi.GatewayEvent, orDefault(upstreamConfig.SendBuffer, defaultGrpcUpstreamSendBuffer)),
+		pending:        make(map[uint64]chan *upstreamapi.ConnectResult),
+		requestTimeout: orDefault(upstreamConfig.RequestTimeout, defaultGrpcUpstreamRequestTimeout),
+		pushTimeout:    orDefault(upstreamConfig.PushTimeout, defaultGrpcUpstreamPushTimeout),
+		reconnect: retryPolicy{
+			initialBackoff: orDefault(upstreamConfig.ReconnectMinBackoff, defaultGrpcUpstreamReconnectMinBackoff),
+			maxBackoff:     orDefault(upstreamConfig.ReconnectMaxBackoff, defaultGrpcUpstreamReconnectMaxBackoff),
+		},
+	}
+	go func() {
+		stream.run(ctx)
+		_ = conn.Close()
+	}()
+	return stream, nil
+}
+
+// run keeps the stream open until ctx is done
+func (s *grpcStream) run(ctx context.Context) {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "grpcStream").Logger()
+	failures := 0
+	for {
+		opened, streamErr := s.serve(ctx, logger)
+		if ctx.Err() != nil {
+			return
+		}
+		if opened {
+			failures = 0
+		}
+		failures++
+		backoff := s.reconnect.backoff(failures)
+		logger.Warn().Err(streamErr).Dur("backoff", backoff).Msg("backend stream ended, reopening")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+	}
+}
+
+// serve opens the stream and relays the events and the commands until the stream fails
+func (s *grpcStream) serve(ctx context.Context, logger zerolog.Logger) (bool, error) {
+	streamCtx, cancel := context.WithCancel(metadata.NewOutgoingContext(ctx, s.metadata))
+	defer cancel()
+
+	stream, openErr := s.client.Events(streamCtx)
+	if openErr != nil {
+		return false, openErr
+	}
+	s.up.Store(true)
+	logger.Info().Msg("backend stream open")
+	defer func() {
+		s.up.Store(false)
+		s.failPending()
+	}()
+
+	sendErr := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case <-streamCtx.Done():
+				sendErr <- streamCtx.Err()
+				return
+			case event := <-s.events:
+				if err := stream.Send(event); err != nil {
+					logger.Info().Err(err).Uint64("event", event.GetId()).Msg("failed to send event")
+					sendErr <- err
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		command, recvErr := stream.Recv()
+		if recvErr != nil {
+			cancel()
+			return true, errors.Join(recvErr, <-sendErr)
+		}
+		s.handle(streamCtx, logger, command)
+	}
+}
+
+func (s *grpcStream) handle(ctx context.Context, logger zerolog.Logger, command *upstreamapi.BackendCommand) {
+	switch cmd := command.GetCommand().(type) {
+	case *upstreamapi.BackendCommand_ConnectResult:
+		s.pendingMux.Lock()
+		result, ok := s.pending[cmd.ConnectResult.GetId()]
+		delete(s.pending, cmd.ConnectResult.GetId())
+		s.pendingMux.Unlock()
+		if ok {
+			result <- cmd.ConnectResult
+		}
+	case *upstreamapi.BackendCommand_Push:
+		connId := ConnectionID(cmd.Push.GetConnectionId())
+		reply := natsReply{Status: http.StatusNotFound, Error: errConnectionNotFound.Error()}
+		if target := s.target.Load(); target != nil {
+			pushCtx := monitoring.ExtractTraceData(ctx, cmd.Push.GetTraceData())
+			reply = pushReply(pushCtx, target.ws, target.owns, connId, cmd.Push.GetMessage(), s.pushTimeout)
+		}
+		if reply.Status != http.StatusNoContent {
+			logger.Info().Str(ConnectionIDKey, string(connId)).Int("status", reply.Status).Msg("push failed")
+		}
+		if cmd.Push.GetId() == 0 {
+			return
+		}
+		result := &upstreamapi.GatewayEvent{Event: &upstreamapi.GatewayEvent_PushResult{PushResult: &upstreamapi.PushResult{
+			Id:     cmd.Push.GetId(),
+			Status: int32(reply.Status),
+			Error:  reply.Error,
+		}}}
+		if sendErr := s.send(ctx, result); sendErr != nil {
+			logger.Info().Err(sendErr).Msg("failed to send push result")
+		}
+	case *upstreamapi.BackendCommand_Close:
+		connId := ConnectionID(cmd.Close.GetConnectionId())
+		target := s.target.Load()
+		if target == nil || !target.owns(connId) {
+			logger.Info().Str(ConnectionIDKey, string(connId)).Msg("close of an unknown connection")
+			return
+		}
+		code := websocket.StatusCode(cmd.Close.GetCode())
+		if code == 0 {
+			code = websocket.StatusNormalClosure
+		}
+		if closeErr := target.ws.close(connId, code, cmd.Close.GetReason()); closeErr != nil {
+			logger.Info().Err(closeErr).Str(ConnectionIDKey, string(connId)).Msg("failed to close connection")
+		}
+	default:
+		logger.Warn().Msgf("unknown command %T", cmd)
+	}
+}
+
+// send queues the event for the stream, waiting for room in the buffer until ctx is done
+func (s *grpcStream) send(ctx context.Context, event *upstreamapi.GatewayEvent) error {
+	select {
+	case s.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// failPending fails the Connect events still waiting for their result, as the results won't come on a new stream
+func (s *grpcStream) failPending() {
+	s.pendingMux.Lock()
+	defer s.pendingMux.Unlock()
+	for id, result := range s.pending {
+		close(result)
+		delete(s.pending, id)
+	}
+}
+
+// request sends the Connect event and waits for its result
+func (s *grpcStream) request(ctx context.Context, event *upstreamapi.GatewayEvent) (*upstreamapi.ConnectResult, error) {
+	event.Id = s.nextId.Add(1)
+	result := make(chan *upstreamapi.ConnectResult, 1)
+	s.pendingMux.Lock()
+	s.pending[event.Id] = result
+	s.pendingMux.Unlock()
+	defer func() {
+		s.pendingMux.Lock()
+		delete(s.pending, event.Id)
+		s.pendingMux.Unlock()
+	}()
+
+	ctx, cancel := context.WithTimeout(ctx, s.requestTimeout)
+	defer cancel()
+	if sendErr := s.send(ctx, event); sendErr != nil {
+		return nil, sendErr
+	}
+	select {
+	case connectResult, ok := <-result:
+		if !ok {
+			return nil, errGrpcStreamDown
+		}
+		return connectResult, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// grpcUpstream carries the events of the connections of a backend profile on the stream of the gateway endpoint
+type grpcUpstream struct {
+	stream  *grpcStream
+	profile string
+}
+
+func (u *grpcUpstream) connecting(ctx context.Context, r *http.Request, connId ConnectionID) (connectionAttributes, error) {
+	logger := zerolog.Ctx(r.Context()).With().Str(ConnectionIDKey, string(connId)).Logger()
+
+	if !u.stream.up.Load() {
+		logger.Info().Msg("backend stream down, rejecting connection")
+		return nil, loadmanagement.OverloadError{RetryAfter: u.stream.reconnect.initialBackoff, Reason: errGrpcStreamDown.Error()}
+	}
+
+	connectResult, requestErr := u.stream.request(ctx, &upstreamapi.GatewayEvent{Event: &upstreamapi.GatewayEvent_Connect{Connect: &upstreamapi.Connect{
+		ConnectionId: string(connId),
+		Profile:      u.profile,
+		Header:       toGrpcHeader(stripWSUpgradeHeaders(r.Header)),
+	}}})
+	if requestErr != nil {
+		logger.Error().Err(requestErr).Msg("failed to send connect event")
+		return nil, errAppConnInternal
+	}
+	return limitConnectionAttributes(connectResult.GetAttributes()), connectStatusError(logger, int(connectResult.GetStatus()))
+}
+
+func (u *grpcUpstream) message(ctx context.Context, connId ConnectionID, msg string) error {
+	if !u.stream.up.Load() {
+		return backendUnavailableError{retryAfter: u.stream.reconnect.initialBackoff}
+	}
+	ctx, cancel := context.WithTimeout(ctx, u.stream.requestTimeout)
+	defer cancel()
+	sendErr := u.stream.send(ctx, &upstreamapi.GatewayEvent{Event: &upstreamapi.GatewayEvent_Message{Message: &upstreamapi.Message{
+		ConnectionId: string(connId),
+		Profile:      u.profile,
+		Message:      msg,
+		TraceData:    monitoring.InjectTraceData(ctx),
+	}}})
+	if sendErr != nil {
+		zerolog.Ctx(ctx).Error().Err(sendErr).Str(ConnectionIDKey, string(connId)).Msg("failed to send message")
+		return backendUnavailableError{retryAfter: u.stream.requestTimeout}
+	}
+	return nil
+}
+
+// disconnected queues the event even while the stream is down, so that it is sent once the stream is reopened
+func (u *grpcUpstream) disconnected(ctx context.Context, header http.Header, connId ConnectionID) {
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), u.stream.requestTimeout)
+	defer cancel()
+	sendErr := u.stream.send(ctx, &upstreamapi.GatewayEvent{Event: &upstreamapi.GatewayEvent_Disconnected{Disconnected: &upstreamapi.Disconnected{
+		ConnectionId: string(connId),
+		Profile:      u.profile,
+		Header:       toGrpcHeader(header),
+	}}})
+	if sendErr != nil {
+		zerolog.Ctx(ctx).Error().Err(sendErr).Str(ConnectionIDKey, string(connId)).Msg("failed to send disconnected event")
+	}
+}
+
+// consumePushes relays the pushes and the closes the backend sends on the stream to the connections
+func (u *grpcUpstream) consumePushes(_ context.Context, ws *wsConnections, owns func(connId ConnectionID) bool) error {
+	u.stream.target.Store(&grpcPushTarget{ws: ws, owns: owns})
+	return nil
+}
+
+func toGrpcHeader(header http.Header) []*upstreamapi.Header {
+	names := make([]string, 0, len(header))
+	for name := range header {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	grpcHeader := make([]*upstreamapi.Header, len(names))
+	for i, name := range names {
+		grpcHeader[i] = &upstreamapi.Header{Name: name, Values: header[name]}
+	}
+	return grpcHeader
+}
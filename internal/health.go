@@ -0,0 +1,204 @@
+package wsgw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+	"wsgw/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rs/zerolog"
+)
+
+const (
+	// HealthzPath is the liveness probe: wsgw answers as long as the process is alive
+	HealthzPath EndpointPath = "/healthz"
+	// ReadyzPath is the readiness probe: wsgw is ready for new clients while its listeners are up, the backend
+	// answers the probe requests, if enabled, and it isn't draining
+	ReadyzPath EndpointPath = "/readyz"
+)
+
+const (
+	defaultBackendProbeInterval = 10 * time.Second
+	defaultBackendProbeTimeout  = 2 * time.Second
+)
+
+const (
+	checkStatusOk   = "ok"
+	checkStatusFail = "fail"
+)
+
+// healthCheck is the outcome of one of the checks of the readiness probe
+type healthCheck struct {
+	Status    string     `json:"status"`
+	Error     string     `json:"error,omitempty"`
+	CheckedAt *time.Time `json:"checkedAt,omitempty"`
+}
+
+func passedOrFailed(err error) healthCheck {
+	if err != nil {
+		return healthCheck{Status: checkStatusFail, Error: err.Error()}
+	}
+	return healthCheck{Status: checkStatusOk}
+}
+
+// readiness tells whether wsgw is ready for new clients
+type readiness struct {
+	listening atomic.Bool
+	draining  atomic.Bool
+	// drainDelay is how long the instance keeps serving on shutdown once it isn't ready
+	drainDelay time.Duration
+	// backendProbe is nil unless the backend probe is enabled
+	backendProbe *backendProbe
+}
+
+func newReadiness(configuration config.Config) (*readiness, error) {
+	r := &readiness{drainDelay: configuration.Readiness.DrainDelay}
+	if !configuration.Readiness.BackendProbeEnabled {
+		return r, nil
+	}
+
+	probeUrl := configuration.Readiness.BackendProbeURL
+	if len(probeUrl) == 0 {
+		baseUrls := defaultBackendBaseUrls(configuration)
+		connecting, connectingErr := newBackendEndpoint("connect", baseUrls, ConnectPath, http.MethodGet, configuration.BackendEndpoints.Connect, 0)
+		if connectingErr != nil {
+			return nil, connectingErr
+		}
+		if connecting.disabled || len(baseUrls) == 0 {
+			return nil, errors.New("the backend probe has no URL to probe")
+		}
+		probeUrl = connecting.url(baseUrls[0], "")
+	}
+	httpClient, clientErr := newBackendHTTPClient(configuration)
+	if clientErr != nil {
+		return nil, clientErr
+	}
+	r.backendProbe = &backendProbe{
+		url:        probeUrl,
+		method:     strings.ToUpper(orDefault(configuration.Readiness.BackendProbeMethod, http.MethodHead)),
+		interval:   orDefault(configuration.Readiness.BackendProbeInterval, defaultBackendProbeInterval),
+		timeout:    orDefault(configuration.Readiness.BackendProbeTimeout, defaultBackendProbeTimeout),
+		httpClient: httpClient,
+	}
+	return r, nil
+}
+
+// checks returns the checks of the readiness probe, and whether they all passed
+func (r *readiness) checks() (map[string]healthCheck, bool) {
+	checks := map[string]healthCheck{}
+	if r.listening.Load() {
+		checks["listener"] = healthCheck{Status: checkStatusOk}
+	} else {
+		checks["listener"] = healthCheck{Status: checkStatusFail, Error: "the listeners aren't up"}
+	}
+	if r.draining.Load() {
+		checks["draining"] = healthCheck{Status: checkStatusFail, Error: "shutting down"}
+	} else {
+		checks["draining"] = healthCheck{Status: checkStatusOk}
+	}
+	if r.backendProbe != nil {
+		checks["backend"] = r.backendProbe.check()
+	}
+
+	ready := true
+	for _, check := range checks {
+		ready = ready && check.Status == checkStatusOk
+	}
+	return checks, ready
+}
+
+// drain makes the readiness probe fail, then waits for the drain delay, so that the load balancers stop
+// sending new clients before the listeners are closed
+func (r *readiness) drain(ctx context.Context) {
+	if r.draining.Swap(true) || r.drainDelay <= 0 {
+		return
+	}
+	zerolog.Ctx(ctx).Info().Dur("drainDelay", r.drainDelay).Msg("draining...")
+	timer := time.NewTimer(r.drainDelay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+}
+
+// register registers the liveness and readiness probes
+func (r *readiness) register(engine *gin.Engine) {
+	engine.GET(string(HealthzPath), func(g *gin.Context) {
+		g.JSON(http.StatusOK, gin.H{"status": checkStatusOk})
+	})
+	engine.GET(string(ReadyzPath), func(g *gin.Context) {
+		checks, ready := r.checks()
+		if !ready {
+			g.JSON(http.StatusServiceUnavailable, gin.H{"status": "not_ready", "checks": checks})
+			return
+		}
+		g.JSON(http.StatusOK, gin.H{"status": "ready", "checks": checks})
+	})
+}
+
+// backendProbe checks periodically that the backend answers, so that the readiness probe doesn't
+// call the backend on every request
+type backendProbe struct {
+	url        string
+	method     string
+	interval   time.Duration
+	timeout    time.Duration
+	httpClient *http.Client
+	// last is the outcome of the last probe request, nil until the first one completes
+	last atomic.Pointer[healthCheck]
+}
+
+func (p *backendProbe) check() healthCheck {
+	last := p.last.Load()
+	if last == nil {
+		return healthCheck{Status: checkStatusFail, Error: "the backend hasn't been probed yet"}
+	}
+	return *last
+}
+
+// run probes the backend right away, then periodically until ctx is done
+func (p *backendProbe) run(ctx context.Context) {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "backendProbe").Logger()
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+	for {
+		check := passedOrFailed(p.probe(ctx))
+		checkedAt := time.Now().UTC()
+		check.CheckedAt = &checkedAt
+		if previous := p.last.Swap(&check); previous == nil || previous.Status != check.Status {
+			logger.Info().Str("status", check.Status).Str("error", check.Error).Str("url", p.url).Msg("backend probe status changed")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// probe tells whether the backend answers; only a status of 500 or above or no response at all fails the probe,
+// as the connect callback may well reject a request without a client
+func (p *backendProbe) probe(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, p.timeout)
+	defer cancel()
+	request, requestErr := http.NewRequestWithContext(ctx, p.method, p.url, nil)
+	if requestErr != nil {
+		return requestErr
+	}
+	response, responseErr := p.httpClient.Do(request)
+	if responseErr != nil {
+		return responseErr
+	}
+	defer cleanupResponse(response)
+	if response.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("received status code %d", response.StatusCode)
+	}
+	return nil
+}
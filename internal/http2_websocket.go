@@ -0,0 +1,147 @@
+package wsgw
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// extendedConnectProtocolHeader is where net/http puts the :protocol pseudo-header of the extended CONNECT requests
+const extendedConnectProtocolHeader = ":protocol"
+
+// isExtendedConnect tells whether the request opens a WebSocket over an HTTP/2 stream (RFC 8441)
+func isExtendedConnect(r *http.Request) bool {
+	return r.ProtoMajor == 2 && r.Method == http.MethodConnect && strings.EqualFold(r.Header.Get(extendedConnectProtocolHeader), "websocket")
+}
+
+// extendedConnectEnabled tells whether the HTTP/2 servers of net/http and x/net advertise extended CONNECT, which
+// they only do with GODEBUG=http2xconnect=1 (see golang/go#71128)
+func extendedConnectEnabled() bool {
+	return strings.Contains(os.Getenv("GODEBUG"), "http2xconnect=1")
+}
+
+// extendedConnectUpgrade dresses the extended CONNECT request up as the HTTP/1.1 upgrade websocket.Accept expects,
+// and wraps the response writer so that it answers with a 200 and hands the HTTP/2 stream over as the hijacked
+// connection.
+func extendedConnectUpgrade(w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request) {
+	// RFC 8441 does without the key, which only guards HTTP/1.1 intermediaries against the upgrade
+	key := make([]byte, 16)
+	_, _ = rand.Read(key)
+
+	upgrade := r.Clone(r.Context())
+	upgrade.Method = http.MethodGet
+	upgrade.Proto, upgrade.ProtoMajor, upgrade.ProtoMinor = "HTTP/1.1", 1, 1
+	upgrade.Header.Del(extendedConnectProtocolHeader)
+	upgrade.Header.Set("Connection", "Upgrade")
+	upgrade.Header.Set("Upgrade", "websocket")
+	upgrade.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(key))
+
+	return &http2StreamWriter{
+		ResponseWriter: w,
+		body:           r.Body,
+		remoteAddr:     r.RemoteAddr,
+		controller:     http.NewResponseController(w),
+	}, upgrade
+}
+
+// http2StreamWriter is the response writer of an extended CONNECT request
+type http2StreamWriter struct {
+	http.ResponseWriter
+	body       io.ReadCloser
+	remoteAddr string
+	controller *http.ResponseController
+}
+
+func (w *http2StreamWriter) WriteHeader(statusCode int) {
+	if statusCode != http.StatusSwitchingProtocols {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	// The connection-specific headers are forbidden in HTTP/2, and the accept key has no use
+	for _, name := range []string{"Upgrade", "Connection", "Sec-Websocket-Accept"} {
+		w.Header().Del(name)
+	}
+	w.ResponseWriter.WriteHeader(http.StatusOK)
+	_ = w.controller.Flush()
+}
+
+// Hijack hands the stream over: the request body carries the frames of the client, the response those of wsgw
+func (w *http2StreamWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	// The timeouts of the server are meant for the requests, not for the streams living as long as the connection
+	if deadlineErr := w.controller.SetReadDeadline(time.Time{}); deadlineErr != nil {
+		return nil, nil, deadlineErr
+	}
+	if deadlineErr := w.controller.SetWriteDeadline(time.Time{}); deadlineErr != nil {
+		return nil, nil, deadlineErr
+	}
+	conn := &http2StreamConn{writer: w.ResponseWriter, body: w.body, controller: w.controller, remoteAddr: w.remoteAddr}
+	return conn, bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn)), nil
+}
+
+// http2StreamConn is the HTTP/2 stream of a WebSocket as a net.Conn
+type http2StreamConn struct {
+	writeMux   sync.Mutex
+	writer     http.ResponseWriter
+	body       io.ReadCloser
+	controller *http.ResponseController
+	remoteAddr string
+}
+
+func (c *http2StreamConn) Read(b []byte) (int, error) {
+	return c.body.Read(b)
+}
+
+func (c *http2StreamConn) Write(b []byte) (int, error) {
+	c.writeMux.Lock()
+	defer c.writeMux.Unlock()
+	n, writeErr := c.writer.Write(b)
+	if writeErr != nil {
+		return n, writeErr
+	}
+	return n, c.controller.Flush()
+}
+
+// Close stops the reads; the stream ends when the handler of the request returns
+func (c *http2StreamConn) Close() error {
+	return c.body.Close()
+}
+
+func (c *http2StreamConn) LocalAddr() net.Addr {
+	return http2StreamAddr("")
+}
+
+func (c *http2StreamConn) RemoteAddr() net.Addr {
+	return http2StreamAddr(c.remoteAddr)
+}
+
+func (c *http2StreamConn) SetDeadline(t time.Time) error {
+	if deadlineErr := c.SetReadDeadline(t); deadlineErr != nil {
+		return deadlineErr
+	}
+	return c.SetWriteDeadline(t)
+}
+
+func (c *http2StreamConn) SetReadDeadline(t time.Time) error {
+	return c.controller.SetReadDeadline(t)
+}
+
+func (c *http2StreamConn) SetWriteDeadline(t time.Time) error {
+	return c.controller.SetWriteDeadline(t)
+}
+
+type http2StreamAddr string
+
+func (a http2StreamAddr) Network() string {
+	return "http2"
+}
+
+func (a http2StreamAddr) String() string {
+	return string(a)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package wsgw
+
+// EnableExtendedConnect does nothing where the process can't be replaced: WebSockets over HTTP/2 then need
+// GODEBUG=http2xconnect=1 in the environment of wsgw.
+func EnableExtendedConnect() error {
+	return nil
+}
@@ -0,0 +1,31 @@
+//go:build unix
+
+package wsgw
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"syscall"
+)
+
+// EnableExtendedConnect restarts the process with GODEBUG=http2xconnect=1, for net/http and x/net to accept
+// WebSockets over HTTP/2, unless the environment already enables or disables it. The HTTP/2 servers read the
+// setting before main runs, and go.mod can't set it. It only returns, with an error, if the restart fails.
+func EnableExtendedConnect() error {
+	godebug := os.Getenv("GODEBUG")
+	if strings.Contains(godebug, "http2xconnect=") {
+		return nil
+	}
+	executable, executableErr := os.Executable()
+	if executableErr != nil {
+		return fmt.Errorf("failed to restart with extended CONNECT: %w", executableErr)
+	}
+	if len(godebug) > 0 {
+		godebug += ","
+	}
+	if setErr := os.Setenv("GODEBUG", godebug+"http2xconnect=1"); setErr != nil {
+		return fmt.Errorf("failed to restart with extended CONNECT: %w", setErr)
+	}
+	return fmt.Errorf("failed to restart with extended CONNECT: %w", syscall.Exec(executable, os.Args, os.Environ()))
+}
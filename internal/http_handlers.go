@@ -3,23 +3,24 @@ package wsgw
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"net"
+	"math"
 	"net/http"
+	"strconv"
 	"time"
 	"wsgw/internal/config"
 	loadmanagement "wsgw/pkgs/loadmanegement"
 	"wsgw/pkgs/monitoring"
+	"wsgw/pkgs/signing"
 
 	"github.com/coder/websocket"
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
 	"go.opentelemetry.io/otel"
-	"golang.org/x/net/http2"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // TODO: make this configurable?
@@ -40,10 +41,18 @@ func (wsIo *wsIOAdapter) Close() error {
 	return wsIo.wsConn.Close(websocket.StatusPolicyViolation, "connection too slow to keep up with messages")
 }
 
+func (wsIo *wsIOAdapter) CloseWith(code websocket.StatusCode, reason string) error {
+	return wsIo.wsConn.Close(code, reason)
+}
+
 func (wsIo *wsIOAdapter) Write(ctx context.Context, msg string) error {
 	return wsIo.wsConn.Write(ctx, websocket.MessageText, []byte(msg))
 }
 
+func (wsIo *wsIOAdapter) Ping(ctx context.Context) error {
+	return wsIo.wsConn.Ping(ctx)
+}
+
 func (wsIo *wsIOAdapter) Read(ctx context.Context) (string, error) {
 	msgType, msg, err := wsIo.wsConn.Read(ctx)
 	if err != nil {
@@ -55,70 +64,85 @@ func (wsIo *wsIOAdapter) Read(ctx context.Context) (string, error) {
 	return string(msg), nil
 }
 
-type applicationURLs interface {
-	connecting() string
-	disconnected() string
-	message() string
-}
-
-var httpClient http.Client = http.Client{
-	Timeout: time.Second * 15,
-}
-
-func configureAppHTTPClient(http2Enabled bool) {
-	if !http2Enabled {
-		return
-	}
-	httpClient.Transport = &http2.Transport{
-		AllowHTTP: true,
-		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
-			return (&net.Dialer{
-				Timeout:   30 * time.Second,
-				KeepAlive: 30 * time.Second,
-			}).DialContext(ctx, network, addr)
-		},
-	}
-}
-
 // stripWSUpgradeHeaders clones the client's headers and removes the HTTP/1.1
 // hop-by-hop WS upgrade headers, so the resulting set is safe to relay to the
 // backend over HTTP/2 (which forbids them per RFC 7540 §8.1.2.2). The actual
 // WS upgrade happens between the client and wsgw, not on the wsgw→backend leg.
+// The wsgw headers are removed too, so that a client cannot smuggle a connection
+// ID or a signature of its own to the backend.
 func stripWSUpgradeHeaders(h http.Header) http.Header {
 	cleaned := h.Clone()
-	for _, name := range []string{"Upgrade", "Connection", "Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions", "Sec-Websocket-Protocol"} {
+	for _, name := range []string{"Upgrade", "Connection", "Sec-Websocket-Key", "Sec-Websocket-Version", "Sec-Websocket-Extensions", "Sec-Websocket-Protocol", extendedConnectProtocolHeader} {
+		cleaned.Del(name)
+	}
+	for _, name := range []string{ConnectionIDHeaderKey, signing.SignatureHeader, signing.TimestampHeader, signing.KeyIDHeader} {
 		cleaned.Del(name)
 	}
 	return cleaned
 }
 
 type appConnection struct {
-	id         ConnectionID
-	httpClient http.Client
+	id       ConnectionID
+	upstream backendUpstream
+	// attributes are provided by the backend on connect
+	attributes connectionAttributes
+	// spanContext is that of the span of the connect request
+	spanContext trace.SpanContext
+	// transport and remoteAddress are those of the connect request, for the audit log
+	transport     string
+	remoteAddress string
 }
 
 var errAppConnInternal = errors.New("internalError")
 var errAppConnAuthn = errors.New("authnError")
 var errAppConnAccepting = errors.New("appError")
 
-// Relays the connection request to the backend's `POST /ws/connect` endpoint and
-func handleClientConnecting(requestCtx context.Context, r *http.Request, createConnectionId func(ctx context.Context) ConnectionID, appUrls applicationURLs) (*appConnection, error) {
+// handleClientConnecting assigns an ID to the connection and asks the backend, through the upstream
+// of the connect path, whether to accept it
+func handleClientConnecting(requestCtx context.Context, r *http.Request, createConnectionId func(ctx context.Context) ConnectionID, upstream backendUpstream) (*appConnection, error) {
+	connId := createConnectionId(r.Context())
+	attributes, connectingErr := upstream.connecting(requestCtx, r, connId)
+	if connectingErr != nil {
+		return nil, connectingErr
+	}
+	return &appConnection{id: connId, upstream: upstream, attributes: attributes, spanContext: trace.SpanContextFromContext(requestCtx)}, nil
+}
+
+// connecting relays the connection request to the backend's connect callback (`GET /ws/connect` by default).
+// If the callback is disabled, every connection is accepted.
+func (b *backendClient) connecting(requestCtx context.Context, r *http.Request, connId ConnectionID) (connectionAttributes, error) {
 	logger := zerolog.Ctx(r.Context()).With().Logger()
 
-	request, err := http.NewRequestWithContext(requestCtx, http.MethodGet, appUrls.connecting(), nil)
+	endpoint := &b.endpoints.connecting
+	if endpoint.disabled {
+		logger.Debug().Msgf("connect callback disabled, accepting: %v", connId)
+		return nil, nil
+	}
+
+	requestCtx, cancel := context.WithTimeout(requestCtx, endpoint.timeout)
+	defer cancel()
+
+	appUrl, release := b.resolve(endpoint, connId)
+	defer release()
+
+	request, err := http.NewRequestWithContext(requestCtx, endpoint.method, appUrl, nil)
 	if err != nil {
 		logger.Error().Err(err).Msgf("failed to create request object")
 		return nil, errAppConnInternal
 	}
 	request.Header = stripWSUpgradeHeaders(r.Header)
 
-	connId := createConnectionId(r.Context())
-
-	request.Header.Add(ConnectionIDHeaderKey, string(connId))
+	request.Header.Set(ConnectionIDHeaderKey, string(connId))
 
 	monitoring.InjectIntoHeader(requestCtx, request.Header)
+	b.sign(request, nil)
 
-	response, requestErr := httpClient.Do(request)
+	response, requestErr := b.do(endpoint, request)
+	var overload loadmanagement.OverloadError
+	if errors.As(requestErr, &overload) {
+		logger.Info().Err(requestErr).Msg("backend unavailable, rejecting connection")
+		return nil, overload
+	}
 	if requestErr != nil {
 		logger.Error().Err(requestErr).Msgf("failed to send request")
 		return nil, errAppConnInternal
@@ -137,70 +161,209 @@ func handleClientConnecting(requestCtx context.Context, r *http.Request, createC
 
 	logger.Debug().Msgf("app has accepted: %v", connId)
 
-	return &appConnection{connId, httpClient}, nil
+	return parseConnectionAttributes(response.Header.Get(ConnectionAttributesHeaderKey)), nil
+}
+
+// handleClientDisconnected notifies the backend of the disconnection through the upstream of the connection
+func handleClientDisconnected(ctx context.Context, connReqHeader http.Header, appConn *appConnection, logger zerolog.Logger) {
+	logger = logger.With().Str(ConnectionIDKey, string(appConn.id)).Logger()
+	appConn.upstream.disconnected(logger.WithContext(ctx), connReqHeader, appConn.id)
 }
 
-func handleClientDisconnected(ctx context.Context, appUrls applicationURLs, connReqHeader http.Header, appConn *appConnection, logger zerolog.Logger) {
-	logger = logger.With().Str("appUrl", appUrls.disconnected()).Str(ConnectionIDKey, string(appConn.id)).Logger()
+// disconnected notifies the backend of the disconnection. Failed notifications are retried
+// and, if the retries are exhausted, put in the outbox to be sent when the backend recovers.
+func (b *backendClient) disconnected(ctx context.Context, connReqHeader http.Header, connId ConnectionID) {
+	if b.endpoints.disconnected.disabled {
+		return
+	}
+
+	logger := zerolog.Ctx(ctx).With().Logger()
 
 	logger.Debug().Msg("BEGIN")
 
-	request, err := http.NewRequestWithContext(ctx, http.MethodPost, appUrls.disconnected(), nil)
+	event := disconnectEvent{
+		ConnectionID:   connId,
+		Header:         connReqHeader,
+		DisconnectedAt: time.Now(),
+	}
+
+	notifyErr := b.disconnectRetries.do(ctx, func(attemptCtx context.Context, attempt int) error {
+		sendErr := b.sendDisconnected(attemptCtx, event)
+		if sendErr != nil {
+			logger.Info().Err(sendErr).Int("attempt", attempt).Msg("failed to notify the backend of the disconnection")
+		}
+		return sendErr
+	})
+
+	switch {
+	case notifyErr == nil:
+		b.disconnectMetrics.count(ctx, "delivered", 1)
+		b.disconnectOutbox.backendRecovered()
+	case errors.Is(notifyErr, errPermanent):
+		b.disconnectMetrics.count(ctx, "rejected", 1)
+	default:
+		b.disconnectOutbox.add(ctx, event)
+	}
+
+	logger.Debug().Msg("END")
+}
+
+// sendDisconnected makes one attempt at sending the disconnect notification to the backend.
+// Responses which retrying won't change (4xx other than 408 and 429) are reported as errPermanent.
+func (b *backendClient) sendDisconnected(ctx context.Context, event disconnectEvent) error {
+	endpoint := &b.endpoints.disconnected
+
+	ctx, cancel := context.WithTimeout(ctx, endpoint.timeout)
+	defer cancel()
+
+	appUrl, release := b.resolve(endpoint, event.ConnectionID)
+	defer release()
+
+	request, err := http.NewRequestWithContext(ctx, endpoint.method, appUrl, nil)
 	if err != nil {
-		logger.Error().Err(err).Msgf("failed to create request object")
-		return
+		return fmt.Errorf("failed to create request object: %w: %w", err, errPermanent)
+	}
+	request.Header = event.Header.Clone()
+	if request.Header == nil {
+		request.Header = http.Header{}
 	}
-	request.Header = connReqHeader
-	request.Header.Add(ConnectionIDHeaderKey, string(appConn.id))
+	request.Header.Set(ConnectionIDHeaderKey, string(event.ConnectionID))
 
 	monitoring.InjectIntoHeader(ctx, request.Header)
+	b.sign(request, nil)
+
+	response, requestErr := b.do(endpoint, request)
+	if requestErr != nil {
+		return fmt.Errorf("failed to send request: %w", requestErr)
+	}
+	defer cleanupResponse(response)
+
+	if response.StatusCode != 200 {
+		statusErr := fmt.Errorf("received status code %d", response.StatusCode)
+		if response.StatusCode >= 400 && response.StatusCode < 500 &&
+			response.StatusCode != http.StatusRequestTimeout && response.StatusCode != http.StatusTooManyRequests {
+			return fmt.Errorf("%w: %w", statusErr, errPermanent)
+		}
+		return statusErr
+	}
+
+	return nil
+}
+
+// handleClientMessage relays the client messages to the backend through the upstream their routing key
+// is routed to, or through the upstream of the connection
+func handleClientMessage(appConn *appConnection, router *backendRouter) func(c context.Context, msg string) error {
+	return func(c context.Context, msg string) error {
+		return router.messageUpstream(appConn.upstream, msg).message(c, appConn.id, msg)
+	}
+}
+
+// message calls the message callback (`POST /ws/message` by default) on the backend with "msg" and ConnectionIDKey.
+// If batching is enabled, the message is added to a batch without waiting for it to be sent: the outcome of the
+// message is reported to the connection asynchronously (see withMessageOutcome).
+// If the callback is disabled, the messages of the clients are dropped.
+func (b *backendClient) message(c context.Context, connId ConnectionID, msg string) error {
+	endpoint := &b.endpoints.message
+	logger := zerolog.Ctx(c).With().Str(ConnectionIDKey, string(connId)).Str("func", "message").Str("profile", b.profile).Logger()
+	logger.Debug().Str("msg", msg).Send()
+
+	if endpoint.disabled {
+		logger.Debug().Msg("message callback disabled, dropping message")
+		return nil
+	}
+
+	if b.batcher != nil {
+		return b.batcher.submit(c, connId, msg, messageOutcome(c))
+	}
 
-	response, requestErr := appConn.httpClient.Do(request)
+	c, cancel := context.WithTimeout(c, endpoint.timeout)
+	defer cancel()
+
+	appUrl, release := b.resolve(endpoint, connId)
+	defer release()
+
+	request, err := http.NewRequestWithContext(c,
+		endpoint.method,
+		appUrl,
+		bytes.NewReader([]byte(msg)),
+	)
+	if err != nil {
+		logger.Error().Err(err).Msgf("failed to create request object")
+		return err
+	}
+	request.Header.Add(ConnectionIDHeaderKey, string(connId))
+	monitoring.InjectIntoHeader(c, request.Header)
+	b.sign(request, []byte(msg))
+
+	response, requestErr := b.do(endpoint, request)
+	var overload loadmanagement.OverloadError
+	if errors.As(requestErr, &overload) && b.shedding.notifyClients {
+		logger.Debug().Err(requestErr).Msg("backend unavailable")
+		return backendUnavailableError{retryAfter: overload.RetryAfter}
+	}
 	if requestErr != nil {
 		logger.Error().Err(requestErr).Msgf("failed to send request")
-		return
+		return requestErr
 	}
 	defer cleanupResponse(response)
 
 	if response.StatusCode != 200 {
 		logger.Info().Msgf("Received status code %d", response.StatusCode)
-		return
+		return messageRejected(response.StatusCode, fmt.Errorf("probelm while sending message to application"))
 	}
 
-	logger.Debug().Msg("END")
+	return nil
 }
 
-// Calls the `POST /ws/message-received` endpoint on the backend with "msg" and ConnectionIDKey
-func handleClientMessage(appConn *appConnection, appUrls applicationURLs) func(c context.Context, msg string) error {
-	return func(c context.Context, msg string) error {
-		logger := zerolog.Ctx(c).With().Str(ConnectionIDKey, string(appConn.id)).Str("func", "handleClientMessage").Logger()
-		logger.Debug().Str("msg", msg).Send()
-
-		request, err := http.NewRequestWithContext(c,
-			http.MethodPost,
-			appUrls.message(),
-			bytes.NewReader([]byte(msg)),
-		)
-		if err != nil {
-			logger.Error().Err(err).Msgf("failed to create request object")
-			return err
-		}
-		request.Header.Add(ConnectionIDHeaderKey, string(appConn.id))
+// clientFrameError is implemented by errors which are reported to the client in a frame of their own
+type clientFrameError interface {
+	error
+	clientFrame() string
+}
 
-		response, requestErr := appConn.httpClient.Do(request)
-		if requestErr != nil {
-			logger.Error().Err(requestErr).Msgf("failed to send request")
-			return requestErr
-		}
-		defer cleanupResponse(response)
+// clientErrorFrame returns the frame to report the error of a client message with
+func clientErrorFrame(err error) string {
+	var frameErr clientFrameError
+	if errors.As(err, &frameErr) {
+		return frameErr.clientFrame()
+	}
+	return err.Error()
+}
 
-		if response.StatusCode != 200 {
-			logger.Info().Msgf("Received status code %d", response.StatusCode)
-			return fmt.Errorf("probelm while sending message to application")
-		}
+// backendUnavailableError is returned for the messages of the clients while the circuit of the backend is open
+type backendUnavailableError struct {
+	retryAfter time.Duration
+}
 
-		return nil
+func (e backendUnavailableError) Error() string {
+	return "backend unavailable"
+}
+
+func (e backendUnavailableError) clientFrame() string {
+	frame, _ := json.Marshal(map[string]any{
+		"error":             "backend_unavailable",
+		"retryAfterSeconds": retryAfterSeconds(e.retryAfter),
+	})
+	return string(frame)
+}
+
+// rateLimitedError is returned for the messages of the clients the backend rejected with 429 Too Many Requests.
+// The clients are answered as for the other rejections.
+type rateLimitedError struct {
+	error
+}
+
+// messageRejected returns the error of a client message the backend rejected with the given status
+func messageRejected(status int, err error) error {
+	if status == http.StatusTooManyRequests {
+		return rateLimitedError{err}
 	}
+	return err
+}
+
+// retryAfterSeconds rounds the duration up to whole seconds, as expected in a `Retry-After` header
+func retryAfterSeconds(d time.Duration) int {
+	return max(int(math.Ceil(d.Seconds())), 1)
 }
 
 func sendMessageToClient(ctx context.Context, wsconn *websocket.Conn, obj any) error {
@@ -215,31 +378,87 @@ func sendMessageToClient(ctx context.Context, wsconn *websocket.Conn, obj any) e
 	return nil
 }
 
-// connectHandler calls `authenticateClient` if it is not `nil` to authenticate the client,
-// then notifies the application of the new WS connection
+// acceptConnection asks the backend of the connect path whether to accept the connection. If it is not accepted,
+// the request is answered with the reason. Either way, the connect attempt is recorded in the audit log.
+func acceptConnection(
+	g *gin.Context,
+	requestContext context.Context,
+	router *backendRouter,
+	ws *wsConnections,
+	transport string,
+	createConnectionId func(ctx context.Context) ConnectionID,
+) (*appConnection, bool) {
+	reject := func(reason string, status int) {
+		ws.audit.connectRejected(requestContext, ws.name, transport, g.ClientIP(), reason, status)
+		if status != 0 {
+			g.AbortWithStatus(status)
+		}
+	}
+
+	upstream, profileFound := router.connectUpstream(g.Param(connectProfilePathParamName))
+	if !profileFound {
+		reject(rejectProfileNotFound, http.StatusNotFound)
+		return nil, false
+	}
+
+	if ws.full() {
+		zerolog.Ctx(requestContext).Info().Msg("connection limit reached, rejecting connection")
+		reject(rejectConnectionLimit, http.StatusServiceUnavailable)
+		return nil, false
+	}
+
+	// The debug sessions of the connection ID apply from the connect callback on
+	createDebuggedConnectionId := func(ctx context.Context) ConnectionID {
+		connId := createConnectionId(ctx)
+		setDebugConnectionId(requestContext, connId)
+		return connId
+	}
+	appConn, clientConnectErr := handleClientConnecting(requestContext, g.Request, createDebuggedConnectionId, upstream)
+
+	var overload loadmanagement.OverloadError
+	if errors.As(clientConnectErr, &overload) {
+		g.Header("Retry-After", strconv.Itoa(retryAfterSeconds(overload.RetryAfter)))
+		reject(rejectBackendOverload, http.StatusServiceUnavailable)
+		return nil, false
+	}
+
+	if clientConnectErr != nil {
+		switch clientConnectErr {
+		case errAppConnAccepting:
+			reject(rejectBackendRejected, 0)
+		case errAppConnInternal:
+			reject(rejectInternalError, http.StatusInternalServerError)
+		case errAppConnAuthn:
+			reject(rejectUnauthenticated, http.StatusUnauthorized)
+		}
+		return nil, false
+	}
+	appConn.transport, appConn.remoteAddress = transport, g.ClientIP()
+	ws.audit.connectAccepted(requestContext, ws.name, appConn)
+	return appConn, true
+}
+
 func connectHandler(
-	appUrls applicationURLs,
+	router *backendRouter,
 	ws *wsConnections,
-	loadBalancerAddress string,
+	originPatterns *allowedOrigins,
 	createConnectionId func(ctx context.Context) ConnectionID,
 	ackWithNewConnId bool,
 ) gin.HandlerFunc {
 	return func(g *gin.Context) {
+		// CONNECT only opens the WebSockets over HTTP/2
+		if g.Request.Method == http.MethodConnect && !isExtendedConnect(g.Request) {
+			g.AbortWithStatus(http.StatusMethodNotAllowed)
+			return
+		}
+
 		requestContext := g.Request.Context()
 		tracer := otel.Tracer(config.OtelScope)
 		requestContext, span := tracer.Start(requestContext, "new-ws-connection")
 		defer span.End()
 
-		appConn, clientConnectErr := handleClientConnecting(requestContext, g.Request, createConnectionId, appUrls)
-
-		if clientConnectErr != nil {
-			switch clientConnectErr {
-			case errAppConnAccepting:
-			case errAppConnInternal:
-				g.AbortWithStatus(http.StatusInternalServerError)
-			case errAppConnAuthn:
-				g.AbortWithStatus(http.StatusUnauthorized)
-			}
+		appConn, accepted := acceptConnection(g, requestContext, router, ws, transportWebSocket, createConnectionId)
+		if !accepted {
 			return
 		}
 
@@ -247,8 +466,12 @@ func connectHandler(
 
 		// logger = logger.().Str(logging.UnitLogger, "connectHandler").Str(ConnectionIDKey, string(appConn.id)).Logger()
 
-		wsConn, subsErr := websocket.Accept(g.Writer, g.Request, &websocket.AcceptOptions{
-			OriginPatterns: []string{loadBalancerAddress},
+		writer, request := http.ResponseWriter(g.Writer), g.Request
+		if isExtendedConnect(g.Request) {
+			writer, request = extendedConnectUpgrade(g.Writer, g.Request)
+		}
+		wsConn, subsErr := websocket.Accept(writer, request, &websocket.AcceptOptions{
+			OriginPatterns: originPatterns.get(),
 		})
 		if subsErr != nil {
 			logger.Error().Err(subsErr).Msgf("failed to accept ws connection request")
@@ -261,9 +484,14 @@ func connectHandler(
 			clientDisconnectCtx, clientDisconnectSpan := tracer.Start(requestContext, "new-ws-disconnect")
 			defer clientDisconnectSpan.End()
 
-			wsConn.Close(websocket.StatusNormalClosure, "")
+			// A client which doesn't answer the pings wouldn't answer the close frame either
+			if errors.Is(wsClosedError, errKeepaliveTimeout) {
+				wsConn.CloseNow()
+			} else {
+				wsConn.Close(websocket.StatusNormalClosure, "")
+			}
 
-			handleClientDisconnected(clientDisconnectCtx, appUrls, stripWSUpgradeHeaders(g.Request.Header), appConn, logger)
+			handleClientDisconnected(clientDisconnectCtx, stripWSUpgradeHeaders(g.Request.Header), appConn, logger)
 
 			if wsClosedError != nil {
 				if errors.Is(wsClosedError, context.Canceled) {
@@ -290,13 +518,37 @@ func connectHandler(
 
 		logger.Debug().Msg("websocket message processing about to start...")
 
-		wsClosedError = ws.processMessages(requestContext, appConn.id, &wsIOAdapter{wsConn}, handleClientMessage(appConn, appUrls)) // we block here until Error or Done
+		// The frames are traced in spans of their own, linked to that of the connect request
+		span.End()
+
+		wsClosedError = ws.processMessages(requestContext, appConn, &wsIOAdapter{wsConn}, handleClientMessage(appConn, router)) // we block here until Error or Done
 
 		logger.Debug().Msgf("websocket message processing finished with %v", wsClosedError)
 	}
 }
 
-func pushHandler(ws *wsConnections) gin.HandlerFunc {
+// connectionDetailsHandler serves the details of the connection, provided that owns tells the connection
+// belongs to the gateway endpoint
+func connectionDetailsHandler(ws *wsConnections, owns func(connId ConnectionID) bool) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		connId := ConnectionID(g.Param(connIdPathParamName))
+		setDebugConnectionId(g.Request.Context(), connId)
+		if !owns(connId) {
+			g.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+		details, detailsErr := ws.details(connId)
+		if detailsErr != nil {
+			g.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+		g.JSON(http.StatusOK, details)
+	}
+}
+
+// pushHandler relays the message of the backend to the connection, provided that owns tells the connection
+// belongs to the gateway endpoint of the push path
+func pushHandler(ws *wsConnections, owns func(connId ConnectionID) bool) gin.HandlerFunc {
 	return func(g *gin.Context) {
 		logger := zerolog.Ctx(g.Request.Context()).With().Logger()
 		logger.Debug().Msg("BEGIN")
@@ -318,6 +570,14 @@ func pushHandler(ws *wsConnections) gin.HandlerFunc {
 			return
 		}
 
+		setDebugConnectionId(requestContext, ConnectionID(connectionIdStr))
+
+		if !owns(ConnectionID(connectionIdStr)) {
+			logger.Info().Msg("connection belongs to another gateway endpoint")
+			g.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
 		logger.Debug().Msg("waiting for input on wsconn...")
 		requestBody, errReadRequest := io.ReadAll(g.Request.Body)
 		g.Request.Body.Close()
@@ -333,7 +593,7 @@ func pushHandler(ws *wsConnections) gin.HandlerFunc {
 		span.AddEvent("pushing")
 
 		errPush := ws.push(requestContext, bodyAsString, ConnectionID(connectionIdStr))
-		var oload *loadmanagement.OverloadError
+		var oload loadmanagement.OverloadError
 		if errors.As(errPush, &oload) {
 			logger.Error().Err(errPush).Str("connectionIdStr", connectionIdStr).Msgf("failed to push to connection")
 			g.AbortWithStatus(http.StatusServiceUnavailable)
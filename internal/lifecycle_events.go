@@ -0,0 +1,208 @@
+package wsgw
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"wsgw/internal/config"
+	"wsgw/pkgs/monitoring"
+	"wsgw/pkgs/signing"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// The types of the lifecycle events, reported in addition to the connect and disconnect callbacks
+const (
+	// lifecycleSlowConsumer is reported when the buffer of a connection overflows, the pushed messages being dropped
+	lifecycleSlowConsumer = "slow_consumer"
+	// lifecycleBackpressureRecovered is reported when the buffer of a slow consumer has drained to half its size
+	lifecycleBackpressureRecovered = "backpressure_recovered"
+	// lifecycleKeepaliveTimeout is reported when a long-polling client stops polling, its session expiring
+	lifecycleKeepaliveTimeout = "keepalive_timeout"
+	// lifecycleRateLimited is reported when the backend rejects the messages of a client with 429 Too Many Requests,
+	// once per streak of rejections
+	lifecycleRateLimited = "rate_limited"
+	// lifecycleClientClosed is reported when a client closes its connection, with the close code
+	lifecycleClientClosed = "client_closed"
+)
+
+const (
+	defaultLifecycleBatchSize     = 100
+	defaultLifecycleFlushInterval = time.Second
+	defaultLifecycleQueueSize     = 10000
+	defaultLifecycleTimeout       = 5 * time.Second
+)
+
+// lifecycleEvent is an event of the health of a connection
+type lifecycleEvent struct {
+	Type            string               `json:"type"`
+	ConnectionID    ConnectionID         `json:"connectionId"`
+	GatewayEndpoint string               `json:"gatewayEndpoint,omitempty"`
+	Timestamp       time.Time            `json:"timestamp"`
+	Attributes      connectionAttributes `json:"attributes,omitempty"`
+	// CloseCode and CloseReason are those of the client_closed events
+	CloseCode   int    `json:"closeCode,omitempty"`
+	CloseReason string `json:"closeReason,omitempty"`
+	// Buffered and BufferSize describe the buffer of the pushed messages on the slow_consumer and
+	// backpressure_recovered events; Dropped is the number of pushed messages dropped meanwhile
+	Buffered   int   `json:"buffered,omitempty"`
+	BufferSize int   `json:"bufferSize,omitempty"`
+	Dropped    int64 `json:"dropped,omitempty"`
+}
+
+func newLifecycleEvent(eventType string, endpoint string, conn *connection) lifecycleEvent {
+	return lifecycleEvent{
+		Type:            eventType,
+		ConnectionID:    conn.id,
+		GatewayEndpoint: endpoint,
+		Timestamp:       time.Now().UTC(),
+		Attributes:      conn.attributes,
+	}
+}
+
+// lifecycleNotifier delivers the lifecycle events to the configured URL, asynchronously and in batches, so that
+// reporting an event never holds up a connection. The events which can't be queued or delivered even after
+// the retries are dropped. A nil lifecycleNotifier drops all the events.
+type lifecycleNotifier struct {
+	url           string
+	batchSize     int
+	flushInterval time.Duration
+	timeout       time.Duration
+	retry         retryPolicy
+	queue         chan lifecycleEvent
+	httpClient    *http.Client
+	// signer signs the requests like the backend callbacks, nil if signing isn't configured
+	signer    *signing.Signer
+	delivered metric.Int64Counter
+	dropped   metric.Int64Counter
+}
+
+// newLifecycleNotifier creates the notifier of the lifecycle events; nil if no URL is configured
+func newLifecycleNotifier(configuration config.Config) (*lifecycleNotifier, error) {
+	eventsConfig := configuration.ConnectionEvents
+	if len(eventsConfig.URL) == 0 {
+		return nil, nil
+	}
+	httpClient, clientErr := newBackendHTTPClient(configuration)
+	if clientErr != nil {
+		return nil, clientErr
+	}
+	var signer *signing.Signer
+	if len(configuration.BackendSigningKeys) > 0 {
+		keys, parseErr := signing.ParseKeys(configuration.BackendSigningKeys)
+		if parseErr != nil {
+			return nil, fmt.Errorf("failed to parse backend signing keys: %w", parseErr)
+		}
+		signer = signing.NewSigner(keys[0])
+	}
+	return &lifecycleNotifier{
+		url:           eventsConfig.URL,
+		batchSize:     orDefault(eventsConfig.BatchSize, defaultLifecycleBatchSize),
+		flushInterval: orDefault(eventsConfig.FlushInterval, defaultLifecycleFlushInterval),
+		timeout:       orDefault(eventsConfig.Timeout, defaultLifecycleTimeout),
+		retry: retryPolicy{
+			maxAttempts:    orDefault(eventsConfig.RetryMaxAttempts, defaultDisconnectRetryMaxAttempts),
+			initialBackoff: orDefault(eventsConfig.RetryInitialBackoff, defaultDisconnectRetryInitialBackoff),
+			maxBackoff:     orDefault(eventsConfig.RetryMaxBackoff, defaultDisconnectRetryMaxBackoff),
+		},
+		queue:      make(chan lifecycleEvent, orDefault(eventsConfig.QueueSize, defaultLifecycleQueueSize)),
+		httpClient: httpClient,
+		signer:     signer,
+		delivered:  monitoring.CreateCounter(config.OtelScope, "wsgw.lifecycle_events.delivered", "Lifecycle events delivered, by type"),
+		dropped:    monitoring.CreateCounter(config.OtelScope, "wsgw.lifecycle_events.dropped", "Lifecycle events dropped, the queue being full or the deliveries failing"),
+	}, nil
+}
+
+// notify queues the event for delivery, without blocking
+func (n *lifecycleNotifier) notify(ctx context.Context, event lifecycleEvent) {
+	if n == nil {
+		return
+	}
+	select {
+	case n.queue <- event:
+	default:
+		n.dropped.Add(ctx, 1, metric.WithAttributes(attribute.String("type", event.Type)))
+		zerolog.Ctx(ctx).Warn().Str("type", event.Type).Msg("lifecycle event queue full, dropping event")
+	}
+}
+
+// run delivers the queued events until ctx is done, in batches of up to batchSize events sent at least every
+// flushInterval. The batches are sent one at a time, so that the events are delivered in order.
+func (n *lifecycleNotifier) run(ctx context.Context) {
+	ticker := time.NewTicker(n.flushInterval)
+	defer ticker.Stop()
+
+	var batch []lifecycleEvent
+	flush := func() {
+		if len(batch) > 0 {
+			n.deliver(ctx, batch)
+			batch = nil
+		}
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event := <-n.queue:
+			batch = append(batch, event)
+			if len(batch) >= n.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// deliver POSTs the batch, retrying on the network errors, the 429 and the 5xx responses
+func (n *lifecycleNotifier) deliver(ctx context.Context, batch []lifecycleEvent) {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "lifecycleNotifier").Int("size", len(batch)).Logger()
+	body, encodeErr := json.Marshal(batch)
+	if encodeErr != nil {
+		logger.Error().Err(encodeErr).Msg("failed to encode lifecycle events")
+		return
+	}
+
+	deliveryErr := n.retry.do(ctx, func(ctx context.Context, attempt int) error {
+		ctx, cancel := context.WithTimeout(ctx, n.timeout)
+		defer cancel()
+		request, requestErr := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+		if requestErr != nil {
+			return errors.Join(errPermanent, requestErr)
+		}
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set(BatchHeaderKey, fmt.Sprint(len(batch)))
+		if n.signer != nil {
+			n.signer.Sign(request, body)
+		}
+		response, responseErr := n.httpClient.Do(request)
+		if responseErr != nil {
+			logger.Debug().Err(responseErr).Int("attempt", attempt).Msg("failed to deliver lifecycle events")
+			return responseErr
+		}
+		defer cleanupResponse(response)
+		switch {
+		case response.StatusCode >= 200 && response.StatusCode <= 299:
+			return nil
+		case response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500:
+			return fmt.Errorf("received status code %d", response.StatusCode)
+		default:
+			return fmt.Errorf("%w: received status code %d", errPermanent, response.StatusCode)
+		}
+	})
+
+	counter := n.delivered
+	if deliveryErr != nil {
+		logger.Error().Err(deliveryErr).Msg("failed to deliver lifecycle events, dropping them")
+		counter = n.dropped
+	}
+	for _, event := range batch {
+		counter.Add(ctx, 1, metric.WithAttributes(attribute.String("type", event.Type)))
+	}
+}
@@ -0,0 +1,282 @@
+package wsgw
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+	"wsgw/internal/config"
+	loadmanagement "wsgw/pkgs/loadmanegement"
+	"wsgw/pkgs/monitoring"
+
+	"github.com/rs/zerolog"
+)
+
+type batchFormat string
+
+const (
+	batchFormatJSON   batchFormat = "json"
+	batchFormatNDJSON batchFormat = "ndjson"
+)
+
+const (
+	defaultMessageBatchMaxDelay = 10 * time.Millisecond
+	// BatchHeaderKey is set to the number of messages on the batched message requests
+	BatchHeaderKey = "X-WSGW-BATCH"
+)
+
+// batchItem is a client message in a batch
+type batchItem struct {
+	ConnectionID ConnectionID `json:"connectionId"`
+	Timestamp    time.Time    `json:"timestamp"`
+	Message      string       `json:"message"`
+	// TraceData is the W3C trace context of the message, as the batch is sent in the trace of none of them
+	TraceData map[string]string `json:"traceData,omitempty"`
+}
+
+// batchItemResult is the outcome of a message of the batch, as reported by the backend.
+// Items with a 2xx or no status are successful.
+type batchItemResult struct {
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (r batchItemResult) err() error {
+	if r.Status == 0 || (r.Status >= 200 && r.Status <= 299) {
+		return nil
+	}
+	if len(r.Error) > 0 {
+		return messageRejected(r.Status, errors.New(r.Error))
+	}
+	return messageRejected(r.Status, fmt.Errorf("backend rejected message with status %d", r.Status))
+}
+
+type pendingBatchItem struct {
+	item   batchItem
+	report func(err error)
+}
+
+// messageBatcher collects the client messages of all the connections of a backend and sends them in one request
+// when the batch is full or its oldest message has waited for the maximum delay. The submitters don't wait for
+// the batch: the outcome of each message is reported back to its connection once the backend has answered.
+type messageBatcher struct {
+	maxSize  int
+	maxDelay time.Duration
+	format   batchFormat
+	pending  chan pendingBatchItem
+	send     func(ctx context.Context, items []batchItem) []error
+}
+
+func newMessageBatcher(batchConfig config.MessageBatchConfig, send func(ctx context.Context, items []batchItem) []error) (*messageBatcher, error) {
+	format := batchFormat(orDefault(batchConfig.Format, string(batchFormatJSON)))
+	if format != batchFormatJSON && format != batchFormatNDJSON {
+		return nil, fmt.Errorf("unsupported message batch format %q: expected %s or %s", format, batchFormatJSON, batchFormatNDJSON)
+	}
+	return &messageBatcher{
+		maxSize:  batchConfig.MaxSize,
+		maxDelay: orDefault(batchConfig.MaxDelay, defaultMessageBatchMaxDelay),
+		format:   format,
+		pending:  make(chan pendingBatchItem, batchConfig.MaxSize),
+		send:     send,
+	}, nil
+}
+
+// submit adds the message to the next batch. The outcome of the message is reported later on, with report.
+func (b *messageBatcher) submit(ctx context.Context, connId ConnectionID, msg string, report func(err error)) error {
+	pending := pendingBatchItem{
+		item:   batchItem{ConnectionID: connId, Timestamp: time.Now(), Message: msg, TraceData: monitoring.InjectTraceData(ctx)},
+		report: report,
+	}
+	select {
+	case b.pending <- pending:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run collects the submitted messages into batches until ctx is done. The batches are sent in the background,
+// so that a slow backend call doesn't hold up the collection of the next batch, yet one after the other, so that
+// the messages of a connection reach the backend in order.
+func (b *messageBatcher) run(ctx context.Context) {
+	var batch []pendingBatchItem
+	// previous is closed once the previous batch is sent
+	var previous chan struct{}
+	timer := time.NewTimer(b.maxDelay)
+	timer.Stop()
+
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		timer.Stop()
+		sent := make(chan struct{})
+		go func(batch []pendingBatchItem, previous chan struct{}) {
+			defer close(sent)
+			if previous != nil {
+				<-previous
+			}
+			b.flush(ctx, batch)
+		}(batch, previous)
+		previous = sent
+		batch = nil
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			for _, pending := range batch {
+				pending.report(ctx.Err())
+			}
+			return
+		case pending := <-b.pending:
+			if len(batch) == 0 {
+				timer.Reset(b.maxDelay)
+			}
+			batch = append(batch, pending)
+			if len(batch) >= b.maxSize {
+				flush()
+			}
+		case <-timer.C:
+			flush()
+		}
+	}
+}
+
+func (b *messageBatcher) flush(ctx context.Context, batch []pendingBatchItem) {
+	items := make([]batchItem, len(batch))
+	for i, pending := range batch {
+		items[i] = pending.item
+	}
+	results := b.send(ctx, items)
+	for i, pending := range batch {
+		pending.report(results[i])
+	}
+}
+
+// encode encodes the batch in the body of the request
+func (b *messageBatcher) encode(items []batchItem) ([]byte, string, error) {
+	if b.format == batchFormatJSON {
+		body, err := json.Marshal(items)
+		return body, "application/json", err
+	}
+	var body bytes.Buffer
+	encoder := json.NewEncoder(&body)
+	for _, item := range items {
+		if err := encoder.Encode(item); err != nil {
+			return nil, "", err
+		}
+	}
+	return body.Bytes(), "application/x-ndjson", nil
+}
+
+// decodeResults decodes the per-item results from the body of the response, in the format of the request.
+// An empty body means all the items succeeded.
+func (b *messageBatcher) decodeResults(body io.Reader, count int) ([]batchItemResult, error) {
+	content, readErr := io.ReadAll(body)
+	if readErr != nil {
+		return nil, readErr
+	}
+	if len(bytes.TrimSpace(content)) == 0 {
+		return make([]batchItemResult, count), nil
+	}
+
+	var results []batchItemResult
+	if b.format == batchFormatJSON {
+		if err := json.Unmarshal(content, &results); err != nil {
+			return nil, err
+		}
+	} else {
+		scanner := bufio.NewScanner(bytes.NewReader(content))
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if len(line) == 0 {
+				continue
+			}
+			var result batchItemResult
+			if err := json.Unmarshal([]byte(line), &result); err != nil {
+				return nil, err
+			}
+			results = append(results, result)
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(results) != count {
+		return nil, fmt.Errorf("expected %d results, got %d", count, len(results))
+	}
+	return results, nil
+}
+
+// sendMessageBatch sends the batch to the message callback of the backend and maps the results
+// of the backend back to the messages. A failure of the whole call fails all the messages.
+func (b *backendClient) sendMessageBatch(ctx context.Context, items []batchItem) []error {
+	logger := zerolog.Ctx(ctx).With().Str("func", "sendMessageBatch").Str("profile", b.profile).Int("size", len(items)).Logger()
+	endpoint := &b.endpoints.message
+
+	failAll := func(err error) []error {
+		errs := make([]error, len(items))
+		for i := range errs {
+			errs[i] = err
+		}
+		return errs
+	}
+
+	body, contentType, encodeErr := b.batcher.encode(items)
+	if encodeErr != nil {
+		logger.Error().Err(encodeErr).Msg("failed to encode message batch")
+		return failAll(encodeErr)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, endpoint.timeout)
+	defer cancel()
+
+	appUrl, release := b.resolve(endpoint, "")
+	defer release()
+
+	request, err := http.NewRequestWithContext(ctx, endpoint.method, appUrl, bytes.NewReader(body))
+	if err != nil {
+		logger.Error().Err(err).Msg("failed to create request object")
+		return failAll(err)
+	}
+	request.Header.Set("Content-Type", contentType)
+	request.Header.Set(BatchHeaderKey, fmt.Sprint(len(items)))
+	monitoring.InjectIntoHeader(ctx, request.Header)
+	b.sign(request, body)
+
+	response, requestErr := b.do(endpoint, request)
+	var overload loadmanagement.OverloadError
+	if errors.As(requestErr, &overload) && b.shedding.notifyClients {
+		logger.Debug().Err(requestErr).Msg("backend unavailable")
+		return failAll(backendUnavailableError{retryAfter: overload.RetryAfter})
+	}
+	if requestErr != nil {
+		logger.Error().Err(requestErr).Msg("failed to send request")
+		return failAll(requestErr)
+	}
+	defer cleanupResponse(response)
+
+	if response.StatusCode != 200 {
+		logger.Info().Msgf("Received status code %d", response.StatusCode)
+		return failAll(messageRejected(response.StatusCode, fmt.Errorf("probelm while sending message to application")))
+	}
+
+	results, decodeErr := b.batcher.decodeResults(response.Body, len(items))
+	if decodeErr != nil {
+		logger.Error().Err(decodeErr).Msg("failed to decode the results of the message batch")
+		return failAll(decodeErr)
+	}
+	errs := make([]error, len(items))
+	for i, result := range results {
+		errs[i] = result.err()
+	}
+	return errs
+}
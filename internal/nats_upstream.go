@@ -0,0 +1,208 @@
+package wsgw
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+	"wsgw/internal/config"
+	loadmanagement "wsgw/pkgs/loadmanegement"
+	"wsgw/pkgs/monitoring"
+
+	"github.com/nats-io/nats.go"
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultNatsSubjectPrefix  = "wsgw"
+	defaultNatsRequestTimeout = 5 * time.Second
+)
+
+// natsEvent is the payload of the events published to NATS
+type natsEvent struct {
+	ConnectionID ConnectionID `json:"connectionId"`
+	// Header holds the headers of the connect request of the client (connect and disconnected events only)
+	Header  http.Header `json:"header,omitempty"`
+	Message string      `json:"message,omitempty"`
+	// PushSubject is where the backend can push messages to the connection
+	PushSubject string    `json:"pushSubject"`
+	Timestamp   time.Time `json:"timestamp"`
+}
+
+// natsReply is the reply of the backend to connect requests, and that of wsgw to push requests
+type natsReply struct {
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Attributes, in the replies to the connect events, describe the accepted connection
+	Attributes map[string]string `json:"attributes,omitempty"`
+}
+
+// natsUpstream publishes the events of the connections to NATS, on the `<prefix>[.<profile>].connect|message|disconnected`
+// subjects. The connect events are requests the backend replies to with the HTTP status it would have given
+// the connect callback. The pushes of the backend are consumed from the `<prefix>.push.<instance-id>` subject,
+// with the target connection in the X-WSGW-CONNECTION-ID header.
+type natsUpstream struct {
+	conn           *nats.Conn
+	subjectPrefix  string
+	pushSubject    string
+	requestTimeout time.Duration
+}
+
+// connectNats connects to the NATS server; the connection is drained when ctx is done
+func connectNats(ctx context.Context, natsConfig config.NatsConfig) (*nats.Conn, error) {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "natsUpstream").Logger()
+	conn, connectErr := nats.Connect(
+		orDefault(natsConfig.URL, nats.DefaultURL),
+		nats.Name(fmt.Sprintf("wsgw-%s", config.GetInstanceId())),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			logger.Warn().Err(err).Msg("disconnected from NATS")
+		}),
+		nats.ReconnectHandler(func(c *nats.Conn) {
+			logger.Info().Str("url", c.ConnectedUrl()).Msg("reconnected to NATS")
+		}),
+	)
+	if connectErr != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", connectErr)
+	}
+	go func() {
+		<-ctx.Done()
+		_ = conn.Drain()
+	}()
+	return conn, nil
+}
+
+func newNatsUpstream(conn *nats.Conn, natsConfig config.NatsConfig, profile string) *natsUpstream {
+	prefix := orDefault(natsConfig.SubjectPrefix, defaultNatsSubjectPrefix)
+	subjectPrefix := prefix
+	if len(profile) > 0 {
+		subjectPrefix = fmt.Sprintf("%s.%s", prefix, profile)
+	}
+	return &natsUpstream{
+		conn:           conn,
+		subjectPrefix:  subjectPrefix,
+		pushSubject:    fmt.Sprintf("%s.push.%s", prefix, config.GetInstanceId()),
+		requestTimeout: orDefault(natsConfig.RequestTimeout, defaultNatsRequestTimeout),
+	}
+}
+
+func (u *natsUpstream) newMsg(event string, payload natsEvent) (*nats.Msg, error) {
+	payload.PushSubject = u.pushSubject
+	payload.Timestamp = time.Now()
+	data, marshalErr := json.Marshal(payload)
+	if marshalErr != nil {
+		return nil, marshalErr
+	}
+	msg := nats.NewMsg(fmt.Sprintf("%s.%s", u.subjectPrefix, event))
+	msg.Header.Set(ConnectionIDHeaderKey, string(payload.ConnectionID))
+	msg.Data = data
+	return msg, nil
+}
+
+func (u *natsUpstream) connecting(ctx context.Context, r *http.Request, connId ConnectionID) (connectionAttributes, error) {
+	logger := zerolog.Ctx(r.Context()).With().Str(ConnectionIDKey, string(connId)).Logger()
+
+	msg, msgErr := u.newMsg("connect", natsEvent{ConnectionID: connId, Header: stripWSUpgradeHeaders(r.Header)})
+	if msgErr != nil {
+		logger.Error().Err(msgErr).Msg("failed to create connect event")
+		return nil, errAppConnInternal
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, u.requestTimeout)
+	defer cancel()
+	response, requestErr := u.conn.RequestMsgWithContext(ctx, msg)
+	if errors.Is(requestErr, nats.ErrNoResponders) {
+		logger.Info().Err(requestErr).Msg("backend unavailable, rejecting connection")
+		return nil, loadmanagement.OverloadError{RetryAfter: u.requestTimeout, Reason: "no responders"}
+	}
+	if requestErr != nil {
+		logger.Error().Err(requestErr).Msg("failed to send connect event")
+		return nil, errAppConnInternal
+	}
+
+	var reply natsReply
+	if unmarshalErr := json.Unmarshal(response.Data, &reply); unmarshalErr != nil {
+		logger.Error().Err(unmarshalErr).Msg("failed to parse the reply to the connect event")
+		return nil, errAppConnInternal
+	}
+	return limitConnectionAttributes(reply.Attributes), connectStatusError(logger, reply.Status)
+}
+
+func (u *natsUpstream) message(ctx context.Context, connId ConnectionID, msg string) error {
+	natsMsg, msgErr := u.newMsg("message", natsEvent{ConnectionID: connId, Message: msg})
+	if msgErr != nil {
+		return msgErr
+	}
+	monitoring.InjectIntoHeader(ctx, http.Header(natsMsg.Header))
+	if publishErr := u.conn.PublishMsg(natsMsg); publishErr != nil {
+		zerolog.Ctx(ctx).Error().Err(publishErr).Str(ConnectionIDKey, string(connId)).Msg("failed to publish message")
+		return publishErr
+	}
+	return nil
+}
+
+func (u *natsUpstream) disconnected(ctx context.Context, header http.Header, connId ConnectionID) {
+	logger := zerolog.Ctx(ctx).With().Logger()
+	msg, msgErr := u.newMsg("disconnected", natsEvent{ConnectionID: connId, Header: header})
+	if msgErr == nil {
+		msgErr = u.conn.PublishMsg(msg)
+	}
+	if msgErr != nil {
+		logger.Error().Err(msgErr).Msg("failed to publish disconnected event")
+	}
+}
+
+// consumePushes relays the messages published to the push subject to the connections. If the push
+// is a request, the outcome is replied with the HTTP status the push endpoint would have returned.
+func (u *natsUpstream) consumePushes(ctx context.Context, ws *wsConnections, owns func(connId ConnectionID) bool) error {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "natsUpstream").Str("subject", u.pushSubject).Logger()
+
+	subscription, subscribeErr := u.conn.Subscribe(u.pushSubject, func(msg *nats.Msg) {
+		connId := ConnectionID(msg.Header.Get(ConnectionIDHeaderKey))
+		pushCtx := monitoring.ExtractFromHeader(ctx, http.Header(msg.Header))
+		reply := pushReply(pushCtx, ws, owns, connId, string(msg.Data), 0)
+		if reply.Status != http.StatusNoContent {
+			logger.Info().Str(ConnectionIDKey, string(connId)).Int("status", reply.Status).Msg("push failed")
+		}
+		if len(msg.Reply) == 0 {
+			return
+		}
+		data, _ := json.Marshal(reply)
+		if respondErr := msg.Respond(data); respondErr != nil {
+			logger.Error().Err(respondErr).Msg("failed to reply to push")
+		}
+	})
+	if subscribeErr != nil {
+		return fmt.Errorf("failed to subscribe to %s: %w", u.pushSubject, subscribeErr)
+	}
+	go func() {
+		<-ctx.Done()
+		_ = subscription.Unsubscribe()
+	}()
+	return nil
+}
+
+// pushReply pushes the message to the connection, waiting up to the given time for room in its buffer,
+// and returns the outcome as a reply
+func pushReply(ctx context.Context, ws *wsConnections, owns func(connId ConnectionID) bool, connId ConnectionID, msg string, wait time.Duration) natsReply {
+	if len(connId) == 0 {
+		return natsReply{Status: http.StatusBadRequest, Error: "missing connection ID"}
+	}
+	if !owns(connId) {
+		return natsReply{Status: http.StatusForbidden, Error: "connection belongs to another gateway endpoint"}
+	}
+	pushErr := ws.pushWait(ctx, msg, connId, wait)
+	var overload loadmanagement.OverloadError
+	switch {
+	case pushErr == nil:
+		return natsReply{Status: http.StatusNoContent}
+	case errors.Is(pushErr, errConnectionNotFound):
+		return natsReply{Status: http.StatusNotFound, Error: pushErr.Error()}
+	case errors.As(pushErr, &overload):
+		return natsReply{Status: http.StatusServiceUnavailable, Error: pushErr.Error()}
+	default:
+		return natsReply{Status: http.StatusInternalServerError, Error: pushErr.Error()}
+	}
+}
@@ -0,0 +1,153 @@
+package wsgw
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"wsgw/internal/config"
+
+	"github.com/rs/zerolog"
+)
+
+// reloadableUpstream is implemented by the upstreams calling the backend at base URLs, whose replicas can be
+// replaced without dropping the connections
+type reloadableUpstream interface {
+	checkBaseUrls(baseUrls []string) error
+	setBaseUrls(baseUrls []string)
+}
+
+// Reload applies the settings which can change without dropping the connections:
+//   - the origin patterns of the gateway endpoints,
+//   - the connection limits of the named gateway endpoints,
+//   - the base URLs of the backends and of the backend profiles, with the HTTP upstream.
+//
+// Nothing is applied if any of the new base URLs is unusable. The other settings take effect on restart,
+// which is logged if any of them changed.
+func (s *Server) Reload(ctx context.Context, configuration config.Config) error {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "configReload").Logger()
+
+	s.reloadMux.Lock()
+	defer s.reloadMux.Unlock()
+	if s.endpoints == nil {
+		return errors.New("the server isn't set up yet")
+	}
+
+	type baseUrlsChange struct {
+		upstream reloadableUpstream
+		baseUrls []string
+	}
+	var baseUrlsChanges []baseUrlsChange
+	var applyEndpointChanges []func()
+
+	for _, endpoint := range s.endpoints {
+		endpointConfiguration, originPatterns, found := reloadedEndpointConfiguration(configuration, endpoint.name)
+		if !found {
+			continue
+		}
+
+		if upstream, ok := endpoint.router.defaultUpstream.(reloadableUpstream); ok {
+			baseUrls := defaultBackendBaseUrls(endpointConfiguration)
+			if checkErr := upstream.checkBaseUrls(baseUrls); checkErr != nil {
+				return fmt.Errorf("gateway endpoint %q: %w", endpoint.name, checkErr)
+			}
+			baseUrlsChanges = append(baseUrlsChanges, baseUrlsChange{upstream: upstream, baseUrls: baseUrls})
+		}
+		for profile, profileUpstream := range endpoint.router.profiles {
+			upstream, ok := profileUpstream.(reloadableUpstream)
+			baseUrls, configured := endpointConfiguration.Routing.Profiles[profile]
+			if !ok || !configured {
+				continue
+			}
+			if checkErr := upstream.checkBaseUrls(baseUrls); checkErr != nil {
+				return fmt.Errorf("gateway endpoint %q, backend profile %q: %w", endpoint.name, profile, checkErr)
+			}
+			baseUrlsChanges = append(baseUrlsChanges, baseUrlsChange{upstream: upstream, baseUrls: baseUrls})
+		}
+
+		applyEndpointChanges = append(applyEndpointChanges, func() {
+			endpoint.originPatterns.set(originPatterns)
+			if len(endpoint.name) > 0 {
+				endpointConfig := namedEndpointConfig(configuration, endpoint.name)
+				endpoint.wsConns.setLimits(endpointConfig.MessageBuffer, endpointConfig.MaxConnections)
+			}
+		})
+	}
+
+	for _, change := range baseUrlsChanges {
+		change.upstream.setBaseUrls(change.baseUrls)
+	}
+	for _, apply := range applyEndpointChanges {
+		apply()
+	}
+
+	if !reflect.DeepEqual(withoutReloadableSettings(s.configuration), withoutReloadableSettings(configuration)) {
+		logger.Warn().Msg("some of the changed settings only take effect after a restart")
+	}
+	logger.Info().Msg("configuration reloaded")
+	s.audit.admin(ctx, "configuration_reloaded", "", nil)
+	return nil
+}
+
+// reloadedEndpointConfiguration returns the configuration and the origin patterns of the gateway endpoint;
+// false if the endpoint is no longer configured
+func reloadedEndpointConfiguration(configuration config.Config, name string) (config.Config, []string, bool) {
+	if len(name) == 0 {
+		return configuration, defaultOriginPatterns(configuration), true
+	}
+	endpointConfig := namedEndpointConfig(configuration, name)
+	if endpointConfig == nil {
+		return config.Config{}, nil, false
+	}
+	return endpointConfiguration(configuration, *endpointConfig), endpointConfig.AllowedOrigins, true
+}
+
+func namedEndpointConfig(configuration config.Config, name string) *config.GatewayEndpointConfig {
+	index := slices.IndexFunc(configuration.Endpoints, func(endpointConfig config.GatewayEndpointConfig) bool {
+		return endpointConfig.Name == name
+	})
+	if index < 0 {
+		return nil
+	}
+	return &configuration.Endpoints[index]
+}
+
+// withoutReloadableSettings blanks the settings Reload applies, so that the configurations compare equal
+// unless a setting requiring a restart changed. Whether the base URLs are set matters, as it decides which
+// gateway endpoints and backend profiles there are.
+func withoutReloadableSettings(configuration config.Config) config.Config {
+	isSet := func(values []string) []string {
+		if len(values) == 0 {
+			return nil
+		}
+		return []string{"set"}
+	}
+
+	configuration.LogLevel = ""
+	configuration.LoadBalancerAddress = ""
+	if len(configuration.AppBaseUrl) > 0 {
+		configuration.AppBaseUrl = "set"
+	}
+	configuration.Upstreams.BaseUrls = isSet(configuration.Upstreams.BaseUrls)
+
+	var profiles map[string][]string
+	for profile, baseUrls := range configuration.Routing.Profiles {
+		if profiles == nil {
+			profiles = map[string][]string{}
+		}
+		profiles[profile] = isSet(baseUrls)
+	}
+	configuration.Routing.Profiles = profiles
+
+	endpoints := make([]config.GatewayEndpointConfig, 0, len(configuration.Endpoints))
+	for _, endpointConfig := range configuration.Endpoints {
+		endpointConfig.AppBaseUrls = isSet(endpointConfig.AppBaseUrls)
+		endpointConfig.AllowedOrigins = nil
+		endpointConfig.MaxConnections = 0
+		endpointConfig.MessageBuffer = 0
+		endpoints = append(endpoints, endpointConfig)
+	}
+	configuration.Endpoints = endpoints
+	return configuration
+}
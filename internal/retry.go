@@ -0,0 +1,50 @@
+package wsgw
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// retryPolicy describes how many times and how far apart a failing operation is attempted.
+// The delays grow exponentially from initialBackoff up to maxBackoff, with full jitter.
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// errPermanent marks errors which retrying won't fix
+var errPermanent = errors.New("permanent failure")
+
+// backoff returns the delay before the attempt following the given (1-based) attempt
+func (p retryPolicy) backoff(attempt int) time.Duration {
+	ceiling := p.initialBackoff
+	for i := 1; i < attempt && ceiling < p.maxBackoff; i++ {
+		ceiling *= 2
+	}
+	ceiling = min(ceiling, p.maxBackoff)
+	if ceiling <= 0 {
+		return 0
+	}
+	return rand.N(ceiling) + 1
+}
+
+// do calls fn until it succeeds, fails with an error wrapping errPermanent,
+// the attempts are exhausted or ctx is done. It returns the last error of fn.
+func (p retryPolicy) do(ctx context.Context, fn func(ctx context.Context, attempt int) error) error {
+	var err error
+	for attempt := 1; attempt <= max(p.maxAttempts, 1); attempt++ {
+		err = fn(ctx, attempt)
+		if err == nil || errors.Is(err, errPermanent) || attempt >= p.maxAttempts {
+			return err
+		}
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(p.backoff(attempt)):
+		}
+	}
+	return err
+}
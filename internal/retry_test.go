@@ -0,0 +1,90 @@
+package wsgw
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type retryPolicyTestSuite struct {
+	suite.Suite
+}
+
+func TestRetryPolicyTestSuite(t *testing.T) {
+	suite.Run(t, &retryPolicyTestSuite{})
+}
+
+func (s *retryPolicyTestSuite) TestBackoffGrowsUpToTheMaximum() {
+	policy := retryPolicy{maxAttempts: 10, initialBackoff: 10 * time.Millisecond, maxBackoff: 50 * time.Millisecond}
+	ceilings := map[int]time.Duration{
+		1: 10 * time.Millisecond,
+		2: 20 * time.Millisecond,
+		3: 40 * time.Millisecond,
+		4: 50 * time.Millisecond,
+		9: 50 * time.Millisecond,
+	}
+	for attempt, ceiling := range ceilings {
+		// Full jitter: the delays spread over (0, ceiling]
+		var longest time.Duration
+		for range 1000 {
+			backoff := policy.backoff(attempt)
+			s.Greater(backoff, time.Duration(0))
+			s.LessOrEqual(backoff, ceiling, "attempt %d", attempt)
+			longest = max(longest, backoff)
+		}
+		s.Greater(longest, ceiling/2, "attempt %d", attempt)
+	}
+	s.Zero(retryPolicy{}.backoff(1))
+}
+
+func (s *retryPolicyTestSuite) TestRetriesUntilSuccess() {
+	policy := retryPolicy{maxAttempts: 5, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+	var attempts []int
+	err := policy.do(context.Background(), func(_ context.Context, attempt int) error {
+		attempts = append(attempts, attempt)
+		if attempt < 3 {
+			return errors.New("unavailable")
+		}
+		return nil
+	})
+	s.NoError(err)
+	s.Equal([]int{1, 2, 3}, attempts)
+}
+
+func (s *retryPolicyTestSuite) TestGivesUpAfterTheLastAttempt() {
+	policy := retryPolicy{maxAttempts: 3, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+	calls := 0
+	err := policy.do(context.Background(), func(_ context.Context, attempt int) error {
+		calls++
+		return errors.New("unavailable")
+	})
+	s.EqualError(err, "unavailable")
+	s.Equal(3, calls)
+}
+
+func (s *retryPolicyTestSuite) TestDoesntRetryPermanentFailures() {
+	policy := retryPolicy{maxAttempts: 3, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+	calls := 0
+	err := policy.do(context.Background(), func(_ context.Context, attempt int) error {
+		calls++
+		return errors.Join(errPermanent, errors.New("rejected"))
+	})
+	s.ErrorIs(err, errPermanent)
+	s.Equal(1, calls)
+}
+
+func (s *retryPolicyTestSuite) TestStopsWhenTheContextIsDone() {
+	policy := retryPolicy{maxAttempts: 3, initialBackoff: time.Hour, maxBackoff: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	err := policy.do(ctx, func(_ context.Context, attempt int) error {
+		calls++
+		cancel()
+		return errors.New("unavailable")
+	})
+	s.ErrorIs(err, context.Canceled)
+	s.Equal(1, calls)
+}
@@ -0,0 +1,156 @@
+package wsgw
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"wsgw/internal/config"
+)
+
+const (
+	connectProfilePathParamName = "profile"
+	// defaultProfileName refers to the default backend in the message routes
+	defaultProfileName = "default"
+)
+
+// messageRoute sends the client messages with a matching routing key to a backend profile
+type messageRoute struct {
+	key string
+	// prefix makes the route match the routing keys starting with key
+	prefix   bool
+	upstream backendUpstream
+}
+
+func (r messageRoute) matches(routingKey string) bool {
+	if r.prefix {
+		return strings.HasPrefix(routingKey, r.key)
+	}
+	return routingKey == r.key
+}
+
+// backendRouter selects the backend profile the connections and the client messages go to
+type backendRouter struct {
+	// defaultUpstream serves the connections made through the plain connect path, nil if no default backend is configured
+	defaultUpstream backendUpstream
+	profiles        map[string]backendUpstream
+	messageField    string
+	topicSeparator  string
+	routes          []messageRoute
+}
+
+func newBackendRouter(ctx context.Context, configuration config.Config) (*backendRouter, error) {
+	mode := upstreamMode(orDefault(configuration.BackendUpstream, string(httpUpstreamMode)))
+	newUpstream, factoryErr := newUpstreamFactory(ctx, mode, configuration)
+	if factoryErr != nil {
+		return nil, factoryErr
+	}
+
+	router := &backendRouter{
+		profiles:       map[string]backendUpstream{},
+		messageField:   configuration.Routing.MessageField,
+		topicSeparator: configuration.Routing.TopicSeparator,
+	}
+
+	defaultBaseUrls := defaultBackendBaseUrls(configuration)
+	// With HTTP profiles only, there needs to be no default backend
+	if mode != httpUpstreamMode || len(defaultBaseUrls) > 0 || len(configuration.Routing.Profiles) == 0 {
+		defaultUpstream, upstreamErr := newUpstream("", defaultBaseUrls)
+		if upstreamErr != nil {
+			return nil, upstreamErr
+		}
+		router.defaultUpstream = defaultUpstream
+	}
+
+	for profile, baseUrls := range configuration.Routing.Profiles {
+		if profile == defaultProfileName {
+			return nil, fmt.Errorf("the backend profile name %q is reserved", defaultProfileName)
+		}
+		if mode == httpUpstreamMode && len(baseUrls) == 0 {
+			return nil, fmt.Errorf("no base URL is configured for the backend profile %q", profile)
+		}
+		upstream, upstreamErr := newUpstream(profile, baseUrls)
+		if upstreamErr != nil {
+			return nil, fmt.Errorf("backend profile %q: %w", profile, upstreamErr)
+		}
+		router.profiles[profile] = upstream
+	}
+
+	for _, route := range configuration.Routing.MessageRoutes {
+		key, profile, found := strings.Cut(route, "=")
+		if !found || len(key) == 0 {
+			return nil, fmt.Errorf("invalid message route %q: expected <routing-key>=<profile>", route)
+		}
+		upstream, ok := router.profileUpstream(profile)
+		if !ok {
+			return nil, fmt.Errorf("message route %q refers to an unknown backend profile", route)
+		}
+		prefix := strings.HasSuffix(key, "*")
+		router.routes = append(router.routes, messageRoute{key: strings.TrimSuffix(key, "*"), prefix: prefix, upstream: upstream})
+	}
+
+	return router, nil
+}
+
+// defaultBackendBaseUrls are the base URLs of the replicas of the default backend
+func defaultBackendBaseUrls(configuration config.Config) []string {
+	if len(configuration.Upstreams.BaseUrls) == 0 && len(configuration.AppBaseUrl) > 0 {
+		return []string{configuration.AppBaseUrl}
+	}
+	return configuration.Upstreams.BaseUrls
+}
+
+// profileUpstream returns the upstream of the named profile, "default" standing for the default backend
+func (r *backendRouter) profileUpstream(profile string) (backendUpstream, bool) {
+	if profile == defaultProfileName {
+		return r.defaultUpstream, r.defaultUpstream != nil
+	}
+	upstream, ok := r.profiles[profile]
+	return upstream, ok
+}
+
+// connectUpstream returns the upstream of the profile selected by the connect path; the default upstream for the plain path
+func (r *backendRouter) connectUpstream(profile string) (backendUpstream, bool) {
+	if len(profile) == 0 {
+		return r.defaultUpstream, r.defaultUpstream != nil
+	}
+	upstream, ok := r.profiles[profile]
+	return upstream, ok
+}
+
+// messageUpstream returns the upstream the client message is to be sent through: that of the first route matching
+// the routing key of the message, or the upstream of the connection if no route matches
+func (r *backendRouter) messageUpstream(connUpstream backendUpstream, msg string) backendUpstream {
+	if len(r.routes) == 0 {
+		return connUpstream
+	}
+	routingKey, ok := r.routingKey(msg)
+	if !ok {
+		return connUpstream
+	}
+	for _, route := range r.routes {
+		if route.matches(routingKey) {
+			return route.upstream
+		}
+	}
+	return connUpstream
+}
+
+// routingKey extracts the routing key from the configured JSON field or, failing that, from the topic prefix of the message
+func (r *backendRouter) routingKey(msg string) (string, bool) {
+	if len(r.messageField) > 0 {
+		var fields map[string]json.RawMessage
+		if json.Unmarshal([]byte(msg), &fields) == nil {
+			var value string
+			if json.Unmarshal(fields[r.messageField], &value) == nil {
+				return value, true
+			}
+		}
+	}
+	if len(r.topicSeparator) > 0 {
+		if topic, _, found := strings.Cut(msg, r.topicSeparator); found {
+			return topic, true
+		}
+	}
+	return "", false
+}
@@ -2,10 +2,13 @@ package wsgw
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 	"wsgw/internal/config"
 	"wsgw/pkgs/logging"
@@ -13,10 +16,14 @@ import (
 	"wsgw/pkgs/version_info"
 
 	"github.com/gin-gonic/gin"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/webtransport-go"
 	"github.com/rs/xid"
 	"github.com/rs/zerolog"
 	"golang.org/x/net/http2"
 	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
 )
 
 type EndpointPath string
@@ -25,11 +32,39 @@ const (
 	ConnectPath     EndpointPath = "/connect"
 	DisonnectedPath EndpointPath = "/disconnected"
 	MessagePath     EndpointPath = "/message"
+	MetricsPath     EndpointPath = "/metrics"
+	// ConnectionsPath is the admin path of the connection details, under the path prefix of the gateway endpoint
+	ConnectionsPath EndpointPath = "/connections"
 )
 
 type Server struct {
-	server             http.Server
-	createConnectionId func(ctx context.Context) ConnectionID
+	serversMux          sync.Mutex
+	servers             []*http.Server
+	grpcServers         []*grpc.Server
+	webTransportServers []*webtransport.Server
+	createConnectionId  func(ctx context.Context) ConnectionID
+
+	// reloadMux guards the gateway endpoints and the configuration they were set up with, for Reload
+	reloadMux     sync.Mutex
+	endpoints     []*gatewayEndpoint
+	configuration config.Config
+	audit         *auditLog
+	readiness     *readiness
+}
+
+// requestHandlers are what the listeners of wsgw serve
+type requestHandlers struct {
+	client http.Handler
+	// admin is nil unless the admin listener is enabled
+	admin http.Handler
+	// grpc is nil unless the gRPC push API is enabled
+	grpc *grpc.Server
+	// webTransport is nil unless WebTransport is enabled; it serves the client handler over HTTP/3
+	webTransport *webtransport.Server
+	endpoints    []*gatewayEndpoint
+	// audit is nil unless the audit log is enabled
+	audit     *auditLog
+	readiness *readiness
 }
 
 func NewServer(
@@ -43,35 +78,107 @@ func NewServer(
 
 // SetupAndStart sets up and starts server.
 func (s *Server) SetupAndStart(serverCtx context.Context, configuration config.Config, ready func(ctx context.Context, port int, stop func(ctx context.Context) error)) error {
-	r := createWsgwRequestHandler(configuration, s.createConnectionId)
-	return s.start(serverCtx, configuration, r, ready)
+	handlers, createHandlerErr := createWsgwRequestHandler(serverCtx, configuration, s.createConnectionId)
+	if createHandlerErr != nil {
+		return createHandlerErr
+	}
+	s.reloadMux.Lock()
+	s.endpoints, s.configuration, s.audit, s.readiness = handlers.endpoints, configuration, handlers.audit, handlers.readiness
+	s.reloadMux.Unlock()
+	return s.start(serverCtx, configuration, handlers, ready)
 }
 
 // For now, we assume that the backend authentication is managed ex-machina by the environment (AWS role or K8S NetworkPolicy
 // or by a service-mesh provider)
 // In the unlikely case of ex-machina control isn't available, OAuth2 client credentials flow could be easily supported.
 // (Use https://pkg.go.dev/github.com/golang-jwt/jwt/v4#example-package-GetTokenViaHTTP to verify the token.)
+// Alternatively, the admin listener can be set up to require client certificates (WSGW_ADMIN_TLS_CLIENT_CA_FILE).
 func authenticateBackend(_ *gin.Context) error {
 	return nil
 }
 
-// start starts the service
-func (s *Server) start(serverCtx context.Context, configuration config.Config, r http.Handler, ready func(ctx context.Context, port int, stop func(ctx context.Context) error)) error {
+// start starts the service: the client listener and, if configured, the admin listener, the gRPC listener and
+// the WebTransport listener. Without a listener of its own, the gRPC push API is served next to the HTTP push endpoint.
+func (s *Server) start(serverCtx context.Context, configuration config.Config, handlers requestHandlers, ready func(ctx context.Context, port int, stop func(ctx context.Context) error)) error {
 	logger := zerolog.Ctx(serverCtx).With().Logger()
+	clientHandler, adminHandler, grpcServer := handlers.client, handlers.admin, handlers.grpc
+
+	clientTLSOptions := serverTLSOptions{
+		certFile:       configuration.TLSCertFile,
+		keyFile:        configuration.TLSKeyFile,
+		minVersion:     configuration.TLSMinVersion,
+		cipherPolicy:   configuration.TLSCipherPolicy,
+		reloadInterval: configuration.TLSReloadInterval,
+	}
+	adminTLSOptions := serverTLSOptions{
+		certFile:       configuration.AdminTLSCertFile,
+		keyFile:        configuration.AdminTLSKeyFile,
+		minVersion:     configuration.TLSMinVersion,
+		cipherPolicy:   configuration.TLSCipherPolicy,
+		clientCAFile:   configuration.AdminTLSClientCAFile,
+		reloadInterval: configuration.TLSReloadInterval,
+	}
 
-	endpoint := fmt.Sprintf("%s:%d", configuration.ServerHost, configuration.ServerPort)
-	listener, err := net.Listen("tcp", endpoint)
-	if err != nil {
-		panic(fmt.Sprintf("Error while starting to listen at: %s", endpoint))
+	// The gRPC requests are told apart from the rest by the HTTP/2 listener serving the push endpoint
+	clientHttp2, adminHttp2 := configuration.Http2 || configuration.ClientHttp2, configuration.Http2
+	if clientHttp2 && !extendedConnectEnabled() {
+		logger.Warn().Msg("WebSockets over HTTP/2 need GODEBUG=http2xconnect=1, the clients will fall back to HTTP/1.1")
+	}
+	if grpcServer != nil && configuration.GrpcPushPort == 0 {
+		if adminHandler != nil {
+			adminHandler, adminHttp2 = withGrpc(adminHandler, grpcServer), true
+		} else if clientTLSOptions.enabled() && !clientHttp2 {
+			return errors.New("the gRPC push API can only share a TLS client listener with HTTP/2 enabled")
+		} else {
+			clientHandler, clientHttp2 = withGrpc(clientHandler, grpcServer), true
+		}
+	}
+
+	clientServer, clientListener, clientErr := s.createServer(serverCtx, "client", configuration.ServerHost, configuration.ServerPort, clientHandler, clientHttp2, clientTLSOptions)
+	if clientErr != nil {
+		return clientErr
 	}
-	logger.Info().Msgf("wsgw instance is listening at %s", listener.Addr().String())
+	serveFuncs := []func() error{func() error { return serve(clientServer, clientListener) }}
 
-	_, port, err := net.SplitHostPort(listener.Addr().String())
+	if adminHandler != nil {
+		adminServer, adminListener, adminErr := s.createServer(serverCtx, "admin", configuration.AdminServerHost, configuration.AdminServerPort, adminHandler, adminHttp2, adminTLSOptions)
+		if adminErr != nil {
+			clientListener.Close()
+			return adminErr
+		}
+		serveFuncs = append(serveFuncs, func() error { return serve(adminServer, adminListener) })
+	}
+
+	if grpcServer != nil {
+		s.serversMux.Lock()
+		s.grpcServers = append(s.grpcServers, grpcServer)
+		s.serversMux.Unlock()
+	}
+	if grpcServer != nil && configuration.GrpcPushPort != 0 {
+		grpcListener, grpcErr := s.createGrpcListener(serverCtx, grpcServer, configuration.AdminServerHost, configuration.GrpcPushPort, adminTLSOptions)
+		if grpcErr != nil {
+			clientListener.Close()
+			return grpcErr
+		}
+		serveFuncs = append(serveFuncs, func() error { return grpcServer.Serve(grpcListener) })
+	}
+
+	if handlers.webTransport != nil {
+		webTransportConn, webTransportErr := s.createWebTransportListener(serverCtx, handlers.webTransport, configuration.ServerHost, configuration.WebTransportPort, clientTLSOptions)
+		if webTransportErr != nil {
+			clientListener.Close()
+			return webTransportErr
+		}
+		serveFuncs = append(serveFuncs, func() error { return serveWebTransport(handlers.webTransport, webTransportConn) })
+	}
+
+	_, port, err := net.SplitHostPort(clientListener.Addr().String())
 	if err != nil {
 		panic(fmt.Sprintf("Error while parsing the server address: %v", err))
 	}
 
 	logger.Info().Msgf("Listening on port: %s", port)
+	handlers.readiness.listening.Store(true)
 
 	if ready != nil {
 		portAsInt, err := strconv.Atoi(port)
@@ -81,29 +188,175 @@ func (s *Server) start(serverCtx context.Context, configuration config.Config, r
 		ready(serverCtx, portAsInt, s.Stop)
 	}
 
-	var handler http.Handler = r
-	if configuration.Http2 {
-		handler = h2c.NewHandler(r, &http2.Server{})
-		logger.Info().Msg("HTTP/2 (h2c) enabled")
+	if len(serveFuncs) == 1 {
+		return serveFuncs[0]()
 	}
 
+	errChan := make(chan error, len(serveFuncs)-1)
+	for _, serveFunc := range serveFuncs[1:] {
+		go func() {
+			errChan <- serveFunc()
+		}()
+	}
+	serveErr := serveFuncs[0]()
+	for range serveFuncs[1:] {
+		serveErr = errors.Join(serveErr, <-errChan)
+	}
+	return serveErr
+}
+
+// createGrpcListener creates the listener of the gRPC push API, with the TLS settings of the admin listener
+func (s *Server) createGrpcListener(serverCtx context.Context, grpcServer *grpc.Server, host string, port int, tlsOptions serverTLSOptions) (net.Listener, error) {
+	logger := zerolog.Ctx(serverCtx).With().Str("listener", "grpc").Logger()
+
+	listener, err := net.Listen("tcp", fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for the gRPC push API: %w", err)
+	}
+	if tlsOptions.enabled() {
+		tlsConfig, tlsErr := newServerTLSConfig(serverCtx, tlsOptions)
+		if tlsErr != nil {
+			listener.Close()
+			return nil, fmt.Errorf("failed to set up TLS for the grpc listener: %w", tlsErr)
+		}
+		tlsConfig.NextProtos = []string{"h2"}
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+	logger.Info().Bool("tls", tlsOptions.enabled()).Msgf("wsgw gRPC push API is listening at %s", listener.Addr().String())
+	return listener, nil
+}
+
+// createWebTransportListener creates the UDP listener of WebTransport, with the TLS settings of the client listener
+func (s *Server) createWebTransportListener(serverCtx context.Context, webTransportServer *webtransport.Server, host string, port int, tlsOptions serverTLSOptions) (net.PacketConn, error) {
+	logger := zerolog.Ctx(serverCtx).With().Str("listener", "webtransport").Logger()
+
+	if !tlsOptions.enabled() {
+		return nil, errors.New("WebTransport requires TLS on the client listener")
+	}
+	tlsConfig, tlsErr := newServerTLSConfig(serverCtx, tlsOptions)
+	if tlsErr != nil {
+		return nil, fmt.Errorf("failed to set up TLS for the webtransport listener: %w", tlsErr)
+	}
+	webTransportServer.H3.TLSConfig = http3.ConfigureTLSConfig(tlsConfig)
+
+	conn, err := net.ListenPacket("udp", fmt.Sprintf("%s:%d", host, port))
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen for WebTransport: %w", err)
+	}
+	logger.Info().Msgf("wsgw WebTransport endpoint is listening at %s (experimental)", conn.LocalAddr().String())
+
+	s.serversMux.Lock()
+	s.webTransportServers = append(s.webTransportServers, webTransportServer)
+	s.serversMux.Unlock()
+
+	return conn, nil
+}
+
+// createServer creates the listener and the HTTP server of one of wsgw's endpoints
+func (s *Server) createServer(serverCtx context.Context, name string, host string, port int, handler http.Handler, http2Enabled bool, tlsOptions serverTLSOptions) (*http.Server, net.Listener, error) {
+	logger := zerolog.Ctx(serverCtx).With().Str("listener", name).Logger()
+
+	var tlsConfig *tls.Config
+	if tlsOptions.enabled() {
+		var tlsErr error
+		tlsConfig, tlsErr = newServerTLSConfig(serverCtx, tlsOptions)
+		if tlsErr != nil {
+			return nil, nil, fmt.Errorf("failed to set up TLS for the %s listener: %w", name, tlsErr)
+		}
+	} else if len(tlsOptions.clientCAFile) > 0 {
+		return nil, nil, fmt.Errorf("client certificate verification requires TLS to be enabled on the %s listener", name)
+	}
+
+	endpoint := fmt.Sprintf("%s:%d", host, port)
+	listener, err := net.Listen("tcp", endpoint)
+	if err != nil {
+		panic(fmt.Sprintf("Error while starting to listen at: %s", endpoint))
+	}
+	logger.Info().Bool("tls", tlsConfig != nil).Msgf("wsgw instance is listening at %s", listener.Addr().String())
+
 	server := &http.Server{
 		BaseContext:       func(l net.Listener) context.Context { return serverCtx },
 		Handler:           handler,
+		TLSConfig:         tlsConfig,
 		ReadHeaderTimeout: 90 * time.Second,
 		ReadTimeout:       90 * time.Second,
 		WriteTimeout:      90 * time.Second,
 		IdleTimeout:       90 * time.Second,
 	}
 
+	switch {
+	case http2Enabled && tlsConfig == nil:
+		server.Handler = h2c.NewHandler(handler, &http2.Server{})
+		logger.Info().Msg("HTTP/2 (h2c) enabled")
+	case http2Enabled:
+		logger.Info().Msg("HTTP/2 (h2) enabled")
+	case tlsConfig != nil:
+		// Without this, net/http would negotiate h2 via ALPN, which WS upgrades don't work over
+		server.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	}
+
+	s.serversMux.Lock()
+	s.servers = append(s.servers, server)
+	s.serversMux.Unlock()
+
+	return server, listener, nil
+}
+
+func serve(server *http.Server, listener net.Listener) error {
+	if server.TLSConfig != nil {
+		return server.ServeTLS(listener, "", "")
+	}
 	return server.Serve(listener)
 }
 
-// Stop kills the listener
+func serveWebTransport(server *webtransport.Server, conn net.PacketConn) error {
+	serveErr := server.Serve(conn)
+	if errors.Is(serveErr, quic.ErrServerClosed) || errors.Is(serveErr, context.Canceled) {
+		return nil
+	}
+	return serveErr
+}
+
+// Drain makes the readiness probe fail, then waits for WSGW_SHUTDOWN_DRAIN_DELAY while the listeners keep serving,
+// so that the load balancers stop sending new clients before Stop
+func (s *Server) Drain(ctx context.Context) {
+	s.reloadMux.Lock()
+	readiness := s.readiness
+	s.reloadMux.Unlock()
+	if readiness != nil {
+		readiness.drain(ctx)
+	}
+}
+
+// Stop kills the listeners
 func (s *Server) Stop(ctx context.Context) error {
 	logger := zerolog.Ctx(ctx).With().Logger()
 	logger.Info().Msgf("Shutting down server...")
-	shutdownErr := s.server.Shutdown(ctx)
+	s.reloadMux.Lock()
+	if s.readiness != nil {
+		s.readiness.draining.Store(true)
+		s.readiness.listening.Store(false)
+	}
+	s.reloadMux.Unlock()
+	s.serversMux.Lock()
+	servers := s.servers
+	grpcServers := s.grpcServers
+	webTransportServers := s.webTransportServers
+	s.serversMux.Unlock()
+	// The gRPC streams are long-lived, they would hold up the shutdown of the HTTP servers
+	for _, grpcServer := range grpcServers {
+		grpcServer.Stop()
+	}
+	var shutdownErr error
+	for _, webTransportServer := range webTransportServers {
+		shutdownErr = errors.Join(shutdownErr, webTransportServer.Close())
+	}
+	for _, server := range servers {
+		shutdownErr = errors.Join(shutdownErr, server.Shutdown(ctx))
+	}
+	s.reloadMux.Lock()
+	shutdownErr = errors.Join(shutdownErr, s.audit.close(), closeGatewayEndpoints(s.endpoints))
+	s.reloadMux.Unlock()
 	if shutdownErr != nil {
 		logger.Error().Err(shutdownErr).Msgf("Error while shutting down server")
 	} else {
@@ -112,58 +365,92 @@ func (s *Server) Stop(ctx context.Context) error {
 	return shutdownErr
 }
 
-func createWsgwRequestHandler(configuration config.Config, createConnectionId func(ctx context.Context) ConnectionID) *gin.Engine {
-	configureAppHTTPClient(configuration.Http2)
-
-	rootEngine := gin.Default()
+// newEngine creates a gin engine with the middlewares common to all listeners
+func newEngine(unitName string, debugSessions *debugSessions) *gin.Engine {
+	engine := gin.Default()
 
-	rootEngine.Use(RequestLogger("websocketGatewayServer"))
+	engine.Use(RequestLogger(unitName))
+	engine.Use(debugSessions.middleware())
 
-	rootEngine.Use(monitoring.NewOtelTraceExtraction())
+	engine.Use(monitoring.NewOtelTraceExtraction())
 
-	rootEngine.GET("/app-info", func(c *gin.Context) {
+	engine.GET("/app-info", func(c *gin.Context) {
 		c.JSON(200, version_info.GetVersionInfo(config.GetVersionData()))
 	})
 
-	wsConns := newWsConnections()
+	return engine
+}
 
-	appUrls := &appURLs{
-		baseUrl: configuration.AppBaseUrl,
+// createWsgwRequestHandler creates the request handler for the clients and, if the admin listener is enabled,
+// the one for the backend. Otherwise, the admin handler is nil and the backend-facing endpoints
+// are served by the client handler.
+func createWsgwRequestHandler(ctx context.Context, configuration config.Config, createConnectionId func(ctx context.Context) ConnectionID) (requestHandlers, error) {
+	audit := newAuditLog(configuration.AuditLog)
+	events, eventsErr := newLifecycleNotifier(configuration)
+	if eventsErr != nil {
+		return requestHandlers{}, fmt.Errorf("failed to set up the connection events: %w", eventsErr)
+	}
+	endpoints, endpointsErr := newGatewayEndpoints(ctx, configuration, audit, events)
+	if endpointsErr != nil {
+		return requestHandlers{}, endpointsErr
+	}
+	if events != nil {
+		go events.run(ctx)
 	}
 
-	rootEngine.GET(
-		string(ConnectPath),
-		connectHandler(
-			appUrls,
-			wsConns,
-			configuration.LoadBalancerAddress,
-			createConnectionId,
-			configuration.AckNewConnWithConnId,
-		),
-	)
+	debugSessions := newDebugSessions(audit)
+	clientEngine := newEngine("websocketGatewayServer", debugSessions)
 
-	rootEngine.POST(
-		fmt.Sprintf("/message/:%s", connIdPathParamName),
-		pushHandler(wsConns),
-	)
+	adminEngine := clientEngine
+	if configuration.AdminServerPort != 0 {
+		adminEngine = newEngine("websocketGatewayAdmin", debugSessions)
+	}
+	debugSessions.register(adminEngine)
 
-	return rootEngine
-}
+	readiness, readinessErr := newReadiness(configuration)
+	if readinessErr != nil {
+		_ = closeGatewayEndpoints(endpoints)
+		return requestHandlers{}, fmt.Errorf("failed to set up the readiness probe: %w", readinessErr)
+	}
+	readiness.register(clientEngine)
+	if adminEngine != clientEngine {
+		readiness.register(adminEngine)
+	}
+	if readiness.backendProbe != nil {
+		go readiness.backendProbe.run(ctx)
+	}
+	if configuration.MetricsEnabled {
+		adminEngine.GET(string(MetricsPath), gin.WrapH(monitoring.MetricsHandler()))
+	}
 
-type appURLs struct {
-	baseUrl string
-}
+	var webTransportServer *webtransport.Server
+	if configuration.WebTransportPort != 0 {
+		webTransportServer = newWebTransportServer(clientEngine)
+	}
 
-func (u *appURLs) connecting() string {
-	return fmt.Sprintf("%s/ws%s", u.baseUrl, ConnectPath)
-}
+	endpointNames := map[string]bool{}
+	for _, endpoint := range endpoints {
+		if len(endpoint.name) > 0 {
+			endpointNames[endpoint.name] = true
+		}
+	}
+	for _, endpoint := range endpoints {
+		if registerErr := endpoint.register(ctx, clientEngine, adminEngine, webTransportServer, createConnectionId, endpointNames); registerErr != nil {
+			_ = closeGatewayEndpoints(endpoints)
+			return requestHandlers{}, registerErr
+		}
+	}
 
-func (u *appURLs) disconnected() string {
-	return fmt.Sprintf("%s/ws%s", u.baseUrl, DisonnectedPath)
-}
+	var grpcServer *grpc.Server
+	if configuration.GrpcPushEnabled {
+		grpcServer = newGrpcPushServer(endpoints, endpointNames)
+	}
 
-func (u *appURLs) message() string {
-	return fmt.Sprintf("%s/ws%s", u.baseUrl, MessagePath)
+	handlers := requestHandlers{client: clientEngine, grpc: grpcServer, webTransport: webTransportServer, endpoints: endpoints, audit: audit, readiness: readiness}
+	if adminEngine != clientEngine {
+		handlers.admin = adminEngine
+	}
+	return handlers, nil
 }
 
 func RequestLogger(unitName string) func(g *gin.Context) {
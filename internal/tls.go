@@ -0,0 +1,197 @@
+package wsgw
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const defaultCertReloadInterval = 10 * time.Second
+
+// serverTLSOptions describe the TLS setup of one of the listeners.
+type serverTLSOptions struct {
+	certFile     string
+	keyFile      string
+	minVersion   string
+	cipherPolicy string
+	// clientCAFile, if set, turns on mTLS: clients must present a certificate signed by one of the CAs in the file.
+	clientCAFile   string
+	reloadInterval time.Duration
+}
+
+func (o serverTLSOptions) enabled() bool {
+	return len(o.certFile) > 0 || len(o.keyFile) > 0
+}
+
+func parseTLSVersion(version string) (uint16, error) {
+	switch version {
+	case "", "1.2":
+		return tls.VersionTLS12, nil
+	case "1.3":
+		return tls.VersionTLS13, nil
+	default:
+		return 0, fmt.Errorf("unsupported TLS minimum version %q: expected 1.2 or 1.3", version)
+	}
+}
+
+// cipherSuites returns the cipher suites allowed by the policy for TLS 1.2 (TLS 1.3 suites aren't configurable in Go).
+//   - "default": Go's default selection
+//   - "modern": TLS 1.2 ECDHE suites with AEAD ciphers and forward secrecy only
+func cipherSuites(policy string) ([]uint16, error) {
+	switch policy {
+	case "", "default":
+		return nil, nil
+	case "modern":
+		return []uint16{
+			tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+			tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported TLS cipher policy %q: expected default or modern", policy)
+	}
+}
+
+// newServerTLSConfig creates the TLS configuration of a listener. The certificate is
+// reloaded from disk whenever the certificate or the key file changes, until ctx is done.
+func newServerTLSConfig(ctx context.Context, options serverTLSOptions) (*tls.Config, error) {
+	if len(options.certFile) == 0 || len(options.keyFile) == 0 {
+		return nil, errors.New("both the TLS certificate and the key file must be specified")
+	}
+
+	minVersion, versionErr := parseTLSVersion(options.minVersion)
+	if versionErr != nil {
+		return nil, versionErr
+	}
+	suites, suitesErr := cipherSuites(options.cipherPolicy)
+	if suitesErr != nil {
+		return nil, suitesErr
+	}
+
+	reloader, reloaderErr := newCertReloader(options.certFile, options.keyFile)
+	if reloaderErr != nil {
+		return nil, reloaderErr
+	}
+	reloadInterval := options.reloadInterval
+	if reloadInterval <= 0 {
+		reloadInterval = defaultCertReloadInterval
+	}
+	go reloader.watch(ctx, reloadInterval)
+
+	tlsConfig := &tls.Config{
+		MinVersion:     minVersion,
+		CipherSuites:   suites,
+		GetCertificate: reloader.getCertificate,
+	}
+
+	if len(options.clientCAFile) > 0 {
+		caPool, caErr := loadCertPool(options.clientCAFile)
+		if caErr != nil {
+			return nil, caErr
+		}
+		tlsConfig.ClientCAs = caPool
+		tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return tlsConfig, nil
+}
+
+func loadCertPool(caFile string) (*x509.CertPool, error) {
+	pem, readErr := os.ReadFile(caFile)
+	if readErr != nil {
+		return nil, fmt.Errorf("failed to read CA file %s: %w", caFile, readErr)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("no PEM certificates found in CA file %s", caFile)
+	}
+	return pool, nil
+}
+
+// certReloader serves the current certificate of a key pair and reloads it when the files change.
+type certReloader struct {
+	certFile string
+	keyFile  string
+
+	mux         sync.RWMutex
+	cert        *tls.Certificate
+	certModTime time.Time
+	keyModTime  time.Time
+}
+
+func newCertReloader(certFile string, keyFile string) (*certReloader, error) {
+	reloader := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, loadErr := reloader.reloadIfChanged(); loadErr != nil {
+		return nil, loadErr
+	}
+	return reloader, nil
+}
+
+func (r *certReloader) getCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mux.RLock()
+	defer r.mux.RUnlock()
+	return r.cert, nil
+}
+
+// reloadIfChanged loads the key pair if either file has been modified since the last load.
+// On failure the previously loaded certificate stays in use.
+func (r *certReloader) reloadIfChanged() (bool, error) {
+	certInfo, certStatErr := os.Stat(r.certFile)
+	if certStatErr != nil {
+		return false, fmt.Errorf("failed to stat TLS certificate file: %w", certStatErr)
+	}
+	keyInfo, keyStatErr := os.Stat(r.keyFile)
+	if keyStatErr != nil {
+		return false, fmt.Errorf("failed to stat TLS key file: %w", keyStatErr)
+	}
+
+	r.mux.RLock()
+	unchanged := r.cert != nil && certInfo.ModTime().Equal(r.certModTime) && keyInfo.ModTime().Equal(r.keyModTime)
+	r.mux.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, loadErr := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if loadErr != nil {
+		return false, fmt.Errorf("failed to load TLS key pair: %w", loadErr)
+	}
+
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.cert = &cert
+	r.certModTime = certInfo.ModTime()
+	r.keyModTime = keyInfo.ModTime()
+	return true, nil
+}
+
+func (r *certReloader) watch(ctx context.Context, interval time.Duration) {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "certReloader").Str("certFile", r.certFile).Logger()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, reloadErr := r.reloadIfChanged()
+			if reloadErr != nil {
+				logger.Error().Err(reloadErr).Msg("failed to reload TLS certificate, keeping the current one")
+				continue
+			}
+			if reloaded {
+				logger.Info().Msg("TLS certificate reloaded")
+			}
+		}
+	}
+}
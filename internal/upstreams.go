@@ -0,0 +1,246 @@
+package wsgw
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+	"wsgw/internal/config"
+
+	"github.com/rs/zerolog"
+)
+
+type balancingPolicy string
+
+const (
+	roundRobin    balancingPolicy = "round_robin"
+	leastInFlight balancingPolicy = "least_in_flight"
+)
+
+const (
+	defaultHealthCheckInterval = 5 * time.Second
+	defaultHealthCheckTimeout  = 2 * time.Second
+	defaultUnhealthyThreshold  = 2
+	defaultHealthyThreshold    = 2
+)
+
+// upstream is one of the replicas of the backend
+type upstream struct {
+	baseUrl  string
+	healthy  atomic.Bool
+	inFlight atomic.Int64
+
+	// only accessed by the health checker
+	consecutiveFailures  int
+	consecutiveSuccesses int
+}
+
+// upstreamPool selects the replica of the backend the calls go to
+type upstreamPool struct {
+	// upstreams are replaced when the base URLs are reloaded
+	upstreams atomic.Pointer[[]*upstream]
+	policy    balancingPolicy
+	// sticky makes all the calls of a connection go to the same (healthy) replica
+	sticky bool
+	next   atomic.Uint64
+
+	healthCheckPath     string
+	healthCheckInterval time.Duration
+	healthCheckTimeout  time.Duration
+	unhealthyThreshold  int
+	healthyThreshold    int
+}
+
+func newUpstreamPool(baseUrls []string, upstreamsConfig config.UpstreamsConfig) (*upstreamPool, error) {
+	policy := balancingPolicy(orDefault(upstreamsConfig.Balancing, string(roundRobin)))
+	if policy != roundRobin && policy != leastInFlight {
+		return nil, fmt.Errorf("unsupported upstream balancing policy %q: expected %s or %s", policy, roundRobin, leastInFlight)
+	}
+
+	pool := &upstreamPool{
+		policy:              policy,
+		sticky:              upstreamsConfig.Sticky,
+		healthCheckPath:     upstreamsConfig.HealthCheckPath,
+		healthCheckInterval: orDefault(upstreamsConfig.HealthCheckInterval, defaultHealthCheckInterval),
+		healthCheckTimeout:  orDefault(upstreamsConfig.HealthCheckTimeout, defaultHealthCheckTimeout),
+		unhealthyThreshold:  orDefault(upstreamsConfig.UnhealthyThreshold, defaultUnhealthyThreshold),
+		healthyThreshold:    orDefault(upstreamsConfig.HealthyThreshold, defaultHealthyThreshold),
+	}
+	pool.setBaseUrls(baseUrls)
+	return pool, nil
+}
+
+func (p *upstreamPool) current() []*upstream {
+	return *p.upstreams.Load()
+}
+
+// setBaseUrls replaces the replicas. Those kept keep their health and their calls in flight; the new ones
+// start healthy.
+func (p *upstreamPool) setBaseUrls(baseUrls []string) {
+	existing := map[string]*upstream{}
+	if current := p.upstreams.Load(); current != nil {
+		for _, u := range *current {
+			existing[u.baseUrl] = u
+		}
+	}
+	upstreams := make([]*upstream, 0, len(baseUrls))
+	for _, baseUrl := range baseUrls {
+		u, ok := existing[baseUrl]
+		if !ok {
+			u = &upstream{baseUrl: baseUrl}
+			u.healthy.Store(true)
+		}
+		upstreams = append(upstreams, u)
+	}
+	p.upstreams.Store(&upstreams)
+}
+
+// pick selects the replica for a call of the connection. The returned function must be called when the call is done.
+// If no replica is healthy, all of them are considered: failing calls are preferable to not trying at all.
+func (p *upstreamPool) pick(connId ConnectionID) (*upstream, func()) {
+	candidates := p.healthyUpstreams()
+	if len(candidates) == 0 {
+		candidates = p.current()
+	}
+
+	var selected *upstream
+	switch {
+	case len(candidates) == 1:
+		selected = candidates[0]
+	case p.sticky && len(connId) > 0:
+		selected = rendezvous(candidates, connId)
+	case p.policy == leastInFlight:
+		selected = p.leastLoaded(candidates)
+	default:
+		selected = candidates[p.next.Add(1)%uint64(len(candidates))]
+	}
+
+	selected.inFlight.Add(1)
+	return selected, func() { selected.inFlight.Add(-1) }
+}
+
+func (p *upstreamPool) healthyUpstreams() []*upstream {
+	upstreams := p.current()
+	healthy := make([]*upstream, 0, len(upstreams))
+	for _, u := range upstreams {
+		if u.healthy.Load() {
+			healthy = append(healthy, u)
+		}
+	}
+	return healthy
+}
+
+// leastLoaded returns the replica with the fewest calls in flight, rotating among the equally loaded ones
+func (p *upstreamPool) leastLoaded(candidates []*upstream) *upstream {
+	offset := int(p.next.Add(1) % uint64(len(candidates)))
+	var selected *upstream
+	for i := range candidates {
+		u := candidates[(offset+i)%len(candidates)]
+		if selected == nil || u.inFlight.Load() < selected.inFlight.Load() {
+			selected = u
+		}
+	}
+	return selected
+}
+
+// rendezvous selects the replica with the highest hash weight for the connection (HRW hashing).
+// As a consistent hashing scheme, it only moves the connections of a replica becoming (un)healthy.
+func rendezvous(candidates []*upstream, connId ConnectionID) *upstream {
+	var selected *upstream
+	var selectedWeight uint64
+	for _, u := range candidates {
+		h := fnv.New64a()
+		h.Write([]byte(u.baseUrl))
+		h.Write([]byte{0})
+		h.Write([]byte(connId))
+		if weight := mix(h.Sum64()); selected == nil || weight > selectedWeight {
+			selected, selectedWeight = u, weight
+		}
+	}
+	return selected
+}
+
+// mix is the finalizer of SplitMix64. FNV spreads the last bytes hashed poorly over the high bits, which would
+// have the replica URL, not the connection, decide the weights.
+func mix(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
+
+// runHealthChecks probes the replicas periodically until ctx is done, as long as there are several of them.
+// No-op if no health check path is configured.
+func (p *upstreamPool) runHealthChecks(ctx context.Context, httpClient *http.Client) {
+	if len(p.healthCheckPath) == 0 {
+		return
+	}
+	logger := zerolog.Ctx(ctx).With().Str("unit", "upstreamHealthCheck").Logger()
+
+	ticker := time.NewTicker(p.healthCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		upstreams := p.current()
+		if len(upstreams) < 2 {
+			continue
+		}
+		var wg sync.WaitGroup
+		for _, u := range upstreams {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				p.checkHealth(ctx, httpClient, u, logger)
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+func (p *upstreamPool) checkHealth(ctx context.Context, httpClient *http.Client, u *upstream, logger zerolog.Logger) {
+	ctx, cancel := context.WithTimeout(ctx, p.healthCheckTimeout)
+	defer cancel()
+
+	probeErr := func() error {
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, u.baseUrl+p.healthCheckPath, nil)
+		if err != nil {
+			return err
+		}
+		response, err := httpClient.Do(request)
+		if err != nil {
+			return err
+		}
+		defer cleanupResponse(response)
+		if response.StatusCode < 200 || response.StatusCode > 299 {
+			return fmt.Errorf("received status code %d", response.StatusCode)
+		}
+		return nil
+	}()
+
+	if probeErr != nil {
+		u.consecutiveSuccesses = 0
+		u.consecutiveFailures++
+		if u.healthy.Load() && u.consecutiveFailures >= p.unhealthyThreshold {
+			u.healthy.Store(false)
+			logger.Warn().Err(probeErr).Str("upstream", u.baseUrl).Msg("upstream became unhealthy")
+		}
+		return
+	}
+
+	u.consecutiveFailures = 0
+	u.consecutiveSuccesses++
+	if !u.healthy.Load() && u.consecutiveSuccesses >= p.healthyThreshold {
+		u.healthy.Store(true)
+		logger.Info().Str("upstream", u.baseUrl).Msg("upstream became healthy")
+	}
+}
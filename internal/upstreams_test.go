@@ -0,0 +1,188 @@
+package wsgw
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"wsgw/internal/config"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type upstreamPoolTestSuite struct {
+	suite.Suite
+}
+
+func TestUpstreamPoolTestSuite(t *testing.T) {
+	suite.Run(t, &upstreamPoolTestSuite{})
+}
+
+func (s *upstreamPoolTestSuite) newPool(upstreamsConfig config.UpstreamsConfig, baseUrls ...string) *upstreamPool {
+	pool, poolErr := newUpstreamPool(baseUrls, upstreamsConfig)
+	s.Require().NoError(poolErr)
+	return pool
+}
+
+// picked returns the base URL of the replica picked for the connection, completing the call right away
+func (s *upstreamPoolTestSuite) picked(pool *upstreamPool, connId ConnectionID) string {
+	selected, done := pool.pick(connId)
+	done()
+	return selected.baseUrl
+}
+
+func (s *upstreamPoolTestSuite) TestRejectsUnknownPolicy() {
+	_, poolErr := newUpstreamPool([]string{"http://a"}, config.UpstreamsConfig{Balancing: "random"})
+	s.Error(poolErr)
+}
+
+func (s *upstreamPoolTestSuite) TestRoundRobin() {
+	pool := s.newPool(config.UpstreamsConfig{}, "http://a", "http://b", "http://c")
+	counts := map[string]int{}
+	for range 30 {
+		counts[s.picked(pool, "conn")]++
+	}
+	s.Equal(map[string]int{"http://a": 10, "http://b": 10, "http://c": 10}, counts)
+}
+
+func (s *upstreamPoolTestSuite) TestLeastInFlight() {
+	pool := s.newPool(config.UpstreamsConfig{Balancing: string(leastInFlight)}, "http://a", "http://b", "http://c")
+	first, doneFirst := pool.pick("")
+	second, doneSecond := pool.pick("")
+	third, doneThird := pool.pick("")
+	s.ElementsMatch([]string{"http://a", "http://b", "http://c"}, []string{first.baseUrl, second.baseUrl, third.baseUrl})
+
+	// Only the replica done with its call is the least loaded
+	doneSecond()
+	for range 5 {
+		s.Equal(second.baseUrl, s.picked(pool, ""))
+	}
+	doneFirst()
+	doneThird()
+	for _, u := range pool.current() {
+		s.Zero(u.inFlight.Load(), u.baseUrl)
+	}
+}
+
+func (s *upstreamPoolTestSuite) TestStickyMovesOnlyTheConnectionsOfAnUnhealthyReplica() {
+	pool := s.newPool(config.UpstreamsConfig{Sticky: true}, "http://a", "http://b", "http://c")
+	before := map[ConnectionID]string{}
+	for i := range 100 {
+		connId := ConnectionID(fmt.Sprintf("conn-%d", i))
+		before[connId] = s.picked(pool, connId)
+		s.Equal(before[connId], s.picked(pool, connId), "the calls of a connection go to the same replica")
+	}
+	perReplica := map[string]int{}
+	for _, baseUrl := range before {
+		perReplica[baseUrl]++
+	}
+	s.Len(perReplica, 3)
+	for baseUrl, count := range perReplica {
+		s.Greater(count, 15, "the connections are spread evenly, %s only has %d", baseUrl, count)
+	}
+
+	pool.current()[1].healthy.Store(false)
+	for connId, baseUrl := range before {
+		after := s.picked(pool, connId)
+		if baseUrl == "http://b" {
+			s.NotEqual("http://b", after)
+		} else {
+			s.Equal(baseUrl, after, "connection %s moved", connId)
+		}
+	}
+
+	// Back to healthy, the connections go back to it
+	pool.current()[1].healthy.Store(true)
+	for connId, baseUrl := range before {
+		s.Equal(baseUrl, s.picked(pool, connId))
+	}
+}
+
+func (s *upstreamPoolTestSuite) TestSkipsUnhealthyReplicasUnlessAllAre() {
+	pool := s.newPool(config.UpstreamsConfig{}, "http://a", "http://b")
+	pool.current()[0].healthy.Store(false)
+	for range 4 {
+		s.Equal("http://b", s.picked(pool, ""))
+	}
+
+	pool.current()[1].healthy.Store(false)
+	counts := map[string]int{}
+	for range 4 {
+		counts[s.picked(pool, "")]++
+	}
+	s.Equal(map[string]int{"http://a": 2, "http://b": 2}, counts)
+}
+
+func (s *upstreamPoolTestSuite) TestReloadKeepsTheStateOfTheKeptReplicas() {
+	pool := s.newPool(config.UpstreamsConfig{}, "http://a", "http://b")
+	pool.current()[0].healthy.Store(false)
+	_, done := pool.pick("")
+	defer done()
+
+	pool.setBaseUrls([]string{"http://b", "http://c"})
+	upstreams := pool.current()
+	s.Require().Len(upstreams, 2)
+	s.Equal("http://b", upstreams[0].baseUrl)
+	s.EqualValues(1, upstreams[0].inFlight.Load())
+	s.Equal("http://c", upstreams[1].baseUrl)
+	s.True(upstreams[1].healthy.Load())
+
+	pool.setBaseUrls([]string{"http://a"})
+	s.True(pool.current()[0].healthy.Load(), "a replica added again starts healthy")
+}
+
+func (s *upstreamPoolTestSuite) TestHealthChecksApplyTheThresholds() {
+	var failing atomic.Bool
+	var probed atomic.Value
+	replica := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		probed.Store(request.URL.Path)
+		if failing.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer replica.Close()
+
+	pool := s.newPool(config.UpstreamsConfig{
+		HealthCheckPath:    "/health",
+		UnhealthyThreshold: 2,
+		HealthyThreshold:   3,
+	}, replica.URL)
+	u := pool.current()[0]
+	check := func() {
+		pool.checkHealth(context.Background(), replica.Client(), u, zerolog.Nop())
+	}
+
+	failing.Store(true)
+	check()
+	s.True(u.healthy.Load(), "a single failure doesn't make a replica unhealthy")
+	s.Equal("/health", probed.Load())
+	check()
+	s.False(u.healthy.Load())
+
+	failing.Store(false)
+	check()
+	check()
+	s.False(u.healthy.Load())
+	// A failure resets the successes counted so far
+	failing.Store(true)
+	check()
+	failing.Store(false)
+	check()
+	check()
+	s.False(u.healthy.Load())
+	check()
+	s.True(u.healthy.Load())
+}
+
+func (s *upstreamPoolTestSuite) TestUnreachableReplicaBecomesUnhealthy() {
+	replica := httptest.NewServer(http.NotFoundHandler())
+	replica.Close()
+
+	pool := s.newPool(config.UpstreamsConfig{HealthCheckPath: "/health", UnhealthyThreshold: 1}, replica.URL)
+	u := pool.current()[0]
+	pool.checkHealth(context.Background(), http.DefaultClient, u, zerolog.Nop())
+	s.False(u.healthy.Load())
+}
@@ -0,0 +1,220 @@
+package wsgw
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+	"wsgw/internal/config"
+
+	"github.com/coder/websocket"
+	"github.com/gin-gonic/gin"
+	"github.com/quic-go/quic-go"
+	"github.com/quic-go/quic-go/http3"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/quic-go/webtransport-go"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+)
+
+// WebTransportPath is the path of the WebTransport sessions, under the path prefix of the gateway endpoint
+const WebTransportPath EndpointPath = "/webtransport"
+
+// maxWebTransportMessageSize is the read limit of the WebSocket connections
+const maxWebTransportMessageSize = 32768
+
+var errWebTransportMessageTooBig = errors.New("message too big")
+
+// newWebTransportServer creates the server of the WebTransport sessions. The HTTP/3 server under it serves the
+// client handler, where the gateway endpoints upgrade the sessions.
+func newWebTransportServer(clientHandler http.Handler) *webtransport.Server {
+	h3 := &http3.Server{Handler: clientHandler}
+	webtransport.ConfigureHTTP3Server(h3)
+	return &webtransport.Server{
+		H3: h3,
+		// The gateway endpoints check the origins, each against its own patterns
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+}
+
+// webTransportWriter lets webtransport reach the HTTP/3 stream under the response writer of gin
+type webTransportWriter struct {
+	gin.ResponseWriter
+	http3.Settingser
+	http3.HTTPStreamer
+}
+
+// newWebTransportWriter returns false unless the request came over HTTP/3
+func newWebTransportWriter(w gin.ResponseWriter) (*webTransportWriter, bool) {
+	unwrapper, isUnwrapper := w.(interface{ Unwrap() http.ResponseWriter })
+	if !isUnwrapper {
+		return nil, false
+	}
+	settingser, isSettingser := unwrapper.Unwrap().(http3.Settingser)
+	streamer, isStreamer := unwrapper.Unwrap().(http3.HTTPStreamer)
+	if !isSettingser || !isStreamer {
+		return nil, false
+	}
+	return &webTransportWriter{ResponseWriter: w, Settingser: settingser, HTTPStreamer: streamer}, true
+}
+
+// webTransportIO relays the messages over the bidirectional stream wsgw opens in the session, each message
+// prefixed with its length as a QUIC variable-length integer
+type webTransportIO struct {
+	session  *webtransport.Session
+	stream   *webtransport.Stream
+	reader   *bufio.Reader
+	writeMux sync.Mutex
+}
+
+func newWebTransportIO(session *webtransport.Session, stream *webtransport.Stream) *webTransportIO {
+	return &webTransportIO{session: session, stream: stream, reader: bufio.NewReader(stream)}
+}
+
+func (w *webTransportIO) Close() error {
+	return w.CloseWith(websocket.StatusPolicyViolation, "connection too slow to keep up with messages")
+}
+
+func (w *webTransportIO) CloseWith(code websocket.StatusCode, reason string) error {
+	return w.session.CloseWithError(webtransport.SessionErrorCode(code), reason)
+}
+
+func (w *webTransportIO) Write(ctx context.Context, msg string) error {
+	w.writeMux.Lock()
+	defer w.writeMux.Unlock()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = w.stream.SetWriteDeadline(deadline)
+		defer func() { _ = w.stream.SetWriteDeadline(time.Time{}) }()
+	}
+	frame := quicvarint.Append(make([]byte, 0, quicvarint.Len(uint64(len(msg)))+len(msg)), uint64(len(msg)))
+	_, writeErr := w.stream.Write(append(frame, msg...))
+	return writeErr
+}
+
+// Read returns the closes of the client as websocket.CloseErrors, as the WebSocket connections do
+func (w *webTransportIO) Read(ctx context.Context) (string, error) {
+	length, readErr := quicvarint.Read(w.reader)
+	if readErr != nil {
+		return "", webTransportReadError(readErr)
+	}
+	if length > maxWebTransportMessageSize {
+		_ = w.CloseWith(websocket.StatusMessageTooBig, errWebTransportMessageTooBig.Error())
+		return "", errWebTransportMessageTooBig
+	}
+	msg := make([]byte, length)
+	if _, readErr = io.ReadFull(w.reader, msg); readErr != nil {
+		return "", webTransportReadError(readErr)
+	}
+	return string(msg), nil
+}
+
+func webTransportReadError(err error) error {
+	var sessionErr *webtransport.SessionError
+	var connectionErr *quic.ApplicationError
+	switch {
+	case errors.Is(err, io.EOF):
+		return websocket.CloseError{Code: websocket.StatusNormalClosure}
+	// Clients may close the QUIC connection along with the session
+	case errors.As(err, &connectionErr) && connectionErr.Remote && connectionErr.ErrorCode == quic.ApplicationErrorCode(http3.ErrCodeNoError):
+		return websocket.CloseError{Code: websocket.StatusNormalClosure}
+	case errors.As(err, &sessionErr) && sessionErr.Remote:
+		// Closing the session without a code is the normal closure of WebTransport
+		if sessionErr.ErrorCode == 0 {
+			return websocket.CloseError{Code: websocket.StatusNormalClosure, Reason: sessionErr.Message}
+		}
+		return websocket.CloseError{Code: websocket.StatusCode(sessionErr.ErrorCode), Reason: sessionErr.Message}
+	}
+	return err
+}
+
+// originPermitted checks the Origin of the request the way websocket.Accept does
+func originPermitted(r *http.Request, originPatterns []string) bool {
+	origin := r.Header.Get("Origin")
+	if len(origin) == 0 {
+		return true
+	}
+	originUrl, parseErr := url.Parse(origin)
+	if parseErr != nil {
+		return false
+	}
+	return strings.EqualFold(originUrl.Host, r.Host) || originAllowed(originUrl, originPatterns)
+}
+
+// registerWebTransport registers `CONNECT <prefix>/webtransport[/{profile}]`, served over HTTP/3 only
+func (e *gatewayEndpoint) registerWebTransport(clientEngine *gin.Engine, server *webtransport.Server, createConnectionId func(ctx context.Context) ConnectionID) {
+	handler := e.webTransportHandler(server, createConnectionId)
+	path := e.pathPrefix + string(WebTransportPath)
+	clientEngine.Handle(http.MethodConnect, path, handler)
+	clientEngine.Handle(http.MethodConnect, fmt.Sprintf("%s/:%s", path, connectProfilePathParamName), handler)
+}
+
+func (e *gatewayEndpoint) webTransportHandler(server *webtransport.Server, createConnectionId func(ctx context.Context) ConnectionID) gin.HandlerFunc {
+	return func(g *gin.Context) {
+		writer, isHttp3 := newWebTransportWriter(g.Writer)
+		if !isHttp3 {
+			g.AbortWithStatus(http.StatusMethodNotAllowed)
+			return
+		}
+		if !originPermitted(g.Request, e.originPatterns.get()) {
+			g.AbortWithStatus(http.StatusForbidden)
+			return
+		}
+
+		requestContext := g.Request.Context()
+		tracer := otel.Tracer(config.OtelScope)
+		requestContext, span := tracer.Start(requestContext, "new-webtransport-connection")
+		defer span.End()
+
+		appConn, accepted := acceptConnection(g, requestContext, e.router, e.wsConns, transportWebTransport, createConnectionId)
+		if !accepted {
+			return
+		}
+		logger := zerolog.Ctx(requestContext).With().Str(ConnectionIDKey, string(appConn.id)).Logger()
+		defer func() {
+			// The request is cancelled along with the QUIC connection
+			clientDisconnectCtx, clientDisconnectSpan := tracer.Start(context.WithoutCancel(requestContext), "new-webtransport-disconnect")
+			defer clientDisconnectSpan.End()
+			handleClientDisconnected(clientDisconnectCtx, stripWSUpgradeHeaders(g.Request.Header), appConn, logger)
+		}()
+
+		session, upgradeErr := server.Upgrade(writer, g.Request)
+		if upgradeErr != nil {
+			logger.Info().Err(upgradeErr).Msg("failed to upgrade the WebTransport session")
+			g.AbortWithStatus(http.StatusBadRequest)
+			return
+		}
+		defer func() { _ = session.CloseWithError(0, "") }()
+
+		stream, openErr := session.OpenStream()
+		if openErr == nil {
+			// Sends the header of the stream, so that the client learns of it before the first message
+			_, openErr = stream.Write(nil)
+		}
+		if openErr != nil {
+			logger.Info().Err(openErr).Msg("failed to open the stream of the session")
+			return
+		}
+		transport := newWebTransportIO(session, stream)
+
+		if e.ackNewConnId {
+			ack, _ := json.Marshal(map[string]string{ConnectionIDKey: string(appConn.id)})
+			if ackErr := transport.Write(requestContext, string(ack)); ackErr != nil {
+				logger.Info().Err(ackErr).Msg("failed to send connect ack")
+				return
+			}
+		}
+
+		// The frames are traced in spans of their own, linked to that of the connect request
+		span.End()
+		closedErr := e.wsConns.processMessages(requestContext, appConn, transport, handleClientMessage(appConn, e.router))
+		logger.Debug().Err(closedErr).Msg("WebTransport session finished")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 	"wsgw/internal/config"
 	loadmanagement "wsgw/pkgs/loadmanegement"
@@ -14,44 +15,129 @@ import (
 	"github.com/rs/zerolog"
 	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/time/rate"
 )
 
 type connection struct {
 	fromClient chan string
-	fromApp    chan string
+	fromApp    chan pushedMessage
 	connClosed chan websocket.CloseError
 	readErr    chan error
 	closeSlow  func()
-	id         ConnectionID
+	// done is closed when the connection loop returns, so that the reader doesn't wait for it forever
+	done chan struct{}
+	// closeRequested receives the request of the backend to close the connection
+	closeRequested chan websocket.CloseError
+	id             ConnectionID
+	connectedAt    time.Time
+	// attributes are provided by the backend on connect
+	attributes connectionAttributes
+	// spanContext is that of the span of the connect request, which the spans of the frames are linked to
+	spanContext trace.SpanContext
+	throughput  connectionThroughput
+	// keepaliveLost receives the error of the keepalive of a client no longer polling or answering the pings
+	keepaliveLost chan error
+	// messageOutcomes receives the outcomes of the client messages delivered to the backend asynchronously
+	messageOutcomes chan error
+	// overloaded is set while the buffer of the pushed messages overflows, and dropped counts the pushed
+	// messages dropped meanwhile
+	overloaded atomic.Bool
+	dropped    atomic.Int64
 	// publishLimiter controls the rate limit applied to the publish endpoint.
 	//
 	// Defaults to one publish every 100ms with a burst of 8.
 	publishLimiter *rate.Limiter
 }
 
-func newConnection(connId ConnectionID, wsIo wsIO, messageBufferSize int) *connection {
+func newConnection(appConn *appConnection, wsIo wsIO, messageBufferSize int, dimensions attribute.Set) *connection {
 	return &connection{
-		id:         connId,
-		fromClient: make(chan string),
-		fromApp:    make(chan string, messageBufferSize),
-		connClosed: make(chan websocket.CloseError),
-		readErr:    make(chan error, 1),
+		id:          appConn.id,
+		attributes:  appConn.attributes,
+		spanContext: appConn.spanContext,
+		throughput:  newConnectionThroughput(dimensions),
+		fromClient:  make(chan string),
+		fromApp:     make(chan pushedMessage, messageBufferSize),
+		connClosed:  make(chan websocket.CloseError, 1),
+		done:        make(chan struct{}),
+		readErr:     make(chan error, 1),
 		closeSlow: func() {
 			wsIo.Close()
 		},
-		publishLimiter: rate.NewLimiter(rate.Every(time.Millisecond*100), 8),
+		closeRequested: make(chan websocket.CloseError, 1),
+		keepaliveLost:  make(chan error, 1),
+		// Sized like the buffer of the frames the failed messages are answered with
+		messageOutcomes: make(chan error, messageBufferSize),
+		connectedAt:     time.Now(),
+		publishLimiter:  rate.NewLimiter(rate.Every(time.Millisecond*100), 8),
 	}
 }
 
+// pushedMessage is a message for the client, waiting in the buffer of the connection
+type pushedMessage struct {
+	text     string
+	queuedAt time.Time
+	// spanContext is that of the span of the push, continued by the write of the message
+	spanContext trace.SpanContext
+}
+
+func newPushedMessage(ctx context.Context, text string) pushedMessage {
+	return pushedMessage{text: text, queuedAt: time.Now(), spanContext: trace.SpanContextFromContext(ctx)}
+}
+
+// connectionThroughput counts the traffic of a connection
+type connectionThroughput struct {
+	messagesFromClient atomic.Int64
+	bytesFromClient    atomic.Int64
+	messagesToClient   atomic.Int64
+	bytesToClient      atomic.Int64
+	// fromClient and toClient are the attributes of the throughput metrics of the connection
+	fromClient metric.MeasurementOption
+	toClient   metric.MeasurementOption
+}
+
+func newConnectionThroughput(dimensions attribute.Set) connectionThroughput {
+	withDirection := func(direction string) metric.MeasurementOption {
+		return metric.WithAttributeSet(attribute.NewSet(append(dimensions.ToSlice(), attribute.String("direction", direction))...))
+	}
+	return connectionThroughput{fromClient: withDirection("from_client"), toClient: withDirection("to_client")}
+}
+
+func (m wsMetrics) countFromClient(ctx context.Context, conn *connection, msg string) {
+	conn.throughput.messagesFromClient.Add(1)
+	conn.throughput.bytesFromClient.Add(int64(len(msg)))
+	m.messages.Add(ctx, 1, conn.throughput.fromClient)
+	m.bytes.Add(ctx, int64(len(msg)), conn.throughput.fromClient)
+}
+
+func (m wsMetrics) countToClient(ctx context.Context, conn *connection, msg string) {
+	conn.throughput.messagesToClient.Add(1)
+	conn.throughput.bytesToClient.Add(int64(len(msg)))
+	m.messages.Add(ctx, 1, conn.throughput.toClient)
+	m.bytes.Add(ctx, int64(len(msg)), conn.throughput.toClient)
+}
+
 type wsMetrics struct {
 	pushes            metric.Int64Counter
 	deliveries        metric.Int64Counter
 	writeErrors       metric.Int64Counter
 	readErrors        metric.Int64Counter
 	activeConnections metric.Int64UpDownCounter
+	// queueTime is the time the pushed messages spend in the buffer of the connection
+	queueTime          metric.Float64Histogram
+	writeDuration      metric.Float64Histogram
+	connectionDuration metric.Float64Histogram
+	// messages and bytes are the throughput, by direction and by the metric dimensions of the connections
+	messages metric.Int64Counter
+	bytes    metric.Int64Counter
 }
 
+// The bucket boundaries, in seconds, of the write and the queue times, and of the connection lifetimes
+var (
+	writeDurationBuckets      = []float64{0.0001, 0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+	connectionDurationBuckets = []float64{1, 5, 15, 30, 60, 300, 900, 1800, 3600, 4 * 3600, 12 * 3600, 24 * 3600}
+)
+
 func newWsMetrics() wsMetrics {
 	return wsMetrics{
 		pushes:            monitoring.CreateCounter(config.OtelScope, "wsgw.push.attempts", "Push attempts, by outcome"),
@@ -59,65 +145,174 @@ func newWsMetrics() wsMetrics {
 		writeErrors:       monitoring.CreateCounter(config.OtelScope, "wsgw.write_errors", "Failed WebSocket writes to client"),
 		readErrors:        monitoring.CreateCounter(config.OtelScope, "wsgw.read_errors", "Unexpected (non-close) WebSocket read errors"),
 		activeConnections: monitoring.CreateUpDownCounter(config.OtelScope, "wsgw.active_connections", "Active WebSocket connections", "{connection}"),
+		queueTime: monitoring.CreateHistogram(config.OtelScope, "wsgw.push.queue_time", "Time the pushed messages wait in the buffer of the connection before being written", "s",
+			metric.WithExplicitBucketBoundaries(writeDurationBuckets...)),
+		writeDuration: monitoring.CreateHistogram(config.OtelScope, "wsgw.write.duration", "Duration of the writes to the client connection, by outcome", "s",
+			metric.WithExplicitBucketBoundaries(writeDurationBuckets...)),
+		connectionDuration: monitoring.CreateHistogram(config.OtelScope, "wsgw.connection.duration", "Lifetime of the client connections, by outcome", "s",
+			metric.WithExplicitBucketBoundaries(connectionDurationBuckets...)),
+		messages: monitoring.CreateCounter(config.OtelScope, "wsgw.messages", "Messages relayed, by direction", metric.WithUnit("{message}")),
+		bytes:    monitoring.CreateCounter(config.OtelScope, "wsgw.bytes", "Bytes of the messages relayed, by direction", metric.WithUnit("By")),
 	}
 }
 
 type wsConnections struct {
+	// name is that of the gateway endpoint, empty for the default one
+	name string
+	// the limits are guarded by wsMapMux, as they change on configuration reloads
 	connectionMessageBuffer int
+	// maxConnections limits the number of concurrent connections, 0 means no limit
+	maxConnections int
+	// keepalive configures the pings of the clients which can be pinged
+	keepalive config.WebSocketKeepaliveConfig
 
 	wsMapMux sync.Mutex
 	wsMap    map[ConnectionID]*connection
+	// watchers are notified of the connects and disconnects; guarded by wsMapMux
+	watchers map[chan connectionEvent]struct{}
 
 	metrics wsMetrics
-	logger  zerolog.Logger
+	// gauges is the registration of the callback observing the buffers of the connections
+	gauges metric.Registration
+	connectionsObservability
+	logger zerolog.Logger
+}
+
+// connectionsObservability is what the connections of all the gateway endpoints are observed with,
+// besides the metrics
+type connectionsObservability struct {
+	// dimensions are those of the throughput metrics
+	dimensions *metricDimensions
+	// traceContextField is the field of the JSON frames of the clients holding their traceparent, if set
+	traceContextField string
+	audit             *auditLog
+	events            *lifecycleNotifier
 }
 
+// errKeepaliveTimeout ends the connections of the clients which stopped polling or answering the pings
+var errKeepaliveTimeout = errors.New("keepalive timeout")
+
 var errConnectionNotFound = errors.New("connection not found")
 
-func newWsConnections() *wsConnections {
+const (
+	defaultConnectionMessageBuffer = 1024
+	defaultPingInterval            = 30 * time.Second
+	defaultPingTimeout             = 10 * time.Second
+)
+
+func newWsConnections(name string, messageBuffer int, maxConnections int, keepalive config.WebSocketKeepaliveConfig, observability connectionsObservability) *wsConnections {
 	ns := &wsConnections{
-		connectionMessageBuffer: 1024,
-		wsMap:                   make(map[ConnectionID]*connection),
-		metrics:                 newWsMetrics(),
+		name:                     name,
+		keepalive:                keepalive,
+		wsMap:                    make(map[ConnectionID]*connection),
+		watchers:                 make(map[chan connectionEvent]struct{}),
+		metrics:                  newWsMetrics(),
+		connectionsObservability: observability,
 	}
+	ns.setLimits(messageBuffer, maxConnections)
+
+	gatewayEndpoint := metric.WithAttributes(attribute.String("gateway_endpoint", name))
+	bufferedGauge := monitoring.CreateObservableGauge(config.OtelScope, "wsgw.push.buffered", "Pushed messages waiting in the buffers of the connections", "{message}")
+	utilizationGauge := monitoring.CreateObservableGauge(config.OtelScope, "wsgw.push.buffer.max_utilization", "Highest ratio of the buffered pushed messages to the buffer size among the connections", "1")
+	ns.gauges = monitoring.RegisterCallback(config.OtelScope, func(_ context.Context, observer metric.Observer) error {
+		buffered, maxUtilization := ns.bufferOccupancy()
+		observer.ObserveFloat64(bufferedGauge, float64(buffered), gatewayEndpoint)
+		observer.ObserveFloat64(utilizationGauge, maxUtilization, gatewayEndpoint)
+		return nil
+	}, bufferedGauge, utilizationGauge)
 
 	return ns
 }
 
+// stopObserving stops the observation of the connections by the gauges, so that the connections of a stopped server
+// are neither reported nor kept from being collected
+func (wsconns *wsConnections) stopObserving() error {
+	return wsconns.gauges.Unregister()
+}
+
+// bufferOccupancy returns the number of pushed messages waiting in the buffers of all the connections,
+// and the highest ratio of the messages waiting in a buffer to its size
+func (wsconns *wsConnections) bufferOccupancy() (int, float64) {
+	buffered := 0
+	maxUtilization := 0.0
+	for _, conn := range wsconns.list() {
+		waiting := len(conn.fromApp)
+		buffered += waiting
+		if capacity := cap(conn.fromApp); capacity > 0 {
+			maxUtilization = max(maxUtilization, float64(waiting)/float64(capacity))
+		}
+	}
+	return buffered, maxUtilization
+}
+
+// setLimits changes the limits of the connections. The buffers of the open connections keep their size, and
+// the connections beyond a lowered limit are left open.
+func (wsconns *wsConnections) setLimits(messageBuffer int, maxConnections int) {
+	wsconns.wsMapMux.Lock()
+	defer wsconns.wsMapMux.Unlock()
+	wsconns.connectionMessageBuffer = orDefault(messageBuffer, defaultConnectionMessageBuffer)
+	wsconns.maxConnections = maxConnections
+}
+
+func (wsconns *wsConnections) messageBuffer() int {
+	wsconns.wsMapMux.Lock()
+	defer wsconns.wsMapMux.Unlock()
+	return wsconns.connectionMessageBuffer
+}
+
 type wsIO interface {
 	Close() error
+	CloseWith(code websocket.StatusCode, reason string) error
 	Write(ctx context.Context, msg string) error
 	Read(ctx context.Context) (string, error)
 }
 
+// wsPinger is implemented by the connections whose clients can be pinged: the WebSockets
+type wsPinger interface {
+	// Ping returns once the client has answered the ping
+	Ping(ctx context.Context) error
+}
+
 type onMgsReceivedFunc func(c context.Context, msg string) error
 
 func (wsconns *wsConnections) processMessages(
 	ctx context.Context,
-	connId ConnectionID,
+	appConn *appConnection,
 	wsIo wsIO,
 	onMessageFromClient onMgsReceivedFunc,
-) error {
-	logger := zerolog.Ctx(ctx).With().Str("unit", "wsConnections.processMessages").Str(ConnectionIDKey, string(connId)).Logger()
-	conn := newConnection(connId, wsIo, wsconns.connectionMessageBuffer)
+) (processErr error) {
+	logger := zerolog.Ctx(ctx).With().Str("unit", "wsConnections.processMessages").Str(ConnectionIDKey, string(appConn.id)).Logger()
+	conn := newConnection(appConn, wsIo, wsconns.messageBuffer(), wsconns.dimensions.of(appConn.attributes))
 
 	wsconns.addConnection(conn)
 	wsconns.metrics.activeConnections.Add(ctx, 1)
 	logger.Debug().Msg("connection added")
+	// end is how the connection ended, for the audit log
+	end := connectionEnd{initiator: initiatorNetwork}
 	defer func() {
+		wsconns.audit.disconnect(ctx, wsconns.name, conn, appConn, end)
 		wsconns.deleteConnection(conn)
 		wsconns.metrics.activeConnections.Add(ctx, -1)
+		wsconns.metrics.connectionDuration.Record(ctx, time.Since(conn.connectedAt).Seconds(), metric.WithAttributes(attribute.String("outcome", outcome(processErr))))
 		logger.Debug().Msg("connection removed")
 	}()
+	defer close(conn.done)
 
 	go func() {
 		for {
 			msgRead, errRead := wsIo.Read(ctx)
 			if errRead != nil {
+				if errors.Is(errRead, errKeepaliveTimeout) {
+					conn.lostKeepalive(errRead)
+					return
+				}
 				var closeError websocket.CloseError
 				if errors.As(errRead, &closeError) {
 					logger.Debug().Interface("closeError", closeError).Msg("WS connection closing...")
-					conn.connClosed <- closeError
+					select {
+					case conn.connClosed <- closeError:
+					case <-conn.done:
+					}
 					return
 				}
 				conn.closeSlow()
@@ -130,28 +325,70 @@ func (wsconns *wsConnections) processMessages(
 				conn.readErr <- errRead
 				return
 			}
-			conn.fromClient <- msgRead
+			select {
+			case conn.fromClient <- msgRead:
+			case <-conn.done:
+				return
+			}
 		}
 	}()
+	if pinger, canPing := wsIo.(wsPinger); canPing && !wsconns.keepalive.Disabled {
+		go conn.keepAlive(ctx, pinger, orDefault(wsconns.keepalive.PingInterval, defaultPingInterval), orDefault(wsconns.keepalive.PingTimeout, defaultPingTimeout))
+	}
+
+	// rateLimited is set while the backend rejects the messages of the client as beyond its rate limit
+	rateLimited := false
+	onMessageOutcome := func(ctx context.Context, sendToAppErr error) {
+		var limited rateLimitedError
+		if errors.As(sendToAppErr, &limited) {
+			if !rateLimited {
+				wsconns.events.notify(ctx, newLifecycleEvent(lifecycleRateLimited, wsconns.name, conn))
+			}
+			rateLimited = true
+		} else {
+			rateLimited = false
+		}
+		if sendToAppErr != nil {
+			conn.replyToClient(ctx, clientErrorFrame(sendToAppErr))
+		}
+	}
 
 	for {
 		select {
 		case msg := <-conn.fromApp:
-			logger.Debug().Str("backendMsg", msg).Msg("select: msg from backend")
-			err := writeWithTimeout(ctx, time.Second*5, wsIo, msg)
+			logger.Debug().Str("backendMsg", msg.text).Msg("select: msg from backend")
+			writeStart := time.Now()
+			wsconns.metrics.queueTime.Record(ctx, writeStart.Sub(msg.queuedAt).Seconds())
+			writeCtx, writeSpan := startPushWriteSpan(ctx, conn, msg)
+			err := writeWithTimeout(writeCtx, time.Second*5, wsIo, msg.text)
+			endSpan(writeSpan, err)
+			wsconns.metrics.writeDuration.Record(ctx, time.Since(writeStart).Seconds(), metric.WithAttributes(attribute.String("outcome", outcome(err))))
 			if err != nil {
 				wsconns.metrics.writeErrors.Add(ctx, 1)
 				logger.Error().Err(err).Msg("select: failed to relay message from app to client")
 				return err
 			}
 			wsconns.metrics.deliveries.Add(ctx, 1)
+			wsconns.metrics.countToClient(ctx, conn, msg.text)
+			if conn.overloaded.Load() && len(conn.fromApp) <= cap(conn.fromApp)/2 && conn.overloaded.CompareAndSwap(true, false) {
+				event := newLifecycleEvent(lifecycleBackpressureRecovered, wsconns.name, conn)
+				event.Buffered, event.BufferSize, event.Dropped = len(conn.fromApp), cap(conn.fromApp), conn.dropped.Swap(0)
+				wsconns.events.notify(ctx, event)
+			}
 		case msg := <-conn.fromClient:
 			logger.Debug().Str("clientMsg", msg).Msg("select: msg from client")
-			sendToAppErr := onMessageFromClient(ctx, msg)
-			if sendToAppErr != nil {
-				conn.fromApp <- sendToAppErr.Error()
-			}
+			wsconns.metrics.countFromClient(ctx, conn, msg)
+			frameCtx, frameSpan := startClientFrameSpan(ctx, conn, wsconns.traceContextField, msg)
+			sendToAppErr := onMessageFromClient(withMessageOutcome(frameCtx, conn.reportMessageOutcome), msg)
+			endSpan(frameSpan, sendToAppErr)
+			onMessageOutcome(frameCtx, sendToAppErr)
+		case outcome := <-conn.messageOutcomes:
+			onMessageOutcome(ctx, outcome)
 		case closeError := <-conn.connClosed:
+			end = connectionEnd{closeCode: int(closeError.Code), closeReason: closeError.Reason, initiator: initiatorClient}
+			event := newLifecycleEvent(lifecycleClientClosed, wsconns.name, conn)
+			event.CloseCode, event.CloseReason = int(closeError.Code), closeError.Reason
+			wsconns.events.notify(ctx, event)
 			if closeError.Code == websocket.StatusNormalClosure {
 				logger.Debug().Msg("select: StatusNormalClosure")
 				return nil
@@ -164,19 +401,113 @@ func (wsconns *wsConnections) processMessages(
 			return fmt.Errorf("select: socket closed abnormaly: %w", closeError)
 		case err := <-conn.readErr:
 			logger.Debug().Err(err).Msg("select: read error, closing")
+			if ctx.Err() != nil {
+				end.initiator = initiatorServer
+			}
 			return err
+		case keepaliveErr := <-conn.keepaliveLost:
+			logger.Info().Err(keepaliveErr).Msg("select: keepalive lost, closing")
+			end = connectionEnd{closeReason: errKeepaliveTimeout.Error(), initiator: initiatorNetwork}
+			wsconns.events.notify(ctx, newLifecycleEvent(lifecycleKeepaliveTimeout, wsconns.name, conn))
+			return keepaliveErr
+		case closeRequest := <-conn.closeRequested:
+			logger.Debug().Interface("closeRequest", closeRequest).Msg("select: closing on request")
+			end = connectionEnd{closeCode: int(closeRequest.Code), closeReason: closeRequest.Reason, initiator: initiatorBackend}
+			return wsIo.CloseWith(closeRequest.Code, closeRequest.Reason)
 		case <-ctx.Done():
 			logger.Debug().Msg("select: context is done")
+			end.initiator = initiatorServer
 			return ctx.Err()
 		}
 	}
 }
 
+// replyToClient queues a frame answering a message of the client. It never blocks, as the buffer is drained
+// by the very loop replying: with the buffer full, the frame is dropped and counted among the dropped messages.
+func (conn *connection) replyToClient(ctx context.Context, frame string) {
+	select {
+	case conn.fromApp <- newPushedMessage(ctx, frame):
+	default:
+		conn.dropped.Add(1)
+	}
+}
+
+// reportMessageOutcome queues the outcome of a client message delivered to the backend asynchronously, for the
+// connection loop to handle as the outcome of a message delivered synchronously. Like replyToClient, it never blocks.
+func (conn *connection) reportMessageOutcome(err error) {
+	select {
+	case conn.messageOutcomes <- err:
+	default:
+		if err != nil {
+			conn.dropped.Add(1)
+		}
+	}
+}
+
+// messageOutcomeKey is the context key of the function reporting the outcome of a client message delivered
+// to the backend after the message handler has returned
+type messageOutcomeKey struct{}
+
+func withMessageOutcome(ctx context.Context, report func(err error)) context.Context {
+	return context.WithValue(ctx, messageOutcomeKey{}, report)
+}
+
+// messageOutcome returns the function to report the outcome of the client message of the context with
+func messageOutcome(ctx context.Context) func(err error) {
+	if report, ok := ctx.Value(messageOutcomeKey{}).(func(err error)); ok {
+		return report
+	}
+	return func(error) {}
+}
+
+// keepAlive pings the client every interval until the connection ends, reporting the keepalive lost if the client
+// doesn't answer a ping within the timeout
+func (conn *connection) keepAlive(ctx context.Context, pinger wsPinger, interval time.Duration, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-conn.done:
+			return
+		}
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		pingErr := pinger.Ping(pingCtx)
+		cancel()
+		// The other failures are those of a closed connection, which the reader reports
+		if errors.Is(pingErr, context.DeadlineExceeded) && ctx.Err() == nil {
+			conn.lostKeepalive(fmt.Errorf("%w: %w", errKeepaliveTimeout, pingErr))
+		}
+		if pingErr != nil {
+			return
+		}
+	}
+}
+
+// lostKeepalive ends the connection as its client no longer polls or answers the pings
+func (conn *connection) lostKeepalive(err error) {
+	select {
+	case conn.keepaliveLost <- err:
+	default:
+	}
+}
+
 // addConnection registers a subscriber.
 func (wsconns *wsConnections) addConnection(conn *connection) {
 	wsconns.wsMapMux.Lock()
 	defer wsconns.wsMapMux.Unlock()
 	wsconns.wsMap[conn.id] = conn
+	wsconns.notifyWatchers(connectionEvent{connected: true, id: conn.id, at: conn.connectedAt})
+}
+
+// full tells whether the limit of concurrent connections is reached
+func (wsconns *wsConnections) full() bool {
+	wsconns.wsMapMux.Lock()
+	defer wsconns.wsMapMux.Unlock()
+	if wsconns.maxConnections <= 0 {
+		return false
+	}
+	return len(wsconns.wsMap) >= wsconns.maxConnections
 }
 
 // deleteConnection deletes the given subscriber.
@@ -184,11 +515,80 @@ func (wsconns *wsConnections) deleteConnection(conn *connection) {
 	wsconns.wsMapMux.Lock()
 	defer wsconns.wsMapMux.Unlock()
 	defer delete(wsconns.wsMap, conn.id)
+	wsconns.notifyWatchers(connectionEvent{connected: false, id: conn.id, at: time.Now()})
+}
+
+// connectionEvent is a connect or a disconnect
+type connectionEvent struct {
+	connected bool
+	id        ConnectionID
+	at        time.Time
+}
+
+const watcherBufferSize = 256
+
+// watch returns the channel the connects and disconnects are sent to, until stop is called. The channel is
+// closed if the watcher falls behind by more than the size of its buffer, or when stop is called.
+func (wsconns *wsConnections) watch() (<-chan connectionEvent, func()) {
+	events := make(chan connectionEvent, watcherBufferSize)
+	wsconns.wsMapMux.Lock()
+	wsconns.watchers[events] = struct{}{}
+	wsconns.wsMapMux.Unlock()
+	return events, func() {
+		wsconns.wsMapMux.Lock()
+		defer wsconns.wsMapMux.Unlock()
+		if _, ok := wsconns.watchers[events]; ok {
+			delete(wsconns.watchers, events)
+			close(events)
+		}
+	}
+}
+
+// notifyWatchers must be called with wsMapMux held
+func (wsconns *wsConnections) notifyWatchers(event connectionEvent) {
+	for events := range wsconns.watchers {
+		select {
+		case events <- event:
+		default:
+			delete(wsconns.watchers, events)
+			close(events)
+		}
+	}
+}
+
+// list returns the connections
+func (wsconns *wsConnections) list() []*connection {
+	wsconns.wsMapMux.Lock()
+	defer wsconns.wsMapMux.Unlock()
+	conns := make([]*connection, 0, len(wsconns.wsMap))
+	for _, conn := range wsconns.wsMap {
+		conns = append(conns, conn)
+	}
+	return conns
+}
+
+// close asks the connection to close with the given WebSocket close code and reason
+func (wsconns *wsConnections) close(connId ConnectionID, code websocket.StatusCode, reason string) error {
+	conn, connNotFoundErr := wsconns.getConnection(connId)
+	if connNotFoundErr != nil {
+		return connNotFoundErr
+	}
+	select {
+	case conn.closeRequested <- websocket.CloseError{Code: code, Reason: reason}:
+	default:
+		// A close is already pending
+	}
+	return nil
 }
 
 // It never blocks and so messages to slow subscribers
 // are dropped.
 func (wsconns *wsConnections) push(ctx context.Context, msg string, connId ConnectionID) error {
+	return wsconns.pushWait(ctx, msg, connId, 0)
+}
+
+// pushWait is push waiting up to the given time for room in the buffer of a slow subscriber
+func (wsconns *wsConnections) pushWait(ctx context.Context, msg string, connId ConnectionID, wait time.Duration) error {
 	conn, connNotFoundErr := wsconns.getConnection(connId)
 	if connNotFoundErr != nil {
 		wsconns.metrics.pushes.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "not_found")))
@@ -196,14 +596,33 @@ func (wsconns *wsConnections) push(ctx context.Context, msg string, connId Conne
 	}
 
 	// conn.publishLimiter.Wait(ctx)
+	pushed := newPushedMessage(ctx, msg)
 	select {
-	case conn.fromApp <- msg:
+	case conn.fromApp <- pushed:
 		wsconns.metrics.pushes.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "delivered")))
 		return nil
 	default:
-		wsconns.metrics.pushes.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "overload")))
-		return loadmanagement.OverloadError{Reason: "fromApp channel full"}
 	}
+
+	if wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case conn.fromApp <- pushed:
+			wsconns.metrics.pushes.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "delivered")))
+			return nil
+		case <-timer.C:
+		case <-ctx.Done():
+		}
+	}
+	wsconns.metrics.pushes.Add(ctx, 1, metric.WithAttributes(attribute.String("outcome", "overload")))
+	conn.dropped.Add(1)
+	if conn.overloaded.CompareAndSwap(false, true) {
+		event := newLifecycleEvent(lifecycleSlowConsumer, wsconns.name, conn)
+		event.Buffered, event.BufferSize = len(conn.fromApp), cap(conn.fromApp)
+		wsconns.events.notify(ctx, event)
+	}
+	return loadmanagement.OverloadError{Reason: "fromApp channel full"}
 }
 
 func (wsconns *wsConnections) getConnection(connId ConnectionID) (*connection, error) {
@@ -216,6 +635,50 @@ func (wsconns *wsConnections) getConnection(connId ConnectionID) (*connection, e
 	return conn, nil
 }
 
+// connectionDetails are served by the connection-detail API
+type connectionDetails struct {
+	ConnectionID       ConnectionID         `json:"connectionId"`
+	ConnectedAt        time.Time            `json:"connectedAt"`
+	Attributes         connectionAttributes `json:"attributes,omitempty"`
+	MessagesFromClient int64                `json:"messagesFromClient"`
+	BytesFromClient    int64                `json:"bytesFromClient"`
+	MessagesToClient   int64                `json:"messagesToClient"`
+	BytesToClient      int64                `json:"bytesToClient"`
+	// BufferedMessages are the pushed messages waiting to be written, out of BufferSize
+	BufferedMessages int `json:"bufferedMessages"`
+	BufferSize       int `json:"bufferSize"`
+}
+
+func (wsconns *wsConnections) details(connId ConnectionID) (connectionDetails, error) {
+	conn, connNotFoundErr := wsconns.getConnection(connId)
+	if connNotFoundErr != nil {
+		return connectionDetails{}, connNotFoundErr
+	}
+	return connectionDetails{
+		ConnectionID:       conn.id,
+		ConnectedAt:        conn.connectedAt.UTC(),
+		Attributes:         conn.attributes,
+		MessagesFromClient: conn.throughput.messagesFromClient.Load(),
+		BytesFromClient:    conn.throughput.bytesFromClient.Load(),
+		MessagesToClient:   conn.throughput.messagesToClient.Load(),
+		BytesToClient:      conn.throughput.bytesToClient.Load(),
+		BufferedMessages:   len(conn.fromApp),
+		BufferSize:         cap(conn.fromApp),
+	}, nil
+}
+
+// outcome is the outcome attribute of the metrics of an operation ending with err
+func outcome(err error) string {
+	switch {
+	case err == nil:
+		return "ok"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return "error"
+	}
+}
+
 func writeWithTimeout(ctx context.Context, timeout time.Duration, sIo wsIO, msg string) error {
 	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
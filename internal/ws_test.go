@@ -0,0 +1,79 @@
+package wsgw
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+	"wsgw/internal/config"
+
+	"github.com/coder/websocket"
+	"github.com/stretchr/testify/suite"
+)
+
+type wsConnectionsTestSuite struct {
+	suite.Suite
+}
+
+func TestWsConnectionsTestSuite(t *testing.T) {
+	suite.Run(t, &wsConnectionsTestSuite{})
+}
+
+// closingWsIO is a connection reading nothing until it is closed, then what the peer sends after the close frame
+type closingWsIO struct {
+	closed chan struct{}
+	msg    string
+	err    error
+}
+
+func (c *closingWsIO) Close() error {
+	return nil
+}
+
+func (c *closingWsIO) CloseWith(websocket.StatusCode, string) error {
+	close(c.closed)
+	return nil
+}
+
+func (c *closingWsIO) Write(context.Context, string) error {
+	return nil
+}
+
+func (c *closingWsIO) Read(ctx context.Context) (string, error) {
+	<-c.closed
+	return c.msg, c.err
+}
+
+func (s *wsConnectionsTestSuite) TestReaderEndsWithTheRequestedClose() {
+	s.Run("echoed close frame", func() {
+		s.closeOnRequest(&closingWsIO{closed: make(chan struct{}), err: websocket.CloseError{Code: websocket.StatusNormalClosure}})
+	})
+	s.Run("late frame", func() {
+		s.closeOnRequest(&closingWsIO{closed: make(chan struct{}), msg: "late"})
+	})
+}
+
+// closeOnRequest has the backend close the connection, checking that no goroutine of the connection is left
+func (s *wsConnectionsTestSuite) closeOnRequest(wsIo *closingWsIO) {
+	wsconns := newWsConnections("", 0, 0, config.WebSocketKeepaliveConfig{}, connectionsObservability{})
+	defer func() { _ = wsconns.stopObserving() }()
+
+	processed := make(chan error, 1)
+	go func() {
+		processed <- wsconns.processMessages(context.Background(), &appConnection{id: "conn"}, wsIo, func(context.Context, string) error {
+			return nil
+		})
+	}()
+	s.Eventually(func() bool {
+		return wsconns.close("conn", websocket.StatusNormalClosure, "bye") == nil
+	}, time.Second, time.Millisecond)
+	s.NoError(<-processed)
+
+	s.Eventually(func() bool { return !connectionGoroutineRunning() }, time.Second, 10*time.Millisecond)
+}
+
+func connectionGoroutineRunning() bool {
+	stacks := make([]byte, 1<<20)
+	return strings.Contains(string(stacks[:runtime.Stack(stacks, true)]), "processMessages.func")
+}
@@ -0,0 +1,237 @@
+package loadmanagement
+
+import (
+	"sync"
+	"time"
+)
+
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitHalfOpen
+	CircuitOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitHalfOpen:
+		return "half-open"
+	case CircuitOpen:
+		return "open"
+	default:
+		return "unknown"
+	}
+}
+
+// CallOutcome is the outcome of a call let through by the breaker
+type CallOutcome int
+
+const (
+	CallSucceeded CallOutcome = iota
+	CallFailed
+	// CallAbandoned is a call given up by its caller, which tells nothing about the health of the dependency
+	CallAbandoned
+)
+
+const windowBuckets = 10
+
+type CircuitBreakerConfig struct {
+	// Window is the period over which the failure and the slow-call rates are computed
+	Window time.Duration
+	// MinRequests is the number of calls within the window below which the circuit doesn't open
+	MinRequests int
+	// FailureRateThreshold is the ratio (0-1] of failed calls opening the circuit
+	FailureRateThreshold float64
+	// SlowCallDuration is the latency above which a call counts as slow
+	SlowCallDuration time.Duration
+	// SlowCallRateThreshold is the ratio (0-1] of slow calls opening the circuit; 0 disables the latency check
+	SlowCallRateThreshold float64
+	// OpenDuration is how long the circuit stays open before probe calls are let through
+	OpenDuration time.Duration
+	// HalfOpenProbes is the number of successful probe calls closing the circuit
+	HalfOpenProbes int
+}
+
+type windowBucket struct {
+	start    time.Time
+	total    int
+	failures int
+	slow     int
+}
+
+// CircuitBreaker stops letting calls through to a dependency whose failure rate
+// or latency exceeds the configured thresholds, and lets probe calls through
+// after a while to detect the recovery of the dependency.
+type CircuitBreaker struct {
+	conf CircuitBreakerConfig
+	now  func() time.Time
+
+	mux            sync.Mutex
+	state          CircuitState
+	openedAt       time.Time
+	buckets        [windowBuckets]windowBucket
+	probesInFlight int
+	probeSuccesses int
+	// generation is incremented on each state change, so that late completions of calls admitted in an earlier state are ignored
+	generation       int
+	onStateChange    func(from CircuitState, to CircuitState)
+	bucketSize       time.Duration
+	currentBucketIdx int
+}
+
+// NewCircuitBreaker creates a circuit breaker in the closed state. The optional onStateChange callback
+// is called with the breaker's lock held, so it must not call the breaker.
+func NewCircuitBreaker(conf CircuitBreakerConfig, onStateChange func(from CircuitState, to CircuitState)) *CircuitBreaker {
+	if onStateChange == nil {
+		onStateChange = func(CircuitState, CircuitState) {}
+	}
+	return &CircuitBreaker{
+		conf:          conf,
+		now:           time.Now,
+		onStateChange: onStateChange,
+		bucketSize:    max(conf.Window/windowBuckets, time.Millisecond),
+	}
+}
+
+// State returns the current state of the circuit
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+	cb.refreshState(cb.now())
+	return cb.state
+}
+
+// Allow checks whether a call may proceed. If it may, the returned function must be
+// called with the outcome of the call; otherwise an OverloadError telling when to retry is returned.
+func (cb *CircuitBreaker) Allow() (func(outcome CallOutcome), error) {
+	cb.mux.Lock()
+	defer cb.mux.Unlock()
+
+	now := cb.now()
+	cb.refreshState(now)
+
+	switch cb.state {
+	case CircuitOpen:
+		return nil, OverloadError{RetryAfter: cb.openedAt.Add(cb.conf.OpenDuration).Sub(now), Reason: "circuit open"}
+	case CircuitHalfOpen:
+		if cb.probesInFlight+cb.probeSuccesses >= max(cb.conf.HalfOpenProbes, 1) {
+			return nil, OverloadError{RetryAfter: cb.conf.OpenDuration, Reason: "circuit half-open, probe quota used up"}
+		}
+		cb.probesInFlight++
+		return cb.completion(now, true, cb.generation), nil
+	default:
+		return cb.completion(now, false, cb.generation), nil
+	}
+}
+
+func (cb *CircuitBreaker) completion(start time.Time, probe bool, generation int) func(outcome CallOutcome) {
+	var once sync.Once
+	return func(outcome CallOutcome) {
+		once.Do(func() {
+			cb.mux.Lock()
+			defer cb.mux.Unlock()
+			if generation != cb.generation {
+				return
+			}
+			if outcome == CallAbandoned {
+				// The probe quota is given back for another call to probe the dependency
+				if probe {
+					cb.probesInFlight--
+				}
+				return
+			}
+			now := cb.now()
+			slow := cb.conf.SlowCallDuration > 0 && now.Sub(start) > cb.conf.SlowCallDuration
+			if probe {
+				cb.probeCompleted(now, outcome == CallSucceeded && !slow)
+				return
+			}
+			cb.record(now, outcome == CallSucceeded, slow)
+		})
+	}
+}
+
+func (cb *CircuitBreaker) probeCompleted(now time.Time, success bool) {
+	cb.probesInFlight--
+	if !success {
+		cb.transition(CircuitOpen, now)
+		return
+	}
+	cb.probeSuccesses++
+	if cb.probeSuccesses >= max(cb.conf.HalfOpenProbes, 1) {
+		cb.transition(CircuitClosed, now)
+	}
+}
+
+func (cb *CircuitBreaker) record(now time.Time, success bool, slow bool) {
+	bucket := cb.bucket(now)
+	bucket.total++
+	if !success {
+		bucket.failures++
+	}
+	if slow {
+		bucket.slow++
+	}
+
+	total, failures, slowCalls := cb.totals(now)
+	if total < max(cb.conf.MinRequests, 1) {
+		return
+	}
+	failureRateExceeded := cb.conf.FailureRateThreshold > 0 && float64(failures)/float64(total) >= cb.conf.FailureRateThreshold
+	slowRateExceeded := cb.conf.SlowCallRateThreshold > 0 && float64(slowCalls)/float64(total) >= cb.conf.SlowCallRateThreshold
+	if failureRateExceeded || slowRateExceeded {
+		cb.transition(CircuitOpen, now)
+	}
+}
+
+// bucket returns the bucket of the window the given moment belongs to, recycling stale buckets
+func (cb *CircuitBreaker) bucket(now time.Time) *windowBucket {
+	start := now.Truncate(cb.bucketSize)
+	current := &cb.buckets[cb.currentBucketIdx]
+	if current.start.Equal(start) {
+		return current
+	}
+	cb.currentBucketIdx = (cb.currentBucketIdx + 1) % windowBuckets
+	cb.buckets[cb.currentBucketIdx] = windowBucket{start: start}
+	return &cb.buckets[cb.currentBucketIdx]
+}
+
+func (cb *CircuitBreaker) totals(now time.Time) (total int, failures int, slow int) {
+	windowStart := now.Add(-cb.conf.Window)
+	for _, b := range cb.buckets {
+		if b.start.Before(windowStart) {
+			continue
+		}
+		total += b.total
+		failures += b.failures
+		slow += b.slow
+	}
+	return
+}
+
+func (cb *CircuitBreaker) refreshState(now time.Time) {
+	if cb.state == CircuitOpen && now.Sub(cb.openedAt) >= cb.conf.OpenDuration {
+		cb.transition(CircuitHalfOpen, now)
+	}
+}
+
+func (cb *CircuitBreaker) transition(to CircuitState, now time.Time) {
+	from := cb.state
+	if from == to {
+		return
+	}
+	cb.state = to
+	cb.generation++
+	cb.probesInFlight = 0
+	cb.probeSuccesses = 0
+	switch to {
+	case CircuitOpen:
+		cb.openedAt = now
+	case CircuitClosed:
+		cb.buckets = [windowBuckets]windowBucket{}
+	}
+	cb.onStateChange(from, to)
+}
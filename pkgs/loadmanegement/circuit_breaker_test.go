@@ -0,0 +1,153 @@
+package loadmanagement
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type circuitBreakerTestSuite struct {
+	suite.Suite
+	clock       time.Time
+	transitions []CircuitState
+	breaker     *CircuitBreaker
+}
+
+func TestCircuitBreakerTestSuite(t *testing.T) {
+	suite.Run(t, &circuitBreakerTestSuite{})
+}
+
+func (s *circuitBreakerTestSuite) SetupTest() {
+	s.clock = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	s.transitions = nil
+	s.breaker = NewCircuitBreaker(CircuitBreakerConfig{
+		Window:               10 * time.Second,
+		MinRequests:          4,
+		FailureRateThreshold: 0.5,
+		OpenDuration:         5 * time.Second,
+		HalfOpenProbes:       2,
+	}, func(_ CircuitState, to CircuitState) {
+		s.transitions = append(s.transitions, to)
+	})
+	s.breaker.now = func() time.Time { return s.clock }
+}
+
+// call lets a call through the breaker and completes it with the outcome
+func (s *circuitBreakerTestSuite) call(outcome CallOutcome) {
+	done, allowErr := s.breaker.Allow()
+	s.Require().NoError(allowErr)
+	done(outcome)
+}
+
+func (s *circuitBreakerTestSuite) TestStaysClosedBelowTheMinimumOfCalls() {
+	for range 3 {
+		s.call(CallFailed)
+	}
+	s.Equal(CircuitClosed, s.breaker.State())
+}
+
+func (s *circuitBreakerTestSuite) TestStaysClosedBelowTheFailureRate() {
+	for range 6 {
+		s.call(CallSucceeded)
+	}
+	for range 5 {
+		s.call(CallFailed)
+	}
+	s.Equal(CircuitClosed, s.breaker.State())
+}
+
+func (s *circuitBreakerTestSuite) TestForgetsTheCallsOutOfTheWindow() {
+	for range 3 {
+		s.call(CallFailed)
+	}
+	s.clock = s.clock.Add(11 * time.Second)
+	s.call(CallFailed)
+	s.Equal(CircuitClosed, s.breaker.State())
+}
+
+func (s *circuitBreakerTestSuite) TestOpensThenProbesTheRecovery() {
+	s.openCircuit()
+	_, allowErr := s.breaker.Allow()
+	var overload OverloadError
+	s.Require().ErrorAs(allowErr, &overload)
+	s.Equal(5*time.Second, overload.RetryAfter)
+
+	s.clock = s.clock.Add(5 * time.Second)
+	s.Equal(CircuitHalfOpen, s.breaker.State())
+	s.call(CallSucceeded)
+	s.Equal(CircuitHalfOpen, s.breaker.State())
+	s.call(CallSucceeded)
+	s.Equal(CircuitClosed, s.breaker.State())
+	s.Equal([]CircuitState{CircuitOpen, CircuitHalfOpen, CircuitClosed}, s.transitions)
+}
+
+func (s *circuitBreakerTestSuite) TestFailedProbeReopens() {
+	s.openCircuit()
+	s.clock = s.clock.Add(5 * time.Second)
+	s.call(CallFailed)
+	s.Equal(CircuitOpen, s.breaker.State())
+}
+
+func (s *circuitBreakerTestSuite) TestLateCompletionsAreIgnored() {
+	late, allowErr := s.breaker.Allow()
+	s.Require().NoError(allowErr)
+	s.openCircuit()
+	s.clock = s.clock.Add(5 * time.Second)
+	s.Equal(CircuitHalfOpen, s.breaker.State())
+
+	// A call admitted while closed completes while half-open: it isn't taken for a probe
+	late(CallFailed)
+	s.Equal(CircuitHalfOpen, s.breaker.State())
+}
+
+func (s *circuitBreakerTestSuite) TestOpensOnSlowCalls() {
+	s.breaker.conf.SlowCallDuration = time.Second
+	s.breaker.conf.SlowCallRateThreshold = 0.5
+	for range 4 {
+		done, allowErr := s.breaker.Allow()
+		s.Require().NoError(allowErr)
+		s.clock = s.clock.Add(2 * time.Second)
+		done(CallSucceeded)
+	}
+	s.Equal(CircuitOpen, s.breaker.State())
+}
+
+func (s *circuitBreakerTestSuite) TestAbandonedCallsDontOpenTheCircuit() {
+	for range 10 {
+		s.call(CallAbandoned)
+	}
+	s.call(CallFailed)
+	s.call(CallSucceeded)
+	s.call(CallSucceeded)
+	s.Equal(CircuitClosed, s.breaker.State())
+	s.Empty(s.transitions)
+}
+
+func (s *circuitBreakerTestSuite) TestAbandonedProbeGivesBackItsQuota() {
+	s.openCircuit()
+	s.clock = s.clock.Add(5 * time.Second)
+	s.Equal(CircuitHalfOpen, s.breaker.State())
+
+	first, firstErr := s.breaker.Allow()
+	s.Require().NoError(firstErr)
+	second, secondErr := s.breaker.Allow()
+	s.Require().NoError(secondErr)
+	_, quotaErr := s.breaker.Allow()
+	s.Error(quotaErr)
+
+	second(CallAbandoned)
+	third, thirdErr := s.breaker.Allow()
+	s.Require().NoError(thirdErr)
+	first(CallSucceeded)
+	third(CallSucceeded)
+	s.Equal(CircuitClosed, s.breaker.State())
+}
+
+// openCircuit fails enough calls to open the circuit
+func (s *circuitBreakerTestSuite) openCircuit() {
+	for range 4 {
+		s.call(CallFailed)
+	}
+	s.Require().Equal(CircuitOpen, s.breaker.State())
+}
@@ -6,6 +6,7 @@ import (
 	"os"
 	"runtime/debug"
 	"sync"
+	"sync/atomic"
 	"time"
 	"wsgw/internal/config"
 
@@ -47,6 +48,9 @@ var once sync.Once
 
 var log zerolog.Logger
 
+// level is the level of the loggers returned by Get; SetLevel changes it at runtime
+var level atomic.Int32
+
 func Get() zerolog.Logger {
 	once.Do(func() {
 		zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
@@ -71,6 +75,7 @@ func Get() zerolog.Logger {
 		}
 
 		logLevel := parseLevel()
+		level.CompareAndSwap(int32(unsetLevel), int32(logLevel))
 
 		fmt.Fprintf(os.Stderr, "default log-level: %v\n", logLevel)
 
@@ -89,5 +94,48 @@ func Get() zerolog.Logger {
 		log = logContext.Logger()
 	})
 
-	return log
+	return log.Level(zerolog.TraceLevel).Sample(runtimeLevel{})
+}
+
+// unsetLevel marks the level as not yet set
+const unsetLevel = zerolog.Disabled + 1
+
+func init() {
+	level.Store(int32(unsetLevel))
+}
+
+// runtimeLevel filters the events by the level at the time they are logged, rather than when the logger
+// was handed out, so that SetLevel applies to the loggers of the open connections too
+type runtimeLevel struct {
+	// verbose, if set, lets the debug events through whatever the level
+	verbose func() bool
+}
+
+func (r runtimeLevel) Sample(eventLevel zerolog.Level) bool {
+	if eventLevel >= zerolog.Level(level.Load()) {
+		return true
+	}
+	return eventLevel >= zerolog.DebugLevel && r.verbose != nil && r.verbose()
+}
+
+// Verbose returns the logger logging the debug events too, whatever the level, while verbose returns true.
+// verbose is called for each debug event below the level, it must be cheap.
+func Verbose(logger zerolog.Logger, verbose func() bool) zerolog.Logger {
+	return logger.Sample(runtimeLevel{verbose: verbose})
+}
+
+// CurrentLevel returns the level set at startup or by SetLevel
+func CurrentLevel() LogLevel {
+	Get()
+	return zerolog.Level(level.Load()).String()
+}
+
+// SetLevel changes the level of all the loggers returned by Get, those of the open connections included
+func SetLevel(logLevel LogLevel) error {
+	parsed, parseErr := zerolog.ParseLevel(logLevel)
+	if parseErr != nil {
+		return parseErr
+	}
+	level.Store(int32(parsed))
+	return nil
 }
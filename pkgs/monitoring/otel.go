@@ -4,63 +4,106 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"net/url"
+	"net/http"
 	"time"
 	"wsgw/internal/config"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
 	"go.opentelemetry.io/otel/metric"
 	metric_api "go.opentelemetry.io/otel/metric"
 	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
-	"go.opentelemetry.io/otel/sdk/trace"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.22.0"
 )
 
 type OtelConfig struct {
-	OtlpEndpoint         string
+	OtlpEndpoint string
+	// OtlpProtocol is that of the exporters: http/protobuf (the default) or grpc
+	OtlpProtocol string
+	// OtlpHeaders are sent with the exports, e.g. to authenticate them
+	OtlpHeaders map[string]string
+	// OtlpCAFile, OtlpClientCertFile and OtlpClientKeyFile set up the TLS of the exports to an https endpoint
+	OtlpCAFile           string
+	OtlpClientCertFile   string
+	OtlpClientKeyFile    string
 	OtlpServiceNamespace string
 	OtlpServiceName      string
-	OtlpTraceSampleAll   bool
+	// OtlpTraceSampleAll samples every trace, unless TraceSampler is set
+	OtlpTraceSampleAll bool
+	// TraceSampler is one of the samplers of OTEL_TRACES_SAMPLER, TraceSamplerRatio the ratio of the ratio-based ones
+	TraceSampler      string
+	TraceSamplerRatio float64
+	TraceBatcher      TraceBatcherConfig
+	// Propagators name the formats the trace context is propagated in; tracecontext if none
+	Propagators []string
+	// PrometheusEnabled makes the metrics available to MetricsHandler, with or without OTLP
+	PrometheusEnabled bool
 }
 
-// InitOtel initialises the global OTel metric and trace providers.
+// prometheusRegistry holds the metrics served by MetricsHandler
+var prometheusRegistry = prometheus.NewRegistry()
+
+// MetricsHandler serves the metrics in the Prometheus exposition format. It serves none unless InitOtel
+// was called with PrometheusEnabled.
+func MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(prometheusRegistry, promhttp.HandlerOpts{})
+}
+
+// InitOtel initialises the global OTel metric and trace providers. It must be called once.
 // The returned function must be called before the process exits (e.g. via defer)
 // to flush in-flight spans/metrics and shut down the exporters cleanly.
-// If no OTLP endpoint is configured a no-op shutdown function is returned.
+// Traces are only exported to an OTLP endpoint; without one, and without Prometheus,
+// a no-op shutdown function is returned. The propagators are set up in any case.
 func InitOtel(ctx context.Context, conf OtelConfig, otelScope string) func(context.Context) error {
-	logger := zerolog.Ctx(ctx).With().Str("OtlpEndpoint", conf.OtlpEndpoint).Logger()
+	logger := zerolog.Ctx(ctx).With().Str("OtlpEndpoint", conf.OtlpEndpoint).Bool("PrometheusEnabled", conf.PrometheusEnabled).Logger()
+
+	textMapPropagator, propagatorErr := NewPropagator(conf.Propagators)
+	if propagatorErr != nil {
+		logger.Error().Err(propagatorErr).Msg("failed to create the propagators")
+		panic(propagatorErr)
+	}
+	propagator = textMapPropagator
+	otel.SetTextMapPropagator(textMapPropagator)
 
-	if len(conf.OtlpEndpoint) == 0 {
+	if len(conf.OtlpEndpoint) == 0 && !conf.PrometheusEnabled {
 		logger.Info().Msg("No OTLP endpoint, skipping...")
 		return func(context.Context) error { return nil }
 	}
 
 	logger.Info().Msg("starting...")
 
-	endpoint, err := url.Parse(conf.OtlpEndpoint)
-	if err != nil {
-		logger.Error().Err(err).Msg("failed to parse OTLP endpoint url")
-		panic(fmt.Sprintf("failed to parse endpoint url %s: %v", conf.OtlpEndpoint, err))
+	var metricReaders []sdkmetric.Reader
+
+	if conf.PrometheusEnabled {
+		prometheusExporter, err := otelprometheus.New(otelprometheus.WithRegisterer(prometheusRegistry))
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to create the Prometheus exporter")
+			panic(fmt.Sprintf("failed to create the Prometheus exporter: %v", err))
+		}
+		metricReaders = append(metricReaders, prometheusExporter)
 	}
-	insecure := endpoint.Scheme == "http"
-	// protocol := "http/protobuf"
 
-	var metricExporter sdkmetric.Exporter
+	var target *otlpTarget
+	if len(conf.OtlpEndpoint) > 0 {
+		otlp, err := newOtlpTarget(conf)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to set up the OTLP export")
+			panic(fmt.Sprintf("failed to set up the OTLP export: %v", err))
+		}
+		target = &otlp
 
-	if insecure {
-		metricExporter, err = otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpoint(endpoint.Host), otlpmetrichttp.WithInsecure())
-	} else {
-		metricExporter, err = otlpmetrichttp.New(ctx, otlpmetrichttp.WithEndpoint(endpoint.Host))
-	}
-	if err != nil {
-		logger.Error().Err(err).Msg("failed to create exporter")
-		panic(fmt.Sprintf("failed to create exporter: %v", err))
+		metricExporter, err := target.metricExporter(ctx)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to create exporter")
+			panic(fmt.Sprintf("failed to create exporter: %v", err))
+		}
+		metricReaders = append(metricReaders, sdkmetric.NewPeriodicReader(metricExporter, sdkmetric.WithInterval(5*time.Second)))
 	}
 
 	serviceComponent := "main"
@@ -79,35 +122,37 @@ func InitOtel(ctx context.Context, conf OtelConfig, otelScope string) func(conte
 			attribute.KeyValue{Key: "service.instance.id", Value: attribute.StringValue(serviceInstanceID)},
 		),
 	)
-	metricReader := sdkmetric.NewPeriodicReader(metricExporter, sdkmetric.WithInterval(5*time.Second))
-
-	provider := sdkmetric.NewMeterProvider(
-		sdkmetric.WithReader(metricReader),
-		sdkmetric.WithResource(res),
-	)
+	providerOptions := []sdkmetric.Option{sdkmetric.WithResource(res)}
+	for _, metricReader := range metricReaders {
+		providerOptions = append(providerOptions, sdkmetric.WithReader(metricReader))
+	}
+	provider := sdkmetric.NewMeterProvider(providerOptions...)
 	otel.SetMeterProvider(provider)
 	addBuiltInGoMetricsToOTEL(otelScope)
 
-	traceExporter, err := otlptracehttp.New(ctx, otlptracehttp.WithEndpoint(endpoint.Host), otlptracehttp.WithInsecure())
+	if target == nil {
+		return provider.Shutdown
+	}
+
+	traceExporter, err := target.traceExporter(ctx)
 	if err != nil {
 		panic(err)
 	}
 
-	// Default batcher limits (MaxQueueSize=2048, MaxExportBatchSize=512) are far
-	// too small for high-concurrency runs (e.g. 512 users × ~384 recipients ≈ 400K
-	// spans per run). Spans overflowing the queue are silently dropped, breaking
-	// the trace chain. Size the queue to absorb a full run; at ~200 bytes/span
-	// 500K slots ≈ 100MB peak — acceptable for a test/dev workload.
+	samplerName := conf.TraceSampler
+	if len(samplerName) == 0 && conf.OtlpTraceSampleAll {
+		samplerName = SamplerAlwaysOn
+	}
+	sampler, samplerErr := newSampler(samplerName, conf.TraceSamplerRatio)
+	if samplerErr != nil {
+		logger.Error().Err(samplerErr).Msg("failed to create the sampler")
+		panic(samplerErr)
+	}
+
 	traceOptions := []sdktrace.TracerProviderOption{
-		sdktrace.WithBatcher(traceExporter,
-			sdktrace.WithMaxQueueSize(500_000),
-			sdktrace.WithMaxExportBatchSize(10_000),
-			sdktrace.WithBatchTimeout(2*time.Second),
-		),
+		sdktrace.WithBatcher(traceExporter, conf.TraceBatcher.options()...),
 		sdktrace.WithResource(res),
-	}
-	if conf.OtlpTraceSampleAll {
-		traceOptions = append(traceOptions, trace.WithSampler(trace.AlwaysSample()))
+		sdktrace.WithSampler(sampler),
 	}
 	tp := sdktrace.NewTracerProvider(
 		traceOptions...,
@@ -122,8 +167,8 @@ func InitOtel(ctx context.Context, conf OtelConfig, otelScope string) func(conte
 func CreateCounter(otelScope string, name string, description string, options ...metric_api.Int64CounterOption) metric_api.Int64Counter {
 	meter := otel.Meter(otelScope)
 
-	options = append(options, metric_api.WithDescription(description))
-	options = append(options, metric_api.WithUnit("{call}"))
+	// The options of the caller come last, so that they can override the unit
+	options = append([]metric_api.Int64CounterOption{metric_api.WithDescription(description), metric_api.WithUnit("{call}")}, options...)
 
 	counter, regErr := meter.Int64Counter(name, options...)
 
@@ -136,7 +181,7 @@ func CreateCounter(otelScope string, name string, description string, options ..
 
 func CreateHistogram(otelScope string, name string, description string, unit string, options ...metric_api.Float64HistogramOption) metric_api.Float64Histogram {
 	options = append(options, metric_api.WithDescription(description))
-	options = append(options, metric_api.WithUnit("{call}"))
+	options = append(options, metric_api.WithUnit(unit))
 
 	histogram, err := otel.Meter(otelScope).Float64Histogram(name, options...)
 	if err != nil {
@@ -161,6 +206,31 @@ func CreateGague(otelScope string, name string, description string, unit string)
 	return speedGauge
 }
 
+// CreateObservableGauge creates a gauge observed by the callbacks registered with RegisterCallback
+func CreateObservableGauge(otelScope string, name string, description string, unit string) metric_api.Float64ObservableGauge {
+	gauge, err := otel.Meter(otelScope).Float64ObservableGauge(
+		name,
+		metric_api.WithDescription(description),
+		metric_api.WithUnit(unit),
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return gauge
+}
+
+// RegisterCallback registers the callback observing the instruments when the metrics are collected, until
+// the returned registration is unregistered
+func RegisterCallback(otelScope string, callback metric_api.Callback, instruments ...metric_api.Observable) metric_api.Registration {
+	registration, err := otel.Meter(otelScope).RegisterCallback(callback, instruments...)
+	if err != nil {
+		panic(err)
+	}
+
+	return registration
+}
+
 func CreateUpDownCounter(otelScope string, name string, description string, unit string) metric_api.Int64UpDownCounter {
 	meter := otel.Meter(otelScope)
 
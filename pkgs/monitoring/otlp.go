@@ -0,0 +1,222 @@
+package monitoring
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/url"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc/credentials"
+)
+
+const (
+	OtlpProtocolHTTP = "http/protobuf"
+	OtlpProtocolGRPC = "grpc"
+)
+
+// TraceBatcherConfig sizes the batching of the exported spans; the zero values are the SDK defaults
+// (a queue of 2048 spans, exported in batches of 512 at least every 5s). Spans overflowing the queue are dropped.
+type TraceBatcherConfig struct {
+	MaxQueueSize       int
+	MaxExportBatchSize int
+	BatchTimeout       time.Duration
+}
+
+// LoadTestTraceBatcher absorbs the spans of a full e2e run: the default batcher is far too small for
+// high-concurrency runs (e.g. 512 users × ~384 recipients ≈ 400K spans per run), so that spans would be
+// dropped, breaking the trace chain. At ~200 bytes/span, 500K slots ≈ 100MB peak — acceptable for a
+// test/dev workload.
+var LoadTestTraceBatcher = TraceBatcherConfig{
+	MaxQueueSize:       500_000,
+	MaxExportBatchSize: 10_000,
+	BatchTimeout:       2 * time.Second,
+}
+
+func (c TraceBatcherConfig) options() []sdktrace.BatchSpanProcessorOption {
+	var options []sdktrace.BatchSpanProcessorOption
+	if c.MaxQueueSize > 0 {
+		options = append(options, sdktrace.WithMaxQueueSize(c.MaxQueueSize))
+	}
+	if c.MaxExportBatchSize > 0 {
+		options = append(options, sdktrace.WithMaxExportBatchSize(c.MaxExportBatchSize))
+	}
+	if c.BatchTimeout > 0 {
+		options = append(options, sdktrace.WithBatchTimeout(c.BatchTimeout))
+	}
+	return options
+}
+
+// otlpTarget is where and how the telemetry is exported
+type otlpTarget struct {
+	host     string
+	grpc     bool
+	insecure bool
+	tls      *tls.Config
+	headers  map[string]string
+}
+
+func newOtlpTarget(conf OtelConfig) (otlpTarget, error) {
+	endpoint, parseErr := url.Parse(conf.OtlpEndpoint)
+	if parseErr != nil {
+		return otlpTarget{}, fmt.Errorf("failed to parse endpoint url %s: %w", conf.OtlpEndpoint, parseErr)
+	}
+	target := otlpTarget{host: endpoint.Host, insecure: endpoint.Scheme == "http", headers: conf.OtlpHeaders}
+
+	switch conf.OtlpProtocol {
+	case "", OtlpProtocolHTTP:
+	case OtlpProtocolGRPC:
+		target.grpc = true
+	default:
+		return otlpTarget{}, fmt.Errorf("unsupported OTLP protocol %q: expected %s or %s", conf.OtlpProtocol, OtlpProtocolHTTP, OtlpProtocolGRPC)
+	}
+
+	if !target.insecure {
+		tlsConfig, tlsErr := otlpTLSConfig(conf)
+		if tlsErr != nil {
+			return otlpTarget{}, tlsErr
+		}
+		target.tls = tlsConfig
+	}
+	return target, nil
+}
+
+// otlpTLSConfig trusts the CAs of OtlpCAFile in addition to those of the system, and presents the client
+// certificate, if any
+func otlpTLSConfig(conf OtelConfig) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if len(conf.OtlpCAFile) > 0 {
+		pem, readErr := os.ReadFile(conf.OtlpCAFile)
+		if readErr != nil {
+			return nil, fmt.Errorf("failed to read the OTLP CA file: %w", readErr)
+		}
+		pool, poolErr := x509.SystemCertPool()
+		if poolErr != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in the OTLP CA file %s", conf.OtlpCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if len(conf.OtlpClientCertFile) > 0 {
+		certificate, loadErr := tls.LoadX509KeyPair(conf.OtlpClientCertFile, conf.OtlpClientKeyFile)
+		if loadErr != nil {
+			return nil, fmt.Errorf("failed to load the OTLP client certificate: %w", loadErr)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
+	return tlsConfig, nil
+}
+
+func (t otlpTarget) traceExporter(ctx context.Context) (sdktrace.SpanExporter, error) {
+	if t.grpc {
+		options := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(t.host), otlptracegrpc.WithHeaders(t.headers)}
+		if t.insecure {
+			options = append(options, otlptracegrpc.WithInsecure())
+		} else {
+			options = append(options, otlptracegrpc.WithTLSCredentials(credentials.NewTLS(t.tls)))
+		}
+		return otlptracegrpc.New(ctx, options...)
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(t.host), otlptracehttp.WithHeaders(t.headers)}
+	if t.insecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	} else {
+		options = append(options, otlptracehttp.WithTLSClientConfig(t.tls))
+	}
+	return otlptracehttp.New(ctx, options...)
+}
+
+func (t otlpTarget) metricExporter(ctx context.Context) (sdkmetric.Exporter, error) {
+	if t.grpc {
+		options := []otlpmetricgrpc.Option{otlpmetricgrpc.WithEndpoint(t.host), otlpmetricgrpc.WithHeaders(t.headers)}
+		if t.insecure {
+			options = append(options, otlpmetricgrpc.WithInsecure())
+		} else {
+			options = append(options, otlpmetricgrpc.WithTLSCredentials(credentials.NewTLS(t.tls)))
+		}
+		return otlpmetricgrpc.New(ctx, options...)
+	}
+
+	options := []otlpmetrichttp.Option{otlpmetrichttp.WithEndpoint(t.host), otlpmetrichttp.WithHeaders(t.headers)}
+	if t.insecure {
+		options = append(options, otlpmetrichttp.WithInsecure())
+	} else {
+		options = append(options, otlpmetrichttp.WithTLSClientConfig(t.tls))
+	}
+	return otlpmetrichttp.New(ctx, options...)
+}
+
+// The samplers, named as in OTEL_TRACES_SAMPLER
+const (
+	SamplerAlwaysOn                = "always_on"
+	SamplerAlwaysOff               = "always_off"
+	SamplerTraceIdRatio            = "traceidratio"
+	SamplerParentBasedAlwaysOn     = "parentbased_always_on"
+	SamplerParentBasedAlwaysOff    = "parentbased_always_off"
+	SamplerParentBasedTraceIdRatio = "parentbased_traceidratio"
+)
+
+// newSampler returns the sampler of the given name; the ratio applies to the ratio-based samplers.
+// Without a name, the SDK default (parentbased_always_on) is used.
+func newSampler(name string, ratio float64) (sdktrace.Sampler, error) {
+	switch name {
+	case SamplerAlwaysOn:
+		return sdktrace.AlwaysSample(), nil
+	case SamplerAlwaysOff:
+		return sdktrace.NeverSample(), nil
+	case SamplerTraceIdRatio:
+		return sdktrace.TraceIDRatioBased(ratio), nil
+	case "", SamplerParentBasedAlwaysOn:
+		return sdktrace.ParentBased(sdktrace.AlwaysSample()), nil
+	case SamplerParentBasedAlwaysOff:
+		return sdktrace.ParentBased(sdktrace.NeverSample()), nil
+	case SamplerParentBasedTraceIdRatio:
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio)), nil
+	default:
+		return nil, fmt.Errorf("unsupported sampler %q", name)
+	}
+}
+
+// The propagators, named as in OTEL_PROPAGATORS
+const (
+	PropagatorTraceContext = "tracecontext"
+	PropagatorBaggage      = "baggage"
+	PropagatorB3           = "b3"
+	PropagatorB3Multi      = "b3multi"
+)
+
+// NewPropagator composes the propagators of the given names; tracecontext without names
+func NewPropagator(names []string) (propagation.TextMapPropagator, error) {
+	if len(names) == 0 {
+		return propagation.TraceContext{}, nil
+	}
+	var propagators []propagation.TextMapPropagator
+	for _, name := range names {
+		switch name {
+		case PropagatorTraceContext:
+			propagators = append(propagators, propagation.TraceContext{})
+		case PropagatorBaggage:
+			propagators = append(propagators, propagation.Baggage{})
+		case PropagatorB3:
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3SingleHeader)))
+		case PropagatorB3Multi:
+			propagators = append(propagators, b3.New(b3.WithInjectEncoding(b3.B3MultipleHeader)))
+		default:
+			return nil, fmt.Errorf("unsupported propagator %q: expected %s, %s, %s or %s", name, PropagatorTraceContext, PropagatorBaggage, PropagatorB3, PropagatorB3Multi)
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
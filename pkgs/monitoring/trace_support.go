@@ -7,9 +7,11 @@ import (
 	"go.opentelemetry.io/otel/propagation"
 )
 
+// propagator is set up by InitOtel
+var propagator propagation.TextMapPropagator = propagation.TraceContext{}
+
 func InjectTraceData(ctx context.Context) propagation.MapCarrier {
 	carrier := propagation.MapCarrier{}
-	propagator := propagation.TraceContext{}
 	propagator.Inject(ctx, carrier)
 	return carrier
 }
@@ -19,17 +21,14 @@ func ExtractTraceData(ctx context.Context, data map[string]string) context.Conte
 	for key, value := range data {
 		carrier.Set(key, value)
 	}
-	propagator := propagation.TraceContext{}
 	return propagator.Extract(ctx, carrier)
 }
 
 func InjectIntoHeader(ctx context.Context, headers http.Header) http.Header {
-	propagator := propagation.TraceContext{}
 	propagator.Inject(ctx, propagation.HeaderCarrier(headers))
 	return headers
 }
 
 func ExtractFromHeader(ctx context.Context, headers http.Header) context.Context {
-	propagator := propagation.TraceContext{}
 	return propagator.Extract(ctx, propagation.HeaderCarrier(headers))
 }
@@ -0,0 +1,203 @@
+// Package signing implements the HMAC request signatures wsgw attaches to the
+// requests it sends to the backend (`/ws/connect`, `/ws/message`, `/ws/disconnected`).
+//
+// The package has no dependencies on the rest of wsgw, so backends written in Go
+// can import it to verify that a request really came from wsgw:
+//
+//	verifier, err := signing.NewVerifier(keys, signing.DefaultMaxClockSkew)
+//	...
+//	http.Handle("/ws/", verifier.Middleware(backendHandler))
+package signing
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	SignatureHeader    = "X-WSGW-SIGNATURE"
+	TimestampHeader    = "X-WSGW-TIMESTAMP"
+	KeyIDHeader        = "X-WSGW-KEY-ID"
+	ConnectionIDHeader = "X-WSGW-CONNECTION-ID"
+
+	signatureVersion = "v1"
+)
+
+// DefaultMaxClockSkew is how far the timestamp of a signed request may be from the
+// verifier's clock before the request is rejected as stale (or from the future).
+const DefaultMaxClockSkew = 5 * time.Minute
+
+var (
+	ErrMissingSignature = errors.New("missing request signature")
+	ErrUnknownKey       = errors.New("unknown signing key")
+	ErrStaleTimestamp   = errors.New("request timestamp outside the accepted window")
+	ErrBadSignature     = errors.New("request signature mismatch")
+)
+
+// Key is a named HMAC secret. The ID travels with each request in `X-WSGW-KEY-ID`,
+// so the secret can be rotated by having the verifier accept both the old and the
+// new key while wsgw is switched over to sign with the new one.
+type Key struct {
+	ID     string
+	Secret []byte
+}
+
+// ParseKeys parses key specifications in the form `<key-id>:<secret>`.
+func ParseKeys(specs []string) ([]Key, error) {
+	keys := make([]Key, 0, len(specs))
+	seen := map[string]struct{}{}
+	for _, spec := range specs {
+		id, secret, found := strings.Cut(spec, ":")
+		if !found || len(id) == 0 || len(secret) == 0 {
+			return nil, fmt.Errorf("invalid signing key spec %q: expected <key-id>:<secret>", redact(spec))
+		}
+		if _, duplicate := seen[id]; duplicate {
+			return nil, fmt.Errorf("duplicate signing key id %q", id)
+		}
+		seen[id] = struct{}{}
+		keys = append(keys, Key{ID: id, Secret: []byte(secret)})
+	}
+	return keys, nil
+}
+
+func redact(spec string) string {
+	id, _, _ := strings.Cut(spec, ":")
+	return id + ":***"
+}
+
+// canonicalString builds the string the signature is computed over:
+// method, path, query, timestamp, connection ID and the hex-encoded SHA-256 of
+// the body, separated by newlines.
+func canonicalString(requestUrl *url.URL, method string, timestamp string, connectionId string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		requestUrl.EscapedPath(),
+		canonicalQuery(requestUrl.RawQuery),
+		timestamp,
+		connectionId,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+}
+
+// canonicalQuery sorts the query parameters by name, so proxies reordering them
+// don't break the signature. A query which doesn't parse is signed as it is.
+func canonicalQuery(rawQuery string) string {
+	values, parseErr := url.ParseQuery(rawQuery)
+	if parseErr != nil {
+		return rawQuery
+	}
+	return values.Encode()
+}
+
+func computeSignature(secret []byte, canonical string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(canonical))
+	return signatureVersion + "=" + base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Signer signs outgoing requests with a single (the currently active) key.
+type Signer struct {
+	key Key
+	now func() time.Time
+}
+
+func NewSigner(key Key) *Signer {
+	return &Signer{key: key, now: time.Now}
+}
+
+// Sign sets the signature headers on the request. The body must be the exact bytes
+// the request is going to carry (nil for requests without a body). The connection
+// ID is taken from the request's `X-WSGW-CONNECTION-ID` header, so that header must
+// be set before Sign is called.
+func (s *Signer) Sign(request *http.Request, body []byte) {
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	canonical := canonicalString(request.URL, request.Method, timestamp, request.Header.Get(ConnectionIDHeader), body)
+	request.Header.Set(TimestampHeader, timestamp)
+	request.Header.Set(KeyIDHeader, s.key.ID)
+	request.Header.Set(SignatureHeader, computeSignature(s.key.Secret, canonical))
+}
+
+// Verifier checks the signatures of incoming requests against a set of keys.
+type Verifier struct {
+	keys         map[string][]byte
+	maxClockSkew time.Duration
+	now          func() time.Time
+}
+
+func NewVerifier(keys []Key, maxClockSkew time.Duration) (*Verifier, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("at least one key is required")
+	}
+	keyMap := make(map[string][]byte, len(keys))
+	for _, key := range keys {
+		keyMap[key.ID] = key.Secret
+	}
+	return &Verifier{keys: keyMap, maxClockSkew: maxClockSkew, now: time.Now}, nil
+}
+
+// Verify checks the signature of the request. The request body is read and
+// replaced with an in-memory copy, so handlers further down the chain can still
+// read it.
+func (v *Verifier) Verify(request *http.Request) error {
+	signature := request.Header.Get(SignatureHeader)
+	timestamp := request.Header.Get(TimestampHeader)
+	keyId := request.Header.Get(KeyIDHeader)
+	if signature == "" || timestamp == "" || keyId == "" {
+		return ErrMissingSignature
+	}
+
+	secret, ok := v.keys[keyId]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKey, keyId)
+	}
+
+	seconds, parseErr := strconv.ParseInt(timestamp, 10, 64)
+	if parseErr != nil {
+		return fmt.Errorf("%w: %v", ErrStaleTimestamp, parseErr)
+	}
+	skew := v.now().Sub(time.Unix(seconds, 0))
+	if skew > v.maxClockSkew || skew < -v.maxClockSkew {
+		return ErrStaleTimestamp
+	}
+
+	var body []byte
+	if request.Body != nil {
+		var readErr error
+		body, readErr = io.ReadAll(request.Body)
+		request.Body.Close()
+		if readErr != nil {
+			return fmt.Errorf("failed to read request body: %w", readErr)
+		}
+		request.Body = io.NopCloser(bytes.NewReader(body))
+	}
+
+	canonical := canonicalString(request.URL, request.Method, timestamp, request.Header.Get(ConnectionIDHeader), body)
+	expected := computeSignature(secret, canonical)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrBadSignature
+	}
+	return nil
+}
+
+// Middleware rejects requests with a missing or invalid signature with `401 Unauthorized`.
+func (v *Verifier) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := v.Verify(r); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,132 @@
+package signing
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/suite"
+)
+
+type signingTestSuite struct {
+	suite.Suite
+	clock    time.Time
+	keys     []Key
+	verifier *Verifier
+}
+
+func TestSigningTestSuite(t *testing.T) {
+	suite.Run(t, &signingTestSuite{})
+}
+
+func (s *signingTestSuite) SetupTest() {
+	s.clock = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	keys, parseErr := ParseKeys([]string{"key-2:new-secret", "key-1:old-secret"})
+	s.Require().NoError(parseErr)
+	s.keys = keys
+	verifier, verifierErr := NewVerifier(keys, DefaultMaxClockSkew)
+	s.Require().NoError(verifierErr)
+	verifier.now = func() time.Time { return s.clock }
+	s.verifier = verifier
+}
+
+// newRequest creates a request to the backend from the connection "some-connection"
+func (s *signingTestSuite) newRequest(target string, body string) *http.Request {
+	request, err := http.NewRequest(http.MethodPost, target, strings.NewReader(body))
+	s.Require().NoError(err)
+	request.Header.Set(ConnectionIDHeader, "some-connection")
+	return request
+}
+
+// sign signs the request with the key as of the suite's clock
+func (s *signingTestSuite) sign(key Key, request *http.Request, body string) {
+	signer := NewSigner(key)
+	signer.now = func() time.Time { return s.clock }
+	signer.Sign(request, []byte(body))
+}
+
+func (s *signingTestSuite) TestParseKeys() {
+	_, parseErr := ParseKeys([]string{"key-1"})
+	s.ErrorContains(parseErr, "expected <key-id>:<secret>")
+
+	_, parseErr = ParseKeys([]string{"key-1:secret", "key-1:other"})
+	s.ErrorContains(parseErr, `duplicate signing key id "key-1"`)
+
+	// The secret isn't leaked in the error
+	_, parseErr = ParseKeys([]string{":secret"})
+	s.Require().Error(parseErr)
+	s.NotContains(parseErr.Error(), "secret\"")
+}
+
+func (s *signingTestSuite) TestSignedRequestIsVerified() {
+	request := s.newRequest("http://backend/ws/message?b=2&a=1", "hello")
+	s.sign(s.keys[0], request, "hello")
+	s.NoError(s.verifier.Verify(request))
+}
+
+func (s *signingTestSuite) TestRotatedOutKeyIsVerified() {
+	request := s.newRequest("http://backend/ws/message", "hello")
+	s.sign(s.keys[1], request, "hello")
+	s.NoError(s.verifier.Verify(request))
+}
+
+func (s *signingTestSuite) TestBodyIsReadableAfterVerification() {
+	request := s.newRequest("http://backend/ws/message", "hello")
+	s.sign(s.keys[0], request, "hello")
+	s.Require().NoError(s.verifier.Verify(request))
+
+	body, readErr := io.ReadAll(request.Body)
+	s.Require().NoError(readErr)
+	s.Equal("hello", string(body))
+}
+
+func (s *signingTestSuite) TestUnsignedRequestIsRejected() {
+	s.ErrorIs(s.verifier.Verify(s.newRequest("http://backend/ws/message", "hello")), ErrMissingSignature)
+}
+
+func (s *signingTestSuite) TestUnknownKeyIsRejected() {
+	request := s.newRequest("http://backend/ws/message", "hello")
+	s.sign(Key{ID: "key-0", Secret: []byte("ancient")}, request, "hello")
+	s.ErrorIs(s.verifier.Verify(request), ErrUnknownKey)
+}
+
+func (s *signingTestSuite) TestStaleRequestIsRejected() {
+	request := s.newRequest("http://backend/ws/message", "hello")
+	s.sign(s.keys[0], request, "hello")
+	s.clock = s.clock.Add(DefaultMaxClockSkew + time.Second)
+	s.ErrorIs(s.verifier.Verify(request), ErrStaleTimestamp)
+}
+
+func (s *signingTestSuite) TestTamperedBodyIsRejected() {
+	request := s.newRequest("http://backend/ws/message", "hello!")
+	s.sign(s.keys[0], request, "hello")
+	s.ErrorIs(s.verifier.Verify(request), ErrBadSignature)
+}
+
+func (s *signingTestSuite) TestForgedConnectionIdIsRejected() {
+	request := s.newRequest("http://backend/ws/message", "hello")
+	s.sign(s.keys[0], request, "hello")
+	request.Header.Set(ConnectionIDHeader, "other-connection")
+	s.ErrorIs(s.verifier.Verify(request), ErrBadSignature)
+}
+
+func (s *signingTestSuite) TestTamperedQueryIsRejected() {
+	request := s.newRequest("http://backend/ws/connect?room=lobby", "")
+	s.sign(s.keys[0], request, "")
+	request.URL.RawQuery = "room=admin"
+	s.ErrorIs(s.verifier.Verify(request), ErrBadSignature)
+
+	added := s.newRequest("http://backend/ws/connect", "")
+	s.sign(s.keys[0], added, "")
+	added.URL.RawQuery = "room=admin"
+	s.ErrorIs(s.verifier.Verify(added), ErrBadSignature)
+}
+
+func (s *signingTestSuite) TestReorderedQueryIsVerified() {
+	request := s.newRequest("http://backend/ws/connect?room=lobby&user=42", "")
+	s.sign(s.keys[0], request, "")
+	request.URL.RawQuery = "user=42&room=lobby"
+	s.NoError(s.verifier.Verify(request))
+}
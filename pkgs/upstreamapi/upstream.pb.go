@@ -0,0 +1,902 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.10
+// 	protoc        (unknown)
+// source: upstream.proto
+
+package upstreamapi
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type Header struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Name          string                 `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Values        []string               `protobuf:"bytes,2,rep,name=values,proto3" json:"values,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Header) Reset() {
+	*x = Header{}
+	mi := &file_upstream_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Header) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Header) ProtoMessage() {}
+
+func (x *Header) ProtoReflect() protoreflect.Message {
+	mi := &file_upstream_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Header.ProtoReflect.Descriptor instead.
+func (*Header) Descriptor() ([]byte, []int) {
+	return file_upstream_proto_rawDescGZIP(), []int{0}
+}
+
+func (x *Header) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *Header) GetValues() []string {
+	if x != nil {
+		return x.Values
+	}
+	return nil
+}
+
+// Connect asks the backend whether to accept a connection; the backend answers with a ConnectResult
+type Connect struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	ConnectionId string                 `protobuf:"bytes,1,opt,name=connection_id,json=connectionId,proto3" json:"connection_id,omitempty"`
+	// profile is the backend profile of the connection, empty for the default one
+	Profile string `protobuf:"bytes,2,opt,name=profile,proto3" json:"profile,omitempty"`
+	// header holds the headers of the connect request of the client
+	Header        []*Header `protobuf:"bytes,3,rep,name=header,proto3" json:"header,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Connect) Reset() {
+	*x = Connect{}
+	mi := &file_upstream_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Connect) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Connect) ProtoMessage() {}
+
+func (x *Connect) ProtoReflect() protoreflect.Message {
+	mi := &file_upstream_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Connect.ProtoReflect.Descriptor instead.
+func (*Connect) Descriptor() ([]byte, []int) {
+	return file_upstream_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Connect) GetConnectionId() string {
+	if x != nil {
+		return x.ConnectionId
+	}
+	return ""
+}
+
+func (x *Connect) GetProfile() string {
+	if x != nil {
+		return x.Profile
+	}
+	return ""
+}
+
+func (x *Connect) GetHeader() []*Header {
+	if x != nil {
+		return x.Header
+	}
+	return nil
+}
+
+// Message is a message of the client
+type Message struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	ConnectionId string                 `protobuf:"bytes,1,opt,name=connection_id,json=connectionId,proto3" json:"connection_id,omitempty"`
+	Profile      string                 `protobuf:"bytes,2,opt,name=profile,proto3" json:"profile,omitempty"`
+	Message      string                 `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	// trace_data is the W3C trace context of the message, e.g. {"traceparent": "00-…"}
+	TraceData     map[string]string `protobuf:"bytes,4,rep,name=trace_data,json=traceData,proto3" json:"trace_data,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Message) Reset() {
+	*x = Message{}
+	mi := &file_upstream_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Message) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Message) ProtoMessage() {}
+
+func (x *Message) ProtoReflect() protoreflect.Message {
+	mi := &file_upstream_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Message.ProtoReflect.Descriptor instead.
+func (*Message) Descriptor() ([]byte, []int) {
+	return file_upstream_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *Message) GetConnectionId() string {
+	if x != nil {
+		return x.ConnectionId
+	}
+	return ""
+}
+
+func (x *Message) GetProfile() string {
+	if x != nil {
+		return x.Profile
+	}
+	return ""
+}
+
+func (x *Message) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Message) GetTraceData() map[string]string {
+	if x != nil {
+		return x.TraceData
+	}
+	return nil
+}
+
+// Disconnected tells the backend that the connection is closed
+type Disconnected struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	ConnectionId  string                 `protobuf:"bytes,1,opt,name=connection_id,json=connectionId,proto3" json:"connection_id,omitempty"`
+	Profile       string                 `protobuf:"bytes,2,opt,name=profile,proto3" json:"profile,omitempty"`
+	Header        []*Header              `protobuf:"bytes,3,rep,name=header,proto3" json:"header,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Disconnected) Reset() {
+	*x = Disconnected{}
+	mi := &file_upstream_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Disconnected) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Disconnected) ProtoMessage() {}
+
+func (x *Disconnected) ProtoReflect() protoreflect.Message {
+	mi := &file_upstream_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Disconnected.ProtoReflect.Descriptor instead.
+func (*Disconnected) Descriptor() ([]byte, []int) {
+	return file_upstream_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *Disconnected) GetConnectionId() string {
+	if x != nil {
+		return x.ConnectionId
+	}
+	return ""
+}
+
+func (x *Disconnected) GetProfile() string {
+	if x != nil {
+		return x.Profile
+	}
+	return ""
+}
+
+func (x *Disconnected) GetHeader() []*Header {
+	if x != nil {
+		return x.Header
+	}
+	return nil
+}
+
+// PushResult is the outcome of a Push the backend gave an id to
+type PushResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	Id    uint64                 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// status is the HTTP status `POST /message/{connectionId}` would have returned
+	Status        int32  `protobuf:"varint,2,opt,name=status,proto3" json:"status,omitempty"`
+	Error         string `protobuf:"bytes,3,opt,name=error,proto3" json:"error,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *PushResult) Reset() {
+	*x = PushResult{}
+	mi := &file_upstream_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *PushResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*PushResult) ProtoMessage() {}
+
+func (x *PushResult) ProtoReflect() protoreflect.Message {
+	mi := &file_upstream_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use PushResult.ProtoReflect.Descriptor instead.
+func (*PushResult) Descriptor() ([]byte, []int) {
+	return file_upstream_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *PushResult) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *PushResult) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
+func (x *PushResult) GetError() string {
+	if x != nil {
+		return x.Error
+	}
+	return ""
+}
+
+type GatewayEvent struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id correlates the Connect events with their ConnectResult
+	Id uint64 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// Types that are valid to be assigned to Event:
+	//
+	//	*GatewayEvent_Connect
+	//	*GatewayEvent_Message
+	//	*GatewayEvent_Disconnected
+	//	*GatewayEvent_PushResult
+	Event         isGatewayEvent_Event `protobuf_oneof:"event"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GatewayEvent) Reset() {
+	*x = GatewayEvent{}
+	mi := &file_upstream_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GatewayEvent) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GatewayEvent) ProtoMessage() {}
+
+func (x *GatewayEvent) ProtoReflect() protoreflect.Message {
+	mi := &file_upstream_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GatewayEvent.ProtoReflect.Descriptor instead.
+func (*GatewayEvent) Descriptor() ([]byte, []int) {
+	return file_upstream_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *GatewayEvent) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *GatewayEvent) GetEvent() isGatewayEvent_Event {
+	if x != nil {
+		return x.Event
+	}
+	return nil
+}
+
+func (x *GatewayEvent) GetConnect() *Connect {
+	if x != nil {
+		if x, ok := x.Event.(*GatewayEvent_Connect); ok {
+			return x.Connect
+		}
+	}
+	return nil
+}
+
+func (x *GatewayEvent) GetMessage() *Message {
+	if x != nil {
+		if x, ok := x.Event.(*GatewayEvent_Message); ok {
+			return x.Message
+		}
+	}
+	return nil
+}
+
+func (x *GatewayEvent) GetDisconnected() *Disconnected {
+	if x != nil {
+		if x, ok := x.Event.(*GatewayEvent_Disconnected); ok {
+			return x.Disconnected
+		}
+	}
+	return nil
+}
+
+func (x *GatewayEvent) GetPushResult() *PushResult {
+	if x != nil {
+		if x, ok := x.Event.(*GatewayEvent_PushResult); ok {
+			return x.PushResult
+		}
+	}
+	return nil
+}
+
+type isGatewayEvent_Event interface {
+	isGatewayEvent_Event()
+}
+
+type GatewayEvent_Connect struct {
+	Connect *Connect `protobuf:"bytes,2,opt,name=connect,proto3,oneof"`
+}
+
+type GatewayEvent_Message struct {
+	Message *Message `protobuf:"bytes,3,opt,name=message,proto3,oneof"`
+}
+
+type GatewayEvent_Disconnected struct {
+	Disconnected *Disconnected `protobuf:"bytes,4,opt,name=disconnected,proto3,oneof"`
+}
+
+type GatewayEvent_PushResult struct {
+	PushResult *PushResult `protobuf:"bytes,5,opt,name=push_result,json=pushResult,proto3,oneof"`
+}
+
+func (*GatewayEvent_Connect) isGatewayEvent_Event() {}
+
+func (*GatewayEvent_Message) isGatewayEvent_Event() {}
+
+func (*GatewayEvent_Disconnected) isGatewayEvent_Event() {}
+
+func (*GatewayEvent_PushResult) isGatewayEvent_Event() {}
+
+// ConnectResult accepts or rejects a connection
+type ConnectResult struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id is that of the Connect event
+	Id uint64 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	// status is the HTTP status the connect callback would have returned: 200 accepts the connection,
+	// 401 rejects it as unauthenticated, anything else rejects it
+	Status int32 `protobuf:"varint,2,opt,name=status,proto3" json:"status,omitempty"`
+	// attributes describe the accepted connection, e.g. its tenant; wsgw may break its metrics down by them
+	Attributes    map[string]string `protobuf:"bytes,3,rep,name=attributes,proto3" json:"attributes,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ConnectResult) Reset() {
+	*x = ConnectResult{}
+	mi := &file_upstream_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ConnectResult) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ConnectResult) ProtoMessage() {}
+
+func (x *ConnectResult) ProtoReflect() protoreflect.Message {
+	mi := &file_upstream_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ConnectResult.ProtoReflect.Descriptor instead.
+func (*ConnectResult) Descriptor() ([]byte, []int) {
+	return file_upstream_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ConnectResult) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *ConnectResult) GetStatus() int32 {
+	if x != nil {
+		return x.Status
+	}
+	return 0
+}
+
+func (x *ConnectResult) GetAttributes() map[string]string {
+	if x != nil {
+		return x.Attributes
+	}
+	return nil
+}
+
+// Push sends a message to a connection
+type Push struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// id, if set, makes wsgw answer with a PushResult
+	Id           uint64 `protobuf:"varint,1,opt,name=id,proto3" json:"id,omitempty"`
+	ConnectionId string `protobuf:"bytes,2,opt,name=connection_id,json=connectionId,proto3" json:"connection_id,omitempty"`
+	Message      string `protobuf:"bytes,3,opt,name=message,proto3" json:"message,omitempty"`
+	// trace_data is the W3C trace context the write of the message to the client continues
+	TraceData     map[string]string `protobuf:"bytes,4,rep,name=trace_data,json=traceData,proto3" json:"trace_data,omitempty" protobuf_key:"bytes,1,opt,name=key" protobuf_val:"bytes,2,opt,name=value"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Push) Reset() {
+	*x = Push{}
+	mi := &file_upstream_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Push) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Push) ProtoMessage() {}
+
+func (x *Push) ProtoReflect() protoreflect.Message {
+	mi := &file_upstream_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Push.ProtoReflect.Descriptor instead.
+func (*Push) Descriptor() ([]byte, []int) {
+	return file_upstream_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *Push) GetId() uint64 {
+	if x != nil {
+		return x.Id
+	}
+	return 0
+}
+
+func (x *Push) GetConnectionId() string {
+	if x != nil {
+		return x.ConnectionId
+	}
+	return ""
+}
+
+func (x *Push) GetMessage() string {
+	if x != nil {
+		return x.Message
+	}
+	return ""
+}
+
+func (x *Push) GetTraceData() map[string]string {
+	if x != nil {
+		return x.TraceData
+	}
+	return nil
+}
+
+// Close closes a connection
+type Close struct {
+	state        protoimpl.MessageState `protogen:"open.v1"`
+	ConnectionId string                 `protobuf:"bytes,1,opt,name=connection_id,json=connectionId,proto3" json:"connection_id,omitempty"`
+	// code is the WebSocket close code, 1000 (normal closure) if not set
+	Code          int32  `protobuf:"varint,2,opt,name=code,proto3" json:"code,omitempty"`
+	Reason        string `protobuf:"bytes,3,opt,name=reason,proto3" json:"reason,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Close) Reset() {
+	*x = Close{}
+	mi := &file_upstream_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Close) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Close) ProtoMessage() {}
+
+func (x *Close) ProtoReflect() protoreflect.Message {
+	mi := &file_upstream_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Close.ProtoReflect.Descriptor instead.
+func (*Close) Descriptor() ([]byte, []int) {
+	return file_upstream_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Close) GetConnectionId() string {
+	if x != nil {
+		return x.ConnectionId
+	}
+	return ""
+}
+
+func (x *Close) GetCode() int32 {
+	if x != nil {
+		return x.Code
+	}
+	return 0
+}
+
+func (x *Close) GetReason() string {
+	if x != nil {
+		return x.Reason
+	}
+	return ""
+}
+
+type BackendCommand struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// Types that are valid to be assigned to Command:
+	//
+	//	*BackendCommand_ConnectResult
+	//	*BackendCommand_Push
+	//	*BackendCommand_Close
+	Command       isBackendCommand_Command `protobuf_oneof:"command"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *BackendCommand) Reset() {
+	*x = BackendCommand{}
+	mi := &file_upstream_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *BackendCommand) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*BackendCommand) ProtoMessage() {}
+
+func (x *BackendCommand) ProtoReflect() protoreflect.Message {
+	mi := &file_upstream_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use BackendCommand.ProtoReflect.Descriptor instead.
+func (*BackendCommand) Descriptor() ([]byte, []int) {
+	return file_upstream_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *BackendCommand) GetCommand() isBackendCommand_Command {
+	if x != nil {
+		return x.Command
+	}
+	return nil
+}
+
+func (x *BackendCommand) GetConnectResult() *ConnectResult {
+	if x != nil {
+		if x, ok := x.Command.(*BackendCommand_ConnectResult); ok {
+			return x.ConnectResult
+		}
+	}
+	return nil
+}
+
+func (x *BackendCommand) GetPush() *Push {
+	if x != nil {
+		if x, ok := x.Command.(*BackendCommand_Push); ok {
+			return x.Push
+		}
+	}
+	return nil
+}
+
+func (x *BackendCommand) GetClose() *Close {
+	if x != nil {
+		if x, ok := x.Command.(*BackendCommand_Close); ok {
+			return x.Close
+		}
+	}
+	return nil
+}
+
+type isBackendCommand_Command interface {
+	isBackendCommand_Command()
+}
+
+type BackendCommand_ConnectResult struct {
+	ConnectResult *ConnectResult `protobuf:"bytes,1,opt,name=connect_result,json=connectResult,proto3,oneof"`
+}
+
+type BackendCommand_Push struct {
+	Push *Push `protobuf:"bytes,2,opt,name=push,proto3,oneof"`
+}
+
+type BackendCommand_Close struct {
+	Close *Close `protobuf:"bytes,3,opt,name=close,proto3,oneof"`
+}
+
+func (*BackendCommand_ConnectResult) isBackendCommand_Command() {}
+
+func (*BackendCommand_Push) isBackendCommand_Command() {}
+
+func (*BackendCommand_Close) isBackendCommand_Command() {}
+
+var File_upstream_proto protoreflect.FileDescriptor
+
+const file_upstream_proto_rawDesc = "" +
+	"\n" +
+	"\x0eupstream.proto\x12\x10wsgw.upstream.v1\"4\n" +
+	"\x06Header\x12\x12\n" +
+	"\x04name\x18\x01 \x01(\tR\x04name\x12\x16\n" +
+	"\x06values\x18\x02 \x03(\tR\x06values\"z\n" +
+	"\aConnect\x12#\n" +
+	"\rconnection_id\x18\x01 \x01(\tR\fconnectionId\x12\x18\n" +
+	"\aprofile\x18\x02 \x01(\tR\aprofile\x120\n" +
+	"\x06header\x18\x03 \x03(\v2\x18.wsgw.upstream.v1.HeaderR\x06header\"\xe9\x01\n" +
+	"\aMessage\x12#\n" +
+	"\rconnection_id\x18\x01 \x01(\tR\fconnectionId\x12\x18\n" +
+	"\aprofile\x18\x02 \x01(\tR\aprofile\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12G\n" +
+	"\n" +
+	"trace_data\x18\x04 \x03(\v2(.wsgw.upstream.v1.Message.TraceDataEntryR\ttraceData\x1a<\n" +
+	"\x0eTraceDataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\x7f\n" +
+	"\fDisconnected\x12#\n" +
+	"\rconnection_id\x18\x01 \x01(\tR\fconnectionId\x12\x18\n" +
+	"\aprofile\x18\x02 \x01(\tR\aprofile\x120\n" +
+	"\x06header\x18\x03 \x03(\v2\x18.wsgw.upstream.v1.HeaderR\x06header\"J\n" +
+	"\n" +
+	"PushResult\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\x05R\x06status\x12\x14\n" +
+	"\x05error\x18\x03 \x01(\tR\x05error\"\x9c\x02\n" +
+	"\fGatewayEvent\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x125\n" +
+	"\aconnect\x18\x02 \x01(\v2\x19.wsgw.upstream.v1.ConnectH\x00R\aconnect\x125\n" +
+	"\amessage\x18\x03 \x01(\v2\x19.wsgw.upstream.v1.MessageH\x00R\amessage\x12D\n" +
+	"\fdisconnected\x18\x04 \x01(\v2\x1e.wsgw.upstream.v1.DisconnectedH\x00R\fdisconnected\x12?\n" +
+	"\vpush_result\x18\x05 \x01(\v2\x1c.wsgw.upstream.v1.PushResultH\x00R\n" +
+	"pushResultB\a\n" +
+	"\x05event\"\xc7\x01\n" +
+	"\rConnectResult\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12\x16\n" +
+	"\x06status\x18\x02 \x01(\x05R\x06status\x12O\n" +
+	"\n" +
+	"attributes\x18\x03 \x03(\v2/.wsgw.upstream.v1.ConnectResult.AttributesEntryR\n" +
+	"attributes\x1a=\n" +
+	"\x0fAttributesEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"\xd9\x01\n" +
+	"\x04Push\x12\x0e\n" +
+	"\x02id\x18\x01 \x01(\x04R\x02id\x12#\n" +
+	"\rconnection_id\x18\x02 \x01(\tR\fconnectionId\x12\x18\n" +
+	"\amessage\x18\x03 \x01(\tR\amessage\x12D\n" +
+	"\n" +
+	"trace_data\x18\x04 \x03(\v2%.wsgw.upstream.v1.Push.TraceDataEntryR\ttraceData\x1a<\n" +
+	"\x0eTraceDataEntry\x12\x10\n" +
+	"\x03key\x18\x01 \x01(\tR\x03key\x12\x14\n" +
+	"\x05value\x18\x02 \x01(\tR\x05value:\x028\x01\"X\n" +
+	"\x05Close\x12#\n" +
+	"\rconnection_id\x18\x01 \x01(\tR\fconnectionId\x12\x12\n" +
+	"\x04code\x18\x02 \x01(\x05R\x04code\x12\x16\n" +
+	"\x06reason\x18\x03 \x01(\tR\x06reason\"\xc4\x01\n" +
+	"\x0eBackendCommand\x12H\n" +
+	"\x0econnect_result\x18\x01 \x01(\v2\x1f.wsgw.upstream.v1.ConnectResultH\x00R\rconnectResult\x12,\n" +
+	"\x04push\x18\x02 \x01(\v2\x16.wsgw.upstream.v1.PushH\x00R\x04push\x12/\n" +
+	"\x05close\x18\x03 \x01(\v2\x17.wsgw.upstream.v1.CloseH\x00R\x05closeB\t\n" +
+	"\acommand2a\n" +
+	"\x0fUpstreamService\x12N\n" +
+	"\x06Events\x12\x1e.wsgw.upstream.v1.GatewayEvent\x1a .wsgw.upstream.v1.BackendCommand(\x010\x01B\x17Z\x15wsgw/pkgs/upstreamapib\x06proto3"
+
+var (
+	file_upstream_proto_rawDescOnce sync.Once
+	file_upstream_proto_rawDescData []byte
+)
+
+func file_upstream_proto_rawDescGZIP() []byte {
+	file_upstream_proto_rawDescOnce.Do(func() {
+		file_upstream_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_upstream_proto_rawDesc), len(file_upstream_proto_rawDesc)))
+	})
+	return file_upstream_proto_rawDescData
+}
+
+var file_upstream_proto_msgTypes = make([]protoimpl.MessageInfo, 13)
+var file_upstream_proto_goTypes = []any{
+	(*Header)(nil),         // 0: wsgw.upstream.v1.Header
+	(*Connect)(nil),        // 1: wsgw.upstream.v1.Connect
+	(*Message)(nil),        // 2: wsgw.upstream.v1.Message
+	(*Disconnected)(nil),   // 3: wsgw.upstream.v1.Disconnected
+	(*PushResult)(nil),     // 4: wsgw.upstream.v1.PushResult
+	(*GatewayEvent)(nil),   // 5: wsgw.upstream.v1.GatewayEvent
+	(*ConnectResult)(nil),  // 6: wsgw.upstream.v1.ConnectResult
+	(*Push)(nil),           // 7: wsgw.upstream.v1.Push
+	(*Close)(nil),          // 8: wsgw.upstream.v1.Close
+	(*BackendCommand)(nil), // 9: wsgw.upstream.v1.BackendCommand
+	nil,                    // 10: wsgw.upstream.v1.Message.TraceDataEntry
+	nil,                    // 11: wsgw.upstream.v1.ConnectResult.AttributesEntry
+	nil,                    // 12: wsgw.upstream.v1.Push.TraceDataEntry
+}
+var file_upstream_proto_depIdxs = []int32{
+	0,  // 0: wsgw.upstream.v1.Connect.header:type_name -> wsgw.upstream.v1.Header
+	10, // 1: wsgw.upstream.v1.Message.trace_data:type_name -> wsgw.upstream.v1.Message.TraceDataEntry
+	0,  // 2: wsgw.upstream.v1.Disconnected.header:type_name -> wsgw.upstream.v1.Header
+	1,  // 3: wsgw.upstream.v1.GatewayEvent.connect:type_name -> wsgw.upstream.v1.Connect
+	2,  // 4: wsgw.upstream.v1.GatewayEvent.message:type_name -> wsgw.upstream.v1.Message
+	3,  // 5: wsgw.upstream.v1.GatewayEvent.disconnected:type_name -> wsgw.upstream.v1.Disconnected
+	4,  // 6: wsgw.upstream.v1.GatewayEvent.push_result:type_name -> wsgw.upstream.v1.PushResult
+	11, // 7: wsgw.upstream.v1.ConnectResult.attributes:type_name -> wsgw.upstream.v1.ConnectResult.AttributesEntry
+	12, // 8: wsgw.upstream.v1.Push.trace_data:type_name -> wsgw.upstream.v1.Push.TraceDataEntry
+	6,  // 9: wsgw.upstream.v1.BackendCommand.connect_result:type_name -> wsgw.upstream.v1.ConnectResult
+	7,  // 10: wsgw.upstream.v1.BackendCommand.push:type_name -> wsgw.upstream.v1.Push
+	8,  // 11: wsgw.upstream.v1.BackendCommand.close:type_name -> wsgw.upstream.v1.Close
+	5,  // 12: wsgw.upstream.v1.UpstreamService.Events:input_type -> wsgw.upstream.v1.GatewayEvent
+	9,  // 13: wsgw.upstream.v1.UpstreamService.Events:output_type -> wsgw.upstream.v1.BackendCommand
+	13, // [13:14] is the sub-list for method output_type
+	12, // [12:13] is the sub-list for method input_type
+	12, // [12:12] is the sub-list for extension type_name
+	12, // [12:12] is the sub-list for extension extendee
+	0,  // [0:12] is the sub-list for field type_name
+}
+
+func init() { file_upstream_proto_init() }
+func file_upstream_proto_init() {
+	if File_upstream_proto != nil {
+		return
+	}
+	file_upstream_proto_msgTypes[5].OneofWrappers = []any{
+		(*GatewayEvent_Connect)(nil),
+		(*GatewayEvent_Message)(nil),
+		(*GatewayEvent_Disconnected)(nil),
+		(*GatewayEvent_PushResult)(nil),
+	}
+	file_upstream_proto_msgTypes[9].OneofWrappers = []any{
+		(*BackendCommand_ConnectResult)(nil),
+		(*BackendCommand_Push)(nil),
+		(*BackendCommand_Close)(nil),
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_upstream_proto_rawDesc), len(file_upstream_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   13,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_upstream_proto_goTypes,
+		DependencyIndexes: file_upstream_proto_depIdxs,
+		MessageInfos:      file_upstream_proto_msgTypes,
+	}.Build()
+	File_upstream_proto = out.File
+	file_upstream_proto_goTypes = nil
+	file_upstream_proto_depIdxs = nil
+}
@@ -0,0 +1,125 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: upstream.proto
+
+package upstreamapi
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	UpstreamService_Events_FullMethodName = "/wsgw.upstream.v1.UpstreamService/Events"
+)
+
+// UpstreamServiceClient is the client API for UpstreamService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// UpstreamService is implemented by backends receiving the events of the connections over one long-lived
+// stream per wsgw instance and gateway endpoint, instead of per-event HTTP callbacks.
+type UpstreamServiceClient interface {
+	// Events carries the events of the connections to the backend and the commands of the backend back
+	// to wsgw. wsgw reopens the stream whenever it ends.
+	Events(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[GatewayEvent, BackendCommand], error)
+}
+
+type upstreamServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewUpstreamServiceClient(cc grpc.ClientConnInterface) UpstreamServiceClient {
+	return &upstreamServiceClient{cc}
+}
+
+func (c *upstreamServiceClient) Events(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[GatewayEvent, BackendCommand], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &UpstreamService_ServiceDesc.Streams[0], UpstreamService_Events_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GatewayEvent, BackendCommand]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UpstreamService_EventsClient = grpc.BidiStreamingClient[GatewayEvent, BackendCommand]
+
+// UpstreamServiceServer is the server API for UpstreamService service.
+// All implementations must embed UnimplementedUpstreamServiceServer
+// for forward compatibility.
+//
+// UpstreamService is implemented by backends receiving the events of the connections over one long-lived
+// stream per wsgw instance and gateway endpoint, instead of per-event HTTP callbacks.
+type UpstreamServiceServer interface {
+	// Events carries the events of the connections to the backend and the commands of the backend back
+	// to wsgw. wsgw reopens the stream whenever it ends.
+	Events(grpc.BidiStreamingServer[GatewayEvent, BackendCommand]) error
+	mustEmbedUnimplementedUpstreamServiceServer()
+}
+
+// UnimplementedUpstreamServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedUpstreamServiceServer struct{}
+
+func (UnimplementedUpstreamServiceServer) Events(grpc.BidiStreamingServer[GatewayEvent, BackendCommand]) error {
+	return status.Errorf(codes.Unimplemented, "method Events not implemented")
+}
+func (UnimplementedUpstreamServiceServer) mustEmbedUnimplementedUpstreamServiceServer() {}
+func (UnimplementedUpstreamServiceServer) testEmbeddedByValue()                         {}
+
+// UnsafeUpstreamServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to UpstreamServiceServer will
+// result in compilation errors.
+type UnsafeUpstreamServiceServer interface {
+	mustEmbedUnimplementedUpstreamServiceServer()
+}
+
+func RegisterUpstreamServiceServer(s grpc.ServiceRegistrar, srv UpstreamServiceServer) {
+	// If the following call pancis, it indicates UnimplementedUpstreamServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&UpstreamService_ServiceDesc, srv)
+}
+
+func _UpstreamService_Events_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(UpstreamServiceServer).Events(&grpc.GenericServerStream[GatewayEvent, BackendCommand]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type UpstreamService_EventsServer = grpc.BidiStreamingServer[GatewayEvent, BackendCommand]
+
+// UpstreamService_ServiceDesc is the grpc.ServiceDesc for UpstreamService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var UpstreamService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "wsgw.upstream.v1.UpstreamService",
+	HandlerType: (*UpstreamServiceServer)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Events",
+			Handler:       _UpstreamService_Events_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "upstream.proto",
+}
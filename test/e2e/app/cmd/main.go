@@ -45,6 +45,7 @@ func main() {
 		OtlpEndpoint:         conf.OtlpEndpoint,
 		OtlpServiceNamespace: conf.OtlpServiceNamespace,
 		OtlpServiceName:      conf.OtlpServiceName,
+		TraceBatcher:         monitoring.LoadTestTraceBatcher,
 	}, config.OtelScope)
 	defer shutdownOtel(context.Background())
 
@@ -40,6 +40,7 @@ func main() {
 			OtlpServiceNamespace: conf.OtlpServiceNamespace,
 			OtlpServiceName:      conf.OtlpServiceName,
 			OtlpTraceSampleAll:   conf.OtlpTraceSampleAll,
+			TraceBatcher:         monitoring.LoadTestTraceBatcher,
 		},
 		config.OtelScope,
 	)
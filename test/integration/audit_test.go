@@ -0,0 +1,149 @@
+package integration
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+	"wsgw/test/mockapp"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type auditTestSuite struct {
+	*baseTestSuite
+	auditFile string
+}
+
+func TestAuditTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestAuditTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	s := &auditTestSuite{baseTestSuite: NewBaseTestSuite(ctx), auditFile: filepath.Join(t.TempDir(), "audit.ndjson")}
+	s.configure = func(conf *config.Config) {
+		conf.AuditLog.Sink = s.auditFile
+	}
+	suite.Run(t, s)
+}
+
+// auditRecord is the part of the audit events the tests check
+type auditRecord struct {
+	Event         string            `json:"event"`
+	ConnectionID  string            `json:"connectionId"`
+	Transport     string            `json:"transport"`
+	RemoteAddress string            `json:"remoteAddress"`
+	Outcome       string            `json:"outcome"`
+	Reason        string            `json:"reason"`
+	Status        int               `json:"status"`
+	CloseCode     int               `json:"closeCode"`
+	Initiator     string            `json:"initiator"`
+	Traffic       map[string]int64  `json:"traffic"`
+	Action        string            `json:"action"`
+	Details       map[string]string `json:"details"`
+}
+
+func (s *auditTestSuite) TestConnectionLifecycle() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	msgFromAppChan := make(chan string)
+	client := NewClient(s.wsgwerver, msgFromAppChan)
+	_, connectErr := client.connect(ctx)
+	s.Require().NoError(connectErr)
+	connId := client.connectionId
+
+	message := toWsMessage("audited")
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, message)
+	s.Require().NoError(client.writeMessage(ctx, message))
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+	s.Require().NoError(client.disconnect(ctx))
+	<-s.mockApp.OnDisconnect(connId)
+
+	var connect, disconnect *auditRecord
+	s.Require().Eventually(func() bool {
+		connect = s.findEvent(func(e auditRecord) bool { return e.Event == "connect" && e.ConnectionID == string(connId) })
+		disconnect = s.findEvent(func(e auditRecord) bool { return e.Event == "disconnect" && e.ConnectionID == string(connId) })
+		return connect != nil && disconnect != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	s.Equal("accepted", connect.Outcome)
+	s.Equal("websocket", connect.Transport)
+	s.NotEmpty(connect.RemoteAddress)
+	s.Equal("client", disconnect.Initiator)
+	s.Equal(1000, disconnect.CloseCode)
+	s.Equal(int64(1), disconnect.Traffic["messagesFromClient"])
+	s.Positive(disconnect.Traffic["bytesFromClient"])
+}
+
+func (s *auditTestSuite) TestRejectedConnect() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s/unknown-profile", s.wsgwerver, wsgw.ConnectPath), nil)
+	s.Require().NoError(requestErr)
+	response, responseErr := http.DefaultClient.Do(request)
+	s.Require().NoError(responseErr)
+	response.Body.Close()
+	s.Equal(http.StatusNotFound, response.StatusCode)
+
+	rejected := s.findEvent(func(e auditRecord) bool { return e.Event == "connect" && e.Outcome == "rejected" })
+	s.Require().NotNil(rejected)
+	s.Equal("profile_not_found", rejected.Reason)
+	s.Equal(http.StatusNotFound, rejected.Status)
+	s.Empty(rejected.ConnectionID)
+}
+
+func (s *auditTestSuite) TestAdminActions() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	initialLevel := logging.CurrentLevel()
+	defer func() { s.NoError(logging.SetLevel(initialLevel)) }()
+
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodPut, fmt.Sprintf("http://%s%s", s.wsgwerver, wsgw.LogLevelPath), strings.NewReader(`{"level":"warn"}`))
+	s.Require().NoError(requestErr)
+	request.Header.Set("Content-Type", "application/json")
+	response, responseErr := http.DefaultClient.Do(request)
+	s.Require().NoError(responseErr)
+	response.Body.Close()
+	s.Equal(http.StatusOK, response.StatusCode)
+
+	changed := s.findEvent(func(e auditRecord) bool { return e.Event == "admin" && e.Action == "log_level_changed" })
+	s.Require().NotNil(changed)
+	s.Equal("warn", changed.Details["level"])
+	s.NotEmpty(changed.RemoteAddress)
+}
+
+// findEvent returns the last event of the audit log matching the predicate
+func (s *auditTestSuite) findEvent(matches func(e auditRecord) bool) *auditRecord {
+	file, openErr := os.Open(s.auditFile)
+	if os.IsNotExist(openErr) {
+		return nil
+	}
+	s.Require().NoError(openErr)
+	defer file.Close()
+
+	var found *auditRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event auditRecord
+		s.Require().NoError(json.Unmarshal(scanner.Bytes(), &event), scanner.Text())
+		if matches(event) {
+			found = &event
+		}
+	}
+	return found
+}
@@ -0,0 +1,130 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+
+	"github.com/coder/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type backendEndpointsTestSuite struct {
+	suite.Suite
+	ctx context.Context
+}
+
+func TestBackendEndpointsTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestBackendEndpointsTestSuite").Logger()
+	suite.Run(t, &backendEndpointsTestSuite{ctx: logger.WithContext(context.Background())})
+}
+
+// callRecorder is a backend accepting all the callbacks, recording their methods and paths.
+// It answers the messages containing "slow" after a second.
+type callRecorder struct {
+	mux   sync.Mutex
+	calls []string
+}
+
+func (r *callRecorder) ServeHTTP(_ http.ResponseWriter, request *http.Request) {
+	body, _ := io.ReadAll(request.Body)
+	r.mux.Lock()
+	r.calls = append(r.calls, request.Method+" "+request.URL.EscapedPath())
+	r.mux.Unlock()
+	if strings.Contains(string(body), "slow") {
+		time.Sleep(time.Second)
+	}
+}
+
+func (r *callRecorder) recorded() []string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]string(nil), r.calls...)
+}
+
+func (s *backendEndpointsTestSuite) TestConfiguredCallbacks() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	recorder := &callRecorder{}
+	backend := httptest.NewServer(recorder)
+	defer backend.Close()
+
+	address := s.start(ctx, config.Config{
+		AppBaseUrl:           backend.URL,
+		AckNewConnWithConnId: true,
+		BackendEndpoints: config.BackendEndpointsConfig{
+			Connect: config.BackendEndpointConfig{Method: "post"},
+			Message: config.BackendEndpointConfig{
+				URL:     "{baseUrl}/hooks/{connectionId}/messages",
+				Method:  http.MethodPut,
+				Timeout: 100 * time.Millisecond,
+			},
+			Disconnected: config.BackendEndpointConfig{Disabled: true},
+		},
+	})
+
+	msgFromAppChan := make(chan string, 1)
+	client := NewClient(address, msgFromAppChan)
+	_, connectErr := client.connect(ctx)
+	s.Require().NoError(connectErr)
+	connId := client.connectionId
+
+	s.Require().NoError(client.writeMessage(ctx, toWsMessage("fast")))
+	// The message callback times out before the backend answers
+	s.Require().NoError(client.writeMessage(ctx, toWsMessage("slow")))
+	select {
+	case frame := <-msgFromAppChan:
+		s.Contains(frame, "context deadline exceeded")
+	case <-time.After(900 * time.Millisecond):
+		s.Fail("the message callback didn't time out")
+	}
+
+	s.Require().NoError(client.wsConn.Close(websocket.StatusNormalClosure, "we're done"))
+	// No disconnected callback is made
+	time.Sleep(200 * time.Millisecond)
+	messagePath := fmt.Sprintf("PUT /hooks/%s/messages", connId)
+	s.Equal([]string{"POST /ws/connect", messagePath, messagePath}, recorder.recorded())
+}
+
+func (s *backendEndpointsTestSuite) TestInvalidCallbackURL() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	configuration := config.Config{
+		ServerHost: "localhost",
+		AppBaseUrl: "http://localhost:1",
+		BackendEndpoints: config.BackendEndpointsConfig{
+			Message: config.BackendEndpointConfig{URL: "ftp://backend/{connectionId}"},
+		},
+	}
+	server := wsgw.NewServer(configuration, wsgw.CreateID)
+	setupErr := server.SetupAndStart(ctx, configuration, func(context.Context, int, func(context.Context) error) {
+		s.Fail("the server started with an invalid callback URL")
+	})
+	s.ErrorContains(setupErr, "invalid URL for the message callback")
+}
+
+// start starts wsgw with the configuration, returning its address. The server is stopped at the end of the test.
+func (s *backendEndpointsTestSuite) start(ctx context.Context, configuration config.Config) string {
+	configuration.ServerHost = "localhost"
+	server := wsgw.NewServer(configuration, wsgw.CreateID)
+	addresses := make(chan string, 1)
+	go func() {
+		_ = server.SetupAndStart(s.ctx, configuration, func(_ context.Context, port int, _ func(context.Context) error) {
+			addresses <- fmt.Sprintf("localhost:%d", port)
+		})
+	}()
+	s.T().Cleanup(func() { server.Stop(context.WithoutCancel(ctx)) })
+	return <-addresses
+}
@@ -0,0 +1,211 @@
+package integration
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/pem"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+type backendTransportTestSuite struct {
+	suite.Suite
+	ctx context.Context
+}
+
+func TestBackendTransportTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestBackendTransportTestSuite").Logger()
+	suite.Run(t, &backendTransportTestSuite{ctx: logger.WithContext(context.Background())})
+}
+
+// protocolRecorder is a backend rejecting the connects, recording the protocol they came with
+type protocolRecorder struct {
+	mux       sync.Mutex
+	protocols []string
+}
+
+func (r *protocolRecorder) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	r.mux.Lock()
+	r.protocols = append(r.protocols, request.Proto)
+	r.mux.Unlock()
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func (r *protocolRecorder) last() string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if len(r.protocols) == 0 {
+		return ""
+	}
+	return r.protocols[len(r.protocols)-1]
+}
+
+func (s *backendTransportTestSuite) TestH2cForPlainBackend() {
+	recorder := &protocolRecorder{}
+	backend := httptest.NewServer(h2c.NewHandler(recorder, &http2.Server{}))
+	defer backend.Close()
+
+	s.connectThrough(config.Config{AppBaseUrl: backend.URL, Http2: true})
+	s.Eventually(func() bool { return recorder.last() == "HTTP/2.0" }, 5*time.Second, 10*time.Millisecond)
+}
+
+func (s *backendTransportTestSuite) TestH2cForPlainBackendWithCustomCA() {
+	recorder := &protocolRecorder{}
+	backend := httptest.NewServer(h2c.NewHandler(recorder, &http2.Server{}))
+	defer backend.Close()
+	// A CA for the https:// callbacks doesn't turn the http:// ones to HTTP/1.1
+	tlsBackend := httptest.NewTLSServer(recorder)
+	defer tlsBackend.Close()
+
+	s.connectThrough(config.Config{
+		AppBaseUrl:       backend.URL,
+		Http2:            true,
+		BackendTransport: config.BackendTransportConfig{CAFile: s.writeCA(tlsBackend)},
+	})
+	s.Eventually(func() bool { return recorder.last() == "HTTP/2.0" }, 5*time.Second, 10*time.Millisecond)
+}
+
+func (s *backendTransportTestSuite) TestH2ForTLSBackend() {
+	recorder := &protocolRecorder{}
+	backend := httptest.NewUnstartedServer(recorder)
+	backend.EnableHTTP2 = true
+	backend.StartTLS()
+	defer backend.Close()
+
+	s.connectThrough(config.Config{
+		AppBaseUrl:       backend.URL,
+		Http2:            true,
+		BackendTransport: config.BackendTransportConfig{CAFile: s.writeCA(backend)},
+	})
+	s.Eventually(func() bool { return recorder.last() == "HTTP/2.0" }, 5*time.Second, 10*time.Millisecond)
+}
+
+func (s *backendTransportTestSuite) TestTLSWithSystemRoots() {
+	// The backend isn't trusted by the system roots, so only the handshake is checked: it must be a TLS
+	// one offering h2, not a cleartext HTTP/2 preface sent to the TLS port
+	offered := make(chan []string, 1)
+	backend := httptest.NewUnstartedServer(&protocolRecorder{})
+	backend.TLS = &tls.Config{
+		GetConfigForClient: func(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+			select {
+			case offered <- hello.SupportedProtos:
+			default:
+			}
+			return nil, nil
+		},
+	}
+	backend.StartTLS()
+	defer backend.Close()
+
+	s.connectThrough(config.Config{AppBaseUrl: backend.URL, Http2: true})
+	select {
+	case protocols := <-offered:
+		s.Contains(protocols, "h2")
+	case <-time.After(5 * time.Second):
+		s.Fail("no TLS handshake with the backend")
+	}
+}
+
+func (s *backendTransportTestSuite) TestClientCertificate() {
+	recorder := &clientCertRecorder{}
+	backend := httptest.NewUnstartedServer(recorder)
+	backend.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+	backend.StartTLS()
+	defer backend.Close()
+
+	certFile := filepath.Join(s.T().TempDir(), "client.crt")
+	keyFile := filepath.Join(s.T().TempDir(), "client.key")
+	s.Require().NoError(writeSelfSignedCert(certFile, keyFile, "first"))
+
+	address := s.start(config.Config{
+		AppBaseUrl: backend.URL,
+		BackendTransport: config.BackendTransportConfig{
+			CAFile:         s.writeCA(backend),
+			ClientCertFile: certFile,
+			ClientKeyFile:  keyFile,
+		},
+	})
+	s.connect(address)
+	s.Eventually(func() bool { return recorder.last() == "first" }, 5*time.Second, 10*time.Millisecond)
+
+	// The rotated certificate is presented on the next handshake
+	s.Require().NoError(writeSelfSignedCert(certFile, keyFile, "second"))
+	s.connect(address)
+	s.Eventually(func() bool { return recorder.last() == "second" }, 5*time.Second, 10*time.Millisecond)
+}
+
+// clientCertRecorder is a backend rejecting the connects, recording the common name of the client certificates they
+// came with. It closes the connections for each connect to come with a handshake of its own.
+type clientCertRecorder struct {
+	mux         sync.Mutex
+	commonNames []string
+}
+
+func (r *clientCertRecorder) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	r.mux.Lock()
+	r.commonNames = append(r.commonNames, request.TLS.PeerCertificates[0].Subject.CommonName)
+	r.mux.Unlock()
+	w.Header().Set("Connection", "close")
+	w.WriteHeader(http.StatusUnauthorized)
+}
+
+func (r *clientCertRecorder) last() string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	if len(r.commonNames) == 0 {
+		return ""
+	}
+	return r.commonNames[len(r.commonNames)-1]
+}
+
+// connectThrough starts wsgw with the configuration, then has a client connect, for wsgw to call the backend
+func (s *backendTransportTestSuite) connectThrough(configuration config.Config) {
+	s.connect(s.start(configuration))
+}
+
+// start starts wsgw with the configuration, returning its address. The server is stopped at the end of the test.
+func (s *backendTransportTestSuite) start(configuration config.Config) string {
+	configuration.ServerHost = "localhost"
+	server := wsgw.NewServer(configuration, wsgw.CreateID)
+	addresses := make(chan string, 1)
+	go func() {
+		_ = server.SetupAndStart(s.ctx, configuration, func(_ context.Context, port int, _ func(context.Context) error) {
+			addresses <- fmt.Sprintf("localhost:%d", port)
+		})
+	}()
+	s.T().Cleanup(func() { server.Stop(s.ctx) })
+	return <-addresses
+}
+
+// connect has a client connect to wsgw at the address, for wsgw to call the backend
+func (s *backendTransportTestSuite) connect(address string) {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	conn, _, _ := connectTowsgw(ctx, address)
+	if conn != nil {
+		conn.CloseNow()
+	}
+}
+
+// writeCA writes the certificate of the TLS test server to a CA file
+func (s *backendTransportTestSuite) writeCA(backend *httptest.Server) string {
+	caFile := filepath.Join(s.T().TempDir(), "ca.crt")
+	certPem := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: backend.Certificate().Raw})
+	s.Require().NoError(os.WriteFile(caFile, certPem, 0o600))
+	return caFile
+}
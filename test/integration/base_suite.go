@@ -8,6 +8,7 @@ import (
 	"sync"
 	"wsgw/internal/config"
 	"wsgw/pkgs/logging"
+	"wsgw/pkgs/signing"
 	"wsgw/test/mockapp"
 
 	"github.com/stretchr/testify/mock"
@@ -27,6 +28,10 @@ type baseTestSuite struct {
 	// Fall-back connection-id in case no generator is specified to be used in strictly sequential test cases
 	// testing in isolation the connection setup itself
 	nextConnId wsgw.ConnectionID
+	// signingKeys, if set, are used by wsgw to sign and by the mock app to verify the backend requests
+	signingKeys []string
+	// configure, if set, can adjust the wsgw configuration before the server is started
+	configure func(conf *config.Config)
 }
 
 func NewBaseTestSuite(ctx context.Context) *baseTestSuite {
@@ -39,6 +44,17 @@ func (s *baseTestSuite) startMockApp() {
 	s.mockApp = mockapp.NewMockApp(func() string {
 		return fmt.Sprintf("http://%s", s.wsgwerver)
 	})
+	if len(s.signingKeys) > 0 {
+		keys, parseErr := signing.ParseKeys(s.signingKeys)
+		if parseErr != nil {
+			panic(parseErr)
+		}
+		verifier, verifierErr := signing.NewVerifier(keys, signing.DefaultMaxClockSkew)
+		if verifierErr != nil {
+			panic(verifierErr)
+		}
+		s.mockApp.RequireSignatures(verifier)
+	}
 	mockAppStartErr := s.mockApp.Start(s.ctx)
 	if mockAppStartErr != nil {
 		panic(mockAppStartErr)
@@ -61,8 +77,12 @@ func (s *baseTestSuite) SetupSuite() {
 		ServerPort:           0,
 		AppBaseUrl:           fmt.Sprintf("http://%s", s.mockApp.GetAppAddress()),
 		AckNewConnWithConnId: true,
+		BackendSigningKeys:   s.signingKeys,
 		LoadBalancerAddress:  "",
 	}
+	if s.configure != nil {
+		s.configure(&configuration)
+	}
 
 	server := wsgw.NewServer(
 		configuration,
@@ -0,0 +1,239 @@
+package integration
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+	"wsgw/test/mockapp"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type batchingTestSuite struct {
+	*baseTestSuite
+	format  string
+	batches *batchRecorder
+}
+
+func TestBatchingTestSuite(t *testing.T) {
+	runBatchingTestSuite(t, "TestBatchingTestSuite", "json")
+}
+
+func TestNDJSONBatchingTestSuite(t *testing.T) {
+	runBatchingTestSuite(t, "TestNDJSONBatchingTestSuite", "ndjson")
+}
+
+func runBatchingTestSuite(t *testing.T, unit string, format string) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", unit).Logger()
+	ctx := logger.WithContext(context.Background())
+	s := &batchingTestSuite{
+		baseTestSuite: NewBaseTestSuite(ctx),
+		format:        format,
+		batches:       &batchRecorder{},
+	}
+	messages := httptest.NewServer(s.batches)
+	defer messages.Close()
+
+	s.configure = func(conf *config.Config) {
+		conf.BackendEndpoints.Message.URL = messages.URL
+		conf.MessageBatch = config.MessageBatchConfig{
+			MaxSize:  2,
+			MaxDelay: 50 * time.Millisecond,
+			Format:   format,
+		}
+	}
+	suite.Run(t, s)
+}
+
+// batchedMessage is a client message in a batch received by the backend
+type batchedMessage struct {
+	ConnectionID wsgw.ConnectionID `json:"connectionId"`
+	Timestamp    time.Time         `json:"timestamp"`
+	Message      string            `json:"message"`
+}
+
+type recordedBatch struct {
+	// size is the value of the batch header
+	size        string
+	contentType string
+	messages    []batchedMessage
+}
+
+// batchRecorder is a message callback receiving batches in either format and recording them. It rejects the
+// messages containing "invalid" with a 422 and accepts the others.
+type batchRecorder struct {
+	mux     sync.Mutex
+	batches []recordedBatch
+}
+
+func (r *batchRecorder) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	batch := recordedBatch{size: request.Header.Get(wsgw.BatchHeaderKey), contentType: request.Header.Get("Content-Type")}
+	ndjson := batch.contentType == "application/x-ndjson"
+	if ndjson {
+		scanner := bufio.NewScanner(request.Body)
+		for scanner.Scan() {
+			var message batchedMessage
+			if err := json.Unmarshal(scanner.Bytes(), &message); err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			batch.messages = append(batch.messages, message)
+		}
+	} else if err := json.NewDecoder(request.Body).Decode(&batch.messages); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	r.mux.Lock()
+	r.batches = append(r.batches, batch)
+	r.mux.Unlock()
+
+	encoder := json.NewEncoder(w)
+	results := make([]map[string]any, len(batch.messages))
+	for i, message := range batch.messages {
+		results[i] = map[string]any{"status": http.StatusOK}
+		if strings.Contains(message.Message, "invalid") {
+			results[i] = map[string]any{"status": http.StatusUnprocessableEntity, "error": "invalid reading"}
+		}
+		if ndjson {
+			_ = encoder.Encode(results[i])
+		}
+	}
+	if !ndjson {
+		_ = encoder.Encode(results)
+	}
+}
+
+func (r *batchRecorder) recorded() []recordedBatch {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]recordedBatch(nil), r.batches...)
+}
+
+func (r *batchRecorder) reset() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	r.batches = nil
+}
+
+func (s *batchingTestSuite) SetupTest() {
+	s.batches.reset()
+}
+
+// connect connects a client, which is disconnected at the end of the test
+func (s *batchingTestSuite) connect(ctx context.Context, msgFromAppChan chan string) *Client {
+	client := NewClient(s.wsgwerver, msgFromAppChan)
+	_, connectErr := client.connect(ctx)
+	s.Require().NoError(connectErr)
+	s.mockApp.On(mockapp.MockMethodDisconnected, client.connectionId)
+	s.T().Cleanup(func() {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(client.connectionId)
+	})
+	return client
+}
+
+// singleBatch waits for the one batch expected, checking its headers
+func (s *batchingTestSuite) singleBatch(size int) []batchedMessage {
+	s.Require().Eventually(func() bool { return len(s.batches.recorded()) > 0 }, 5*time.Second, 10*time.Millisecond)
+	batches := s.batches.recorded()
+	s.Require().Len(batches, 1)
+	s.Require().Len(batches[0].messages, size)
+	s.Equal(map[string]string{"json": "application/json", "ndjson": "application/x-ndjson"}[s.format], batches[0].contentType)
+	s.Equal(strconv.Itoa(size), batches[0].size)
+	for _, message := range batches[0].messages {
+		s.WithinDuration(time.Now(), message.Timestamp, 10*time.Second)
+	}
+	return batches[0].messages
+}
+
+func (s *batchingTestSuite) TestMessagesOfSeveralConnectionsAreBatched() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+	first := s.connect(ctx, nil)
+	second := s.connect(ctx, nil)
+
+	s.Require().NoError(first.writeMessage(ctx, toWsMessage("first")))
+	s.Require().NoError(second.writeMessage(ctx, toWsMessage("second")))
+
+	messages := s.singleBatch(2)
+	s.ElementsMatch([]wsgw.ConnectionID{first.connectionId, second.connectionId}, []wsgw.ConnectionID{messages[0].ConnectionID, messages[1].ConnectionID})
+}
+
+func (s *batchingTestSuite) TestMessagesOfAConnectionAreBatched() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+	client := s.connect(ctx, nil)
+
+	// The connection doesn't wait for the outcome of a message to relay the next one
+	s.Require().NoError(client.writeMessage(ctx, toWsMessage("first")))
+	s.Require().NoError(client.writeMessage(ctx, toWsMessage("second")))
+
+	messages := s.singleBatch(2)
+	for i, content := range []string{"first", "second"} {
+		s.Equal(client.connectionId, messages[i].ConnectionID)
+		s.JSONEq(`{"message":"`+content+`"}`, messages[i].Message)
+	}
+}
+
+func (s *batchingTestSuite) TestSingleMessageIsSentAfterMaxDelay() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+	client := s.connect(ctx, nil)
+
+	s.Require().NoError(client.writeMessage(ctx, toWsMessage("alone")))
+	messages := s.singleBatch(1)
+	s.Equal(client.connectionId, messages[0].ConnectionID)
+}
+
+func (s *batchingTestSuite) TestItemResultsAreMappedToTheirClients() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+	rejectedFrames := make(chan string, 1)
+	rejected := s.connect(ctx, rejectedFrames)
+	acceptedFrames := make(chan string, 1)
+	accepted := s.connect(ctx, acceptedFrames)
+
+	s.Require().NoError(rejected.writeMessage(ctx, toWsMessage("invalid")))
+	s.Require().NoError(accepted.writeMessage(ctx, toWsMessage("valid")))
+	s.singleBatch(2)
+
+	select {
+	case frame := <-rejectedFrames:
+		s.Equal("invalid reading", frame)
+	case <-time.After(5 * time.Second):
+		s.Fail("the rejected message wasn't reported to its client")
+	}
+	select {
+	case frame := <-acceptedFrames:
+		s.Fail("unexpected frame", frame)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
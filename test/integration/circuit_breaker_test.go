@@ -0,0 +1,98 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+	"wsgw/test/mockapp"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type circuitBreakerTestSuite struct {
+	*baseTestSuite
+	// messagesFailing makes the backend fail the client messages
+	messagesFailing atomic.Bool
+}
+
+func TestCircuitBreakerTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestCircuitBreakerTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	s := &circuitBreakerTestSuite{baseTestSuite: NewBaseTestSuite(ctx)}
+	messages := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		if s.messagesFailing.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer messages.Close()
+
+	s.configure = func(conf *config.Config) {
+		conf.BackendEndpoints.Message.URL = messages.URL
+		conf.BackendBreaker = config.CircuitBreakerConfig{
+			Enabled:              true,
+			MinRequests:          3,
+			FailureRateThreshold: 0.5,
+			OpenDuration:         300 * time.Millisecond,
+			HalfOpenProbes:       1,
+			RejectConnects:       true,
+			NotifyClients:        true,
+		}
+	}
+	suite.Run(t, s)
+}
+
+func (s *circuitBreakerTestSuite) TestLoadSheddingWhileOpen() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+	msgFromAppChan := make(chan string, 3)
+	client := NewClient(s.wsgwerver, msgFromAppChan)
+	_, connectErr := client.connect(ctx)
+	s.Require().NoError(connectErr)
+	connId := client.connectionId
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+	defer func() {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	// The connect succeeded, two messages failing out of three calls open the circuit
+	s.messagesFailing.Store(true)
+	s.Require().NoError(client.writeMessage(ctx, toWsMessage("first")))
+	s.Equal("probelm while sending message to application", <-msgFromAppChan)
+	s.Require().NoError(client.writeMessage(ctx, toWsMessage("second")))
+	s.Equal("probelm while sending message to application", <-msgFromAppChan)
+
+	s.Require().NoError(client.writeMessage(ctx, toWsMessage("shed")))
+	var shed map[string]any
+	s.Require().NoError(json.Unmarshal([]byte(<-msgFromAppChan), &shed))
+	s.Equal("backend_unavailable", shed["error"])
+	s.EqualValues(1, shed["retryAfterSeconds"])
+
+	_, response, rejectedErr := connectTowsgw(ctx, s.wsgwerver)
+	s.Require().Error(rejectedErr)
+	s.Equal(http.StatusServiceUnavailable, response.StatusCode)
+	s.Equal("1", response.Header.Get("Retry-After"))
+
+	// Once the circuit is half-open, a successful probe closes it
+	s.messagesFailing.Store(false)
+	time.Sleep(300 * time.Millisecond)
+	s.Require().NoError(client.writeMessage(ctx, toWsMessage("probe")))
+	s.Require().NoError(client.writeMessage(ctx, toWsMessage("after the recovery")))
+	select {
+	case frame := <-msgFromAppChan:
+		s.Fail("unexpected frame", frame)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
@@ -0,0 +1,240 @@
+package integration
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+	"wsgw/test/mockapp"
+
+	"github.com/coder/websocket"
+	"github.com/quic-go/quic-go/quicvarint"
+	"github.com/quic-go/webtransport-go"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"golang.org/x/net/http2"
+)
+
+type http2WebSocketTestSuite struct {
+	*baseTestSuite
+}
+
+// TestMain restarts the tests with extended CONNECT, which net/http only offers with a GODEBUG setting it reads
+// before the tests run
+func TestMain(m *testing.M) {
+	if xconnectErr := wsgw.EnableExtendedConnect(); xconnectErr != nil {
+		fmt.Fprintln(os.Stderr, xconnectErr)
+		os.Exit(1)
+	}
+	os.Exit(m.Run())
+}
+
+func TestHttp2WebSocketTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestHttp2WebSocketTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.ClientHttp2 = true
+	}
+	suite.Run(t, &http2WebSocketTestSuite{baseTestSuite: base})
+}
+
+func (s *http2WebSocketTestSuite) TestMessagesOverExtendedConnect() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	msgFromApp := make(chan string, 1)
+	client := NewClient(s.wsgwerver, msgFromApp)
+	_, connectErr := client.connect(ctx, &websocket.DialOptions{
+		HTTPClient: &http.Client{Transport: &extendedConnectTransport{h2c: &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, network, addr)
+			},
+		}}},
+		HTTPHeader: defaultConnectOptions.HTTPHeader,
+	})
+	s.Require().NoError(connectErr)
+	connId := client.connectionId
+
+	message := "message_" + xid.New().String()
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, toWsMessage(message))
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+	s.NoError(client.writeMessage(ctx, toWsMessage(message)))
+
+	s.Require().Eventually(func() bool {
+		return s.mockApp.SendToClient(ctx, connId, mockapp.MessageJSON{"message": "from the backend"}) == nil
+	}, time.Second, 10*time.Millisecond)
+	s.Equal("from the backend", <-msgFromApp)
+
+	s.NoError(client.disconnect(ctx))
+	<-s.mockApp.OnDisconnect(connId)
+	calls := s.mockApp.GetCalls(connId)
+	s.Require().Len(calls, 2)
+	s.Equal(mockapp.MockMethodMessageReceived, calls[0].Method)
+	s.assertArguments(&calls[0], toWsMessage(message))
+}
+
+// extendedConnectTransport turns the HTTP/1.1 upgrades of websocket.Dial into extended CONNECT requests,
+// and their responses into the upgrade responses websocket.Dial expects
+type extendedConnectTransport struct {
+	h2c *http2.Transport
+}
+
+func (t *extendedConnectTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	key := request.Header.Get("Sec-WebSocket-Key")
+	toServer, clientWriter := io.Pipe()
+	connect := request.Clone(request.Context())
+	connect.Method = http.MethodConnect
+	connect.URL.Scheme = "http"
+	connect.Body = toServer
+	for _, name := range []string{"Connection", "Upgrade", "Sec-WebSocket-Key"} {
+		connect.Header.Del(name)
+	}
+	connect.Header.Set(":protocol", "websocket")
+
+	response, responseErr := t.h2c.RoundTrip(connect)
+	if responseErr != nil || response.StatusCode != http.StatusOK {
+		return response, responseErr
+	}
+	accept := sha1.Sum([]byte(key + "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"))
+	response.StatusCode = http.StatusSwitchingProtocols
+	response.Header.Set("Connection", "Upgrade")
+	response.Header.Set("Upgrade", "websocket")
+	response.Header.Set("Sec-WebSocket-Accept", base64.StdEncoding.EncodeToString(accept[:]))
+	response.Body = &streamBody{ReadCloser: response.Body, writer: clientWriter}
+	return response, nil
+}
+
+type streamBody struct {
+	io.ReadCloser
+	writer *io.PipeWriter
+}
+
+func (b *streamBody) Write(p []byte) (int, error) {
+	return b.writer.Write(p)
+}
+
+func (b *streamBody) Close() error {
+	b.writer.Close()
+	return b.ReadCloser.Close()
+}
+
+type webTransportTestSuite struct {
+	*baseTestSuite
+	webTransportPort int
+}
+
+func TestWebTransportTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestWebTransportTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	certDir := t.TempDir()
+	certFile, keyFile := filepath.Join(certDir, "tls.crt"), filepath.Join(certDir, "tls.key")
+	if err := writeSelfSignedCert(certFile, keyFile, "webtransport"); err != nil {
+		t.Fatal(err)
+	}
+	// A free UDP port, for want of a way to learn the port of the listener
+	udpConn, listenErr := net.ListenPacket("udp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatal(listenErr)
+	}
+	port := udpConn.LocalAddr().(*net.UDPAddr).Port
+	udpConn.Close()
+
+	s := &webTransportTestSuite{baseTestSuite: NewBaseTestSuite(ctx), webTransportPort: port}
+	s.configure = func(conf *config.Config) {
+		conf.ServerHost = "127.0.0.1"
+		conf.TLSCertFile = certFile
+		conf.TLSKeyFile = keyFile
+		conf.WebTransportPort = port
+	}
+	suite.Run(t, s)
+}
+
+func (s *webTransportTestSuite) TestMessagesOverWebTransport() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	dialer := webtransport.Dialer{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	defer dialer.Close()
+	response, session, dialErr := dialer.Dial(ctx, fmt.Sprintf("https://127.0.0.1:%d%s", s.webTransportPort, wsgw.WebTransportPath), defaultConnectOptions.HTTPHeader.Clone())
+	s.Require().NoError(dialErr)
+	s.Equal(http.StatusOK, response.StatusCode)
+	stream, acceptErr := session.AcceptStream(ctx)
+	s.Require().NoError(acceptErr)
+	reader := bufio.NewReader(stream)
+
+	var ack map[string]string
+	s.Require().NoError(json.Unmarshal([]byte(readWebTransportMessage(s, reader)), &ack))
+	connId := wsgw.ConnectionID(ack[wsgw.ConnectionIDKey])
+	s.NotEmpty(connId)
+
+	message := "message_" + xid.New().String()
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, toWsMessage(message))
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+	body, _ := json.Marshal(toWsMessage(message))
+	_, writeErr := stream.Write(append(quicvarint.Append(nil, uint64(len(body))), body...))
+	s.Require().NoError(writeErr)
+
+	// The mock app pushes over plain HTTP, while the client listener has TLS on
+	client := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	pushResponse, pushErr := client.Post(fmt.Sprintf("https://%s%s/%s", s.wsgwerver, wsgw.MessagePath, connId), "text/plain", strings.NewReader("from the backend"))
+	s.Require().NoError(pushErr)
+	pushResponse.Body.Close()
+	s.Equal(http.StatusNoContent, pushResponse.StatusCode)
+	s.Equal("from the backend", readWebTransportMessage(s, reader))
+
+	s.NoError(session.CloseWithError(0, ""))
+	<-s.mockApp.OnDisconnect(connId)
+	calls := s.mockApp.GetCalls(connId)
+	s.Require().Len(calls, 2)
+	s.Equal(mockapp.MockMethodMessageReceived, calls[0].Method)
+	s.assertArguments(&calls[0], toWsMessage(message))
+}
+
+func (s *webTransportTestSuite) TestRejectedOverHttp1() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	client := http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}}
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodConnect, fmt.Sprintf("https://%s%s", s.wsgwerver, wsgw.WebTransportPath), nil)
+	s.Require().NoError(requestErr)
+	request.Header.Set("Authorization", "some credentials")
+	response, responseErr := client.Do(request)
+	s.Require().NoError(responseErr)
+	response.Body.Close()
+	s.Equal(http.StatusMethodNotAllowed, response.StatusCode)
+}
+
+func readWebTransportMessage(s *webTransportTestSuite, reader *bufio.Reader) string {
+	length, readErr := quicvarint.Read(reader)
+	s.Require().NoError(readErr)
+	message := make([]byte, length)
+	_, readErr = io.ReadFull(reader, message)
+	s.Require().NoError(readErr)
+	return string(message)
+}
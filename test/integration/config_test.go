@@ -0,0 +1,244 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+	"wsgw/test/mockapp"
+
+	"github.com/coder/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type configTestSuite struct {
+	*baseTestSuite
+	// started is the configuration the server was started with
+	started config.Config
+}
+
+func TestConfigTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestConfigTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	s := &configTestSuite{baseTestSuite: NewBaseTestSuite(ctx)}
+	s.configure = func(conf *config.Config) {
+		conf.Endpoints = []config.GatewayEndpointConfig{
+			{
+				Name:                 chatEndpointName,
+				AppBaseUrls:          []string{fmt.Sprintf("http://%s", s.mockApp.GetAppAddress())},
+				AckNewConnWithConnId: true,
+				AllowedOrigins:       []string{"allowed.example"},
+			},
+		}
+		s.started = *conf
+	}
+	suite.Run(t, s)
+}
+
+func (s *configTestSuite) TestFileEnvAndFlags() {
+	configFile := filepath.Join(s.T().TempDir(), "wsgw.yaml")
+	s.Require().NoError(os.WriteFile(configFile, []byte(`
+server_port: 8080
+app_base_url: http://from-the-file:8080
+backend_timeout: 3s
+endpoints: [chat]
+endpoint:
+  chat:
+    app_base_urls: [http://chat-1:8080, http://chat-2:8080]
+    max_connections: 5
+`), 0o600))
+	s.T().Setenv("WSGW_SERVER_PORT", "9090")
+
+	conf, configErr := config.GetConfig([]string{"wsgw", "--config", configFile, "--app-base-url", "http://from-the-flag:8080", "--set", "BACKEND_TIMEOUT=7s"})
+	s.Require().NoError(configErr)
+
+	s.Equal(9090, conf.ServerPort)
+	s.Equal("http://from-the-flag:8080", conf.AppBaseUrl)
+	s.Equal(7*time.Second, conf.BackendTransport.Timeout)
+	s.Require().Len(conf.Endpoints, 1)
+	s.Equal([]string{"http://chat-1:8080", "http://chat-2:8080"}, conf.Endpoints[0].AppBaseUrls)
+	s.Equal(5, conf.Endpoints[0].MaxConnections)
+}
+
+func (s *configTestSuite) TestTomlFile() {
+	configFile := filepath.Join(s.T().TempDir(), "wsgw.toml")
+	s.Require().NoError(os.WriteFile(configFile, []byte(`
+server_port = 8080
+app_base_urls = "http://app-1:8080 http://app-2:8080"
+
+[upstream]
+balancing = "least_in_flight"
+`), 0o600))
+	s.T().Setenv(config.ConfigFileEnvName, configFile)
+
+	conf, configErr := config.GetConfig([]string{"wsgw"})
+	s.Require().NoError(configErr)
+
+	s.Equal(8080, conf.ServerPort)
+	s.Equal([]string{"http://app-1:8080", "http://app-2:8080"}, conf.Upstreams.BaseUrls)
+	s.Equal("least_in_flight", conf.Upstreams.Balancing)
+}
+
+func (s *configTestSuite) TestValidationErrors() {
+	_, configErr := config.GetConfig([]string{"wsgw"})
+	s.Require().Error(configErr)
+	s.Contains(configErr.Error(), "WSGW_SERVER_PORT must be set")
+	s.Contains(configErr.Error(), "WSGW_APP_BASE_URL must be set")
+
+	_, configErr = config.GetConfig([]string{"wsgw", "--server-port", "8080", "--app-base-url", "backend:8080", "--set", "BACKEND_TIMEOUT=5"})
+	s.Require().Error(configErr)
+	s.Contains(configErr.Error(), `WSGW_APP_BASE_URL must be an http:// or https:// URL, got "backend:8080"`)
+	s.Contains(configErr.Error(), `WSGW_BACKEND_TIMEOUT must be a duration`)
+
+	_, configErr = config.GetConfig([]string{"wsgw", "--config", "wsgw.json"})
+	s.ErrorContains(configErr, "expected a .yaml, .yml or .toml file")
+}
+
+func (s *configTestSuite) TestUnknownSettings() {
+	configFile := filepath.Join(s.T().TempDir(), "wsgw.yaml")
+	s.Require().NoError(os.WriteFile(configFile, []byte(`
+servr:
+  port: 8080
+app_base_url: http://backend:8080
+endpoints: [chat]
+endpoint:
+  chat:
+    app_base_urls: [http://chat:8080]
+`), 0o600))
+	s.T().Setenv("WSGW_ENDPOINT_CHAT_MAX_CONECTIONS", "5")
+	s.T().Setenv("WSGW_MESAGE_BUFFER", "5")
+	s.T().Setenv("WSGW_ENDPOINT_CAHT_MAX_CONNECTIONS", "5")
+	s.T().Setenv("WSGW_FOO", "bar")
+
+	_, configErr := config.GetConfig([]string{"wsgw", "--config", configFile, "--set", "BACKEND_TIMOUT=5s"})
+	s.Require().Error(configErr)
+	s.Contains(configErr.Error(), "WSGW_SERVR_PORT isn't a setting, did you mean WSGW_SERVER_PORT?")
+	s.Contains(configErr.Error(), "WSGW_ENDPOINT_CHAT_MAX_CONECTIONS isn't a setting, did you mean WSGW_ENDPOINT_CHAT_MAX_CONNECTIONS?")
+	s.Contains(configErr.Error(), "WSGW_MESAGE_BUFFER isn't a setting, did you mean WSGW_ENDPOINT_CHAT_MESSAGE_BUFFER?")
+	s.Contains(configErr.Error(), "WSGW_ENDPOINT_CAHT_MAX_CONNECTIONS isn't a setting, did you mean WSGW_ENDPOINT_CHAT_MAX_CONNECTIONS?")
+	s.Contains(configErr.Error(), "WSGW_BACKEND_TIMOUT isn't a setting, did you mean WSGW_BACKEND_TIMEOUT?")
+	s.Contains(configErr.Error(), "WSGW_FOO isn't a setting")
+	s.NotContains(configErr.Error(), "WSGW_FOO isn't a setting, did you mean")
+}
+
+func (s *configTestSuite) TestConnectPathValidation() {
+	configFile := filepath.Join(s.T().TempDir(), "wsgw.yaml")
+	s.Require().NoError(os.WriteFile(configFile, []byte(`
+server_port: 8080
+app_base_url: http://backend:8080
+endpoints: [chat, feed, live, news, alerts]
+endpoint:
+  chat:
+    app_base_urls: [http://chat:8080]
+    connect_path: /connect
+  feed:
+    app_base_urls: [http://feed:8080]
+    connect_path: feed/connect
+  live:
+    app_base_urls: [http://live:8080]
+  news:
+    app_base_urls: [http://news:8080]
+    connect_path: /live/connect
+  alerts:
+    app_base_urls: [http://alerts:8080]
+    connect_path: /alerts/:topic
+`), 0o600))
+
+	_, configErr := config.GetConfig([]string{"wsgw", "--config", configFile})
+	s.Require().Error(configErr)
+	s.Contains(configErr.Error(), `the connect path /connect of the gateway endpoint "chat" is already that of the default endpoint`)
+	s.Contains(configErr.Error(), `WSGW_ENDPOINT_FEED_CONNECT_PATH must start with a /`)
+	s.Contains(configErr.Error(), `the connect path /live/connect of the gateway endpoint "news" is already that of the gateway endpoint "live"`)
+	s.Contains(configErr.Error(), `WSGW_ENDPOINT_ALERTS_CONNECT_PATH must start with a /, not end with one and contain no : or *`)
+}
+
+func (s *configTestSuite) TestReloadOriginsKeepsConnections() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+	defer func() { s.NoError(s.wsGateway.Reload(ctx, s.started)) }()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	conn, connId, disconnect := s.connectToChat(ctx, "http://allowed.example")
+	defer disconnect()
+	_, _, rejectedErr := s.dialChat(ctx, "http://reloaded.example")
+	s.Error(rejectedErr)
+
+	reloaded := s.started
+	reloaded.Endpoints = []config.GatewayEndpointConfig{s.started.Endpoints[0]}
+	reloaded.Endpoints[0].AllowedOrigins = []string{"reloaded.example"}
+	s.Require().NoError(s.wsGateway.Reload(ctx, reloaded))
+
+	_, _, disconnectReloaded := s.connectToChat(ctx, "http://reloaded.example")
+	disconnectReloaded()
+	_, _, rejectedErr = s.dialChat(ctx, "http://allowed.example")
+	s.Error(rejectedErr)
+
+	// The connection made before the reload is still open
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/%s%s/%s", s.wsgwerver, chatEndpointName, wsgw.MessagePath, connId), strings.NewReader("after the reload"))
+	s.Require().NoError(requestErr)
+	response, pushErr := http.DefaultClient.Do(request)
+	s.Require().NoError(pushErr)
+	response.Body.Close()
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	_, pushed, readErr := conn.Read(ctx)
+	s.Require().NoError(readErr)
+	s.Equal("after the reload", string(pushed))
+}
+
+func (s *configTestSuite) TestReloadBackendUrls() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+	defer func() { s.NoError(s.wsGateway.Reload(ctx, s.started)) }()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	reloaded := s.started
+	reloaded.Endpoints = []config.GatewayEndpointConfig{s.started.Endpoints[0]}
+	reloaded.Endpoints[0].AppBaseUrls = []string{"http://127.0.0.1:1"}
+	s.Require().NoError(s.wsGateway.Reload(ctx, reloaded))
+	_, response, unreachableErr := s.dialChat(ctx, "http://allowed.example")
+	s.Require().Error(unreachableErr)
+	s.Equal(http.StatusInternalServerError, response.StatusCode)
+
+	// Nothing is applied if a base URL is unusable
+	reloaded.Endpoints[0].AppBaseUrls = []string{"not a URL"}
+	s.Error(s.wsGateway.Reload(ctx, reloaded))
+
+	s.Require().NoError(s.wsGateway.Reload(ctx, s.started))
+	_, _, disconnect := s.connectToChat(ctx, "http://allowed.example")
+	disconnect()
+}
+
+func (s *configTestSuite) dialChat(ctx context.Context, origin string) (*websocket.Conn, *http.Response, error) {
+	header := defaultConnectOptions.HTTPHeader.Clone()
+	header.Set("Origin", origin)
+	return websocket.Dial(ctx, fmt.Sprintf("ws://%s/%s%s", s.wsgwerver, chatEndpointName, wsgw.ConnectPath), &websocket.DialOptions{HTTPHeader: header})
+}
+
+func (s *configTestSuite) connectToChat(ctx context.Context, origin string) (*websocket.Conn, wsgw.ConnectionID, func()) {
+	wsConn, _, dialErr := s.dialChat(ctx, origin)
+	s.Require().NoError(dialErr)
+
+	client := &Client{wsConn: wsConn}
+	connId, readErr := client.readConnId(ctx)
+	s.Require().NoError(readErr)
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+
+	return wsConn, connId, func() {
+		_ = wsConn.Close(websocket.StatusNormalClosure, "we're done")
+		<-s.mockApp.OnDisconnect(connId)
+	}
+}
@@ -0,0 +1,142 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+	"wsgw/test/mockapp"
+
+	"github.com/coder/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+const chatEndpointName = "chat"
+
+type gatewayEndpointsTestSuite struct {
+	*baseTestSuite
+}
+
+func TestGatewayEndpointsTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestGatewayEndpointsTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	s := &gatewayEndpointsTestSuite{
+		baseTestSuite: NewBaseTestSuite(ctx),
+	}
+	s.configure = func(conf *config.Config) {
+		conf.Endpoints = []config.GatewayEndpointConfig{
+			{
+				Name:                 chatEndpointName,
+				AppBaseUrls:          []string{fmt.Sprintf("http://%s", s.mockApp.GetAppAddress())},
+				AckNewConnWithConnId: true,
+				AllowedOrigins:       []string{""},
+				MessageBuffer:        4,
+			},
+		}
+	}
+	suite.Run(t, s)
+}
+
+func (s *gatewayEndpointsTestSuite) TestConnectionIdsAreNamespaced() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	_, connId, disconnect := s.connectToChat(ctx)
+	defer disconnect()
+
+	s.True(strings.HasPrefix(string(connId), chatEndpointName+"."), "connection ID %q not namespaced", connId)
+}
+
+func (s *gatewayEndpointsTestSuite) TestCrossEndpointPushesAreRejected() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	chatConn, chatConnId, disconnectChat := s.connectToChat(ctx)
+	defer disconnectChat()
+
+	defaultClient := NewClient(s.wsgwerver, make(chan string, 1))
+	_, connectErr := defaultClient.connect(ctx)
+	s.Require().NoError(connectErr)
+	defer func() {
+		_ = defaultClient.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(defaultClient.connectionId)
+	}()
+	s.mockApp.On(mockapp.MockMethodDisconnected, defaultClient.connectionId)
+
+	s.Equal(http.StatusForbidden, s.push(ctx, "/message", chatConnId))
+	s.Equal(http.StatusForbidden, s.push(ctx, "/chat/message", defaultClient.connectionId))
+	s.Equal(http.StatusNoContent, s.push(ctx, "/chat/message", chatConnId))
+	_, pushed, readErr := chatConn.Read(ctx)
+	s.NoError(readErr)
+	s.Equal("hello", string(pushed))
+
+	s.Equal(http.StatusNoContent, s.push(ctx, "/message", defaultClient.connectionId))
+	s.Equal("hello", <-defaultClient.msgFromAppChan)
+}
+
+func (s *gatewayEndpointsTestSuite) TestPushToFullBufferIsUnavailable() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	// The client reads nothing: once the socket buffers are full, the pushed messages fill the buffer of the connection
+	chatConn, chatConnId, _ := s.connectToChat(ctx)
+	defer func() {
+		_ = chatConn.CloseNow()
+		<-s.mockApp.OnDisconnect(chatConnId)
+	}()
+
+	message := strings.Repeat("x", 1<<20)
+	status := http.StatusNoContent
+	for range 100 {
+		if status = s.pushBody(ctx, "/chat/message", chatConnId, message); status != http.StatusNoContent {
+			break
+		}
+	}
+	s.Equal(http.StatusServiceUnavailable, status)
+}
+
+func (s *gatewayEndpointsTestSuite) connectToChat(ctx context.Context) (*websocket.Conn, wsgw.ConnectionID, func()) {
+	wsConn, _, dialErr := websocket.Dial(ctx, fmt.Sprintf("ws://%s/%s%s", s.wsgwerver, chatEndpointName, wsgw.ConnectPath), defaultConnectOptions)
+	s.Require().NoError(dialErr)
+
+	client := &Client{wsConn: wsConn}
+	connId, readErr := client.readConnId(ctx)
+	s.Require().NoError(readErr)
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+
+	return wsConn, connId, func() {
+		_ = wsConn.Close(websocket.StatusNormalClosure, "we're done")
+		<-s.mockApp.OnDisconnect(connId)
+	}
+}
+
+func (s *gatewayEndpointsTestSuite) push(ctx context.Context, pushPath string, connId wsgw.ConnectionID) int {
+	return s.pushBody(ctx, pushPath, connId, "hello")
+}
+
+func (s *gatewayEndpointsTestSuite) pushBody(ctx context.Context, pushPath string, connId wsgw.ConnectionID, message string) int {
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s%s/%s", s.wsgwerver, pushPath, connId), strings.NewReader(message))
+	s.Require().NoError(requestErr)
+	response, responseErr := http.DefaultClient.Do(request)
+	s.Require().NoError(responseErr)
+	defer response.Body.Close()
+	return response.StatusCode
+}
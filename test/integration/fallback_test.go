@@ -0,0 +1,181 @@
+package integration
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+	"wsgw/test/mockapp"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type fallbackTransportsTestSuite struct {
+	*baseTestSuite
+}
+
+func TestFallbackTransportsTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestFallbackTransportsTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.FallbackTransports = config.FallbackTransportsConfig{
+			Enabled:         true,
+			LongPollTimeout: 200 * time.Millisecond,
+		}
+	}
+	suite.Run(t, &fallbackTransportsTestSuite{baseTestSuite: base})
+}
+
+func (s *fallbackTransportsTestSuite) TestServerSentEvents() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	streamCtx, closeStream := context.WithCancel(ctx)
+	defer closeStream()
+	request, requestErr := http.NewRequestWithContext(streamCtx, http.MethodGet, fmt.Sprintf("http://%s/events", s.wsgwerver), nil)
+	s.Require().NoError(requestErr)
+	request.Header.Set("Authorization", "some credentials")
+	response, responseErr := http.DefaultClient.Do(request)
+	s.Require().NoError(responseErr)
+	defer response.Body.Close()
+	s.Require().Equal(http.StatusOK, response.StatusCode)
+	s.Equal("text/event-stream", response.Header.Get("Content-Type"))
+
+	events := bufio.NewReader(response.Body)
+	event, data := readServerSentEvent(s, events)
+	s.Equal("session", event)
+	var ack map[string]string
+	s.Require().NoError(json.Unmarshal([]byte(data), &ack))
+	connId := wsgw.ConnectionID(ack[wsgw.ConnectionIDKey])
+	token := ack[wsgw.SessionTokenKey]
+	s.NotEmpty(connId)
+	s.NotEmpty(token)
+
+	message := "message_" + xid.New().String()
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, toWsMessage(message))
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+	s.Equal(http.StatusNoContent, s.send(ctx, connId, token, toWsMessage(message)))
+	s.Equal(http.StatusForbidden, s.send(ctx, connId, "not the token", toWsMessage(message)))
+
+	s.NoError(s.mockApp.SendToClient(ctx, connId, mockapp.MessageJSON{"message": "first line\nsecond line"}))
+	event, data = readServerSentEvent(s, events)
+	s.Equal("", event)
+	s.Equal("first line\nsecond line", data)
+
+	closeStream()
+	<-s.mockApp.OnDisconnect(connId)
+	calls := s.mockApp.GetCalls(connId)
+	s.Require().Len(calls, 2)
+	s.Equal(mockapp.MockMethodMessageReceived, calls[0].Method)
+	s.assertArguments(&calls[0], toWsMessage(message))
+}
+
+func (s *fallbackTransportsTestSuite) TestLongPolling() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/poll", s.wsgwerver), nil)
+	s.Require().NoError(requestErr)
+	request.Header.Set("Authorization", "some credentials")
+	response, responseErr := http.DefaultClient.Do(request)
+	s.Require().NoError(responseErr)
+	var ack map[string]string
+	s.Require().NoError(json.NewDecoder(response.Body).Decode(&ack))
+	response.Body.Close()
+	connId := wsgw.ConnectionID(ack[wsgw.ConnectionIDKey])
+	token := ack[wsgw.SessionTokenKey]
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+
+	status, messages := s.poll(ctx, connId, token)
+	s.Equal(http.StatusOK, status)
+	s.Empty(messages)
+
+	message := "message_" + xid.New().String()
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, toWsMessage(message))
+	s.Equal(http.StatusNoContent, s.send(ctx, connId, token, toWsMessage(message)))
+
+	s.Require().Eventually(func() bool {
+		return s.mockApp.SendToClient(ctx, connId, mockapp.MessageJSON{"message": "first"}) == nil
+	}, time.Second, 10*time.Millisecond)
+	s.NoError(s.mockApp.SendToClient(ctx, connId, mockapp.MessageJSON{"message": "second"}))
+	s.Eventually(func() bool {
+		status, messages = s.poll(ctx, connId, token)
+		return status == http.StatusOK && len(messages) > 0
+	}, time.Second, 10*time.Millisecond)
+	s.Equal([]string{"first", "second"}, messages)
+
+	closeRequest, closeRequestErr := http.NewRequestWithContext(ctx, http.MethodDelete, fmt.Sprintf("http://%s/poll/%s", s.wsgwerver, connId), nil)
+	s.Require().NoError(closeRequestErr)
+	closeRequest.Header.Set(wsgw.SessionTokenHeaderKey, token)
+	closeResponse, closeErr := http.DefaultClient.Do(closeRequest)
+	s.Require().NoError(closeErr)
+	closeResponse.Body.Close()
+	s.Equal(http.StatusNoContent, closeResponse.StatusCode)
+
+	<-s.mockApp.OnDisconnect(connId)
+	calls := s.mockApp.GetCalls(connId)
+	s.Require().Len(calls, 2)
+	s.Equal(mockapp.MockMethodMessageReceived, calls[0].Method)
+}
+
+func (s *fallbackTransportsTestSuite) send(ctx context.Context, connId wsgw.ConnectionID, token string, message mockapp.MessageJSON) int {
+	body, _ := json.Marshal(message)
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/send/%s", s.wsgwerver, connId), strings.NewReader(string(body)))
+	s.Require().NoError(requestErr)
+	request.Header.Set(wsgw.SessionTokenHeaderKey, token)
+	response, responseErr := http.DefaultClient.Do(request)
+	s.Require().NoError(responseErr)
+	defer response.Body.Close()
+	return response.StatusCode
+}
+
+func (s *fallbackTransportsTestSuite) poll(ctx context.Context, connId wsgw.ConnectionID, token string) (int, []string) {
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s/poll/%s", s.wsgwerver, connId), nil)
+	s.Require().NoError(requestErr)
+	request.Header.Set(wsgw.SessionTokenHeaderKey, token)
+	response, responseErr := http.DefaultClient.Do(request)
+	s.Require().NoError(responseErr)
+	defer response.Body.Close()
+	var messages []string
+	if response.StatusCode == http.StatusOK {
+		s.Require().NoError(json.NewDecoder(response.Body).Decode(&messages))
+	}
+	return response.StatusCode, messages
+}
+
+// readServerSentEvent returns the name and the data of the next event, skipping the comments
+func readServerSentEvent(s *fallbackTransportsTestSuite, events *bufio.Reader) (string, string) {
+	var event string
+	var data []string
+	for {
+		line, readErr := events.ReadString('\n')
+		s.Require().NoError(readErr)
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case len(line) == 0 && len(data) > 0:
+			return event, strings.Join(data, "\n")
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = append(data, strings.TrimPrefix(line, "data: "))
+		}
+	}
+}
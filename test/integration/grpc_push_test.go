@@ -0,0 +1,110 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+	"wsgw/pkgs/pushapi"
+	"wsgw/test/mockapp"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+)
+
+type grpcPushTestSuite struct {
+	*baseTestSuite
+}
+
+func TestGrpcPushTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestGrpcPushTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	base := NewBaseTestSuite(ctx)
+	base.configure = func(conf *config.Config) {
+		conf.GrpcPushEnabled = true
+	}
+	suite.Run(t, &grpcPushTestSuite{baseTestSuite: base})
+}
+
+func (s *grpcPushTestSuite) TestPushListWatchAndClose() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	pushClient := s.newPushClient()
+
+	watch, watchErr := pushClient.WatchConnections(ctx, &pushapi.WatchConnectionsRequest{})
+	s.Require().NoError(watchErr)
+	// The connections are watched once the headers are received
+	_, headerErr := watch.Header()
+	s.Require().NoError(headerErr)
+
+	msgFromApp := make(chan string, 1)
+	client := NewClient(s.wsgwerver, msgFromApp)
+	_, connectErr := client.connect(ctx)
+	s.Require().NoError(connectErr)
+	connId := string(client.connectionId)
+	s.mockApp.On(mockapp.MockMethodDisconnected, client.connectionId)
+
+	connected, recvErr := watch.Recv()
+	s.Require().NoError(recvErr)
+	s.Equal(pushapi.ConnectionEvent_TYPE_CONNECTED, connected.GetType())
+	s.Equal(connId, connected.GetConnectionId())
+
+	list, listErr := pushClient.ListConnections(ctx, &pushapi.ListConnectionsRequest{})
+	s.Require().NoError(listErr)
+	s.Require().Len(list.GetConnections(), 1)
+	s.Equal(connId, list.GetConnections()[0].GetConnectionId())
+
+	_, pushErr := pushClient.Push(ctx, &pushapi.PushRequest{ConnectionId: connId, Message: "pushed over gRPC"})
+	s.Require().NoError(pushErr)
+	s.Equal("pushed over gRPC", <-msgFromApp)
+
+	pushMany, pushManyErr := pushClient.PushMany(ctx, &pushapi.PushManyRequest{ConnectionIds: []string{connId, "unknown"}, Message: "to many"})
+	s.Require().NoError(pushManyErr)
+	s.Equal("to many", <-msgFromApp)
+	s.Require().Len(pushMany.GetResults(), 2)
+	s.Equal(int32(codes.OK), pushMany.GetResults()[0].GetCode())
+	s.Equal(int32(codes.NotFound), pushMany.GetResults()[1].GetCode())
+
+	_, closeErr := pushClient.Close(ctx, &pushapi.CloseRequest{ConnectionId: connId, Code: 4000, Reason: "closed by the backend"})
+	s.Require().NoError(closeErr)
+
+	disconnected, recvErr := watch.Recv()
+	s.Require().NoError(recvErr)
+	s.Equal(pushapi.ConnectionEvent_TYPE_DISCONNECTED, disconnected.GetType())
+	s.Equal(connId, disconnected.GetConnectionId())
+	<-s.mockApp.OnDisconnect(client.connectionId)
+}
+
+func (s *grpcPushTestSuite) TestErrorsMatchThoseOfTheHttpPushEndpoint() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	pushClient := s.newPushClient()
+
+	_, pushErr := pushClient.Push(ctx, &pushapi.PushRequest{ConnectionId: "unknown", Message: "lost"})
+	s.Equal(codes.NotFound, status.Code(pushErr))
+
+	_, missingIdErr := pushClient.Push(ctx, &pushapi.PushRequest{Message: "lost"})
+	s.Equal(codes.InvalidArgument, status.Code(missingIdErr))
+
+	_, listErr := pushClient.ListConnections(ctx, &pushapi.ListConnectionsRequest{Endpoint: "unknown"})
+	s.Equal(codes.NotFound, status.Code(listErr))
+}
+
+func (s *grpcPushTestSuite) newPushClient() pushapi.PushServiceClient {
+	conn, dialErr := grpc.NewClient(s.wsgwerver, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	s.Require().NoError(dialErr)
+	s.T().Cleanup(func() { _ = conn.Close() })
+	return pushapi.NewPushServiceClient(conn)
+}
@@ -0,0 +1,198 @@
+package integration
+
+import (
+	"context"
+	"net"
+	"sync"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+	"wsgw/pkgs/upstreamapi"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"google.golang.org/grpc"
+)
+
+// grpcBackend is a backend serving the gRPC upstream: it hands the streams wsgw opens over to the test
+type grpcBackend struct {
+	upstreamapi.UnimplementedUpstreamServiceServer
+	streams chan *backendStream
+}
+
+type backendStream struct {
+	upstreamapi.UpstreamService_EventsServer
+	events chan *upstreamapi.GatewayEvent
+	// end ends the stream on the backend side
+	end func()
+}
+
+// Events serves the stream until the test ends it
+func (b *grpcBackend) Events(stream upstreamapi.UpstreamService_EventsServer) error {
+	done := make(chan struct{})
+	backendStream := &backendStream{
+		UpstreamService_EventsServer: stream,
+		events:                       make(chan *upstreamapi.GatewayEvent, 16),
+		end:                          sync.OnceFunc(func() { close(done) }),
+	}
+	go func() {
+		for {
+			event, recvErr := stream.Recv()
+			if recvErr != nil {
+				return
+			}
+			backendStream.events <- event
+		}
+	}()
+	b.streams <- backendStream
+	select {
+	case <-stream.Context().Done():
+	case <-done:
+	}
+	return nil
+}
+
+type grpcUpstreamTestSuite struct {
+	*baseTestSuite
+	backend *grpcBackend
+}
+
+func TestGrpcUpstreamTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestGrpcUpstreamTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatal(listenErr)
+	}
+	backend := &grpcBackend{streams: make(chan *backendStream, 1)}
+	server := grpc.NewServer()
+	upstreamapi.RegisterUpstreamServiceServer(server, backend)
+	go func() { _ = server.Serve(listener) }()
+	defer server.Stop()
+
+	s := &grpcUpstreamTestSuite{
+		baseTestSuite: NewBaseTestSuite(ctx),
+		backend:       backend,
+	}
+	s.configure = func(conf *config.Config) {
+		conf.BackendUpstream = "grpc"
+		conf.GrpcUpstream = config.GrpcUpstreamConfig{
+			Target:              listener.Addr().String(),
+			ReconnectMinBackoff: 10 * time.Millisecond,
+			ReconnectMaxBackoff: 50 * time.Millisecond,
+		}
+	}
+	suite.Run(t, s)
+}
+
+func (s *grpcUpstreamTestSuite) TestEventsAndCommandsShareTheStream() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	stream := s.nextStream(ctx)
+	defer stream.end()
+	events := stream.events
+
+	msgFromApp := make(chan string, 1)
+	client := NewClient(s.wsgwerver, msgFromApp)
+	connected := make(chan error, 1)
+	go func() {
+		_, connectErr := client.connect(ctx)
+		connected <- connectErr
+	}()
+
+	connectEvent := <-events
+	connect := connectEvent.GetConnect()
+	s.Require().NotNil(connect)
+	s.Equal([]string{"some credentials"}, headerValues(connect.GetHeader(), "Authorization"))
+	s.Require().NoError(stream.Send(connectResult(connectEvent.GetId(), 200)))
+	s.Require().NoError(<-connected)
+	s.Equal(string(client.connectionId), connect.GetConnectionId())
+
+	message := "message_" + xid.New().String()
+	s.NoError(client.writeMessage(ctx, toWsMessage(message)))
+	received := (<-events).GetMessage()
+	s.Require().NotNil(received)
+	s.Equal(string(client.connectionId), received.GetConnectionId())
+	s.JSONEq(`{"message":"`+message+`"}`, received.GetMessage())
+
+	s.Require().NoError(stream.Send(&upstreamapi.BackendCommand{Command: &upstreamapi.BackendCommand_Push{Push: &upstreamapi.Push{
+		Id:           7,
+		ConnectionId: string(client.connectionId),
+		Message:      "from the backend",
+	}}}))
+	s.Equal("from the backend", <-msgFromApp)
+	pushResult := (<-events).GetPushResult()
+	s.Require().NotNil(pushResult)
+	s.Equal(uint64(7), pushResult.GetId())
+	s.Equal(int32(204), pushResult.GetStatus())
+
+	s.Require().NoError(stream.Send(&upstreamapi.BackendCommand{Command: &upstreamapi.BackendCommand_Close{Close: &upstreamapi.Close{
+		ConnectionId: string(client.connectionId),
+		Reason:       "closed by the backend",
+	}}}))
+	disconnected := (<-events).GetDisconnected()
+	s.Require().NotNil(disconnected)
+	s.Equal(string(client.connectionId), disconnected.GetConnectionId())
+}
+
+func (s *grpcUpstreamTestSuite) TestStreamIsReopened() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	// Ending the stream on the backend side makes wsgw open a new one
+	s.nextStream(ctx).end()
+	stream := s.nextStream(ctx)
+	defer stream.end()
+	events := stream.events
+
+	client := NewClient(s.wsgwerver, nil)
+	connected := make(chan error, 1)
+	go func() {
+		_, connectErr := client.connect(ctx)
+		connected <- connectErr
+	}()
+
+	connectEvent := <-events
+	s.Require().NotNil(connectEvent.GetConnect())
+	s.Require().NoError(stream.Send(connectResult(connectEvent.GetId(), 401)))
+	s.Error(<-connected)
+}
+
+func (s *grpcUpstreamTestSuite) nextStream(ctx context.Context) *backendStream {
+	select {
+	case stream := <-s.backend.streams:
+		return stream
+	case <-ctx.Done():
+		s.FailNow("no stream opened by wsgw")
+		return nil
+	}
+}
+
+func connectResult(id uint64, status int32) *upstreamapi.BackendCommand {
+	return &upstreamapi.BackendCommand{Command: &upstreamapi.BackendCommand_ConnectResult{ConnectResult: &upstreamapi.ConnectResult{
+		Id:     id,
+		Status: status,
+	}}}
+}
+
+func headerValues(header []*upstreamapi.Header, name string) []string {
+	for _, h := range header {
+		if h.GetName() == name {
+			return h.GetValues()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type healthTestSuite struct {
+	*baseTestSuite
+}
+
+func TestHealthTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestHealthTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	s := &healthTestSuite{baseTestSuite: NewBaseTestSuite(ctx)}
+	s.configure = func(conf *config.Config) {
+		conf.Readiness.BackendProbeEnabled = true
+		conf.Readiness.BackendProbeInterval = 50 * time.Millisecond
+	}
+	suite.Run(t, s)
+}
+
+type readinessBody struct {
+	Status string `json:"status"`
+	Checks map[string]struct {
+		Status    string     `json:"status"`
+		Error     string     `json:"error"`
+		CheckedAt *time.Time `json:"checkedAt"`
+	} `json:"checks"`
+}
+
+func (s *healthTestSuite) TestProbes() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	status, body := s.get(ctx, wsgw.HealthzPath)
+	s.Equal(http.StatusOK, status)
+	s.JSONEq(`{"status":"ok"}`, body)
+
+	var readiness readinessBody
+	s.Require().Eventually(func() bool {
+		status, body = s.get(ctx, wsgw.ReadyzPath)
+		return status == http.StatusOK
+	}, 5*time.Second, 10*time.Millisecond, body)
+	s.Require().NoError(json.Unmarshal([]byte(body), &readiness))
+	s.Equal("ready", readiness.Status)
+	for _, check := range []string{"listener", "backend", "draining"} {
+		s.Equal("ok", readiness.Checks[check].Status, check)
+	}
+	s.NotNil(readiness.Checks["backend"].CheckedAt)
+
+	// Draining flips the readiness while the listeners keep serving
+	s.wsGateway.Drain(ctx)
+	status, body = s.get(ctx, wsgw.ReadyzPath)
+	s.Equal(http.StatusServiceUnavailable, status)
+	s.Require().NoError(json.Unmarshal([]byte(body), &readiness))
+	s.Equal("not_ready", readiness.Status)
+	s.Equal("fail", readiness.Checks["draining"].Status)
+	s.Equal("ok", readiness.Checks["listener"].Status)
+
+	status, _ = s.get(ctx, wsgw.HealthzPath)
+	s.Equal(http.StatusOK, status)
+}
+
+func (s *healthTestSuite) TestProbeConfiguration() {
+	s.T().Setenv("WSGW_READINESS_BACKEND_PROBE_ENABLED", "true")
+	s.T().Setenv("WSGW_READINESS_BACKEND_PROBE_METHOD", "head")
+	s.T().Setenv("WSGW_SHUTDOWN_DRAIN_DELAY", "15s")
+	conf, configErr := config.GetConfig([]string{"wsgw", "--server-port", "8080", "--app-base-url", "http://backend:8080"})
+	s.Require().NoError(configErr)
+	s.True(conf.Readiness.BackendProbeEnabled)
+	s.Equal(15*time.Second, conf.Readiness.DrainDelay)
+
+	s.T().Setenv("WSGW_READINESS_BACKEND_PROBE_METHOD", "DELETE")
+	s.T().Setenv("WSGW_SHUTDOWN_DRAIN_DELAY", "soon")
+	s.T().Setenv("WSGW_BACKEND_UPSTREAM", "nats")
+	s.T().Setenv("WSGW_NATS_URL", "nats://nats:4222")
+	_, configErr = config.GetConfig([]string{"wsgw", "--server-port", "8080"})
+	s.Require().Error(configErr)
+	for _, setting := range []string{"WSGW_READINESS_BACKEND_PROBE_METHOD", "WSGW_SHUTDOWN_DRAIN_DELAY", "WSGW_READINESS_BACKEND_PROBE_URL"} {
+		s.Contains(configErr.Error(), setting)
+	}
+}
+
+func (s *healthTestSuite) get(ctx context.Context, path wsgw.EndpointPath) (int, string) {
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s", s.wsgwerver, path), nil)
+	s.Require().NoError(requestErr)
+	response, responseErr := http.DefaultClient.Do(request)
+	s.Require().NoError(responseErr)
+	defer response.Body.Close()
+	responseBody, readErr := io.ReadAll(response.Body)
+	s.Require().NoError(readErr)
+	return response.StatusCode, string(responseBody)
+}
@@ -0,0 +1,220 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+	"wsgw/test/mockapp"
+
+	"github.com/coder/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type lifecycleEventsTestSuite struct {
+	*baseTestSuite
+	collector *eventCollector
+}
+
+func TestLifecycleEventsTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestLifecycleEventsTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	collector := &eventCollector{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	s := &lifecycleEventsTestSuite{baseTestSuite: NewBaseTestSuite(ctx), collector: collector}
+	s.configure = func(conf *config.Config) {
+		conf.ConnectionEvents = config.ConnectionEventsConfig{
+			URL:                 server.URL + "/events",
+			FlushInterval:       10 * time.Millisecond,
+			RetryInitialBackoff: time.Millisecond,
+		}
+		// The client messages are all rejected as beyond the rate limit of the backend
+		conf.BackendEndpoints.Message.URL = server.URL + "/messages"
+		conf.FallbackTransports = config.FallbackTransportsConfig{
+			Enabled:                true,
+			LongPollSessionTimeout: 200 * time.Millisecond,
+		}
+		conf.WebSocketKeepalive = config.WebSocketKeepaliveConfig{
+			PingInterval: 50 * time.Millisecond,
+			PingTimeout:  100 * time.Millisecond,
+		}
+	}
+	suite.Run(t, s)
+}
+
+// lifecycleEventRecord is the part of the lifecycle events the tests check
+type lifecycleEventRecord struct {
+	Type         string `json:"type"`
+	ConnectionID string `json:"connectionId"`
+	CloseCode    int    `json:"closeCode"`
+	CloseReason  string `json:"closeReason"`
+}
+
+// eventCollector receives the batches of lifecycle events, failing the first request to exercise the retries,
+// and answers the client messages with 429 Too Many Requests
+type eventCollector struct {
+	mux      sync.Mutex
+	requests int
+	events   []lifecycleEventRecord
+}
+
+func (c *eventCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/messages" {
+		w.WriteHeader(http.StatusTooManyRequests)
+		return
+	}
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.requests++
+	if c.requests == 1 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	var batch []lifecycleEventRecord
+	if decodeErr := json.NewDecoder(r.Body).Decode(&batch); decodeErr != nil || r.Header.Get(wsgw.BatchHeaderKey) == "" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	c.events = append(c.events, batch...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *eventCollector) find(eventType string, connId wsgw.ConnectionID) []lifecycleEventRecord {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	var found []lifecycleEventRecord
+	for _, event := range c.events {
+		if event.Type == eventType && event.ConnectionID == string(connId) {
+			found = append(found, event)
+		}
+	}
+	return found
+}
+
+func (s *lifecycleEventsTestSuite) awaitEvent(eventType string, connId wsgw.ConnectionID) lifecycleEventRecord {
+	var found []lifecycleEventRecord
+	s.Require().Eventually(func() bool {
+		found = s.collector.find(eventType, connId)
+		return len(found) > 0
+	}, 5*time.Second, 10*time.Millisecond, eventType)
+	return found[0]
+}
+
+func (s *lifecycleEventsTestSuite) connect(ctx context.Context, msgFromAppChan chan string) *Client {
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+	client := NewClient(s.wsgwerver, msgFromAppChan)
+	_, connectErr := client.connect(ctx)
+	s.Require().NoError(connectErr)
+	return client
+}
+
+func (s *lifecycleEventsTestSuite) TestClientClose() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	client := s.connect(ctx, make(chan string))
+	connId := client.connectionId
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+	s.Require().NoError(client.disconnect(ctx))
+	<-s.mockApp.OnDisconnect(connId)
+
+	closed := s.awaitEvent("client_closed", connId)
+	s.Equal(int(websocket.StatusNormalClosure), closed.CloseCode)
+	s.Equal("we're done", closed.CloseReason)
+}
+
+func (s *lifecycleEventsTestSuite) TestRateLimit() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	msgFromAppChan := make(chan string, 2)
+	client := s.connect(ctx, msgFromAppChan)
+	connId := client.connectionId
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+	defer func() {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	s.Require().NoError(client.writeMessage(ctx, toWsMessage("beyond the limit")))
+	s.Require().NoError(client.writeMessage(ctx, toWsMessage("still beyond the limit")))
+
+	// The clients are answered as for the other rejections of the backend
+	s.Equal("probelm while sending message to application", <-msgFromAppChan)
+	s.Equal("probelm while sending message to application", <-msgFromAppChan)
+	s.awaitEvent("rate_limited", connId)
+	// A streak of rejections is reported once
+	s.Len(s.collector.find("rate_limited", connId), 1)
+}
+
+func (s *lifecycleEventsTestSuite) TestKeepaliveTimeout() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+	// The client opens a long-polling session, then never polls
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s/poll", s.wsgwerver), nil)
+	s.Require().NoError(requestErr)
+	request.Header.Set("Authorization", "some credentials")
+	response, responseErr := http.DefaultClient.Do(request)
+	s.Require().NoError(responseErr)
+	var ack map[string]string
+	s.Require().NoError(json.NewDecoder(response.Body).Decode(&ack))
+	response.Body.Close()
+	connId := wsgw.ConnectionID(ack[wsgw.ConnectionIDKey])
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+
+	s.awaitEvent("keepalive_timeout", connId)
+	<-s.mockApp.OnDisconnect(connId)
+}
+
+func (s *lifecycleEventsTestSuite) TestWebSocketKeepaliveTimeout() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	// The client reads its connection ID, then nothing: as the pings are answered while reading, it answers none
+	silent := s.connectSilent(ctx)
+	connId := silent.connectionId
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+
+	answering := s.connect(ctx, make(chan string, 1))
+	s.mockApp.On(mockapp.MockMethodDisconnected, answering.connectionId)
+	defer func() {
+		_ = answering.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(answering.connectionId)
+	}()
+
+	s.awaitEvent("keepalive_timeout", connId)
+	<-s.mockApp.OnDisconnect(connId)
+	// The client answering the pings keeps its connection
+	s.Empty(s.collector.find("keepalive_timeout", answering.connectionId))
+}
+
+// connectSilent connects a client which doesn't read past its connection ID
+func (s *lifecycleEventsTestSuite) connectSilent(ctx context.Context) *Client {
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+	conn, _, dialErr := connectTowsgw(ctx, s.wsgwerver)
+	s.Require().NoError(dialErr)
+	s.T().Cleanup(func() { _ = conn.CloseNow() })
+	client := &Client{wsConn: conn, proxyUrl: s.wsgwerver}
+	connId, readErr := client.readConnId(ctx)
+	s.Require().NoError(readErr)
+	client.connectionId = connId
+	return client
+}
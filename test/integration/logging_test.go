@@ -0,0 +1,135 @@
+package integration
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/pkgs/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type loggingTestSuite struct {
+	*baseTestSuite
+}
+
+func TestLoggingTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestLoggingTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	suite.Run(t, &loggingTestSuite{baseTestSuite: NewBaseTestSuite(ctx)})
+}
+
+func (s *loggingTestSuite) TestLogLevel() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	initialLevel := logging.CurrentLevel()
+	defer func() { s.NoError(logging.SetLevel(initialLevel)) }()
+
+	status, body := s.request(ctx, http.MethodPut, wsgw.LogLevelPath, `{"level":"trace"}`)
+	s.Equal(http.StatusOK, status)
+	s.JSONEq(`{"level":"trace"}`, body)
+
+	status, body = s.request(ctx, http.MethodGet, wsgw.LogLevelPath, "")
+	s.Equal(http.StatusOK, status)
+	s.JSONEq(`{"level":"trace"}`, body)
+	s.Equal("trace", logging.CurrentLevel())
+
+	status, _ = s.request(ctx, http.MethodPut, wsgw.LogLevelPath, `{"level":"loud"}`)
+	s.Equal(http.StatusBadRequest, status)
+	s.Equal("trace", logging.CurrentLevel())
+}
+
+func (s *loggingTestSuite) TestDebugSessions() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	for _, invalid := range []string{
+		`{}`,
+		`{"connectionId":"c1","remoteAddress":"10.0.0.1"}`,
+		`{"remoteAddress":"customer.example"}`,
+		`{"connectionId":"c1","duration":"2h"}`,
+		`{"connectionId":"c1","duration":"soon"}`,
+	} {
+		status, _ := s.request(ctx, http.MethodPost, wsgw.DebugSessionsPath, invalid)
+		s.Equal(http.StatusBadRequest, status, invalid)
+	}
+
+	status, body := s.request(ctx, http.MethodPost, wsgw.DebugSessionsPath, `{"connectionId":"c1","duration":"90s"}`)
+	s.Require().Equal(http.StatusCreated, status)
+	var session struct {
+		ID           string    `json:"id"`
+		ConnectionID string    `json:"connectionId"`
+		ExpiresAt    time.Time `json:"expiresAt"`
+	}
+	s.Require().NoError(json.Unmarshal([]byte(body), &session))
+	s.Equal("c1", session.ConnectionID)
+	s.WithinDuration(time.Now().Add(90*time.Second), session.ExpiresAt, 10*time.Second)
+
+	status, body = s.request(ctx, http.MethodGet, wsgw.DebugSessionsPath, "")
+	s.Equal(http.StatusOK, status)
+	s.Contains(body, session.ID)
+
+	sessionPath := wsgw.EndpointPath(fmt.Sprintf("%s/%s", wsgw.DebugSessionsPath, session.ID))
+	status, _ = s.request(ctx, http.MethodDelete, sessionPath, "")
+	s.Equal(http.StatusNoContent, status)
+	status, _ = s.request(ctx, http.MethodDelete, sessionPath, "")
+	s.Equal(http.StatusNotFound, status)
+	_, body = s.request(ctx, http.MethodGet, wsgw.DebugSessionsPath, "")
+	s.JSONEq(`[]`, body)
+}
+
+func (s *loggingTestSuite) TestVerboseLogger() {
+	initialLevel := logging.CurrentLevel()
+	defer func() { s.NoError(logging.SetLevel(initialLevel)) }()
+	s.Require().NoError(logging.SetLevel(logging.InfoLevel))
+
+	var output bytes.Buffer
+	verbose := false
+	logger := logging.Verbose(zerolog.New(&output), func() bool { return verbose }).With().Str(wsgw.ConnectionIDKey, "c1").Logger()
+
+	logger.Debug().Msg("dropped")
+	logger.Info().Msg("logged at info")
+	verbose = true
+	logger.Debug().Msg("logged while verbose")
+	logger.Trace().Msg("dropped while verbose")
+	verbose = false
+	s.Require().NoError(logging.SetLevel(logging.DebugLevel))
+	logger.Debug().Msg("logged at debug")
+
+	s.Equal([]string{"logged at info", "logged while verbose", "logged at debug"}, loggedMessages(s.T(), output.String()))
+}
+
+func (s *loggingTestSuite) request(ctx context.Context, method string, path wsgw.EndpointPath, body string) (int, string) {
+	request, requestErr := http.NewRequestWithContext(ctx, method, fmt.Sprintf("http://%s%s", s.wsgwerver, path), strings.NewReader(body))
+	s.Require().NoError(requestErr)
+	request.Header.Set("Content-Type", "application/json")
+	response, responseErr := http.DefaultClient.Do(request)
+	s.Require().NoError(responseErr)
+	defer response.Body.Close()
+	responseBody, readErr := io.ReadAll(response.Body)
+	s.Require().NoError(readErr)
+	return response.StatusCode, string(responseBody)
+}
+
+func loggedMessages(t *testing.T, output string) []string {
+	var messages []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var event struct {
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("invalid log line %q: %v", line, err)
+		}
+		messages = append(messages, event.Message)
+	}
+	return messages
+}
@@ -0,0 +1,220 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+	"wsgw/pkgs/monitoring"
+	"wsgw/test/mockapp"
+
+	"github.com/coder/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type metricsTestSuite struct {
+	*baseTestSuite
+	shutdownOtel func(context.Context) error
+}
+
+func TestMetricsTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestMetricsTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	s := &metricsTestSuite{baseTestSuite: NewBaseTestSuite(ctx)}
+	s.configure = func(conf *config.Config) {
+		conf.MetricsEnabled = true
+		conf.MetricsConnectionAttributes = []string{"tenant"}
+		conf.MetricsAttributeMaxValues = 2
+	}
+	suite.Run(t, s)
+}
+
+func (s *metricsTestSuite) SetupSuite() {
+	// The instruments of wsgw are created with the server, so the meter provider is set up first
+	s.shutdownOtel = monitoring.InitOtel(s.ctx, monitoring.OtelConfig{PrometheusEnabled: true}, config.OtelScope)
+	s.baseTestSuite.SetupSuite()
+}
+
+func (s *metricsTestSuite) TearDownSuite() {
+	s.baseTestSuite.TearDownSuite()
+	s.NoError(s.shutdownOtel(context.Background()))
+}
+
+func (s *metricsTestSuite) TestScrape() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	msgFromAppChan := make(chan string)
+	client := NewClient(s.wsgwerver, msgFromAppChan)
+	_, connectErr := client.connect(ctx)
+	s.Require().NoError(connectErr)
+	connId := client.connectionId
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+	defer func() {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	s.Require().NoError(s.mockApp.SendToClient(ctx, connId, toWsMessage("hello")))
+	s.Equal("hello", <-msgFromAppChan)
+
+	metrics := s.scrape(ctx)
+	s.Contains(metrics, "wsgw_deliveries_total")
+	s.Contains(metrics, "wsgw_active_connections")
+	// The Go runtime metrics
+	s.Contains(metrics, "sched_goroutines_goroutines")
+}
+
+func (s *metricsTestSuite) TestLatencyHistograms() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	msgFromAppChan := make(chan string)
+	client := NewClient(s.wsgwerver, msgFromAppChan)
+	_, connectErr := client.connect(ctx)
+	s.Require().NoError(connectErr)
+	connId := client.connectionId
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+
+	s.Require().NoError(s.mockApp.SendToClient(ctx, connId, toWsMessage("hello")))
+	s.Equal("hello", <-msgFromAppChan)
+	_ = client.disconnect(ctx)
+	<-s.mockApp.OnDisconnect(connId)
+
+	metrics := s.scrape(ctx)
+	s.Regexp(`wsgw_backend_duration_seconds_bucket\{[^}]*endpoint="connect"[^}]*status="2xx"[^}]*le="0.005"`, metrics)
+	s.Contains(metrics, "wsgw_push_queue_time_seconds_bucket")
+	s.Regexp(`wsgw_write_duration_seconds_count\{[^}]*outcome="ok"`, metrics)
+	s.Regexp(`wsgw_connection_duration_seconds_bucket\{[^}]*le="86400"`, metrics)
+}
+
+func (s *metricsTestSuite) TestThroughputByConnectionAttributes() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	connect := func(attributes string) (*Client, chan string) {
+		header := defaultConnectOptions.HTTPHeader.Clone()
+		header.Set(mockapp.ConnectionAttributesHeader, attributes)
+		msgFromAppChan := make(chan string)
+		client := NewClient(s.wsgwerver, msgFromAppChan)
+		_, connectErr := client.connect(ctx, &websocket.DialOptions{HTTPHeader: header})
+		s.Require().NoError(connectErr)
+		s.mockApp.On(mockapp.MockMethodDisconnected, client.connectionId)
+		return client, msgFromAppChan
+	}
+	disconnect := func(client *Client) {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(client.connectionId)
+	}
+
+	client, msgFromAppChan := connect("tenant=acme, plan=pro")
+	defer disconnect(client)
+	message := toWsMessage("hello app")
+	s.mockApp.On(mockapp.MockMethodMessageReceived, client.connectionId, message)
+	s.Require().NoError(client.writeMessage(ctx, message))
+	s.Require().NoError(s.mockApp.SendToClient(ctx, client.connectionId, toWsMessage("hello client")))
+	<-msgFromAppChan
+
+	var details struct {
+		Attributes         map[string]string `json:"attributes"`
+		MessagesFromClient int64             `json:"messagesFromClient"`
+		BytesFromClient    int64             `json:"bytesFromClient"`
+		MessagesToClient   int64             `json:"messagesToClient"`
+		BufferSize         int               `json:"bufferSize"`
+	}
+	detailsUrl := fmt.Sprintf("http://%s%s/%s", s.wsgwerver, wsgw.ConnectionsPath, client.connectionId)
+	s.Eventually(func() bool {
+		response, getErr := http.Get(detailsUrl)
+		s.Require().NoError(getErr)
+		defer response.Body.Close()
+		s.Require().Equal(http.StatusOK, response.StatusCode)
+		s.Require().NoError(json.NewDecoder(response.Body).Decode(&details))
+		return details.MessagesFromClient == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	s.Equal(map[string]string{"tenant": "acme", "plan": "pro"}, details.Attributes)
+	s.Positive(details.BytesFromClient)
+	s.EqualValues(1, details.MessagesToClient)
+	s.Equal(1024, details.BufferSize)
+
+	response, getErr := http.Get(fmt.Sprintf("http://%s%s/unknown", s.wsgwerver, wsgw.ConnectionsPath))
+	s.Require().NoError(getErr)
+	response.Body.Close()
+	s.Equal(http.StatusNotFound, response.StatusCode)
+
+	// Beyond two tenants, the tenants are recorded as "other"
+	for _, tenant := range []string{"globex", "initech"} {
+		other, otherMsgFromAppChan := connect("tenant=" + tenant)
+		s.Require().NoError(s.mockApp.SendToClient(ctx, other.connectionId, toWsMessage("hello "+tenant)))
+		<-otherMsgFromAppChan
+		disconnect(other)
+	}
+
+	metrics := s.scrape(ctx)
+	s.Regexp(`wsgw_messages_total\{[^}]*direction="from_client"[^}]*tenant="acme"[^}]*\} 1`, metrics)
+	s.Regexp(`wsgw_bytes_total\{[^}]*direction="to_client"[^}]*tenant="acme"`, metrics)
+	s.Regexp(`wsgw_messages_total\{[^}]*direction="to_client"[^}]*tenant="globex"`, metrics)
+	s.Regexp(`wsgw_messages_total\{[^}]*direction="to_client"[^}]*tenant="other"`, metrics)
+	s.NotContains(metrics, `tenant="initech"`)
+	s.NotContains(metrics, `plan="pro"`)
+	s.Contains(metrics, "wsgw_push_buffered")
+	s.Contains(metrics, "wsgw_push_buffer_max_utilization")
+}
+
+// scrape returns the metrics served at /metrics
+func (s *metricsTestSuite) scrape(ctx context.Context) string {
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("http://%s%s", s.wsgwerver, wsgw.MetricsPath), nil)
+	s.Require().NoError(requestErr)
+	response, scrapeErr := http.DefaultClient.Do(request)
+	s.Require().NoError(scrapeErr)
+	defer response.Body.Close()
+	s.Equal(http.StatusOK, response.StatusCode)
+	s.Contains(response.Header.Get("Content-Type"), "text/plain")
+
+	body, readErr := io.ReadAll(response.Body)
+	s.Require().NoError(readErr)
+	return string(body)
+}
+
+func (s *metricsTestSuite) TestGaugesOfStoppedServer() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	// A second server, sharing the meter provider, observes the buffers of its own gateway endpoint
+	configuration := config.Config{
+		ServerHost: "localhost",
+		Endpoints: []config.GatewayEndpointConfig{
+			{Name: "stale", AppBaseUrls: []string{fmt.Sprintf("http://%s", s.mockApp.GetAppAddress())}},
+		},
+	}
+	other := wsgw.NewServer(configuration, wsgw.CreateID)
+	started := make(chan struct{})
+	go func() {
+		_ = other.SetupAndStart(ctx, configuration, func(context.Context, int, func(context.Context) error) {
+			close(started)
+		})
+	}()
+	<-started
+	s.Contains(s.scrape(ctx), `gateway_endpoint="stale"`)
+
+	s.Require().NoError(other.Stop(ctx))
+	s.NotContains(s.scrape(ctx), `gateway_endpoint="stale"`)
+}
@@ -0,0 +1,137 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type natsEvent struct {
+	ConnectionID string `json:"connectionId"`
+	Message      string `json:"message"`
+	PushSubject  string `json:"pushSubject"`
+}
+
+type natsTestSuite struct {
+	*baseTestSuite
+	natsServer *server.Server
+	backend    *nats.Conn
+}
+
+func TestNatsTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestNatsTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	natsServer, serverErr := server.NewServer(&server.Options{Host: "127.0.0.1", Port: server.RANDOM_PORT, NoSigs: true})
+	if serverErr != nil {
+		t.Fatal(serverErr)
+	}
+	go natsServer.Start()
+	defer natsServer.Shutdown()
+	if !natsServer.ReadyForConnections(10 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+
+	backend, connectErr := nats.Connect(natsServer.ClientURL())
+	if connectErr != nil {
+		t.Fatal(connectErr)
+	}
+	defer backend.Close()
+
+	s := &natsTestSuite{
+		baseTestSuite: NewBaseTestSuite(ctx),
+		natsServer:    natsServer,
+		backend:       backend,
+	}
+	s.configure = func(conf *config.Config) {
+		conf.BackendUpstream = "nats"
+		conf.Nats = config.NatsConfig{URL: natsServer.ClientURL()}
+	}
+	suite.Run(t, s)
+}
+
+func (s *natsTestSuite) TestEventsArePublishedAndPushesConsumed() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	connects := make(chan natsEvent, 1)
+	connectSub, subErr := s.backend.Subscribe("wsgw.connect", func(msg *nats.Msg) {
+		var event natsEvent
+		_ = json.Unmarshal(msg.Data, &event)
+		connects <- event
+		_ = msg.Respond([]byte(`{"status":200}`))
+	})
+	s.Require().NoError(subErr)
+	defer connectSub.Unsubscribe()
+
+	messages, messagesSub := s.subscribe("wsgw.message")
+	defer messagesSub.Unsubscribe()
+	disconnects, disconnectsSub := s.subscribe("wsgw.disconnected")
+	defer disconnectsSub.Unsubscribe()
+
+	msgFromApp := make(chan string, 1)
+	client := NewClient(s.wsgwerver, msgFromApp)
+	_, err := client.connect(ctx)
+	s.Require().NoError(err)
+
+	connected := <-connects
+	s.Equal(string(client.connectionId), connected.ConnectionID)
+
+	message := "message_" + xid.New().String()
+	s.NoError(client.writeMessage(ctx, toWsMessage(message)))
+	received := <-messages
+	s.Equal(string(client.connectionId), received.ConnectionID)
+	s.JSONEq(`{"message":"`+message+`"}`, received.Message)
+
+	push := nats.NewMsg(connected.PushSubject)
+	push.Header.Set(wsgw.ConnectionIDHeaderKey, string(client.connectionId))
+	push.Data = []byte("from the backend")
+	reply, requestErr := s.backend.RequestMsgWithContext(ctx, push)
+	s.Require().NoError(requestErr)
+	s.JSONEq(`{"status":204}`, string(reply.Data))
+	s.Equal("from the backend", <-msgFromApp)
+
+	_ = client.disconnect(ctx)
+	disconnected := <-disconnects
+	s.Equal(string(client.connectionId), disconnected.ConnectionID)
+}
+
+func (s *natsTestSuite) TestConnectIsRejectedWithoutResponders() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	client := NewClient(s.wsgwerver, nil)
+	response, err := client.connect(ctx)
+	s.Error(err)
+	s.Require().NotNil(response)
+	s.Equal(503, response.StatusCode)
+}
+
+func (s *natsTestSuite) subscribe(subject string) (chan natsEvent, *nats.Subscription) {
+	events := make(chan natsEvent, 1)
+	subscription, subErr := s.backend.Subscribe(subject, func(msg *nats.Msg) {
+		var event natsEvent
+		_ = json.Unmarshal(msg.Data, &event)
+		events <- event
+	})
+	s.Require().NoError(subErr)
+	return events, subscription
+}
@@ -0,0 +1,195 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+	"wsgw/test/mockapp"
+
+	"github.com/coder/websocket"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+const billingProfile = "billing"
+
+type routingTestSuite struct {
+	*baseTestSuite
+	billing *recordingBackend
+}
+
+func TestRoutingTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestRoutingTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	s := &routingTestSuite{
+		baseTestSuite: NewBaseTestSuite(ctx),
+		billing:       &recordingBackend{},
+	}
+	billing := httptest.NewServer(s.billing)
+	defer billing.Close()
+
+	s.configure = func(conf *config.Config) {
+		conf.Routing = config.RoutingConfig{
+			Profiles:       map[string][]string{billingProfile: {billing.URL}},
+			MessageField:   "type",
+			TopicSeparator: ":",
+			MessageRoutes:  []string{"invoice.*=" + billingProfile, "chat=default", "refund=" + billingProfile},
+		}
+	}
+	suite.Run(t, s)
+}
+
+// recordingBackend is a backend profile accepting all the callbacks, recording the client messages it receives
+type recordingBackend struct {
+	mux      sync.Mutex
+	connects []wsgw.ConnectionID
+	messages map[wsgw.ConnectionID][]string
+}
+
+func (b *recordingBackend) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	connId := wsgw.ConnectionID(request.Header.Get(wsgw.ConnectionIDHeaderKey))
+	body, _ := io.ReadAll(request.Body)
+
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	switch request.URL.Path {
+	case "/ws" + string(wsgw.ConnectPath):
+		b.connects = append(b.connects, connId)
+	case "/ws" + string(wsgw.MessagePath):
+		if b.messages == nil {
+			b.messages = map[wsgw.ConnectionID][]string{}
+		}
+		b.messages[connId] = append(b.messages[connId], strings.TrimSpace(string(body)))
+	}
+}
+
+func (b *recordingBackend) connected(connId wsgw.ConnectionID) bool {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	for _, connected := range b.connects {
+		if connected == connId {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *recordingBackend) received(connId wsgw.ConnectionID) []string {
+	b.mux.Lock()
+	defer b.mux.Unlock()
+	return append([]string(nil), b.messages[connId]...)
+}
+
+func (s *routingTestSuite) TestMessagesRoutedByField() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+	client := NewClient(s.wsgwerver, make(chan string, 1))
+	_, connectErr := client.connect(ctx)
+	s.Require().NoError(connectErr)
+	connId := client.connectionId
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+	defer func() {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	// "invoice" doesn't match the "invoice.*" route, the messages without a route go to the profile of the connection
+	toDefault := []mockapp.MessageJSON{{"type": "chat"}, {"type": "invoice"}, {"type": "unrouted"}}
+	for _, message := range toDefault {
+		s.mockApp.On(mockapp.MockMethodMessageReceived, connId, message)
+	}
+
+	s.Require().NoError(client.writeMessage(ctx, mockapp.MessageJSON{"type": "invoice.paid"}))
+	for _, message := range toDefault {
+		s.Require().NoError(client.writeMessage(ctx, message))
+	}
+	s.Require().NoError(client.writeMessage(ctx, mockapp.MessageJSON{"type": "invoice.sent"}))
+
+	s.Eventually(func() bool { return len(s.billing.received(connId)) == 2 }, 5*time.Second, 10*time.Millisecond)
+	s.Equal([]string{`{"type":"invoice.paid"}`, `{"type":"invoice.sent"}`}, s.billing.received(connId))
+	s.Eventually(func() bool { return len(s.mockApp.GetCalls(connId)) == len(toDefault) }, 5*time.Second, 10*time.Millisecond)
+	for i, message := range toDefault {
+		call := s.getCall(connId, i)
+		s.assertArguments(&call, message)
+	}
+}
+
+func (s *routingTestSuite) TestMessagesRoutedByTopic() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+	client := NewClient(s.wsgwerver, make(chan string, 1))
+	_, connectErr := client.connect(ctx)
+	s.Require().NoError(connectErr)
+	connId := client.connectionId
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+	defer func() {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	s.Require().NoError(client.wsConn.Write(ctx, websocket.MessageText, []byte("refund:42")))
+	s.Eventually(func() bool { return len(s.billing.received(connId)) == 1 }, 5*time.Second, 10*time.Millisecond)
+	s.Equal([]string{"refund:42"}, s.billing.received(connId))
+}
+
+func (s *routingTestSuite) TestConnectToProfile() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+	client := s.connectToProfile(ctx, billingProfile)
+	connId := client.connectionId
+	defer func() {
+		_ = client.disconnect(ctx)
+	}()
+	s.True(s.billing.connected(connId))
+	s.Empty(s.mockApp.GetCalls(connId))
+
+	// The routes apply to the connections of the profiles too
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, mockapp.MessageJSON{"type": "chat"})
+	s.Require().NoError(client.writeMessage(ctx, toWsMessage("to the profile")))
+	s.Require().NoError(client.writeMessage(ctx, mockapp.MessageJSON{"type": "chat"}))
+
+	s.Eventually(func() bool { return len(s.billing.received(connId)) == 1 }, 5*time.Second, 10*time.Millisecond)
+	s.Equal([]string{`{"message":"to the profile"}`}, s.billing.received(connId))
+	s.Eventually(func() bool { return len(s.mockApp.GetCalls(connId)) == 1 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func (s *routingTestSuite) TestUnknownProfileIsNotFound() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	_, response, connectErr := websocket.Dial(ctx, fmt.Sprintf("ws://%s%s/unknown", s.wsgwerver, wsgw.ConnectPath), defaultConnectOptions)
+	s.Require().Error(connectErr)
+	s.Equal(http.StatusNotFound, response.StatusCode)
+}
+
+// connectToProfile connects a client through the connect path of the backend profile
+func (s *routingTestSuite) connectToProfile(ctx context.Context, profile string) *Client {
+	conn, _, dialErr := websocket.Dial(ctx, fmt.Sprintf("ws://%s%s/%s", s.wsgwerver, wsgw.ConnectPath, profile), defaultConnectOptions)
+	s.Require().NoError(dialErr)
+	client := &Client{wsConn: conn, proxyUrl: s.wsgwerver}
+	connId, readConnIdErr := client.readConnId(ctx)
+	s.Require().NoError(readConnIdErr)
+	client.connectionId = connId
+	return client
+}
@@ -0,0 +1,64 @@
+package integration
+
+import (
+	"context"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/pkgs/logging"
+	"wsgw/test/mockapp"
+
+	"github.com/rs/xid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type signingTestSuite struct {
+	*baseTestSuite
+}
+
+func TestSigningTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestSigningTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	base := NewBaseTestSuite(ctx)
+	base.signingKeys = []string{"key-2:new-secret", "key-1:old-secret"}
+	suite.Run(
+		t,
+		&signingTestSuite{
+			baseTestSuite: base,
+		},
+	)
+}
+
+func (s *signingTestSuite) TestSignedRequestsAreAccepted() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	client := NewClient(s.wsgwerver, nil)
+	_, err := client.connect(ctx)
+	s.NoError(err)
+	if err != nil {
+		return
+	}
+
+	connId := client.connectionId
+	message := "message_" + xid.New().String()
+
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, toWsMessage(message))
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+
+	err = client.writeMessage(ctx, toWsMessage(message))
+	s.NoError(err)
+
+	_ = client.disconnect(ctx)
+	<-s.mockApp.OnDisconnect(connId)
+
+	calls := s.mockApp.GetCalls(connId)
+	s.Len(calls, 2)
+	s.Equal(mockapp.MockMethodMessageReceived, calls[0].Method)
+	s.Equal(mockapp.MockMethodDisconnected, calls[1].Method)
+}
@@ -0,0 +1,232 @@
+package integration
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+)
+
+type tlsTestSuite struct {
+	*baseTestSuite
+	certFile string
+	keyFile  string
+}
+
+func TestTLSTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestTLSTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	certDir := t.TempDir()
+	s := &tlsTestSuite{
+		baseTestSuite: NewBaseTestSuite(ctx),
+		certFile:      filepath.Join(certDir, "tls.crt"),
+		keyFile:       filepath.Join(certDir, "tls.key"),
+	}
+	if err := writeSelfSignedCert(s.certFile, s.keyFile, "first"); err != nil {
+		t.Fatal(err)
+	}
+	s.configure = func(conf *config.Config) {
+		conf.TLSCertFile = s.certFile
+		conf.TLSKeyFile = s.keyFile
+		conf.TLSReloadInterval = 50 * time.Millisecond
+	}
+	suite.Run(t, s)
+}
+
+func (s *tlsTestSuite) TestCertificateIsReloaded() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.Equal("first", s.servedCommonName(ctx))
+
+	// Make sure the modification time changes even on file systems with coarse timestamps
+	time.Sleep(10 * time.Millisecond)
+	s.Require().NoError(writeSelfSignedCert(s.certFile, s.keyFile, "second"))
+	future := time.Now().Add(time.Second)
+	s.Require().NoError(os.Chtimes(s.certFile, future, future))
+	s.Require().NoError(os.Chtimes(s.keyFile, future, future))
+
+	s.Eventually(func() bool {
+		return s.servedCommonName(ctx) == "second"
+	}, 5*time.Second, 50*time.Millisecond)
+}
+
+type adminTLSTestSuite struct {
+	*baseTestSuite
+	adminPort int
+	certDir   string
+	// ca signs the client certificates the admin listener accepts
+	ca    *x509.Certificate
+	caKey *ecdsa.PrivateKey
+}
+
+func TestAdminTLSTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestAdminTLSTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+
+	certDir := t.TempDir()
+	certFile, keyFile := filepath.Join(certDir, "tls.crt"), filepath.Join(certDir, "tls.key")
+	if err := writeSelfSignedCert(certFile, keyFile, "admin"); err != nil {
+		t.Fatal(err)
+	}
+	caFile := filepath.Join(certDir, "ca.crt")
+	ca, caKey, caErr := writeCert(caFile, filepath.Join(certDir, "ca.key"), "client CA", x509.ExtKeyUsageClientAuth, nil, nil)
+	if caErr != nil {
+		t.Fatal(caErr)
+	}
+	// A free port, for want of a way to learn the port of the admin listener
+	listener, listenErr := net.Listen("tcp", "127.0.0.1:0")
+	if listenErr != nil {
+		t.Fatal(listenErr)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	s := &adminTLSTestSuite{baseTestSuite: NewBaseTestSuite(ctx), adminPort: port, certDir: certDir, ca: ca, caKey: caKey}
+	s.configure = func(conf *config.Config) {
+		conf.AdminServerHost = "127.0.0.1"
+		conf.AdminServerPort = port
+		conf.AdminTLSCertFile = certFile
+		conf.AdminTLSKeyFile = keyFile
+		conf.AdminTLSClientCAFile = caFile
+	}
+	suite.Run(t, s)
+}
+
+func (s *adminTLSTestSuite) TestClientWithoutCertificateIsRejected() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	_, err := s.adminHealth(ctx, nil)
+	s.ErrorContains(err, "tls: certificate required")
+}
+
+func (s *adminTLSTestSuite) TestCertificateOfAnotherCAIsRejected() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	otherCA, otherCAKey, caErr := writeCert(filepath.Join(s.certDir, "other-ca.crt"), filepath.Join(s.certDir, "other-ca.key"), "other CA", x509.ExtKeyUsageClientAuth, nil, nil)
+	s.Require().NoError(caErr)
+	_, err := s.adminHealth(ctx, s.clientCertificate("untrusted", otherCA, otherCAKey))
+	s.ErrorContains(err, "tls: unknown certificate authority")
+}
+
+func (s *adminTLSTestSuite) TestCertificateOfTheConfiguredCAIsAccepted() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	status, err := s.adminHealth(ctx, s.clientCertificate("trusted", s.ca, s.caKey))
+	s.Require().NoError(err)
+	s.Equal(http.StatusOK, status)
+}
+
+// clientCertificate creates a client certificate signed by the CA
+func (s *adminTLSTestSuite) clientCertificate(commonName string, ca *x509.Certificate, caKey *ecdsa.PrivateKey) *tls.Certificate {
+	certFile, keyFile := filepath.Join(s.certDir, commonName+".crt"), filepath.Join(s.certDir, commonName+".key")
+	_, _, certErr := writeCert(certFile, keyFile, commonName, x509.ExtKeyUsageClientAuth, ca, caKey)
+	s.Require().NoError(certErr)
+	cert, loadErr := tls.LoadX509KeyPair(certFile, keyFile)
+	s.Require().NoError(loadErr)
+	return &cert
+}
+
+// adminHealth calls the liveness probe of the admin listener, presenting the client certificate if any, even if
+// it isn't signed by one of the CAs the listener asks for
+func (s *adminTLSTestSuite) adminHealth(ctx context.Context, clientCert *tls.Certificate) (int, error) {
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+	if clientCert != nil {
+		tlsConfig.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return clientCert, nil
+		}
+	}
+	client := http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig, DisableKeepAlives: true}}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://127.0.0.1:%d%s", s.adminPort, wsgw.HealthzPath), nil)
+	s.Require().NoError(err)
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	return response.StatusCode, nil
+}
+
+func (s *tlsTestSuite) servedCommonName(ctx context.Context) string {
+	client := http.Client{
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
+			// a new connection for every request, so that every request sees the current certificate
+			DisableKeepAlives: true,
+		},
+	}
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("https://%s/app-info", s.wsgwerver), nil)
+	s.Require().NoError(err)
+	response, err := client.Do(request)
+	s.Require().NoError(err)
+	defer response.Body.Close()
+	s.Require().Equal(http.StatusOK, response.StatusCode)
+	return response.TLS.PeerCertificates[0].Subject.CommonName
+}
+
+func writeSelfSignedCert(certFile string, keyFile string, commonName string) error {
+	_, _, err := writeCert(certFile, keyFile, commonName, x509.ExtKeyUsageServerAuth, nil, nil)
+	return err
+}
+
+// writeCert writes a certificate signed by the parent, or self-signed without one, and its key.
+// It returns them for the certificate to sign others.
+func writeCert(certFile string, keyFile string, commonName string, usage x509.ExtKeyUsage, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	if parent == nil {
+		// Self-signed certificates can sign others
+		template.IsCA, template.BasicConstraintsValid = true, true
+		template.KeyUsage |= x509.KeyUsageCertSign
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		return nil, nil, err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		return nil, nil, err
+	}
+	cert, err := x509.ParseCertificate(der)
+	return cert, key, err
+}
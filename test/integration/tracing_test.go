@@ -0,0 +1,221 @@
+package integration
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+	wsgw "wsgw/internal"
+	"wsgw/internal/config"
+	"wsgw/pkgs/logging"
+	"wsgw/pkgs/monitoring"
+	"wsgw/test/mockapp"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/suite"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type tracingTestSuite struct {
+	*baseTestSuite
+	spans          *tracetest.SpanRecorder
+	tracerProvider trace.TracerProvider
+}
+
+func TestTracingTestSuite(t *testing.T) {
+	logger := logging.Get().Level(zerolog.DebugLevel).With().Str("unit", "TestTracingTestSuite").Logger()
+	ctx := logger.WithContext(context.Background())
+	s := &tracingTestSuite{baseTestSuite: NewBaseTestSuite(ctx)}
+	s.configure = func(conf *config.Config) {
+		conf.TraceContextField = "traceparent"
+	}
+	suite.Run(t, s)
+}
+
+func (s *tracingTestSuite) SetupSuite() {
+	s.spans = tracetest.NewSpanRecorder()
+	s.tracerProvider = otel.GetTracerProvider()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(s.spans)))
+	s.baseTestSuite.SetupSuite()
+}
+
+func (s *tracingTestSuite) TearDownSuite() {
+	s.baseTestSuite.TearDownSuite()
+	otel.SetTracerProvider(s.tracerProvider)
+}
+
+func (s *tracingTestSuite) TestFrameSpans() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	msgFromAppChan := make(chan string)
+	client := NewClient(s.wsgwerver, msgFromAppChan)
+	_, connectErr := client.connect(ctx)
+	s.Require().NoError(connectErr)
+	connId := client.connectionId
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+	defer func() {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	// The span of the connection ends with the connect request, not with the connection
+	var connectionSpan sdktrace.ReadOnlySpan
+	s.Require().Eventually(func() bool {
+		connectionSpan = s.endedSpan("new-ws-connection")
+		return connectionSpan != nil
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// A frame without trace context starts a trace of its own
+	untraced := toWsMessage("untraced")
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, untraced)
+	s.Require().NoError(client.writeMessage(ctx, untraced))
+
+	// A frame with the traceparent of the client continues its trace
+	clientTraceId := "4bf92f3577b34da6a3ce929d0e0e4736"
+	clientSpanId := "00f067aa0ba902b7"
+	traced := mockapp.MessageJSON{"message": "traced", "traceparent": fmt.Sprintf("00-%s-%s-01", clientTraceId, clientSpanId)}
+	s.mockApp.On(mockapp.MockMethodMessageReceived, connId, traced)
+	s.Require().NoError(client.writeMessage(ctx, traced))
+
+	var frameSpans []sdktrace.ReadOnlySpan
+	s.Require().Eventually(func() bool {
+		frameSpans = s.endedSpans("ws-client-message")
+		return len(frameSpans) == 2
+	}, 5*time.Second, 10*time.Millisecond)
+	for _, frameSpan := range frameSpans {
+		s.Require().Len(frameSpan.Links(), 1)
+		s.Equal(connectionSpan.SpanContext().SpanID(), frameSpan.Links()[0].SpanContext.SpanID())
+	}
+	s.NotEqual(connectionSpan.SpanContext().TraceID(), frameSpans[0].SpanContext().TraceID())
+	s.False(frameSpans[0].Parent().IsValid())
+	s.Equal(clientTraceId, frameSpans[1].SpanContext().TraceID().String())
+	s.Equal(clientSpanId, frameSpans[1].Parent().SpanID().String())
+
+	// The message callback is called in the trace of the frame
+	traceParents := s.mockApp.MessageTraceParents(connId)
+	s.Require().Len(traceParents, 2)
+	s.Contains(traceParents[0], frameSpans[0].SpanContext().TraceID().String())
+	s.Contains(traceParents[1], frameSpans[1].SpanContext().SpanID().String())
+
+	// The write of a pushed message continues the trace of the push
+	pushTraceId := "0af7651916cd43dd8448eb211c80319c"
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s%s/%s", s.wsgwerver, wsgw.MessagePath, connId), strings.NewReader("pushed"))
+	s.Require().NoError(requestErr)
+	request.Header.Set("traceparent", fmt.Sprintf("00-%s-b7ad6b7169203331-01", pushTraceId))
+	response, pushErr := http.DefaultClient.Do(request)
+	s.Require().NoError(pushErr)
+	response.Body.Close()
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	s.Equal("pushed", <-msgFromAppChan)
+
+	var writeSpan sdktrace.ReadOnlySpan
+	s.Require().Eventually(func() bool {
+		writeSpan = s.endedSpan("ws-push-write")
+		return writeSpan != nil
+	}, 5*time.Second, 10*time.Millisecond)
+	s.Equal(pushTraceId, writeSpan.SpanContext().TraceID().String())
+	pushSpan := s.endedSpan("push-message")
+	s.Require().NotNil(pushSpan)
+	s.Equal(pushSpan.SpanContext().SpanID(), writeSpan.Parent().SpanID())
+	s.Require().Len(writeSpan.Links(), 1)
+	s.Equal(connectionSpan.SpanContext().SpanID(), writeSpan.Links()[0].SpanContext.SpanID())
+}
+
+func (s *tracingTestSuite) TestB3Propagation() {
+	ctx, cancel := context.WithTimeout(s.ctx, time.Minute)
+	defer cancel()
+
+	monitoring.InitOtel(ctx, monitoring.OtelConfig{Propagators: []string{monitoring.PropagatorTraceContext, monitoring.PropagatorB3}}, config.OtelScope)
+	defer monitoring.InitOtel(ctx, monitoring.OtelConfig{}, config.OtelScope)
+
+	s.connIdGenerator = func() wsgw.ConnectionID {
+		return wsgw.CreateID(ctx)
+	}
+
+	msgFromAppChan := make(chan string)
+	client := NewClient(s.wsgwerver, msgFromAppChan)
+	_, connectErr := client.connect(ctx)
+	s.Require().NoError(connectErr)
+	connId := client.connectionId
+	s.mockApp.On(mockapp.MockMethodDisconnected, connId)
+	defer func() {
+		_ = client.disconnect(ctx)
+		<-s.mockApp.OnDisconnect(connId)
+	}()
+
+	pushTraceId := "80f198ee56343ba864fe8b2a57d3eff7"
+	request, requestErr := http.NewRequestWithContext(ctx, http.MethodPost, fmt.Sprintf("http://%s%s/%s", s.wsgwerver, wsgw.MessagePath, connId), strings.NewReader("pushed with b3"))
+	s.Require().NoError(requestErr)
+	request.Header.Set("b3", fmt.Sprintf("%s-e457b5a2e4d86bd1-1", pushTraceId))
+	response, pushErr := http.DefaultClient.Do(request)
+	s.Require().NoError(pushErr)
+	response.Body.Close()
+	s.Equal(http.StatusNoContent, response.StatusCode)
+	s.Equal("pushed with b3", <-msgFromAppChan)
+
+	s.Require().Eventually(func() bool {
+		writeSpan := s.endedSpan("ws-push-write")
+		return writeSpan != nil && writeSpan.SpanContext().TraceID().String() == pushTraceId
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func (s *tracingTestSuite) TestTelemetryConfiguration() {
+	s.T().Setenv("WSGW_OTLP_ENDPOINT", "https://collector.example:4317")
+	s.T().Setenv("WSGW_OTLP_PROTOCOL", "grpc")
+	s.T().Setenv("WSGW_OTLP_HEADERS", "Authorization=Bearer%20secret,X-Tenant=wsgw")
+	s.T().Setenv("WSGW_OTLP_TRACE_SAMPLER", "parentbased_traceidratio")
+	s.T().Setenv("WSGW_OTLP_TRACE_SAMPLER_RATIO", "0.25")
+	s.T().Setenv("WSGW_OTLP_TRACE_QUEUE_SIZE", "8192")
+	s.T().Setenv("WSGW_TRACE_PROPAGATORS", "tracecontext baggage")
+
+	conf, configErr := config.GetConfig([]string{"wsgw", "--server-port", "8080", "--app-base-url", "http://backend:8080"})
+	s.Require().NoError(configErr)
+	s.Equal("grpc", conf.OtlpProtocol)
+	s.Equal("parentbased_traceidratio", conf.OtlpTraceSampler)
+	s.Equal(0.25, conf.OtlpTraceSamplerRatio)
+	s.Equal(8192, conf.OtlpTraceQueueSize)
+	s.Equal([]string{"tracecontext", "baggage"}, conf.TracePropagators)
+	headers, headersErr := config.ParseOtlpHeaders(conf.OtlpHeaders)
+	s.Require().NoError(headersErr)
+	s.Equal(map[string]string{"Authorization": "Bearer secret", "X-Tenant": "wsgw"}, headers)
+
+	s.T().Setenv("WSGW_OTLP_PROTOCOL", "thrift")
+	s.T().Setenv("WSGW_OTLP_HEADERS", "Authorization")
+	s.T().Setenv("WSGW_OTLP_TRACE_SAMPLER", "sometimes")
+	s.T().Setenv("WSGW_OTLP_TRACE_SAMPLER_RATIO", "2")
+	s.T().Setenv("WSGW_TRACE_PROPAGATORS", "jaeger")
+	_, configErr = config.GetConfig([]string{"wsgw", "--server-port", "8080", "--app-base-url", "http://backend:8080"})
+	s.Require().Error(configErr)
+	for _, setting := range []string{"WSGW_OTLP_PROTOCOL", "WSGW_OTLP_HEADERS", "WSGW_OTLP_TRACE_SAMPLER must", "WSGW_OTLP_TRACE_SAMPLER_RATIO", "WSGW_TRACE_PROPAGATORS"} {
+		s.Contains(configErr.Error(), setting)
+	}
+}
+
+// endedSpans returns the ended spans with the given name, in the order they ended
+func (s *tracingTestSuite) endedSpans(name string) []sdktrace.ReadOnlySpan {
+	var spans []sdktrace.ReadOnlySpan
+	for _, span := range s.spans.Ended() {
+		if span.Name() == name {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+func (s *tracingTestSuite) endedSpan(name string) sdktrace.ReadOnlySpan {
+	spans := s.endedSpans(name)
+	if len(spans) == 0 {
+		return nil
+	}
+	return spans[len(spans)-1]
+}
@@ -12,6 +12,7 @@ import (
 	"sync"
 	"time"
 	wsgw "wsgw/internal"
+	"wsgw/pkgs/signing"
 
 	"github.com/gin-gonic/gin"
 	"github.com/rs/zerolog"
@@ -20,6 +21,9 @@ import (
 
 const BadCredential = "bad-credential"
 
+// ConnectionAttributesHeader, on a connect request, is answered with these attributes for the connection
+const ConnectionAttributesHeader = "X-Mock-Connection-Attributes"
+
 const (
 	MockMethodConnect         = "connect"
 	MockMethodDisconnected    = "disconnected"
@@ -38,12 +42,19 @@ type MockApp interface {
 	ExpectConnDisconn(connId wsgw.ConnectionID)
 	GetCalls(connId wsgw.ConnectionID) []mock.Call
 	OnDisconnect(connectionId wsgw.ConnectionID) chan struct{}
+	// RequireSignatures makes the mock app reject requests not signed with one of the keys.
+	// It must be called before Start.
+	RequireSignatures(verifier *signing.Verifier)
+	// MessageTraceParents returns the traceparent headers of the message requests of the connection
+	MessageTraceParents(connId wsgw.ConnectionID) []string
 }
 
 type MessageJSON map[string]string
 
 type MyMock struct {
 	disconnectNotification chan struct{}
+	// traceParents are guarded by connMocksMux
+	traceParents []string
 	mock.Mock
 }
 
@@ -74,6 +85,7 @@ type mockApplication struct {
 	logger       zerolog.Logger
 	connMocks    map[string]*MyMock
 	connMocksMux sync.Mutex
+	verifier     *signing.Verifier
 }
 
 func NewMockApp(getwsgwUrl func() string) MockApp {
@@ -121,6 +133,16 @@ func (m *mockApplication) Stop(ctx context.Context) {
 func (m *mockApplication) createMockAppRequestHandler() (http.Handler, error) {
 	rootEngine := gin.Default()
 	rootEngine.Use(wsgw.RequestLogger("mockApplication"))
+	if m.verifier != nil {
+		rootEngine.Use(func(g *gin.Context) {
+			if verifyErr := m.verifier.Verify(g.Request); verifyErr != nil {
+				zerolog.Ctx(g.Request.Context()).Info().Err(verifyErr).Msg("signature verification failed")
+				g.AbortWithStatus(http.StatusUnauthorized)
+				return
+			}
+			g.Next()
+		})
+	}
 
 	ws := rootEngine.Group("/ws")
 
@@ -138,6 +160,9 @@ func (m *mockApplication) createMockAppRequestHandler() (http.Handler, error) {
 			_ = res.AbortWithError(401, errors.New("bad credentials in Authorization header"))
 			return
 		}
+		if attributes := req.Header.Get(ConnectionAttributesHeader); attributes != "" {
+			res.Header(wsgw.ConnectionAttributesHeaderKey, attributes)
+		}
 
 		connHeaderKey := wsgw.ConnectionIDHeaderKey
 		if connId := req.Header.Get(connHeaderKey); connId != "" {
@@ -181,6 +206,11 @@ func (m *mockApplication) createMockAppRequestHandler() (http.Handler, error) {
 		req := g.Request
 		res := g
 
+		if req.Header.Get(wsgw.BatchHeaderKey) != "" {
+			m.receiveMessageBatch(g)
+			return
+		}
+
 		connHeaderKey := wsgw.ConnectionIDHeaderKey
 		if connId := req.Header.Get(connHeaderKey); connId != "" {
 			bodyAsBytes, readBodyErr := io.ReadAll(req.Body)
@@ -192,6 +222,9 @@ func (m *mockApplication) createMockAppRequestHandler() (http.Handler, error) {
 
 			m.connMocksMux.Lock()
 			mockConn, ok := m.connMocks[connId]
+			if ok {
+				mockConn.traceParents = append(mockConn.traceParents, req.Header.Get("traceparent"))
+			}
 			m.connMocksMux.Unlock()
 			if !ok {
 				logger.Error().Str(wsgw.ConnectionIDKey, connId).Msg("connection not mocked")
@@ -205,6 +238,41 @@ func (m *mockApplication) createMockAppRequestHandler() (http.Handler, error) {
 	return rootEngine, nil
 }
 
+// receiveMessageBatch handles a batch of client messages in the JSON array format, reporting
+// a per-item 200 for the messages of the mocked connections and a 500 for the others
+func (m *mockApplication) receiveMessageBatch(g *gin.Context) {
+	logger := zerolog.Ctx(g.Request.Context()).With().Logger()
+
+	var items []struct {
+		ConnectionID string `json:"connectionId"`
+		Message      string `json:"message"`
+	}
+	if decodeErr := json.NewDecoder(g.Request.Body).Decode(&items); decodeErr != nil {
+		logger.Error().Err(decodeErr).Msg("failed to decode message batch")
+		g.Status(http.StatusBadRequest)
+		return
+	}
+
+	results := make([]map[string]any, len(items))
+	for i, item := range items {
+		m.connMocksMux.Lock()
+		mockConn, ok := m.connMocks[item.ConnectionID]
+		m.connMocksMux.Unlock()
+		if !ok {
+			logger.Error().Str(wsgw.ConnectionIDKey, item.ConnectionID).Msg("connection not mocked")
+			results[i] = map[string]any{"status": http.StatusInternalServerError, "error": "connection not mocked"}
+			continue
+		}
+		mockConn.messageReceived(parseMessageJSON([]byte(item.Message)))
+		results[i] = map[string]any{"status": http.StatusOK}
+	}
+	g.JSON(http.StatusOK, results)
+}
+
+func (m *mockApplication) RequireSignatures(verifier *signing.Verifier) {
+	m.verifier = verifier
+}
+
 func (m *mockApplication) OnDisconnect(connId wsgw.ConnectionID) chan struct{} {
 	m.connMocksMux.Lock()
 	mockConn := m.connMocks[string(connId)]
@@ -235,6 +303,15 @@ func (m *mockApplication) GetCalls(connId wsgw.ConnectionID) []mock.Call {
 	return m.connMocks[string(connId)].Calls
 }
 
+func (m *mockApplication) MessageTraceParents(connId wsgw.ConnectionID) []string {
+	m.connMocksMux.Lock()
+	defer m.connMocksMux.Unlock()
+	if mockConn, ok := m.connMocks[string(connId)]; ok {
+		return append([]string(nil), mockConn.traceParents...)
+	}
+	return nil
+}
+
 func (s *mockApplication) SendToClient(ctx context.Context, connId wsgw.ConnectionID, message MessageJSON) error {
 	return s.SendToClientVia(ctx, s.getwsgwUrl(), connId, message)
 }
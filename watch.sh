@@ -30,9 +30,9 @@ trap cleanup EXIT
 
 build_and_run() {
   if task build; then
-    "./cmd/${WSGW_EXEC_NAME}" >"$WSGW_LOG_FILE" 2>"$WSGW_LOG_FILE" &
+    "./cmd/${WATCH_EXEC_NAME}" >"$WATCH_LOG_FILE" 2>"$WATCH_LOG_FILE" &
     app_pid=$!
-    tail -f "${WSGW_LOG_FILE}" &
+    tail -f "${WATCH_LOG_FILE}" &
     tail_pid=$!
   fi
 }